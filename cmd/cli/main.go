@@ -1,20 +1,33 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"watermark-tool/internal/service"
+	"watermark-tool/internal/watermark"
+	_ "watermark-tool/internal/watermark/bmp"
 	_ "watermark-tool/internal/watermark/docx"
+	_ "watermark-tool/internal/watermark/gif"
 	_ "watermark-tool/internal/watermark/jpg"
+	"watermark-tool/internal/watermark/keys"
 	_ "watermark-tool/internal/watermark/odt"
+	"watermark-tool/internal/watermark/overlay"
 	_ "watermark-tool/internal/watermark/pdf"
 	_ "watermark-tool/internal/watermark/png"
 	_ "watermark-tool/internal/watermark/pptx"
 	_ "watermark-tool/internal/watermark/rtf"
+	_ "watermark-tool/internal/watermark/svg"
+	_ "watermark-tool/internal/watermark/tiff"
 	_ "watermark-tool/internal/watermark/xlsx"
 )
 
@@ -30,7 +43,20 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
 		},
+		// 加载水印密钥，命令行参数优先于环境变量
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			provider, err := loadKeyProvider(cmd)
+			if err != nil {
+				return fmt.Errorf("加载水印密钥失败: %w", err)
+			}
+			if provider != nil {
+				watermark.SetKeyProvider(provider)
+			}
+			return nil
+		},
 	}
+	rootCmd.PersistentFlags().String("keyring", "", "密钥环文件路径（默认读取环境变量 "+keys.EnvKeyring+"）")
+	rootCmd.PersistentFlags().String("kms", "", "本地KMS密钥文件路径（默认读取环境变量 "+keys.EnvKMS+"）")
 
 	// 添加水印命令
 	addCmd := &cobra.Command{
@@ -43,8 +69,66 @@ func main() {
 			outputFile := args[1]
 			watermarkText := args[2]
 
+			// 构建水印载荷
+			payload := watermark.NewPayload(watermarkText)
+			payload.RecipientID, _ = cmd.Flags().GetString("recipient")
+			payload.DocumentID, _ = cmd.Flags().GetString("document-id")
+			payload.Issuer, _ = cmd.Flags().GetString("issuer")
+			payload.Rights, _ = cmd.Flags().GetString("rights")
+			fields, _ := cmd.Flags().GetStringArray("field")
+			for _, field := range fields {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok {
+					fmt.Printf("无效的自定义字段 %q，格式应为 key=value\n", field)
+					os.Exit(1)
+				}
+				if payload.Fields == nil {
+					payload.Fields = make(map[string]string)
+				}
+				payload.Fields[key] = value
+			}
+
+			// 文档已有水印时的处理方式
+			policyName, _ := cmd.Flags().GetString("policy")
+			policy, err := service.ParsePolicy(policyName)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// 嵌入方式，为空时使用优先级最高的方式
+			method, _ := cmd.Flags().GetString("method")
+
+			// 可见水印参数，未指定 --visible 和 --logo 时为nil
+			visible, err := overlayOptions(cmd, watermarkText)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// 打开加密文档的密码
+			password, _ := cmd.Flags().GetString("password")
+
 			fmt.Printf("正在为文件 %s 添加水印...\n", inputFile)
-			err := watermarkService.AddWatermark(inputFile, outputFile, watermarkText)
+			warnTypeMismatch(watermarkService, inputFile)
+			err = watermarkService.WithPolicy(policy).WithMethod(method).WithOverlay(visible).WithPassword(password).AddWatermarkPayload(context.Background(), inputFile, outputFile, payload)
+			if errors.Is(err, service.ErrAlreadyWatermarked) {
+				fmt.Println("文件已有水印，可以使用 --policy replace 替换或 --policy append 追加")
+				os.Exit(1)
+			}
+			if errors.Is(err, watermark.ErrUnknownMethod) {
+				fmt.Printf("%v，可以使用 types 命令查看支持的嵌入方式\n", err)
+				os.Exit(1)
+			}
+			if errors.Is(err, watermark.ErrOverlayUnsupported) {
+				fmt.Printf("%v，可以使用 types 命令查看支持可见水印的嵌入方式\n", err)
+				os.Exit(1)
+			}
+			if errors.Is(err, overlay.ErrUnsupportedText) {
+				fmt.Println("可见水印只支持ASCII字符，请使用 --visible-text 指定可见水印的文本")
+				os.Exit(1)
+			}
+			exitOnPasswordError(err)
 			if err != nil {
 				fmt.Printf("添加水印失败: %v\n", err)
 				os.Exit(1)
@@ -62,58 +146,374 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			inputFile := args[0]
 			showTimestamp, _ := cmd.Flags().GetBool("timestamp")
+			outputJSON, _ := cmd.Flags().GetBool("json")
+			password, _ := cmd.Flags().GetString("password")
 
-			fmt.Printf("正在从文件 %s 中提取水印...\n", inputFile)
+			if !outputJSON {
+				fmt.Printf("正在从文件 %s 中提取水印...\n", inputFile)
+			}
+			warnTypeMismatch(watermarkService, inputFile)
 
-			if showTimestamp {
-				watermarkText, timestamp, err := watermarkService.ExtractWatermarkWithTimestamp(inputFile)
+			payload, err := watermarkService.WithPassword(password).ExtractPayload(context.Background(), inputFile)
+			exitOnPasswordError(err)
+			if err != nil {
+				fmt.Printf("提取水印失败: %v\n", err)
+				os.Exit(1)
+			}
+
+			// 以JSON格式输出完整载荷和签名校验结果，便于脚本处理
+			if outputJSON {
+				data, err := json.MarshalIndent(struct {
+					*watermark.Payload
+					Verification *watermark.Verification `json:"verification"`
+				}{payload, payload.Verification}, "", "  ")
 				if err != nil {
-					fmt.Printf("提取水印失败: %v\n", err)
+					fmt.Printf("序列化水印失败: %v\n", err)
 					os.Exit(1)
 				}
+				fmt.Println(string(data))
+				if payload.Verification.Forged() {
+					os.Exit(2)
+				}
+				return
+			}
 
-				// 转换时间戳格式
-				var formattedTimestamp string
-				if unixTimestamp, err := parseTimestamp(timestamp); err == nil {
-					formattedTimestamp = unixTimestamp.Format("2006-01-02 15:04:05")
+			fmt.Printf("提取的水印文本: %s\n", payload.Text)
+			if payload.RecipientID != "" {
+				fmt.Printf("接收者: %s\n", payload.RecipientID)
+			}
+			if payload.DocumentID != "" {
+				fmt.Printf("文档ID: %s\n", payload.DocumentID)
+			}
+			if payload.Issuer != "" {
+				fmt.Printf("签发方: %s\n", payload.Issuer)
+			}
+			if payload.Rights != "" {
+				fmt.Printf("版权声明: %s\n", payload.Rights)
+			}
+			fieldNames := make([]string, 0, len(payload.Fields))
+			for name := range payload.Fields {
+				fieldNames = append(fieldNames, name)
+			}
+			sort.Strings(fieldNames)
+			for _, name := range fieldNames {
+				fmt.Printf("%s: %s\n", name, payload.Fields[name])
+			}
+			if showTimestamp {
+				if payload.IssuedAt.IsZero() {
+					fmt.Println("水印添加时间: 未知")
 				} else {
-					formattedTimestamp = timestamp
+					fmt.Printf("水印添加时间: %s\n", payload.IssuedAt.Local().Format("2006-01-02 15:04:05"))
 				}
+			}
+			fmt.Printf("签名验证: %s\n", payload.Verification)
+
+			// 按添加顺序输出之前的水印
+			if len(payload.History) > 0 {
+				fmt.Println("历史水印:")
+				for i, entry := range payload.History {
+					fmt.Printf("  %d. %s", i+1, entry.Text)
+					if entry.RecipientID != "" {
+						fmt.Printf("（接收者: %s）", entry.RecipientID)
+					}
+					if !entry.IssuedAt.IsZero() {
+						fmt.Printf(" %s", entry.IssuedAt.Local().Format("2006-01-02 15:04:05"))
+					}
+					fmt.Println()
+				}
+			}
 
-				fmt.Printf("提取的水印文本: %s\n", watermarkText)
-				fmt.Printf("水印添加时间: %s\n", formattedTimestamp)
-			} else {
-				watermarkText, err := watermarkService.ExtractWatermark(inputFile)
+			// 签名无效时以非零状态退出，便于脚本判断
+			if payload.Verification.Forged() {
+				os.Exit(2)
+			}
+		},
+	}
+
+	// 检测水印命令
+	detectCmd := &cobra.Command{
+		Use:   "detect [input_file...]",
+		Short: "检测文档中是否有水印",
+		Long:  "检测一个或多个文档中是否有水印，报告水印位置、是否能解密和校验以及置信度，没有水印的文件不会导致命令失败",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			outputJSON, _ := cmd.Flags().GetBool("json")
+			password, _ := cmd.Flags().GetString("password")
+			detector := watermarkService.WithPassword(password)
+
+			failed := false
+			for _, inputFile := range args {
+				warnTypeMismatch(watermarkService, inputFile)
+				detection, err := detector.DetectWatermark(context.Background(), inputFile)
 				if err != nil {
-					fmt.Printf("提取水印失败: %v\n", err)
-					os.Exit(1)
+					fmt.Fprintf(os.Stderr, "%s: 检测失败: %v\n", inputFile, err)
+					failed = true
+					continue
 				}
-				fmt.Printf("提取的水印文本: %s\n", watermarkText)
+
+				// 每个文件输出一行JSON，便于脚本处理
+				if outputJSON {
+					data, err := json.Marshal(struct {
+						File string `json:"file"`
+						*watermark.Detection
+					}{inputFile, detection})
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "%s: 序列化检测结果失败: %v\n", inputFile, err)
+						failed = true
+						continue
+					}
+					fmt.Println(string(data))
+					continue
+				}
+
+				switch {
+				case !detection.Present:
+					fmt.Printf("%s: 没有水印\n", inputFile)
+				case !detection.Decrypted:
+					fmt.Printf("%s: 有水印但无法读取（置信度 %.2f）: %s\n", inputFile, detection.Confidence, detection.Error)
+				default:
+					fmt.Printf("%s: %s，签名验证: %s（置信度 %.2f）\n", inputFile, detection.Payload.Text, detection.Verification, detection.Confidence)
+				}
+				if len(detection.Locations) > 0 {
+					fmt.Printf("  位置: %s\n", strings.Join(detection.Locations, ", "))
+				}
+			}
+
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	detectCmd.Flags().Bool("json", false, "每个文件输出一行JSON格式的检测结果")
+	detectCmd.Flags().String("password", "", "打开加密文档的用户密码或所有者密码，所有文件使用相同的密码")
+
+	// 移除水印命令
+	stripCmd := &cobra.Command{
+		Use:   "strip [input_file] [output_file]",
+		Short: "移除文档中的水印",
+		Long:  "移除指定文档中的所有水印，用于将文档重新签发给其他接收者",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			inputFile := args[0]
+			outputFile := args[1]
+			password, _ := cmd.Flags().GetString("password")
+
+			fmt.Printf("正在移除文件 %s 中的水印...\n", inputFile)
+			warnTypeMismatch(watermarkService, inputFile)
+
+			err := watermarkService.WithPassword(password).RemoveWatermarkContext(context.Background(), inputFile, outputFile)
+			if errors.Is(err, watermark.ErrNoWatermark) {
+				fmt.Println("文件中没有水印")
+				os.Exit(1)
+			}
+			exitOnPasswordError(err)
+			if err != nil {
+				fmt.Printf("移除水印失败: %v\n", err)
+				os.Exit(1)
 			}
+
+			fmt.Printf("成功移除水印并保存到 %s\n", outputFile)
 		},
 	}
 
+	// 添加载荷字段选项
+	addCmd.Flags().String("recipient", "", "文档接收者或用户ID")
+	addCmd.Flags().String("document-id", "", "文档ID")
+	addCmd.Flags().String("issuer", "", "水印签发方")
+	addCmd.Flags().String("rights", "", "版权声明，以明文写入XMP的dc:rights")
+	addCmd.Flags().StringArray("field", nil, "自定义字段，格式为 key=value，可重复指定")
+	addCmd.Flags().String("policy", "replace", "文档已有水印时的处理方式: replace 替换、append 追加到历史记录、refuse 拒绝")
+	addCmd.Flags().String("method", "", "水印嵌入方式，默认使用优先级最高的方式，可用的方式见 types 命令")
+	defaults := overlay.DefaultOptions()
+	addCmd.Flags().Bool("visible", false, "同时在图片、SVG或PDF页面上绘制可见水印")
+	addCmd.Flags().String("visible-text", "", "可见水印的文本，默认与水印文本相同，只支持ASCII字符；指定后自动启用 --visible")
+	addCmd.Flags().String("visible-layout", string(overlay.LayoutTile), "可见水印的排列方式: tile（平铺）、diagonal（对角线）、header（页眉）或 footer（页脚）")
+	addCmd.Flags().Float64("opacity", defaults.Opacity, "可见水印的不透明度，范围为0到1")
+	addCmd.Flags().Float64("angle", defaults.Angle, "可见水印的旋转角度，正数为顺时针")
+	addCmd.Flags().Float64("font-size", defaults.FontSize, "可见水印的字号（像素），0表示按图片尺寸自动确定")
+	addCmd.Flags().String("color", "#808080", "可见水印的颜色，格式为 #RRGGBB")
+	addCmd.Flags().Float64("spacing", defaults.Spacing, "相邻可见水印之间的间距（像素），0表示使用字号的2倍")
+	addCmd.Flags().String("logo", "", "叠加到图片上的PNG标志图片，透明部分按alpha通道合成")
+	addCmd.Flags().String("logo-anchor", string(overlay.AnchorBottomRight), "标志的位置: top-left、top-right、bottom-left、bottom-right、center 或 tile（平铺）")
+	addCmd.Flags().Float64("logo-scale", 0.2, "标志相对于图片宽和高的最大比例，范围为0到1")
+	addCmd.Flags().Float64("logo-opacity", 0.5, "标志的不透明度，范围为0到1")
+	addCmd.Flags().String("password", "", "打开加密PDF的用户密码或所有者密码，添加水印后文件的密码和权限不变")
+	stripCmd.Flags().String("password", "", "打开加密PDF的用户密码或所有者密码")
+
 	// 添加时间戳选项
 	extractCmd.Flags().BoolP("timestamp", "t", false, "显示水印添加时间")
+	extractCmd.Flags().Bool("json", false, "以JSON格式输出完整的水印载荷")
+	extractCmd.Flags().String("password", "", "打开加密PDF的用户密码或所有者密码")
 
 	// 列出支持的文件类型命令
 	listTypesCmd := &cobra.Command{
 		Use:   "types",
 		Short: "列出支持的文件类型",
-		Long:  "列出工具支持的所有文件类型",
+		Long:  "列出工具支持的所有文件类型，以及每种类型的嵌入方式，按优先级从高到低排列",
 		Run: func(cmd *cobra.Command, args []string) {
 			types := watermarkService.GetSupportedTypes()
 			fmt.Println("支持的文件类型:")
 			for _, t := range types {
 				fmt.Printf("- .%s\n", t)
+				for _, strategy := range watermarkService.GetStrategies(t) {
+					fmt.Printf("    %s (优先级 %d)%s\n", strategy.Method, strategy.Priority, describeCapabilities(strategy.Capabilities))
+				}
+			}
+		},
+	}
+
+	// 密钥管理命令
+	keysCmd := &cobra.Command{
+		Use:   "keys",
+		Short: "管理水印密钥",
+	}
+
+	// 生成密钥命令
+	generateKeyCmd := &cobra.Command{
+		Use:   "generate [key_id]",
+		Short: "生成一个随机密钥",
+		Long: "生成一个随机的加密密钥和独立的Ed25519签名私钥，输出格式为 key_id:密钥:签名私钥，可以直接用于环境变量 " + keys.EnvKeys +
+			"；写入密钥环文件时分别放在 keys 和 signing_keys 中",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			key, err := keys.GenerateKey()
+			if err != nil {
+				fmt.Printf("生成密钥失败: %v\n", err)
+				os.Exit(1)
+			}
+			signingKey, err := keys.GenerateSigningKey()
+			if err != nil {
+				fmt.Printf("生成签名密钥失败: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s:%s:%s\n", args[0], base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(signingKey))
+		},
+	}
+
+	// 轮换本地KMS主密钥命令
+	rotateKeyCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "轮换本地KMS的主密钥",
+		Long:  "生成新的主密钥并设为当前密钥，旧的主密钥保留用于读取已有文件",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			path := kmsPath(cmd)
+			if path == "" {
+				fmt.Printf("请使用 --kms 参数或环境变量 %s 指定本地KMS密钥文件\n", keys.EnvKMS)
+				os.Exit(1)
+			}
+
+			kms, err := keys.OpenLocalKMS(path)
+			if err != nil {
+				fmt.Printf("打开本地KMS失败: %v\n", err)
+				os.Exit(1)
+			}
+			keyID, err := kms.RotateKey()
+			if err != nil {
+				fmt.Printf("轮换密钥失败: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("当前密钥: %s\n", keyID)
+		},
+	}
+
+	// 导出签名公钥命令
+	publicKeyCmd := &cobra.Command{
+		Use:   "public [key_id]",
+		Short: "输出用于验证水印签名的公钥",
+		Long: "输出指定密钥的Ed25519签名公钥（Base64编码），未指定时使用当前密钥。" +
+			"公钥可以公开给需要独立验证水印来源的第三方，通过 verify --public-key 校验签名，公钥不能读取或伪造水印",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			provider := watermark.GetKeyProvider()
+			keyID := provider.ActiveKeyID()
+			if len(args) > 0 {
+				keyID = args[0]
+			}
+
+			// 没有独立签名密钥时水印只有MAC，公钥无法用于校验
+			if !provider.HasSigningKey(keyID) {
+				fmt.Printf("密钥 %s 没有独立的签名密钥，无法导出公钥，请使用 keys generate 生成新密钥或轮换本地KMS的主密钥\n", keyID)
+				os.Exit(1)
+			}
+
+			publicKey, err := provider.PublicKey(keyID)
+			if err != nil {
+				fmt.Printf("获取公钥失败: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s:%s\n", keyID, base64.StdEncoding.EncodeToString(publicKey))
+		},
+	}
+	// 使用公钥校验水印命令
+	verifyCmd := &cobra.Command{
+		Use:   "verify [input_file...]",
+		Short: "只使用签名公钥校验水印的来源",
+		Long: "使用 keys public 导出的公钥校验一个或多个文档中水印的签名，不需要加密密钥，也无法读取水印内容。" +
+			"只能校验以文本形式嵌入的水印，像素和频域水印的嵌入位置由加密密钥决定，只有公钥时无法找到；" +
+			"所有文件的水印都由指定的公钥签发时以零状态退出",
+		Args: cobra.MinimumNArgs(1),
+		// 不加载加密密钥，只使用命令行指定的公钥
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			specs, _ := cmd.Flags().GetStringArray("public-key")
+			publicKeys, err := parsePublicKeys(specs)
+			if err != nil {
+				return err
+			}
+			verifier, err := keys.NewPublicKeyring(publicKeys)
+			if err != nil {
+				return err
+			}
+			watermark.SetKeyProvider(verifier)
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			password, _ := cmd.Flags().GetString("password")
+			detector := watermarkService.WithPassword(password)
+
+			failed := false
+			for _, inputFile := range args {
+				detection, err := detector.DetectWatermark(context.Background(), inputFile)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: 检测失败: %v\n", inputFile, err)
+					failed = true
+					continue
+				}
+
+				switch {
+				case !detection.Present:
+					fmt.Printf("%s: 没有找到水印\n", inputFile)
+				case detection.Verification == nil:
+					fmt.Printf("%s: 有水印但无法校验: %s\n", inputFile, detection.Error)
+				default:
+					fmt.Printf("%s: %s\n", inputFile, detection.Verification)
+				}
+				if detection.Verification == nil || !detection.Verification.Authentic() {
+					failed = true
+				}
+			}
+
+			if failed {
+				os.Exit(1)
 			}
 		},
 	}
+	verifyCmd.Flags().StringArray("public-key", nil, "签名公钥，格式为 key_id:公钥，即 keys public 的输出，可重复指定")
+	verifyCmd.Flags().String("password", "", "打开加密PDF的用户密码或所有者密码")
+	verifyCmd.MarkFlagRequired("public-key")
+
+	keysCmd.AddCommand(generateKeyCmd)
+	keysCmd.AddCommand(rotateKeyCmd)
+	keysCmd.AddCommand(publicKeyCmd)
 
 	// 将命令添加到根命令
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(extractCmd)
+	rootCmd.AddCommand(stripCmd)
+	rootCmd.AddCommand(detectCmd)
+	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(listTypesCmd)
+	rootCmd.AddCommand(keysCmd)
 
 	// 执行命令
 	if err := rootCmd.Execute(); err != nil {
@@ -122,25 +522,154 @@ func main() {
 	}
 }
 
-// parseTimestamp 尝试将时间戳字符串解析为时间
-func parseTimestamp(timestamp string) (time.Time, error) {
-	// 尝试解析为 Unix 时间戳（秒）
-	if unixTime, err := parseSingleValue(timestamp); err == nil {
-		return time.Unix(unixTime, 0), nil
+// kmsPath 返回本地KMS密钥文件路径
+func kmsPath(cmd *cobra.Command) string {
+	if path, _ := cmd.Flags().GetString("kms"); path != "" {
+		return path
+	}
+	return os.Getenv(keys.EnvKMS)
+}
+
+// loadKeyProvider 根据命令行参数或环境变量加载密钥提供者，都未配置时返回nil
+func loadKeyProvider(cmd *cobra.Command) (keys.KeyProvider, error) {
+	if path, _ := cmd.Flags().GetString("kms"); path != "" {
+		return keys.OpenLocalKMS(path)
+	}
+	if path, _ := cmd.Flags().GetString("keyring"); path != "" {
+		return keys.LoadKeyringFile(path)
+	}
+	return keys.FromEnvironment()
+}
+
+// parsePublicKeys 解析 key_id:公钥 格式的签名公钥
+func parsePublicKeys(specs []string) (map[string]ed25519.PublicKey, error) {
+	publicKeys := make(map[string]ed25519.PublicKey, len(specs))
+	for _, spec := range specs {
+		keyID, encoded, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		if !ok {
+			return nil, fmt.Errorf("公钥格式应为 key_id:公钥: %s", spec)
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("公钥 %s 不是有效的Base64编码: %w", keyID, err)
+		}
+		publicKeys[keyID] = publicKey
+	}
+	return publicKeys, nil
+}
+
+// warnTypeMismatch 扩展名与文件内容不一致时输出提示，文件按内容识别的类型处理
+// 无法打开或识别的文件不提示，由之后的命令报告错误
+func warnTypeMismatch(s *service.WatermarkService, inputFile string) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	typeInfo, err := s.DetectFileType(file, info.Size(), inputFile)
+	if err == nil && typeInfo.Mismatch() {
+		fmt.Fprintf(os.Stderr, "%s: 文件扩展名为 %s，但实际内容为 %s 文件，已按 %s 处理\n", inputFile, typeInfo.Claimed, typeInfo.Detected, typeInfo.Detected)
+	}
+}
+
+// exitOnPasswordError 文档已加密但没有提供密码或密码错误时输出提示并退出
+func exitOnPasswordError(err error) {
+	if errors.Is(err, watermark.ErrPasswordRequired) {
+		fmt.Println("文档已加密，请使用 --password 提供用户密码或所有者密码")
+		os.Exit(1)
+	}
+	if errors.Is(err, watermark.ErrInvalidPassword) {
+		fmt.Println("文档密码不正确，请检查 --password 指定的密码")
+		os.Exit(1)
+	}
+}
+
+// overlayOptions 读取可见水印参数，未启用可见水印也未指定标志时返回nil
+// 启用可见水印但没有指定 --visible-text 时使用水印文本
+func overlayOptions(cmd *cobra.Command, watermarkText string) (*overlay.Options, error) {
+	enabled, _ := cmd.Flags().GetBool("visible")
+	text, _ := cmd.Flags().GetString("visible-text")
+	logoPath, _ := cmd.Flags().GetString("logo")
+	if !enabled && text == "" && logoPath == "" {
+		return nil, nil
 	}
 
-	// 尝试解析为 RFC3339 格式
-	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
-		return t, nil
+	opts := overlay.DefaultOptions()
+	opts.Text = text
+	if enabled && text == "" {
+		opts.Text = watermarkText
+	}
+	if logoPath != "" {
+		logo, err := readLogo(cmd, logoPath)
+		if err != nil {
+			return nil, err
+		}
+		opts.Logo = logo
+	}
+	opts.Opacity, _ = cmd.Flags().GetFloat64("opacity")
+	opts.Angle, _ = cmd.Flags().GetFloat64("angle")
+	opts.FontSize, _ = cmd.Flags().GetFloat64("font-size")
+	opts.Spacing, _ = cmd.Flags().GetFloat64("spacing")
+	layoutName, _ := cmd.Flags().GetString("visible-layout")
+	layout, err := overlay.ParseLayout(layoutName)
+	if err != nil {
+		return nil, err
 	}
+	opts.Layout = layout
+	colorName, _ := cmd.Flags().GetString("color")
+	color, err := overlay.ParseColor(colorName)
+	if err != nil {
+		return nil, err
+	}
+	opts.Color = color
+	return &opts, nil
+}
 
-	// 无法解析
-	return time.Time{}, fmt.Errorf("无法解析时间戳: %s", timestamp)
+// readLogo 读取标志图片和 --logo-anchor、--logo-scale、--logo-opacity 参数
+func readLogo(cmd *cobra.Command, path string) (*overlay.Logo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开标志图片失败: %w", err)
+	}
+	defer file.Close()
+	logo, err := overlay.DecodeLogo(file)
+	if err != nil {
+		return nil, err
+	}
+
+	anchorName, _ := cmd.Flags().GetString("logo-anchor")
+	if logo.Anchor, err = overlay.ParseAnchor(anchorName); err != nil {
+		return nil, err
+	}
+	logo.Scale, _ = cmd.Flags().GetFloat64("logo-scale")
+	logo.Opacity, _ = cmd.Flags().GetFloat64("logo-opacity")
+	return logo, nil
 }
 
-// parseSingleValue 尝试将字符串解析为整数
-func parseSingleValue(value string) (int64, error) {
-	var result int64
-	_, err := fmt.Sscanf(value, "%d", &result)
-	return result, err
+// describeCapabilities 返回嵌入方式能力的简短说明
+func describeCapabilities(capabilities watermark.Capabilities) string {
+	var notes []string
+	if capabilities.Description != "" {
+		notes = append(notes, capabilities.Description)
+	}
+	if capabilities.Lossless {
+		notes = append(notes, "无损")
+	}
+	if capabilities.Robust {
+		notes = append(notes, "抗转换")
+	}
+	if capabilities.Locate {
+		notes = append(notes, "可定位")
+	}
+	if capabilities.Visible {
+		notes = append(notes, "可见水印")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(notes, "，")
 }
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -15,13 +20,20 @@ import (
 	"github.com/google/uuid"
 
 	"watermark-tool/internal/service"
+	"watermark-tool/internal/watermark"
+	_ "watermark-tool/internal/watermark/bmp"
 	_ "watermark-tool/internal/watermark/docx"
+	_ "watermark-tool/internal/watermark/gif"
 	_ "watermark-tool/internal/watermark/jpg"
+	"watermark-tool/internal/watermark/keys"
 	_ "watermark-tool/internal/watermark/odt"
+	"watermark-tool/internal/watermark/overlay"
 	_ "watermark-tool/internal/watermark/pdf"
 	_ "watermark-tool/internal/watermark/png"
 	_ "watermark-tool/internal/watermark/pptx"
 	_ "watermark-tool/internal/watermark/rtf"
+	_ "watermark-tool/internal/watermark/svg"
+	_ "watermark-tool/internal/watermark/tiff"
 	_ "watermark-tool/internal/watermark/xlsx"
 )
 
@@ -31,6 +43,9 @@ const (
 	CleanupInterval      = 1 * time.Hour
 )
 
+// 单个请求的最长处理时间
+const processTimeout = 30 * time.Second
+
 // ClientRequests 存储客户端请求频率
 type ClientRequests struct {
 	Count     int
@@ -104,24 +119,20 @@ func generateUniqueFilename(originalFilename string) string {
 	return uuid.New().String() + ext
 }
 
-// 安全地移除临时文件
-func safeRemoveFile(filePath string) {
-	if _, err := os.Stat(filePath); err == nil {
-		os.Remove(filePath)
+func main() {
+	// 从环境变量加载水印密钥
+	provider, err := keys.FromEnvironment()
+	if err != nil {
+		log.Fatalf("加载水印密钥失败: %v", err)
+	}
+	if provider != nil {
+		watermark.SetKeyProvider(provider)
+		log.Printf("水印密钥已加载，当前密钥: %s", provider.ActiveKeyID())
 	}
-}
 
-func main() {
 	// 创建水印服务
 	watermarkService := service.NewWatermarkService()
 
-	// 创建临时目录用于存储上传和处理的文件
-	tempDir, err := os.MkdirTemp("", "watermark-uploads-*")
-	if err != nil {
-		log.Fatalf("创建临时目录失败: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
 	// 设置为发布模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -137,7 +148,7 @@ func main() {
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST"},
 		AllowHeaders:     []string{"Origin", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Disposition"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "X-Detected-Type", "X-Claimed-Type"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -168,12 +179,6 @@ func main() {
 				return
 			}
 
-			// 检查文件类型
-			if err := watermarkService.ValidateMimeType(file.Filename); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型，请上传PDF、DOCX、XLSX、PPTX、ODT、RTF、JPG或PNG文件"})
-				return
-			}
-
 			// 检查文件大小
 			if file.Size > service.MaxFileSize {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小超过限制"})
@@ -187,56 +192,104 @@ func main() {
 				return
 			}
 
-			// 检查水印文本长度
-			if len(watermarkText) > 100 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "水印文本过长，请控制在100个字符以内"})
+			// 构建水印载荷
+			payload := watermark.NewPayload(watermarkText)
+			payload.RecipientID = c.PostForm("recipient_id")
+			payload.DocumentID = c.PostForm("document_id")
+			payload.Issuer = c.PostForm("issuer")
+			payload.Rights = c.PostForm("rights")
+			if fields := c.PostForm("fields"); fields != "" {
+				if err := json.Unmarshal([]byte(fields), &payload.Fields); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "自定义字段格式错误，应为JSON对象"})
+					return
+				}
+			}
+
+			// 检查水印文本长度和其他字段
+			if err := payload.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
 
-			// 生成唯一的文件名前缀
-			inputFilename := generateUniqueFilename(file.Filename)
-			outputFilename := "watermarked_" + inputFilename
+			// 文档已有水印时的处理方式，默认替换
+			policy, err := service.ParsePolicy(c.PostForm("policy"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// 嵌入方式，为空时使用优先级最高的方式
+			method := c.PostForm("method")
 
-			// 保存上传的文件
-			inputPath := filepath.Join(tempDir, inputFilename)
-			if err := c.SaveUploadedFile(file, inputPath); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "保存上传文件失败"})
+			// 可见水印参数，未启用也没有上传标志时为nil
+			visible, err := overlayFromForm(c, watermarkText)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			defer safeRemoveFile(inputPath) // 确保处理完后删除临时文件
-
-			// 生成输出文件路径
-			outputPath := filepath.Join(tempDir, outputFilename)
-			defer safeRemoveFile(outputPath) // 确保处理完后删除临时文件
-
-			// 设置处理超时
-			processDone := make(chan error, 1)
-			go func() {
-				// 添加水印
-				err := watermarkService.AddWatermark(inputPath, outputPath, watermarkText)
-				processDone <- err
-			}()
-
-			// 等待处理完成或超时
-			select {
-			case err := <-processDone:
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("添加水印失败: %v", err)})
+
+			// 打开上传的文件，直接以流的方式处理，不再写入临时文件
+			input, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "读取上传文件失败"})
+				return
+			}
+			defer input.Close()
+
+			// 根据文件内容识别文件类型，不依赖扩展名
+			typeInfo, err := watermarkService.DetectFileType(input, file.Size, file.Filename)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型，请上传PDF、DOCX、XLSX、PPTX、ODT、RTF、JPG、PNG、GIF、TIFF、BMP或SVG文件"})
+				return
+			}
+			c.Header("X-Detected-Type", typeInfo.Detected)
+			if typeInfo.Mismatch() {
+				c.Header("X-Claimed-Type", typeInfo.Claimed)
+			}
+
+			// 设置处理超时，超时或客户端断开后处理会被中止
+			ctx, cancel := context.WithTimeout(c.Request.Context(), processTimeout)
+			defer cancel()
+
+			// 添加水印，加密的PDF使用password字段中的密码打开
+			var output bytes.Buffer
+			err = watermarkService.WithPolicy(policy).WithMethod(method).WithOverlay(visible).WithPassword(c.PostForm("password")).AddWatermarkStream(ctx, input, file.Size, &output, typeInfo.Detected, payload)
+			if err != nil {
+				if isPasswordError(err) {
+					c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 					return
 				}
-			case <-time.After(30 * time.Second):
-				c.JSON(http.StatusRequestTimeout, gin.H{"error": "处理超时，请尝试使用更小的文件"})
+				if errors.Is(err, watermark.ErrUnknownMethod) || errors.Is(err, watermark.ErrOverlayUnsupported) ||
+					errors.Is(err, overlay.ErrUnsupportedText) || errors.Is(err, overlay.ErrInvalidOptions) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if errors.Is(err, context.DeadlineExceeded) {
+					c.JSON(http.StatusRequestTimeout, gin.H{"error": "处理超时，请尝试使用更小的文件"})
+					return
+				}
+				if errors.Is(err, service.ErrAlreadyWatermarked) {
+					c.JSON(http.StatusConflict, gin.H{"error": "文件已有水印"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("添加水印失败: %v", err)})
 				return
 			}
 
 			// 设置Content-Disposition头以使浏览器下载文件
+			// 输出文件使用实际类型的扩展名
+			outputFilename := "watermarked_" + generateUniqueFilename("."+typeInfo.Detected)
 			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", outputFilename))
 			c.Header("Content-Description", "File Transfer")
 			c.Header("Content-Transfer-Encoding", "binary")
 			c.Header("Cache-Control", "no-cache")
 
 			// 返回带水印的文件
-			c.File(outputPath)
+			contentType := mime.TypeByExtension("." + typeInfo.Detected)
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			c.Data(http.StatusOK, contentType, output.Bytes())
 		})
 
 		// 提取水印API
@@ -248,12 +301,6 @@ func main() {
 				return
 			}
 
-			// 检查文件类型
-			if err := watermarkService.ValidateMimeType(file.Filename); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型，请上传PDF、DOCX、XLSX、PPTX、ODT、RTF、JPG或PNG文件"})
-				return
-			}
-
 			// 检查文件大小
 			if file.Size > service.MaxFileSize {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小超过限制"})
@@ -263,111 +310,209 @@ func main() {
 			// 是否显示时间戳
 			showTimestamp := c.DefaultQuery("show_timestamp", "false") == "true"
 
-			// 生成唯一的文件名
-			inputFilename := generateUniqueFilename(file.Filename)
-			inputPath := filepath.Join(tempDir, inputFilename)
+			// 打开上传的文件
+			input, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "读取上传文件失败"})
+				return
+			}
+			defer input.Close()
 
-			// 保存上传的文件
-			if err := c.SaveUploadedFile(file, inputPath); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "保存上传文件失败"})
+			// 根据文件内容识别文件类型，不依赖扩展名
+			typeInfo, err := watermarkService.DetectFileType(input, file.Size, file.Filename)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型，请上传PDF、DOCX、XLSX、PPTX、ODT、RTF、JPG、PNG、GIF、TIFF、BMP或SVG文件"})
 				return
 			}
-			defer safeRemoveFile(inputPath) // 确保处理完后删除临时文件
+			c.Header("X-Detected-Type", typeInfo.Detected)
+			if typeInfo.Mismatch() {
+				c.Header("X-Claimed-Type", typeInfo.Claimed)
+			}
 
-			// 设置处理超时
-			var watermarkText string
-			var timestamp string
-			processDone := make(chan error, 1)
+			// 设置处理超时，超时或客户端断开后处理会被中止
+			ctx, cancel := context.WithTimeout(c.Request.Context(), processTimeout)
+			defer cancel()
 
-			if showTimestamp {
-				go func() {
-					// 提取水印和时间戳
-					var err error
-					watermarkText, timestamp, err = watermarkService.ExtractWatermarkWithTimestamp(inputPath)
-					processDone <- err
-				}()
-			} else {
-				go func() {
-					// 只提取水印
-					var err error
-					watermarkText, err = watermarkService.ExtractWatermark(inputPath)
-					processDone <- err
-				}()
-			}
-
-			// 等待处理完成或超时
-			select {
-			case err := <-processDone:
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("提取水印失败: %v", err)})
+			// 提取水印和时间戳
+			payload, err := watermarkService.WithPassword(c.PostForm("password")).ExtractWatermarkStream(ctx, input, file.Size, typeInfo.Detected)
+			if err != nil {
+				if isPasswordError(err) {
+					c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+					return
+				}
+				if errors.Is(err, context.DeadlineExceeded) {
+					c.JSON(http.StatusRequestTimeout, gin.H{"error": "处理超时，请尝试使用更小的文件"})
+					return
+				}
+				if errors.Is(err, watermark.ErrForgedWatermark) {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{
+						"error":        watermark.ErrForgedWatermark.Error(),
+						"verification": watermark.Verification{Status: watermark.StatusForged},
+					})
 					return
 				}
-			case <-time.After(30 * time.Second):
-				c.JSON(http.StatusRequestTimeout, gin.H{"error": "处理超时，请尝试使用更小的文件"})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("提取水印失败: %v", err)})
 				return
 			}
 
-			// 返回提取的水印文本
+			// 返回提取的水印文本、完整载荷和签名校验结果
+			// 签名无效时仍然返回提取的内容，由调用方根据 verification 判断是否可信
+			response := gin.H{
+				"watermark":    payload.Text,
+				"payload":      payload,
+				"verification": payload.Verification,
+				"file_type":    typeInfo.Detected,
+			}
 			if showTimestamp {
-				// 格式化时间戳
-				formattedTimestamp := formatTimestamp(timestamp)
-				c.JSON(http.StatusOK, gin.H{
-					"watermark": watermarkText,
-					"timestamp": formattedTimestamp,
-				})
-			} else {
-				c.JSON(http.StatusOK, gin.H{"watermark": watermarkText})
+				response["timestamp"] = formatTimestamp(payload.IssuedAt)
+			}
+			if typeInfo.Mismatch() {
+				response["warning"] = typeMismatchWarning(typeInfo)
 			}
+			c.JSON(http.StatusOK, response)
 		})
 
-		// 获取支持的文件类型
-		api.GET("/supported-types", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"types": watermarkService.GetSupportedTypes()})
-		})
-	}
+		// 检测水印API，没有水印或水印无法读取时也返回200
+		api.POST("/detect-watermark", func(c *gin.Context) {
+			// 获取上传的文件
+			file, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "请选择文件"})
+				return
+			}
 
-	// 启动定期清理过期临时文件的任务
-	go cleanupTempFiles(tempDir)
+			// 检查文件大小
+			if file.Size > service.MaxFileSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小超过限制"})
+				return
+			}
 
-	// 启动另一个协程定期清理客户端请求记录
-	go cleanupClientRequests()
+			// 打开上传的文件
+			input, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "读取上传文件失败"})
+				return
+			}
+			defer input.Close()
 
-	// 启动服务器
-	log.Println("服务器已启动，访问 http://localhost:8080")
-	r.Run(":8080")
-}
+			// 根据文件内容识别文件类型，不依赖扩展名
+			typeInfo, err := watermarkService.DetectFileType(input, file.Size, file.Filename)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型，请上传PDF、DOCX、XLSX、PPTX、ODT、RTF、JPG、PNG、GIF、TIFF、BMP或SVG文件"})
+				return
+			}
+			c.Header("X-Detected-Type", typeInfo.Detected)
 
-// cleanupTempFiles 定期清理临时文件
-func cleanupTempFiles(tempDir string) {
-	ticker := time.NewTicker(10 * time.Minute)
-	defer ticker.Stop()
+			// 设置处理超时，超时或客户端断开后处理会被中止
+			ctx, cancel := context.WithTimeout(c.Request.Context(), processTimeout)
+			defer cancel()
 
-	for range ticker.C {
-		now := time.Now()
-		err := filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+			detection, err := watermarkService.WithPassword(c.PostForm("password")).DetectWatermarkStream(ctx, input, file.Size, typeInfo.Detected)
 			if err != nil {
-				return err
+				if errors.Is(err, context.DeadlineExceeded) {
+					c.JSON(http.StatusRequestTimeout, gin.H{"error": "处理超时，请尝试使用更小的文件"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("检测水印失败: %v", err)})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"detection": detection,
+				"file_type": typeInfo.Detected,
+			})
+		})
+
+		// 移除水印API
+		api.POST("/strip-watermark", func(c *gin.Context) {
+			// 获取上传的文件
+			file, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "请选择文件"})
+				return
+			}
+
+			// 检查文件大小
+			if file.Size > service.MaxFileSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小超过限制"})
+				return
+			}
+
+			// 打开上传的文件
+			input, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "读取上传文件失败"})
+				return
 			}
+			defer input.Close()
 
-			// 跳过目录
-			if info.IsDir() {
-				return nil
+			// 根据文件内容识别文件类型，不依赖扩展名
+			typeInfo, err := watermarkService.DetectFileType(input, file.Size, file.Filename)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型，请上传PDF、DOCX、XLSX、PPTX、ODT、RTF、JPG、PNG、GIF、TIFF、BMP或SVG文件"})
+				return
 			}
+			c.Header("X-Detected-Type", typeInfo.Detected)
+			if typeInfo.Mismatch() {
+				c.Header("X-Claimed-Type", typeInfo.Claimed)
+			}
+
+			// 设置处理超时，超时或客户端断开后处理会被中止
+			ctx, cancel := context.WithTimeout(c.Request.Context(), processTimeout)
+			defer cancel()
 
-			// 如果文件超过1小时，删除
-			if now.Sub(info.ModTime()) > time.Hour {
-				if err := os.Remove(path); err != nil {
-					log.Printf("删除文件失败 %s: %v", path, err)
+			// 移除水印
+			var output bytes.Buffer
+			err = watermarkService.WithPassword(c.PostForm("password")).RemoveWatermarkStream(ctx, input, file.Size, &output, typeInfo.Detected)
+			if err != nil {
+				if isPasswordError(err) {
+					c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+					return
+				}
+				if errors.Is(err, context.DeadlineExceeded) {
+					c.JSON(http.StatusRequestTimeout, gin.H{"error": "处理超时，请尝试使用更小的文件"})
+					return
+				}
+				if errors.Is(err, watermark.ErrNoWatermark) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "文件中没有水印"})
+					return
 				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("移除水印失败: %v", err)})
+				return
 			}
 
-			return nil
+			// 设置Content-Disposition头以使浏览器下载文件
+			outputFilename := "stripped_" + generateUniqueFilename("."+typeInfo.Detected)
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", outputFilename))
+			c.Header("Content-Description", "File Transfer")
+			c.Header("Content-Transfer-Encoding", "binary")
+			c.Header("Cache-Control", "no-cache")
+
+			// 返回移除水印后的文件
+			contentType := mime.TypeByExtension("." + typeInfo.Detected)
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			c.Data(http.StatusOK, contentType, output.Bytes())
 		})
 
-		if err != nil {
-			log.Printf("清理临时文件时出错: %v", err)
-		}
+		// 获取支持的文件类型和每种类型的嵌入方式
+		api.GET("/supported-types", func(c *gin.Context) {
+			types := watermarkService.GetSupportedTypes()
+			strategies := make(map[string][]watermark.Strategy, len(types))
+			for _, fileType := range types {
+				strategies[fileType] = watermarkService.GetStrategies(fileType)
+			}
+			c.JSON(http.StatusOK, gin.H{"types": types, "strategies": strategies})
+		})
 	}
+
+	// 启动协程定期清理客户端请求记录
+	go cleanupClientRequests()
+
+	// 启动服务器
+	log.Println("服务器已启动，访问 http://localhost:8080")
+	r.Run(":8080")
 }
 
 // cleanupClientRequests 定期清理客户端请求记录
@@ -386,18 +531,110 @@ func cleanupClientRequests() {
 	}
 }
 
-// formatTimestamp 格式化时间戳
-func formatTimestamp(timestamp string) string {
-	// 尝试解析为 Unix 时间戳（秒）
-	if unixTime, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
-		return time.Unix(unixTime, 0).Format("2006-01-02 15:04:05")
+// isPasswordError 文档已加密，请求中没有提供密码或密码错误
+func isPasswordError(err error) bool {
+	return errors.Is(err, watermark.ErrPasswordRequired) || errors.Is(err, watermark.ErrInvalidPassword)
+}
+
+// overlayFromForm 读取表单中的可见水印参数，visible不为true、没有visible_text也没有上传logo时返回nil
+// visible为true但没有visible_text时使用水印文本，水印文本包含内置字体不支持的字符（如中文）时返回错误，
+// 提示调用方通过visible_text指定可见水印文本
+func overlayFromForm(c *gin.Context, watermarkText string) (*overlay.Options, error) {
+	text := c.PostForm("visible_text")
+	enabled, _ := strconv.ParseBool(c.PostForm("visible"))
+	logoFile, err := c.FormFile("logo")
+	if err != nil && !errors.Is(err, http.ErrMissingFile) {
+		return nil, fmt.Errorf("%w: 读取标志图片失败: %v", overlay.ErrInvalidOptions, err)
+	}
+	if !enabled && text == "" && logoFile == nil {
+		return nil, nil
+	}
+
+	opts := overlay.DefaultOptions()
+	opts.Text = text
+	if enabled && text == "" {
+		if !overlay.Supported(watermarkText) {
+			return nil, fmt.Errorf("%w: 隐水印文本包含中文等其他字符，请通过 visible_text 指定只含ASCII字符的可见水印文本", overlay.ErrUnsupportedText)
+		}
+		opts.Text = watermarkText
+	}
+	if logoFile != nil {
+		logo, err := logoFromForm(c, logoFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Logo = logo
+	}
+	for name, value := range map[string]*float64{
+		"opacity":   &opts.Opacity,
+		"angle":     &opts.Angle,
+		"font_size": &opts.FontSize,
+		"spacing":   &opts.Spacing,
+	} {
+		field := c.PostForm(name)
+		if field == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s 应为数字", overlay.ErrInvalidOptions, name)
+		}
+		*value = parsed
+	}
+	if opts.Layout, err = overlay.ParseLayout(c.PostForm("visible_layout")); err != nil {
+		return nil, err
+	}
+	if colorName := c.PostForm("color"); colorName != "" {
+		color, err := overlay.ParseColor(colorName)
+		if err != nil {
+			return nil, err
+		}
+		opts.Color = color
 	}
+	return &opts, nil
+}
 
-	// 尝试解析为 RFC3339 格式
-	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
-		return t.Format("2006-01-02 15:04:05")
+// logoFromForm 读取上传的标志图片和 logo_anchor、logo_scale、logo_opacity 参数
+func logoFromForm(c *gin.Context, file *multipart.FileHeader) (*overlay.Logo, error) {
+	input, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: 读取标志图片失败: %v", overlay.ErrInvalidOptions, err)
+	}
+	defer input.Close()
+	logo, err := overlay.DecodeLogo(input)
+	if err != nil {
+		return nil, err
 	}
 
-	// 无法解析，直接返回原始字符串
-	return timestamp
+	if logo.Anchor, err = overlay.ParseAnchor(c.PostForm("logo_anchor")); err != nil {
+		return nil, err
+	}
+	for name, value := range map[string]*float64{
+		"logo_scale":   &logo.Scale,
+		"logo_opacity": &logo.Opacity,
+	} {
+		field := c.PostForm(name)
+		if field == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s 应为数字", overlay.ErrInvalidOptions, name)
+		}
+		*value = parsed
+	}
+	return logo, nil
+}
+
+// typeMismatchWarning 生成扩展名与文件内容不一致的提示
+func typeMismatchWarning(typeInfo service.TypeInfo) string {
+	return fmt.Sprintf("文件扩展名为 %s，但实际内容为 %s 文件，已按 %s 处理", typeInfo.Claimed, typeInfo.Detected, typeInfo.Detected)
+}
+
+// formatTimestamp 格式化时间戳
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "未知"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
 }
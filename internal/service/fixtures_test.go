@@ -0,0 +1,224 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFixtures 在dir中生成各种格式的最小测试文档，返回 文件类型 -> 文件路径
+func writeFixtures(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	fixtures := map[string][]byte{
+		"pdf":  minimalPDF(),
+		"png":  minimalPNG(t),
+		"jpg":  minimalJPG(t),
+		"gif":  minimalGIF(t),
+		"tiff": minimalTIFF(),
+		"bmp":  minimalBMP(),
+		"svg":  []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 160 120"><rect width="160" height="120" fill="#eef"/></svg>`),
+		"rtf":  []byte("{\\rtf1\\ansi\\deff0 {\\info{\\title Test}}{\\fonttbl{\\f0 Arial;}}\\f0 Hello RTF\\par}"),
+		"docx": minimalZip(t, []zipEntry{
+			{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`, false},
+			{"docProps/core.xml", `<?xml version="1.0" encoding="UTF-8"?><cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Test</dc:title></cp:coreProperties>`, false},
+			{"word/document.xml", `<?xml version="1.0" encoding="UTF-8"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>Hello</w:t></w:r></w:p></w:body></w:document>`, false},
+		}),
+		"pptx": minimalZip(t, []zipEntry{
+			{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Override PartName="/ppt/presentation.xml" ContentType="application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml"/></Types>`, false},
+			{"docProps/core.xml", `<?xml version="1.0" encoding="UTF-8"?><cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Test</dc:title></cp:coreProperties>`, false},
+			{"ppt/presentation.xml", `<?xml version="1.0" encoding="UTF-8"?><p:presentation xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"/>`, false},
+			{"ppt/slides/slide1.xml", `<?xml version="1.0" encoding="UTF-8"?><p:sld xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"><p:cSld/></p:sld>`, false},
+		}),
+		"xlsx": minimalZip(t, []zipEntry{
+			{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/></Types>`, false},
+			{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8"?><workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheets/></workbook>`, false},
+		}),
+		"odt": minimalZip(t, []zipEntry{
+			{"mimetype", "application/vnd.oasis.opendocument.text", true},
+			{"META-INF/manifest.xml", `<?xml version="1.0" encoding="UTF-8"?><manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0"><manifest:file-entry manifest:full-path="/" manifest:media-type="application/vnd.oasis.opendocument.text"/></manifest:manifest>`, false},
+			{"content.xml", `<?xml version="1.0" encoding="UTF-8"?><office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"><office:body/></office:document-content>`, false},
+		}),
+	}
+
+	paths := make(map[string]string, len(fixtures))
+	for fileType, data := range fixtures {
+		path := filepath.Join(dir, "fixture."+fileType)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+		paths[fileType] = path
+	}
+
+	return paths
+}
+
+// zipEntry 描述测试ZIP文档中的一个文件
+type zipEntry struct {
+	name    string
+	content string
+	store   bool
+}
+
+// minimalZip 生成包含指定文件的ZIP文档
+func minimalZip(t *testing.T, entries []zipEntry) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.store {
+			header.Method = zip.Store
+		}
+		w, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("创建ZIP条目失败: %v", err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("写入ZIP条目失败: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("关闭ZIP失败: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+// testImage 生成一张带渐变的测试图片
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 160, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y * 2), B: uint8(x + y), A: 255})
+		}
+	}
+	return img
+}
+
+// minimalPNG 生成测试用PNG图片
+func minimalPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, testImage()); err != nil {
+		t.Fatalf("编码PNG失败: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// minimalJPG 生成测试用JPG图片
+func minimalJPG(t *testing.T) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, testImage(), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("编码JPG失败: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// minimalGIF 生成测试用GIF图片
+func minimalGIF(t *testing.T) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := gif.Encode(&buffer, testImage(), nil); err != nil {
+		t.Fatalf("编码GIF失败: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// minimalTIFF 生成测试用的单页未压缩RGB TIFF图片，像素数据在IFD之前
+func minimalTIFF() []byte {
+	img := testImage()
+	bounds := img.Bounds()
+	output := []byte("II\x2a\x00\x00\x00\x00\x00")
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			output = append(output, c.R, c.G, c.B)
+		}
+	}
+
+	// 字段：宽、高、每通道位数、压缩、光度解释、条带偏移、通道数、每条带行数、条带字节数
+	fields := [][3]uint32{
+		{256, 4, uint32(bounds.Dx())}, {257, 4, uint32(bounds.Dy())}, {258, 3, 8}, {259, 3, 1}, {262, 3, 2},
+		{273, 4, 8}, {277, 3, 3}, {278, 4, uint32(bounds.Dy())}, {279, 4, uint32(len(output) - 8)},
+	}
+	binary.LittleEndian.PutUint32(output[4:], uint32(len(output)))
+	output = binary.LittleEndian.AppendUint16(output, uint16(len(fields)))
+	for _, field := range fields {
+		output = binary.LittleEndian.AppendUint16(output, uint16(field[0]))
+		output = binary.LittleEndian.AppendUint16(output, uint16(field[1]))
+		output = binary.LittleEndian.AppendUint32(output, 1)
+		if field[1] == 3 {
+			output = binary.LittleEndian.AppendUint16(output, uint16(field[2]))
+			output = append(output, 0, 0)
+		} else {
+			output = binary.LittleEndian.AppendUint32(output, field[2])
+		}
+	}
+	return binary.LittleEndian.AppendUint32(output, 0)
+}
+
+// minimalBMP 生成测试用的24位BMP图片，像素水印要求图片至少有一个128×128的区块
+func minimalBMP() []byte {
+	const width, height = 160, 128
+	stride := (24*width + 31) / 32 * 4
+	output := make([]byte, 54, 54+stride*height)
+	copy(output, "BM")
+	binary.LittleEndian.PutUint32(output[2:], uint32(54+stride*height))
+	binary.LittleEndian.PutUint32(output[10:], 54)
+	binary.LittleEndian.PutUint32(output[14:], 40)
+	binary.LittleEndian.PutUint32(output[18:], width)
+	binary.LittleEndian.PutUint32(output[22:], height)
+	binary.LittleEndian.PutUint16(output[26:], 1)
+	binary.LittleEndian.PutUint16(output[28:], 24)
+	// 各行从下到上保存，每个像素按B、G、R的顺序
+	for y := height - 1; y >= 0; y-- {
+		row := make([]byte, stride)
+		for x := 0; x < width; x++ {
+			row[x*3], row[x*3+1], row[x*3+2] = uint8(x+y), uint8(y*2), uint8(x)
+		}
+		output = append(output, row...)
+	}
+	return output
+}
+
+// minimalPDF 生成一个带有正确交叉引用表的单页PDF
+func minimalPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << >> >>",
+		"<< /Length 0 >>\nstream\n\nendstream",
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xrefOffset := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	return buffer.Bytes()
+}
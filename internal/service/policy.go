@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"watermark-tool/internal/watermark"
+)
+
+// ErrAlreadyWatermarked 文档已有水印，且策略为 PolicyRefuse
+var ErrAlreadyWatermarked = errors.New("文档已有水印")
+
+// Policy 指定为已有水印的文档添加水印时的处理方式
+type Policy int
+
+const (
+	// PolicyReplace 移除已有的水印，只保留新水印
+	PolicyReplace Policy = iota
+	// PolicyAppend 移除已有的水印，并将其加入新水印的历史记录
+	PolicyAppend
+	// PolicyRefuse 文档已有水印时返回 ErrAlreadyWatermarked
+	PolicyRefuse
+)
+
+// String 返回策略名称
+func (p Policy) String() string {
+	switch p {
+	case PolicyReplace:
+		return "replace"
+	case PolicyAppend:
+		return "append"
+	case PolicyRefuse:
+		return "refuse"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// ParsePolicy 解析策略名称，空字符串为 PolicyReplace
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "", "replace":
+		return PolicyReplace, nil
+	case "append":
+		return PolicyAppend, nil
+	case "refuse":
+		return PolicyRefuse, nil
+	default:
+		return PolicyReplace, fmt.Errorf("未知的水印策略: %s，可选值为 replace、append、refuse", name)
+	}
+}
+
+// policyWatermarker 在添加水印前按策略处理文档中已有的水印
+// 所有格式都先移除已有的水印再添加新水印，因此文档中始终只有一个水印，
+// 追加模式下之前的水印保存在新载荷的历史记录中
+type policyWatermarker struct {
+	watermark.StreamWatermarker
+	policy Policy
+}
+
+// AddWatermarkStream 按策略处理已有的水印后添加新水印
+func (w *policyWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	existing, err := w.ExtractWatermarkStream(ctx, src, size)
+	if errors.Is(err, watermark.ErrNoWatermark) {
+		return w.StreamWatermarker.AddWatermarkStream(ctx, src, size, dst, payload)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	// 只有找到了水印时才按策略处理；需要密码、读取失败或文件无法解析时原样返回错误
+	if err != nil && !markFound(err) {
+		return err
+	}
+
+	switch w.policy {
+	case PolicyRefuse:
+		return ErrAlreadyWatermarked
+	case PolicyAppend:
+		// 无法读取或被篡改的水印不能加入历史记录
+		if err != nil {
+			return fmt.Errorf("读取已有水印失败: %w", err)
+		}
+		if existing.Verification.Forged() {
+			return watermark.ErrForgedWatermark
+		}
+		chained := *payload
+		chained.AppendHistory(existing)
+		if err := chained.Validate(); err != nil {
+			return fmt.Errorf("水印历史记录过长: %w", err)
+		}
+		payload = &chained
+	}
+
+	// 移除已有的水印，无法读取的水印同样会被移除
+	var stripped bytes.Buffer
+	err = w.RemoveWatermarkStream(ctx, src, size, &stripped)
+	if errors.Is(err, watermark.ErrNoWatermark) {
+		return w.StreamWatermarker.AddWatermarkStream(ctx, src, size, dst, payload)
+	}
+	if err != nil {
+		return fmt.Errorf("移除已有水印失败: %w", err)
+	}
+
+	return w.StreamWatermarker.AddWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len()), dst, payload)
+}
+
+// markFound 提取已有水印时的错误是否表示文档中有水印，只是签名无效或信封无法读取
+func markFound(err error) bool {
+	return errors.Is(err, watermark.ErrForgedWatermark) || errors.Is(err, watermark.ErrUnreadableWatermark)
+}
@@ -1,8 +1,10 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
 	"os"
 	"path/filepath"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/overlay"
 )
 
 // 定义支持的最大文件大小（50MB）
@@ -25,13 +28,86 @@ var (
 )
 
 // WatermarkService 提供水印操作服务
-type WatermarkService struct{}
+type WatermarkService struct {
+	policy   Policy
+	method   string
+	overlay  *overlay.Options
+	password string
+}
 
-// NewWatermarkService 创建一个新的水印服务
+// NewWatermarkService 创建一个新的水印服务，为已有水印的文档添加水印时替换已有的水印
 func NewWatermarkService() *WatermarkService {
 	return &WatermarkService{}
 }
 
+// WithPolicy 返回使用指定策略处理已有水印的水印服务，原服务不受影响
+func (s *WatermarkService) WithPolicy(policy Policy) *WatermarkService {
+	service := *s
+	service.policy = policy
+	return &service
+}
+
+// Policy 返回为已有水印的文档添加水印时使用的策略
+func (s *WatermarkService) Policy() Policy {
+	return s.policy
+}
+
+// WithMethod 返回使用指定嵌入方式添加水印的水印服务，原服务不受影响
+// method为空时使用优先级最高的方式，可用的方式见 watermark.Registry.Strategies
+func (s *WatermarkService) WithMethod(method string) *WatermarkService {
+	service := *s
+	service.method = method
+	return &service
+}
+
+// Method 返回添加水印时使用的嵌入方式，为空表示使用优先级最高的方式
+func (s *WatermarkService) Method() string {
+	return s.method
+}
+
+// WithOverlay 返回添加隐水印时同时绘制可见水印的水印服务，原服务不受影响
+// opts为nil时不绘制；只有能力中 Visible 为true的嵌入方式支持，其他文件类型返回 watermark.ErrOverlayUnsupported
+func (s *WatermarkService) WithOverlay(opts *overlay.Options) *WatermarkService {
+	service := *s
+	service.overlay = opts
+	return &service
+}
+
+// Overlay 返回添加水印时绘制的可见水印参数，为nil表示不绘制
+func (s *WatermarkService) Overlay() *overlay.Options {
+	return s.overlay
+}
+
+// overlayPayload 需要绘制可见水印时检查嵌入方式是否支持，并返回带有可见水印参数的载荷副本，原载荷不受影响
+func (s *WatermarkService) overlayPayload(payload *watermark.Payload, fileType string) (*watermark.Payload, error) {
+	if s.overlay == nil {
+		return payload, nil
+	}
+	strategy, err := watermark.DefaultRegistry.Preferred(fileType, s.method)
+	if err != nil {
+		return nil, err
+	}
+	if !strategy.Capabilities.Visible {
+		return nil, fmt.Errorf("%w: %s", watermark.ErrOverlayUnsupported, fileType)
+	}
+	overlaid := *payload
+	overlaid.Overlay = s.overlay
+	return &overlaid, nil
+}
+
+// WithPassword 返回使用指定密码打开加密文档的水印服务，原服务不受影响
+// 密码可以是用户密码或所有者密码；加密的PDF在添加水印后仍使用原来的密码和权限，不支持加密的文件类型忽略该参数
+func (s *WatermarkService) WithPassword(password string) *WatermarkService {
+	service := *s
+	service.password = password
+	return &service
+}
+
+// Password 返回打开加密文档时使用的密码，为空表示不提供密码
+func (s *WatermarkService) Password() string {
+	return s.password
+}
+
 // validateFile 验证文件是否符合要求
 func (s *WatermarkService) validateFile(filePath string) error {
 	// 检查文件是否存在
@@ -48,19 +124,6 @@ func (s *WatermarkService) validateFile(filePath string) error {
 		return ErrFileTooBig
 	}
 
-	// 检查文件类型
-	fileExt := strings.ToLower(filepath.Ext(filePath))
-	if fileExt == "" {
-		return ErrInvalidFileType
-	}
-	fileExt = fileExt[1:] // 去掉点号
-
-	// 检查是否支持该文件类型
-	_, ok := watermark.GetWatermarker(fileExt)
-	if !ok {
-		return ErrInvalidFileType
-	}
-
 	// 尝试读取文件的前几个字节，确保文件未损坏
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -78,16 +141,78 @@ func (s *WatermarkService) validateFile(filePath string) error {
 	return nil
 }
 
-// validateWatermarkText 验证水印文本是否有效
-func (s *WatermarkService) validateWatermarkText(text string) error {
+// TypeInfo 文件类型的识别结果
+type TypeInfo struct {
+	// Claimed 扩展名或调用方声明的类型，未声明时为空
+	Claimed string
+	// Detected 实际使用的类型，优先根据文件内容识别
+	Detected string
+}
+
+// Mismatch 判断声明的类型是否与文件内容不一致
+func (t TypeInfo) Mismatch() bool {
+	return t.Claimed != "" && t.Claimed != t.Detected
+}
+
+// DetectFileType 根据文件内容识别文件类型，filename只用于判断扩展名是否与内容一致
+func (s *WatermarkService) DetectFileType(src io.ReaderAt, size int64, filename string) (TypeInfo, error) {
+	return s.detectType(src, size, filepath.Ext(filename))
+}
+
+// detectType 根据文件内容确定文件类型
+// 内容无法识别时（如自定义格式的处理器）才使用claimed声明的类型，声明的类型与内容不一致时由调用方提示
+func (s *WatermarkService) detectType(src io.ReaderAt, size int64, claimed string) (TypeInfo, error) {
+	info := TypeInfo{Claimed: watermark.NormalizeType(claimed)}
+
+	detected, err := watermark.DetectType(src, size)
+	switch {
+	case err == nil:
+		info.Detected = detected
+	case errors.Is(err, watermark.ErrUnknownType) && info.Claimed != "":
+		info.Detected = info.Claimed
+	case errors.Is(err, watermark.ErrUnknownType):
+		return info, ErrInvalidFileType
+	default:
+		return info, fmt.Errorf("识别文件类型失败: %w", err)
+	}
+
+	if _, ok := watermark.GetWatermarker(info.Detected); !ok {
+		return info, ErrInvalidFileType
+	}
+
+	return info, nil
+}
+
+// detectFileType 打开文件并识别文件类型
+func (s *WatermarkService) detectFileType(filePath string) (TypeInfo, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return TypeInfo{}, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return TypeInfo{}, fmt.Errorf("读取文件信息失败: %w", err)
+	}
+
+	return s.detectType(file, info.Size(), filepath.Ext(filePath))
+}
+
+// validatePayload 验证水印载荷是否有效，未设置签发时间时使用当前时间
+func (s *WatermarkService) validatePayload(payload *watermark.Payload) error {
 	// 检查水印文本是否为空
-	if strings.TrimSpace(text) == "" {
+	if payload == nil || strings.TrimSpace(payload.Text) == "" {
 		return ErrEmptyWatermark
 	}
 
-	// 检查水印文本长度
-	if len(text) > 100 {
-		return errors.New("水印文本过长，请控制在100个字符以内")
+	// 检查水印文本长度和其他字段
+	if err := payload.Validate(); err != nil {
+		return err
+	}
+
+	if payload.IssuedAt.IsZero() {
+		payload.IssuedAt = time.Now().UTC().Truncate(time.Second)
 	}
 
 	return nil
@@ -95,8 +220,19 @@ func (s *WatermarkService) validateWatermarkText(text string) error {
 
 // AddWatermark 为文档添加水印
 func (s *WatermarkService) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 验证水印文本
-	if err := s.validateWatermarkText(watermarkText); err != nil {
+	return s.AddWatermarkPayload(context.Background(), inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
+
+// AddWatermarkContext 为文档添加水印，ctx取消或超时后处理会被中止
+func (s *WatermarkService) AddWatermarkContext(ctx context.Context, inputFile, outputFile, watermarkText string) error {
+	return s.AddWatermarkPayload(ctx, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
+
+// AddWatermarkPayload 为文档添加结构化水印载荷
+// 文档已有水印时按服务的策略处理，见 WithPolicy
+func (s *WatermarkService) AddWatermarkPayload(ctx context.Context, inputFile, outputFile string, payload *watermark.Payload) error {
+	// 验证水印载荷
+	if err := s.validatePayload(payload); err != nil {
 		return err
 	}
 
@@ -111,21 +247,26 @@ func (s *WatermarkService) AddWatermark(inputFile, outputFile, watermarkText str
 		return fmt.Errorf("创建输出目录失败: %w", err)
 	}
 
-	// 根据文件扩展名获取处理器
-	fileExt := strings.ToLower(filepath.Ext(inputFile))
-	fileExt = fileExt[1:] // 去掉扩展名前面的点号
+	// 根据文件内容识别文件类型
+	typeInfo, err := s.detectFileType(inputFile)
+	if err != nil {
+		return err
+	}
 
 	// 获取对应的水印处理器
-	processor, ok := watermark.GetWatermarker(fileExt)
-	if !ok {
-		return fmt.Errorf("不支持的文件类型: %s", fileExt)
+	processor, err := s.processor(typeInfo.Detected)
+	if err != nil {
+		return err
+	}
+	if payload, err = s.overlayPayload(payload, typeInfo.Detected); err != nil {
+		return err
 	}
 
 	// 记录开始时间，用于性能分析
 	startTime := time.Now()
 
-	// 添加水印
-	err := processor.AddWatermark(inputFile, outputFile, watermarkText)
+	// 按策略处理已有的水印并添加新水印
+	err = watermark.AddWatermarkFile(ctx, s.withPolicy(processor), inputFile, outputFile, payload)
 
 	// 记录处理时间
 	elapsedTime := time.Since(startTime)
@@ -143,84 +284,259 @@ func (s *WatermarkService) AddWatermark(inputFile, outputFile, watermarkText str
 	return nil
 }
 
-// ExtractWatermark 从文档中提取水印
-func (s *WatermarkService) ExtractWatermark(inputFile string) (string, error) {
+// AddWatermarkStream 为内存或对象存储中的文档添加水印
+// fileType为声明的文件类型，如"pdf"，可以为空；实际使用的处理器根据文件内容确定
+func (s *WatermarkService) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, fileType string, payload *watermark.Payload) error {
+	// 验证水印载荷
+	if err := s.validatePayload(payload); err != nil {
+		return err
+	}
+
+	// 验证输入数据并获取处理器
+	detected, err := s.streamType(src, size, fileType)
+	if err != nil {
+		return err
+	}
+	processor, err := s.processor(detected)
+	if err != nil {
+		return err
+	}
+	if payload, err = s.overlayPayload(payload, detected); err != nil {
+		return err
+	}
+
+	if err := s.withPolicy(processor).AddWatermarkStream(ctx, src, size, dst, payload); err != nil {
+		return fmt.Errorf("添加水印失败: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveWatermark 移除文档中的水印，文档中没有水印时返回 watermark.ErrNoWatermark
+func (s *WatermarkService) RemoveWatermark(inputFile, outputFile string) error {
+	return s.RemoveWatermarkContext(context.Background(), inputFile, outputFile)
+}
+
+// RemoveWatermarkContext 移除文档中的水印，ctx取消或超时后处理会被中止
+func (s *WatermarkService) RemoveWatermarkContext(ctx context.Context, inputFile, outputFile string) error {
 	// 验证输入文件
 	if err := s.validateFile(inputFile); err != nil {
-		return "", err
+		return err
+	}
+
+	// 确保输出目录存在
+	outputDir := filepath.Dir(outputFile)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
 	}
 
-	// 根据文件扩展名获取处理器
-	fileExt := strings.ToLower(filepath.Ext(inputFile))
-	fileExt = fileExt[1:] // 去掉扩展名前面的点号
+	// 根据文件内容识别文件类型
+	typeInfo, err := s.detectFileType(inputFile)
+	if err != nil {
+		return err
+	}
 
 	// 获取对应的水印处理器
-	processor, ok := watermark.GetWatermarker(fileExt)
-	if !ok {
-		return "", fmt.Errorf("不支持的文件类型: %s", fileExt)
+	processor, err := s.processor(typeInfo.Detected)
+	if err != nil {
+		return err
 	}
 
-	// 记录开始时间，用于性能分析
-	startTime := time.Now()
-
-	// 提取水印
-	watermarkText, _, err := processor.ExtractWatermark(inputFile)
+	if err := watermark.RemoveWatermarkFile(ctx, processor, inputFile, outputFile); err != nil {
+		return fmt.Errorf("移除水印失败: %w", err)
+	}
 
-	// 记录处理时间
-	elapsedTime := time.Since(startTime)
-	fmt.Printf("提取水印从文件 %s 耗时: %v\n", filepath.Base(inputFile), elapsedTime)
+	return nil
+}
 
+// RemoveWatermarkStream 移除内存或对象存储中的文档的水印
+// fileType为声明的文件类型，如"pdf"，可以为空；实际使用的处理器根据文件内容确定
+func (s *WatermarkService) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, fileType string) error {
+	processor, err := s.streamProcessor(src, size, fileType)
 	if err != nil {
-		return "", fmt.Errorf("提取水印失败: %w", err)
+		return err
+	}
+
+	if err := processor.RemoveWatermarkStream(ctx, src, size, dst); err != nil {
+		return fmt.Errorf("移除水印失败: %w", err)
 	}
 
-	return watermarkText, nil
+	return nil
+}
+
+// ExtractWatermark 从文档中提取水印
+func (s *WatermarkService) ExtractWatermark(inputFile string) (string, error) {
+	return s.ExtractWatermarkContext(context.Background(), inputFile)
+}
+
+// ExtractWatermarkContext 从文档中提取水印，ctx取消或超时后处理会被中止
+func (s *WatermarkService) ExtractWatermarkContext(ctx context.Context, inputFile string) (string, error) {
+	watermarkText, _, err := s.ExtractWatermarkWithTimestampContext(ctx, inputFile)
+	return watermarkText, err
 }
 
 // ExtractWatermarkWithTimestamp 从文档中提取水印和时间戳
 func (s *WatermarkService) ExtractWatermarkWithTimestamp(inputFile string) (string, string, error) {
+	return s.ExtractWatermarkWithTimestampContext(context.Background(), inputFile)
+}
+
+// ExtractWatermarkWithTimestampContext 从文档中提取水印和时间戳，ctx取消或超时后处理会被中止
+// 水印签名无效时返回 watermark.ErrForgedWatermark，需要查看伪造内容时使用 ExtractPayload
+func (s *WatermarkService) ExtractWatermarkWithTimestampContext(ctx context.Context, inputFile string) (string, string, error) {
+	payload, err := s.ExtractPayload(ctx, inputFile)
+	if err != nil {
+		return "", "", err
+	}
+	if payload.Verification.Forged() {
+		return "", "", watermark.ErrForgedWatermark
+	}
+	return payload.Text, payload.Timestamp(), nil
+}
+
+// ExtractPayload 从文档中提取完整的水印载荷
+// 载荷的 Verification 字段记录了签名校验结果，签名无效时也会返回载荷
+func (s *WatermarkService) ExtractPayload(ctx context.Context, inputFile string) (*watermark.Payload, error) {
 	// 验证输入文件
 	if err := s.validateFile(inputFile); err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	// 根据文件扩展名获取处理器
-	fileExt := strings.ToLower(filepath.Ext(inputFile))
-	fileExt = fileExt[1:] // 去掉扩展名前面的点号
+	// 根据文件内容识别文件类型
+	typeInfo, err := s.detectFileType(inputFile)
+	if err != nil {
+		return nil, err
+	}
 
 	// 获取对应的水印处理器
-	processor, ok := watermark.GetWatermarker(fileExt)
-	if !ok {
-		return "", "", fmt.Errorf("不支持的文件类型: %s", fileExt)
+	processor, err := s.processor(typeInfo.Detected)
+	if err != nil {
+		return nil, err
 	}
 
 	// 记录开始时间，用于性能分析
 	startTime := time.Now()
 
 	// 提取水印
-	watermarkText, timestamp, err := processor.ExtractWatermark(inputFile)
+	payload, err := watermark.ExtractWatermarkFile(ctx, processor, inputFile)
 
 	// 记录处理时间
 	elapsedTime := time.Since(startTime)
 	fmt.Printf("提取水印从文件 %s 耗时: %v\n", filepath.Base(inputFile), elapsedTime)
 
 	if err != nil {
-		return "", "", fmt.Errorf("提取水印失败: %w", err)
+		return nil, fmt.Errorf("提取水印失败: %w", err)
+	}
+
+	return payload, nil
+}
+
+// ExtractWatermarkStream 从内存或对象存储中的文档提取水印载荷
+// 与 ExtractPayload 相同，调用方需要检查载荷的 Verification 字段
+// fileType为声明的文件类型，如"pdf"，可以为空；实际使用的处理器根据文件内容确定
+func (s *WatermarkService) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, fileType string) (*watermark.Payload, error) {
+	processor, err := s.streamProcessor(src, size, fileType)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := processor.ExtractWatermarkStream(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("提取水印失败: %w", err)
 	}
 
-	return watermarkText, timestamp, nil
+	return payload, nil
+}
+
+// withPolicy 包装处理器，添加水印前按服务的策略处理已有的水印
+func (s *WatermarkService) withPolicy(processor watermark.StreamWatermarker) watermark.StreamWatermarker {
+	return &policyWatermarker{StreamWatermarker: processor, policy: s.policy}
+}
+
+// DetectWatermark 检测文档中是否有水印，用于批量扫描
+// 没有水印或水印无法读取时不返回错误，结果中记录了找到的位置、是否解密和校验成功以及置信度
+func (s *WatermarkService) DetectWatermark(ctx context.Context, inputFile string) (*watermark.Detection, error) {
+	// 验证输入文件
+	if err := s.validateFile(inputFile); err != nil {
+		return nil, err
+	}
+
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件信息失败: %w", err)
+	}
+
+	return s.DetectWatermarkStream(ctx, input, info.Size(), filepath.Ext(inputFile))
+}
+
+// DetectWatermarkStream 检测内存或对象存储中的文档是否有水印
+// fileType为声明的文件类型，如"pdf"，可以为空；实际使用的处理器根据文件内容确定
+func (s *WatermarkService) DetectWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, fileType string) (*watermark.Detection, error) {
+	processor, err := s.streamProcessor(src, size, fileType)
+	if err != nil {
+		return nil, err
+	}
+
+	return watermark.Detect(ctx, processor, src, size)
+}
+
+// streamProcessor 验证流式输入的大小，并根据文件内容返回对应的处理器
+func (s *WatermarkService) streamProcessor(src io.ReaderAt, size int64, fileType string) (watermark.StreamWatermarker, error) {
+	detected, err := s.streamType(src, size, fileType)
+	if err != nil {
+		return nil, err
+	}
+	return s.processor(detected)
+}
+
+// streamType 验证输入数据的大小并根据内容识别文件类型
+func (s *WatermarkService) streamType(src io.ReaderAt, size int64, fileType string) (string, error) {
+	if size > MaxFileSize {
+		return "", ErrFileTooBig
+	}
+	if size <= 0 {
+		return "", ErrFileCorrupted
+	}
+
+	typeInfo, err := s.detectType(src, size, fileType)
+	if err != nil {
+		return "", err
+	}
+	return typeInfo.Detected, nil
+}
+
+// processor 返回文件类型的处理器，添加水印时使用服务指定的嵌入方式，设置了密码时使用该密码打开加密文档
+func (s *WatermarkService) processor(fileType string) (watermark.StreamWatermarker, error) {
+	processor, err := watermark.DefaultRegistry.LookupMethod(fileType, s.method)
+	if errors.Is(err, watermark.ErrUnknownMethod) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrInvalidFileType
+	}
+	if s.password != "" {
+		processor = watermark.WithPassword(processor, s.password)
+	}
+	return processor, nil
 }
 
 // GetSupportedTypes 获取所有支持的文件类型
 func (s *WatermarkService) GetSupportedTypes() []string {
-	types := make([]string, 0, len(watermark.WatermarkRegistry))
-	for fileType := range watermark.WatermarkRegistry {
-		types = append(types, fileType)
-	}
-	return types
+	return watermark.DefaultRegistry.Types()
+}
+
+// GetStrategies 获取文件类型的所有嵌入方式，按优先级从高到低排列
+func (s *WatermarkService) GetStrategies(fileType string) []watermark.Strategy {
+	return watermark.DefaultRegistry.Strategies(fileType)
 }
 
-// ValidateMimeType 验证MIME类型是否为支持的文档类型
+// ValidateMimeType 根据文件扩展名验证MIME类型是否为支持的文档类型
+// 扩展名可能与实际内容不一致，处理上传文件时应使用 DetectFileType
 func (s *WatermarkService) ValidateMimeType(filename string) error {
 	ext := strings.ToLower(filepath.Ext(filename))
 	if ext == "" {
@@ -251,6 +567,11 @@ func (s *WatermarkService) ValidateMimeType(filename string) error {
 		"image/jpeg":      true, // JPG
 		"image/jpg":       true, // JPG 另一种MIME类型
 		"image/png":       true, // PNG
+		"image/gif":       true, // GIF
+		"image/tiff":      true, // TIFF
+		"image/bmp":       true, // BMP
+		"image/x-ms-bmp":  true, // BMP 另一种MIME类型
+		"image/svg+xml":   true, // SVG
 	}
 
 	if !validMimeTypes[mimeType] {
@@ -1,13 +1,29 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"watermark-tool/internal/watermark"
+	_ "watermark-tool/internal/watermark/bmp"
 	_ "watermark-tool/internal/watermark/docx"
+	_ "watermark-tool/internal/watermark/gif"
+	_ "watermark-tool/internal/watermark/jpg"
+	"watermark-tool/internal/watermark/keys"
+	_ "watermark-tool/internal/watermark/odt"
+	"watermark-tool/internal/watermark/overlay"
 	_ "watermark-tool/internal/watermark/pdf"
+	_ "watermark-tool/internal/watermark/png"
 	_ "watermark-tool/internal/watermark/pptx"
+	_ "watermark-tool/internal/watermark/rtf"
+	_ "watermark-tool/internal/watermark/svg"
+	_ "watermark-tool/internal/watermark/tiff"
 	_ "watermark-tool/internal/watermark/xlsx"
 )
 
@@ -93,3 +109,491 @@ func TestWatermarkService(t *testing.T) {
 		})
 	}
 }
+
+func TestWatermarkStreamRoundTrip(t *testing.T) {
+	service := NewWatermarkService()
+	fixtures := writeFixtures(t, t.TempDir())
+
+	for fileType, path := range fixtures {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取测试文件失败: %v", err)
+			}
+
+			payload := watermark.NewPayload("stream-test")
+			payload.RecipientID = "user-42"
+			payload.DocumentID = "doc-7"
+			payload.Fields = map[string]string{"department": "财务部"}
+
+			var output bytes.Buffer
+			err = service.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &output, fileType, payload)
+			if err != nil {
+				t.Fatalf("添加水印失败: %v", err)
+			}
+
+			extracted, err := service.ExtractWatermarkStream(context.Background(), bytes.NewReader(output.Bytes()), int64(output.Len()), fileType)
+			if err != nil {
+				t.Fatalf("提取水印失败: %v", err)
+			}
+			if extracted.Text != payload.Text {
+				t.Errorf("提取的水印为 %q，期望 %q", extracted.Text, payload.Text)
+			}
+			if extracted.RecipientID != payload.RecipientID || extracted.DocumentID != payload.DocumentID {
+				t.Errorf("提取的载荷字段不一致: %+v", extracted)
+			}
+			if extracted.Fields["department"] != "财务部" {
+				t.Errorf("自定义字段丢失: %v", extracted.Fields)
+			}
+			if !extracted.IssuedAt.Equal(payload.IssuedAt) {
+				t.Errorf("签发时间为 %v，期望 %v", extracted.IssuedAt, payload.IssuedAt)
+			}
+		})
+	}
+}
+
+func TestWatermarkStreamCanceled(t *testing.T) {
+	service := NewWatermarkService()
+	fixtures := writeFixtures(t, t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for fileType, path := range fixtures {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取测试文件失败: %v", err)
+			}
+
+			var output bytes.Buffer
+			err = service.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &output, fileType, watermark.NewPayload("canceled"))
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("期望返回 context.Canceled，实际为: %v", err)
+			}
+		})
+	}
+}
+
+func TestDetectFileType(t *testing.T) {
+	service := NewWatermarkService()
+	fixtures := writeFixtures(t, t.TempDir())
+
+	for fileType, path := range fixtures {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取测试文件失败: %v", err)
+			}
+
+			info, err := service.DetectFileType(bytes.NewReader(data), int64(len(data)), "upload")
+			if err != nil {
+				t.Fatalf("识别文件类型失败: %v", err)
+			}
+			if info.Detected != fileType || info.Mismatch() {
+				t.Errorf("识别结果为 %+v，期望 %s", info, fileType)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(fixtures["jpg"])
+	if err != nil {
+		t.Fatalf("读取测试文件失败: %v", err)
+	}
+	info, err := service.DetectFileType(bytes.NewReader(data), int64(len(data)), "photo.JPEG")
+	if err != nil || info.Detected != "jpg" || info.Mismatch() {
+		t.Errorf(".jpeg 文件识别结果为 %+v, %v", info, err)
+	}
+
+	for _, text := range []string{"plain text", "BMW 3 Series brochure, prices and options"} {
+		if _, err := service.DetectFileType(bytes.NewReader([]byte(text)), int64(len(text)), "notes"); !errors.Is(err, ErrInvalidFileType) {
+			t.Errorf("%q 期望返回 ErrInvalidFileType，实际为: %v", text, err)
+		}
+	}
+
+	// 文件头中记录的长度超过实际长度的BMP不能识别
+	truncated := minimalBMP()[:1024]
+	if _, err := service.DetectFileType(bytes.NewReader(truncated), int64(len(truncated)), "notes"); !errors.Is(err, ErrInvalidFileType) {
+		t.Errorf("截断的BMP期望返回 ErrInvalidFileType，实际为: %v", err)
+	}
+}
+
+func TestAddWatermarkRenamedFile(t *testing.T) {
+	service := NewWatermarkService()
+	dir := t.TempDir()
+	fixtures := writeFixtures(t, dir)
+
+	// PDF文件被错误地命名为.docx
+	renamed := filepath.Join(dir, "renamed.docx")
+	if err := os.Rename(fixtures["pdf"], renamed); err != nil {
+		t.Fatalf("重命名测试文件失败: %v", err)
+	}
+
+	output := filepath.Join(dir, "output.pdf")
+	if err := service.AddWatermark(renamed, output, "renamed"); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	text, err := service.ExtractWatermark(output)
+	if err != nil {
+		t.Fatalf("提取水印失败: %v", err)
+	}
+	if text != "renamed" {
+		t.Errorf("提取的水印为 %q，期望 %q", text, "renamed")
+	}
+}
+
+func TestWatermarkProvenance(t *testing.T) {
+	service := NewWatermarkService()
+	fixtures := writeFixtures(t, t.TempDir())
+	data, err := os.ReadFile(fixtures["pdf"])
+	if err != nil {
+		t.Fatalf("读取测试文件失败: %v", err)
+	}
+
+	issuerKey, _ := keys.GenerateKey()
+	issuerSigningKey, _ := keys.GenerateSigningKey()
+	issuer, err := keys.NewKeyring("k1", map[string][]byte{"k1": issuerKey})
+	if err != nil {
+		t.Fatalf("创建密钥环失败: %v", err)
+	}
+	if err := issuer.AddSigningKey("k1", issuerSigningKey); err != nil {
+		t.Fatalf("设置签名密钥失败: %v", err)
+	}
+	watermark.SetKeyProvider(issuer)
+	t.Cleanup(func() { watermark.SetKeyProvider(nil) })
+
+	var output bytes.Buffer
+	err = service.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &output, "pdf", watermark.NewPayload("provenance"))
+	if err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	extracted, err := service.ExtractWatermarkStream(context.Background(), bytes.NewReader(output.Bytes()), int64(output.Len()), "pdf")
+	if err != nil {
+		t.Fatalf("提取水印失败: %v", err)
+	}
+	if v := extracted.Verification; !v.Authentic() || v.KeyID != "k1" || v.Algorithm != watermark.AlgorithmEd25519 {
+		t.Errorf("校验结果为 %+v，期望由 k1 签发", v)
+	}
+
+	// 第三方只持有公钥时可以确认水印的来源，但无法读取内容
+	publicKey, _ := issuer.PublicKey("k1")
+	verifier, err := keys.NewPublicKeyring(map[string]ed25519.PublicKey{"k1": publicKey})
+	if err != nil {
+		t.Fatalf("创建公钥密钥环失败: %v", err)
+	}
+	watermark.SetKeyProvider(verifier)
+	_, err = service.ExtractWatermarkStream(context.Background(), bytes.NewReader(output.Bytes()), int64(output.Len()), "pdf")
+	var sealed *watermark.SealedError
+	if !errors.As(err, &sealed) || !sealed.Verification.Authentic() || sealed.Verification.KeyID != "k1" {
+		t.Errorf("只用公钥校验的结果为: %v", err)
+	}
+	detection, err := service.DetectWatermarkStream(context.Background(), bytes.NewReader(output.Bytes()), int64(output.Len()), "pdf")
+	if err != nil || !detection.Present || detection.Decrypted || !detection.Verified || detection.Confidence != watermark.ConfidenceAuthentic {
+		t.Errorf("只用公钥检测的结果为 %+v, %v", detection, err)
+	}
+
+	// 使用同一ID的其他密钥生成的水印无法通过校验
+	forgerKey, _ := keys.GenerateKey()
+	forgerSigningKey, _ := keys.GenerateSigningKey()
+	forger, err := keys.NewKeyring("k1", map[string][]byte{"k1": forgerKey})
+	if err != nil {
+		t.Fatalf("创建密钥环失败: %v", err)
+	}
+	if err := forger.AddSigningKey("k1", forgerSigningKey); err != nil {
+		t.Fatalf("设置签名密钥失败: %v", err)
+	}
+	watermark.SetKeyProvider(forger)
+	var forged bytes.Buffer
+	err = service.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &forged, "pdf", watermark.NewPayload("forged"))
+	if err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	for _, provider := range []keys.KeyProvider{issuer, verifier} {
+		watermark.SetKeyProvider(provider)
+		_, err = service.ExtractWatermarkStream(context.Background(), bytes.NewReader(forged.Bytes()), int64(forged.Len()), "pdf")
+		if !errors.Is(err, watermark.ErrForgedWatermark) {
+			t.Errorf("期望返回 ErrForgedWatermark，实际为: %v", err)
+		}
+	}
+
+	// 没有独立签名密钥的密钥只计算MAC
+	unsigned, _ := keys.NewKeyring("k2", map[string][]byte{"k2": forgerKey})
+	watermark.SetKeyProvider(unsigned)
+	output.Reset()
+	if err := service.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &output, "pdf", watermark.NewPayload("mac")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+	extracted, err = service.ExtractWatermarkStream(context.Background(), bytes.NewReader(output.Bytes()), int64(output.Len()), "pdf")
+	if err != nil || extracted.Verification.Algorithm != watermark.AlgorithmHMACSHA256 {
+		t.Errorf("没有签名密钥时的校验结果为 %+v, %v", extracted, err)
+	}
+}
+
+func TestRemoveWatermarkStream(t *testing.T) {
+	service := NewWatermarkService()
+	fixtures := writeFixtures(t, t.TempDir())
+
+	for fileType, path := range fixtures {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取测试文件失败: %v", err)
+			}
+
+			var marked bytes.Buffer
+			err = service.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &marked, fileType, watermark.NewPayload("strip-test"))
+			if err != nil {
+				t.Fatalf("添加水印失败: %v", err)
+			}
+
+			var stripped bytes.Buffer
+			err = service.RemoveWatermarkStream(context.Background(), bytes.NewReader(marked.Bytes()), int64(marked.Len()), &stripped, fileType)
+			if err != nil {
+				t.Fatalf("移除水印失败: %v", err)
+			}
+
+			// 移除后的文件仍然是同一类型，并且不再包含水印
+			info, err := service.DetectFileType(bytes.NewReader(stripped.Bytes()), int64(stripped.Len()), "")
+			if err != nil || info.Detected != fileType {
+				t.Errorf("移除水印后识别结果为 %+v, %v", info, err)
+			}
+			_, err = service.ExtractWatermarkStream(context.Background(), bytes.NewReader(stripped.Bytes()), int64(stripped.Len()), fileType)
+			if !errors.Is(err, watermark.ErrNoWatermark) {
+				t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+			}
+
+			// 文本标记插入的格式移除后应与原文件完全一致
+			if (fileType == "pdf" || fileType == "rtf" || fileType == "png" || fileType == "jpg" || fileType == "gif" || fileType == "tiff" || fileType == "svg") && !bytes.Equal(stripped.Bytes(), data) {
+				t.Error("移除水印后的文件与原文件不一致")
+			}
+
+			var again bytes.Buffer
+			err = service.RemoveWatermarkStream(context.Background(), bytes.NewReader(stripped.Bytes()), int64(stripped.Len()), &again, fileType)
+			if !errors.Is(err, watermark.ErrNoWatermark) {
+				t.Errorf("没有水印时期望返回 ErrNoWatermark，实际为: %v", err)
+			}
+		})
+	}
+}
+
+func TestAddWatermarkPolicy(t *testing.T) {
+	service := NewWatermarkService()
+	fixtures := writeFixtures(t, t.TempDir())
+
+	// add 按指定策略为data添加水印
+	add := func(t *testing.T, policy Policy, data []byte, fileType, text string) ([]byte, error) {
+		t.Helper()
+		var output bytes.Buffer
+		err := service.WithPolicy(policy).AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &output, fileType, watermark.NewPayload(text))
+		return output.Bytes(), err
+	}
+	extract := func(t *testing.T, data []byte, fileType string) *watermark.Payload {
+		t.Helper()
+		payload, err := service.ExtractWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), fileType)
+		if err != nil {
+			t.Fatalf("提取水印失败: %v", err)
+		}
+		return payload
+	}
+
+	for fileType, path := range fixtures {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取测试文件失败: %v", err)
+			}
+
+			first, err := add(t, PolicyRefuse, data, fileType, "first")
+			if err != nil {
+				t.Fatalf("为没有水印的文件添加水印失败: %v", err)
+			}
+			if _, err := add(t, PolicyRefuse, first, fileType, "second"); !errors.Is(err, ErrAlreadyWatermarked) {
+				t.Errorf("期望返回 ErrAlreadyWatermarked，实际为: %v", err)
+			}
+
+			// 追加模式下提取结果包含完整的水印链
+			second, err := add(t, PolicyAppend, first, fileType, "second")
+			if err != nil {
+				t.Fatalf("追加水印失败: %v", err)
+			}
+			third, err := add(t, PolicyAppend, second, fileType, "third")
+			if err != nil {
+				t.Fatalf("追加水印失败: %v", err)
+			}
+			var texts []string
+			for _, entry := range extract(t, third, fileType).Chain() {
+				texts = append(texts, entry.Text)
+			}
+			if strings.Join(texts, ",") != "first,second,third" {
+				t.Errorf("水印链为 %v，期望 [first second third]", texts)
+			}
+
+			// 替换模式下只保留新水印，移除一次后文件中不再有水印
+			replaced, err := add(t, PolicyReplace, third, fileType, "replaced")
+			if err != nil {
+				t.Fatalf("替换水印失败: %v", err)
+			}
+			if payload := extract(t, replaced, fileType); payload.Text != "replaced" || len(payload.History) != 0 {
+				t.Errorf("替换后的水印为 %q，历史记录 %d 条", payload.Text, len(payload.History))
+			}
+			var stripped bytes.Buffer
+			if err := service.RemoveWatermarkStream(context.Background(), bytes.NewReader(replaced), int64(len(replaced)), &stripped, fileType); err != nil {
+				t.Fatalf("移除水印失败: %v", err)
+			}
+			if _, err := service.ExtractWatermarkStream(context.Background(), bytes.NewReader(stripped.Bytes()), int64(stripped.Len()), fileType); !errors.Is(err, watermark.ErrNoWatermark) {
+				t.Errorf("替换后文件中仍有其他水印: %v", err)
+			}
+		})
+	}
+}
+
+func TestDetectWatermark(t *testing.T) {
+	service := NewWatermarkService()
+	fixtures := writeFixtures(t, t.TempDir())
+
+	k1, _ := keys.GenerateKey()
+	k2, _ := keys.GenerateKey()
+	issuer, _ := keys.NewKeyring("k1", map[string][]byte{"k1": k1})
+	other, _ := keys.NewKeyring("k2", map[string][]byte{"k2": k2})
+	t.Cleanup(func() { watermark.SetKeyProvider(nil) })
+
+	for fileType, path := range fixtures {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取测试文件失败: %v", err)
+			}
+			detect := func(data []byte) *watermark.Detection {
+				t.Helper()
+				detection, err := service.DetectWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), fileType)
+				if err != nil {
+					t.Fatalf("检测水印失败: %v", err)
+				}
+				return detection
+			}
+
+			// 没有水印的文件
+			if d := detect(data); d.Present || d.Confidence != watermark.ConfidenceNone || len(d.Locations) != 0 {
+				t.Errorf("没有水印的文件检测结果为 %+v", d)
+			}
+
+			watermark.SetKeyProvider(issuer)
+			var marked bytes.Buffer
+			if err := service.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &marked, fileType, watermark.NewPayload("detect")); err != nil {
+				t.Fatalf("添加水印失败: %v", err)
+			}
+
+			d := detect(marked.Bytes())
+			if !d.Present || !d.Decrypted || !d.Verified || d.Confidence != watermark.ConfidenceAuthentic || len(d.Locations) == 0 {
+				t.Errorf("有水印的文件检测结果为 %+v", d)
+			}
+
+			// BMP只有像素水印，嵌入位置由密钥派生，使用其他密钥时无法发现
+			if fileType == "bmp" {
+				return
+			}
+
+			// 使用其他密钥时能发现水印，但无法读取
+			watermark.SetKeyProvider(other)
+			d = detect(marked.Bytes())
+			if !d.Present || d.Decrypted || d.Confidence != watermark.ConfidenceDamaged || d.Error == "" {
+				t.Errorf("使用其他密钥的检测结果为 %+v", d)
+			}
+		})
+	}
+}
+
+func TestAddVisibleWatermark(t *testing.T) {
+	fixtures := writeFixtures(t, t.TempDir())
+	opts := overlay.DefaultOptions()
+	service := NewWatermarkService().WithOverlay(&opts)
+
+	for fileType, path := range fixtures {
+		t.Run(fileType, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取测试文件失败: %v", err)
+			}
+			var output bytes.Buffer
+			payload := watermark.NewPayload("SAMPLE")
+			err = service.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &output, fileType, payload)
+
+			// 只有图片、SVG和PDF支持可见水印，可见水印文本默认使用隐水印文本
+			if fileType == "png" || fileType == "jpg" || fileType == "svg" || fileType == "pdf" {
+				if err != nil {
+					t.Fatalf("添加可见水印失败: %v", err)
+				}
+				if payload.Overlay != nil {
+					t.Error("调用方的载荷被修改")
+				}
+				if bytes.Equal(output.Bytes(), data) {
+					t.Error("输出与原文件相同")
+				}
+				return
+			}
+			if !errors.Is(err, watermark.ErrOverlayUnsupported) {
+				t.Errorf("期望返回 ErrOverlayUnsupported，实际为: %v", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedPDF(t *testing.T) {
+	// 使用RC4加密的PDF，用户密码为user，所有者密码为owner；文件中没有字符串且内容流为空，对象不需要加密
+	encrypt := "/Encrypt << /Filter /Standard /V 2 /R 3 /Length 128 /P -3904" +
+		" /O <0ba3835f88f90388e74e54584125ce142be0de24c6b0d37746e075b891756671>" +
+		" /U <7443054f26f45bb262048d46fc50eef200000000000000000000000000000000> >>" +
+		" /ID [<30313233343536373839616263646566> <30313233343536373839616263646566>]"
+	data := bytes.Replace(minimalPDF(), []byte("/Root 1 0 R"), []byte("/Root 1 0 R "+encrypt), 1)
+	ctx := context.Background()
+	service := NewWatermarkService()
+
+	add := func(service *WatermarkService) ([]byte, error) {
+		var output bytes.Buffer
+		err := service.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &output, "pdf", watermark.NewPayload("加密文档"))
+		return output.Bytes(), err
+	}
+	if _, err := add(service); !errors.Is(err, watermark.ErrPasswordRequired) {
+		t.Errorf("期望返回 ErrPasswordRequired，实际为: %v", err)
+	}
+	if _, err := add(service.WithPassword("wrong")); !errors.Is(err, watermark.ErrInvalidPassword) {
+		t.Errorf("期望返回 ErrInvalidPassword，实际为: %v", err)
+	}
+	marked, err := add(service.WithPassword("user"))
+	if err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+	if service.Password() != "" {
+		t.Error("WithPassword 修改了原服务")
+	}
+
+	if _, err := service.ExtractWatermarkStream(ctx, bytes.NewReader(marked), int64(len(marked)), "pdf"); !errors.Is(err, watermark.ErrPasswordRequired) {
+		t.Errorf("期望返回 ErrPasswordRequired，实际为: %v", err)
+	}
+	owner := service.WithPassword("owner")
+	payload, err := owner.ExtractWatermarkStream(ctx, bytes.NewReader(marked), int64(len(marked)), "pdf")
+	if err != nil || payload.Text != "加密文档" {
+		t.Fatalf("提取水印结果为 %v, %v", payload, err)
+	}
+	detection, err := owner.DetectWatermarkStream(ctx, bytes.NewReader(marked), int64(len(marked)), "pdf")
+	if err != nil || !detection.Decrypted {
+		t.Errorf("检测结果为 %+v, %v", detection, err)
+	}
+
+	// 拒绝策略下没有密码时返回需要密码，而不是文件已有水印
+	refuse := func(service *WatermarkService, input []byte) error {
+		return service.WithPolicy(PolicyRefuse).AddWatermarkStream(ctx, bytes.NewReader(input), int64(len(input)), &bytes.Buffer{}, "pdf", watermark.NewPayload("第二次"))
+	}
+	if err := refuse(service, data); !errors.Is(err, watermark.ErrPasswordRequired) {
+		t.Errorf("期望返回 ErrPasswordRequired，实际为: %v", err)
+	}
+	if err := refuse(service, marked); !errors.Is(err, watermark.ErrPasswordRequired) {
+		t.Errorf("期望返回 ErrPasswordRequired，实际为: %v", err)
+	}
+	if err := refuse(owner, marked); !errors.Is(err, ErrAlreadyWatermarked) {
+		t.Errorf("期望返回 ErrAlreadyWatermarked，实际为: %v", err)
+	}
+}
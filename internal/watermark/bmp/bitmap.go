@@ -0,0 +1,103 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+)
+
+// BMP文件头和信息头中的字段
+const (
+	fileHeaderSize = 14
+	infoHeaderSize = 40 // BITMAPINFOHEADER，更新的V4/V5信息头在其后追加字段
+	biRGB          = 0
+	biBitfields    = 3
+	maxDimension   = 1 << 15 // 宽高的上限，防止构造的文件占用过多内存
+)
+
+// bmpMagic BMP文件头标记
+var bmpMagic = []byte("BM")
+
+// bitmap 内存中的BMP文件，像素直接在文件数据中读写，文件头、调色板和色彩配置等都原样保留
+type bitmap struct {
+	data []byte
+	// pixels 像素数据在文件中的偏移
+	pixels    int
+	width     int
+	height    int
+	bottomUp  bool // 高度为正时按从下到上的顺序保存各行
+	pixelSize int  // 每个像素的字节数，3或4
+	stride    int  // 每行的字节数，按4字节对齐
+}
+
+// parseBitmap 解析BMP文件，只支持未压缩的24位和32位图片
+func parseBitmap(data []byte) (*bitmap, error) {
+	if len(data) < fileHeaderSize+infoHeaderSize || string(data[:2]) != string(bmpMagic) {
+		return nil, errors.New("不是有效的BMP文件")
+	}
+	headerSize := binary.LittleEndian.Uint32(data[14:])
+	if headerSize < infoHeaderSize {
+		return nil, errors.New("不支持OS/2格式的BMP文件")
+	}
+
+	width := int(int32(binary.LittleEndian.Uint32(data[18:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[22:])))
+	bitCount := int(binary.LittleEndian.Uint16(data[28:]))
+	compression := binary.LittleEndian.Uint32(data[30:])
+
+	b := &bitmap{data: data, pixels: int(binary.LittleEndian.Uint32(data[10:])), width: width, height: height, bottomUp: true}
+	if height < 0 {
+		b.height, b.bottomUp = -height, false
+	}
+	if b.width <= 0 || b.height <= 0 || b.width > maxDimension || b.height > maxDimension {
+		return nil, fmt.Errorf("BMP图片尺寸%d×%d无效", width, height)
+	}
+
+	switch {
+	case bitCount == 24 && compression == biRGB:
+	case bitCount == 32 && compression == biRGB:
+	case bitCount == 32 && compression == biBitfields:
+		// 位域掩码紧跟在BITMAPINFOHEADER之后，V4/V5信息头中的位置相同；只支持标准的BGR顺序
+		if len(data) < fileHeaderSize+infoHeaderSize+12 ||
+			binary.LittleEndian.Uint32(data[54:]) != 0x00FF0000 ||
+			binary.LittleEndian.Uint32(data[58:]) != 0x0000FF00 ||
+			binary.LittleEndian.Uint32(data[62:]) != 0x000000FF {
+			return nil, errors.New("不支持非标准位域的BMP图片")
+		}
+	default:
+		return nil, fmt.Errorf("不支持%d位或压缩的BMP图片，只支持未压缩的24位和32位图片", bitCount)
+	}
+	b.pixelSize = bitCount / 8
+	b.stride = (bitCount*b.width + 31) / 32 * 4
+
+	if uint64(b.pixels) < fileHeaderSize+uint64(headerSize) || b.pixels+b.stride*b.height > len(data) {
+		return nil, errors.New("BMP文件的像素数据不完整")
+	}
+	return b, nil
+}
+
+// offset 返回像素(x, y)某个通道在文件中的偏移，y从图像顶部开始计算，通道按文件中的B、G、R顺序
+func (b *bitmap) offset(x, y, channel int) int {
+	row := y
+	if b.bottomUp {
+		row = b.height - 1 - y
+	}
+	return b.pixels + row*b.stride + x*b.pixelSize + channel
+}
+
+// Bounds 返回图像的范围，实现 lsb.Pixels
+func (b *bitmap) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.width, b.height)
+}
+
+// Bit 读取像素(x, y)某个通道的最低位，通道按文件中的B、G、R顺序
+func (b *bitmap) Bit(x, y, channel int) byte {
+	return b.data[b.offset(x, y, channel)] & 1
+}
+
+// SetBit 设置像素(x, y)某个通道的最低位，直接修改文件数据
+func (b *bitmap) SetBit(x, y, channel int, bit byte) {
+	offset := b.offset(x, y, channel)
+	b.data[offset] = b.data[offset]&^1 | bit
+}
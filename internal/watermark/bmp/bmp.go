@@ -0,0 +1,145 @@
+// Package bmp 提供BMP图片的水印处理
+// BMP没有可以保存元数据的位置，水印嵌入在像素的最低位中
+package bmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
+	"watermark-tool/internal/watermark/lsb"
+)
+
+func init() {
+	watermark.RegisterStreamWatermarker(NewBMPWatermarker())
+}
+
+// pixelFormat BMP像素水印的帧头标记和位置序列标签，区块划分和帧格式与PNG像素水印相同
+var pixelFormat = lsb.Format{Magic: 0xB3C5, SeedLabel: []byte("watermark-bmp-lsb")}
+
+// BMPWatermarker 将水印嵌入BMP图片像素的最低位
+// 直接修改文件中的像素数据，文件头、信息头和行尾填充等其他数据保持不变
+type BMPWatermarker struct{}
+
+// NewBMPWatermarker 创建一个新的BMP水印处理器
+func NewBMPWatermarker() *BMPWatermarker {
+	return &BMPWatermarker{}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (w *BMPWatermarker) GetSupportedType() string {
+	return "bmp"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (w *BMPWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "在像素最低位中重复嵌入，裁剪后仍可提取", Locate: true, Robust: true}
+}
+
+// AddWatermarkStream 将水印信封嵌入BMP图片的像素
+func (w *BMPWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	b, err := readBitmap(ctx, src, size)
+	if err != nil {
+		return err
+	}
+
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
+	env, err := envelope.Dearmor(armored)
+	if err != nil {
+		return err
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := pixelFormat.Embed(b, watermark.GetKeyProvider().ActiveKeyID(), data); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.write(dst)
+}
+
+// ExtractWatermarkStream 从BMP图片的像素中提取水印
+func (w *BMPWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	b, err := readBitmap(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+	mark, err := pixelFormat.Find(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := envelope.Unmarshal(mark.Data)
+	if err != nil {
+		return nil, fmt.Errorf("解析像素水印失败: %w", err)
+	}
+	armored, err := env.Armor()
+	if err != nil {
+		return nil, err
+	}
+	return watermark.OpenPayload(armored)
+}
+
+// RemoveWatermarkStream 用随机数据覆盖像素水印所在的位
+// 原始像素的最低位无法恢复，移除后的图片与添加水印前不完全相同，但差异不可见
+func (w *BMPWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	b, err := readBitmap(ctx, src, size)
+	if err != nil {
+		return err
+	}
+	mark, err := pixelFormat.Find(ctx, b)
+	if err != nil {
+		return err
+	}
+	lsb.Erase(b, mark)
+	return b.write(dst)
+}
+
+// LocateWatermarks 返回包含像素水印的区块的左上角坐标，坐标从图像顶部开始计算
+func (w *BMPWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	b, err := readBitmap(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+	mark, err := pixelFormat.Find(ctx, b)
+	if errors.Is(err, watermark.ErrNoWatermark) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for _, origin := range lsb.Tiles(b, mark.OriginX, mark.OriginY) {
+		locations = append(locations, fmt.Sprintf("tile@%d,%d", origin.X, origin.Y))
+	}
+	return locations, nil
+}
+
+// readBitmap 读取并解析BMP文件，返回的像素数据是原文件的副本
+func readBitmap(ctx context.Context, src io.ReaderAt, size int64) (*bitmap, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	return parseBitmap(append([]byte(nil), data...))
+}
+
+// write 写出修改后的BMP文件
+func (b *bitmap) write(dst io.Writer) error {
+	if _, err := dst.Write(b.data); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package bmp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+// testBMP 生成BMP图片，height为负时按从上到下的顺序保存各行，像素颜色由pixel函数给出；
+// 行尾填充字节为0xEE，32位图片的保留字节为0
+func testBMP(width, height, bitCount int, pixel func(x, y int) [3]byte) []byte {
+	rows := max(height, -height)
+	stride := (bitCount*width + 31) / 32 * 4
+	output := make([]byte, 54, 54+stride*rows)
+	copy(output, bmpMagic)
+	binary.LittleEndian.PutUint32(output[2:], uint32(54+stride*rows))
+	binary.LittleEndian.PutUint32(output[10:], 54)
+	binary.LittleEndian.PutUint32(output[14:], infoHeaderSize)
+	binary.LittleEndian.PutUint32(output[18:], uint32(int32(width)))
+	binary.LittleEndian.PutUint32(output[22:], uint32(int32(height)))
+	binary.LittleEndian.PutUint16(output[26:], 1)
+	binary.LittleEndian.PutUint16(output[28:], uint16(bitCount))
+	binary.LittleEndian.PutUint32(output[34:], uint32(stride*rows))
+
+	for row := 0; row < rows; row++ {
+		y := row
+		if height > 0 {
+			y = rows - 1 - row
+		}
+		line := bytes.Repeat([]byte{0xEE}, stride)
+		for x := 0; x < width; x++ {
+			c := pixel(x, y)
+			copy(line[x*bitCount/8:], []byte{c[2], c[1], c[0]})
+			if bitCount == 32 {
+				line[x*4+3] = 0
+			}
+		}
+		output = append(output, line...)
+	}
+	return output
+}
+
+// gradient 测试图片的颜色
+func gradient(x, y int) [3]byte {
+	return [3]byte{byte(x * 255 / 300), byte(y * 255 / 200), byte((x + y) % 256)}
+}
+
+func TestBMPPixelWatermark(t *testing.T) {
+	ctx := context.Background()
+	w := NewBMPWatermarker()
+
+	tests := []struct {
+		name     string
+		height   int
+		bitCount int
+	}{
+		{"24位从下到上", 200, 24},
+		{"32位从上到下", -200, 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 宽度不是4的倍数，24位图片每行有填充字节
+			data := testBMP(301, tt.height, tt.bitCount, gradient)
+
+			var marked bytes.Buffer
+			if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("截图")); err != nil {
+				t.Fatalf("添加水印失败: %v", err)
+			}
+			if marked.Len() != len(data) || !bytes.Equal(marked.Bytes()[:54], data[:54]) {
+				t.Fatal("文件头或文件长度被修改")
+			}
+			// 只有B、G、R通道的最低位改变，行尾填充和32位图片的保留字节不变
+			b, _ := parseBitmap(data)
+			channels := make(map[int]bool)
+			for y := 0; y < b.height; y++ {
+				for x := 0; x < b.width; x++ {
+					for c := 0; c < 3; c++ {
+						channels[b.offset(x, y, c)] = true
+					}
+				}
+			}
+			for i := 54; i < len(data); i++ {
+				if got := marked.Bytes()[i]; got != data[i] && (!channels[i] || got&^1 != data[i]&^1) {
+					t.Fatalf("偏移%d处的字节从%#x变为%#x", i, data[i], got)
+				}
+			}
+
+			payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()))
+			if err != nil || payload.Text != "截图" {
+				t.Fatalf("提取水印结果为 %v, %v", payload, err)
+			}
+			if locations, err := w.LocateWatermarks(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len())); err != nil || len(locations) != 2 {
+				t.Errorf("水印位置为 %v, %v，期望两个区块", locations, err)
+			}
+
+			// 裁掉左边和底部后网格起点改变，保留了第二个完整区块，仍然可以提取
+			original, _ := parseBitmap(marked.Bytes())
+			cropped := testBMP(250, 150, 24, func(x, y int) [3]byte {
+				offset := original.offset(x+37, y, 0)
+				return [3]byte{marked.Bytes()[offset+2], marked.Bytes()[offset+1], marked.Bytes()[offset]}
+			})
+			payload, err = w.ExtractWatermarkStream(ctx, bytes.NewReader(cropped), int64(len(cropped)))
+			if err != nil || payload.Text != "截图" {
+				t.Fatalf("从裁剪后的图片提取水印结果为 %v, %v", payload, err)
+			}
+
+			var stripped bytes.Buffer
+			if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()), &stripped); err != nil {
+				t.Fatalf("移除水印失败: %v", err)
+			}
+			if _, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+				t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+			}
+		})
+	}
+}
+
+func TestBMPUnsupported(t *testing.T) {
+	ctx := context.Background()
+	w := NewBMPWatermarker()
+
+	small := testBMP(100, 100, 24, gradient)
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(small), int64(len(small)), &bytes.Buffer{}, watermark.NewPayload("截图")); err == nil {
+		t.Error("小于一个区块的图片应当返回错误")
+	}
+
+	indexed := testBMP(200, 200, 24, gradient)
+	binary.LittleEndian.PutUint16(indexed[28:], 8)
+	if _, err := parseBitmap(indexed); err == nil {
+		t.Error("8位图片应当返回错误")
+	}
+
+	truncated := testBMP(200, 200, 24, gradient)[:1000]
+	if _, err := parseBitmap(truncated); err == nil {
+		t.Error("不完整的文件应当返回错误")
+	}
+}
@@ -0,0 +1,135 @@
+package watermark
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+// 检测结果的置信度
+const (
+	ConfidenceNone       = 0.0 // 没有找到水印
+	ConfidenceDamaged    = 0.5 // 找到了水印标记，但无法解密或解析，可能已损坏或使用了其他密钥
+	ConfidenceForged     = 0.6 // 水印可以解析，但签名或MAC无效
+	ConfidenceUnverified = 0.9 // 水印可以解析且校验通过，但没有可信的签名
+	ConfidenceAuthentic  = 1.0 // 水印由记录的密钥签发且未被修改
+)
+
+// Detection 描述文档中水印的检测结果，用于批量扫描时区分没有水印的文件和水印已损坏的文件
+type Detection struct {
+	// Present 文档中是否有水印，包括无法读取的水印
+	Present bool `json:"present"`
+	// Locations 找到水印标记的嵌入位置，如ZIP中的文件名或标记在文件中的偏移
+	Locations []string `json:"locations,omitempty"`
+	// Decrypted 水印载荷是否已成功解密和解析
+	Decrypted bool `json:"decrypted"`
+	// Verified 水印的校验和、MAC或签名是否校验通过
+	Verified bool `json:"verified"`
+	// Confidence 文档中有有效水印的置信度，取值为0到1
+	Confidence float64 `json:"confidence"`
+	// Payload 解析出的水印载荷
+	Payload *Payload `json:"payload,omitempty"`
+	// Verification 水印的签名校验结果
+	Verification *Verification `json:"verification,omitempty"`
+	// Error 无法读取水印的原因
+	Error string `json:"error,omitempty"`
+}
+
+// WatermarkLocator 由能够报告水印嵌入位置的处理器实现
+type WatermarkLocator interface {
+	// LocateWatermarks 返回文档中找到水印标记的位置，不解密也不校验水印
+	LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error)
+}
+
+// Detect 检测文档中是否有水印，水印不存在或无法读取时不会返回错误，
+// 只有ctx被取消或超时时才返回错误
+func Detect(ctx context.Context, w StreamWatermarker, src io.ReaderAt, size int64) (*Detection, error) {
+	detection := &Detection{}
+
+	var locatorErr error
+	locator, hasLocator := w.(WatermarkLocator)
+	if hasLocator {
+		detection.Locations, locatorErr = locator.LocateWatermarks(ctx, src, size)
+		detection.Present = len(detection.Locations) > 0
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	payload, err := w.ExtractWatermarkStream(ctx, src, size)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	var sealed *SealedError
+	switch {
+	case err == nil:
+		detection.Present = true
+		detection.Decrypted = true
+		detection.Payload = payload
+		detection.Verification = payload.Verification
+		detection.Verified = !payload.Verification.Forged()
+		switch {
+		case payload.Verification.Authentic():
+			detection.Confidence = ConfidenceAuthentic
+		case payload.Verification.Forged():
+			detection.Confidence = ConfidenceForged
+		default:
+			detection.Confidence = ConfidenceUnverified
+		}
+	case errors.Is(err, ErrNoWatermark):
+		if detection.Present {
+			// 找到了标记但处理器无法识别其内容
+			detection.Confidence = ConfidenceDamaged
+			detection.Error = err.Error()
+		}
+	case errors.As(err, &sealed):
+		// 只有签名公钥，签名有效但无法解密载荷
+		detection.Present = true
+		detection.Verified = true
+		detection.Verification = sealed.Verification
+		detection.Confidence = ConfidenceAuthentic
+		detection.Error = err.Error()
+	case errors.Is(err, ErrForgedWatermark):
+		// 签名或MAC无效且载荷无法解密，水印存在但被篡改或伪造
+		detection.Present = true
+		detection.Verified = false
+		detection.Confidence = ConfidenceForged
+		detection.Verification = &Verification{Status: StatusForged}
+		detection.Error = err.Error()
+	default:
+		// 没有定位器的处理器无法区分文件损坏和水印损坏，都视为存在无法读取的水印
+		if !hasLocator || detection.Present {
+			detection.Present = true
+			detection.Confidence = ConfidenceDamaged
+		}
+		detection.Error = err.Error()
+	}
+
+	if detection.Error == "" && locatorErr != nil && !detection.Decrypted {
+		detection.Error = locatorErr.Error()
+	}
+
+	return detection, nil
+}
+
+// FindMarkers 返回data中所有以prefix开始、以suffix结束的文本标记的偏移
+func FindMarkers(data []byte, prefix, suffix string) []int64 {
+	var offsets []int64
+	for offset := 0; offset < len(data); {
+		start := bytes.Index(data[offset:], []byte(prefix))
+		if start < 0 {
+			break
+		}
+		start += offset
+		end := bytes.Index(data[start:], []byte(suffix))
+		if end < 0 {
+			break
+		}
+
+		offsets = append(offsets, int64(start))
+		offset = start + end + len(suffix)
+	}
+	return offsets
+}
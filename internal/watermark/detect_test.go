@@ -0,0 +1,31 @@
+package watermark
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// forgedWatermarker 提取时总是返回 ErrForgedWatermark，模拟签名无效且无法解密的水印
+type forgedWatermarker struct {
+	fakeWatermarker
+}
+
+func (f *forgedWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*Payload, error) {
+	return nil, ErrForgedWatermark
+}
+
+func TestDetectForged(t *testing.T) {
+	src := strings.NewReader("document")
+	d, err := Detect(context.Background(), &forgedWatermarker{}, src, src.Size())
+	if err != nil {
+		t.Fatalf("检测水印失败: %v", err)
+	}
+	if !d.Present || d.Decrypted || d.Verified || d.Confidence != ConfidenceForged {
+		t.Errorf("伪造水印的检测结果为 %+v", d)
+	}
+	if !d.Verification.Forged() || d.Error != ErrForgedWatermark.Error() {
+		t.Errorf("伪造水印的校验结果为 %+v, %q", d.Verification, d.Error)
+	}
+}
@@ -3,14 +3,14 @@ package docx
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
+	"regexp"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
 )
 
 // DOCXWatermarker 实现Word文档的水印处理
@@ -22,194 +22,128 @@ func init() {
 }
 
 // AddWatermark 为Word文档添加水印
-// 注意：由于文档格式的复杂性，这里使用一个简化的实现
-// 实际应用中可能需要更复杂的方法
 func (d *DOCXWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 创建临时目录
-	tempDir, err := os.MkdirTemp("", "docx-watermark-*")
-	if err != nil {
-		return fmt.Errorf("创建临时目录失败: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
+	return watermark.AddWatermarkFile(context.Background(), d, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
 
-	// 解压DOCX文件
-	err = unzipFile(inputFile, tempDir)
+// ExtractWatermark 从DOCX文档中提取水印
+func (d *DOCXWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), d, inputFile)
 	if err != nil {
-		return fmt.Errorf("解压DOCX文件失败: %w", err)
+		return "", "", err
 	}
+	return payload.Text, payload.Timestamp(), nil
+}
 
-	// 向文档添加水印
-	// 1. 修改document.xml，添加水印到页眉
-	documentPath := filepath.Join(tempDir, "word", "document.xml")
-	docContent, err := os.ReadFile(documentPath)
+// AddWatermarkStream 为Word文档数据流添加水印
+// 注意：由于文档格式的复杂性，这里使用一个简化的实现
+// 实际应用中可能需要更复杂的方法
+func (d *DOCXWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	// 水印载荷编码为Base64，避免破坏XML结构
+	encoded, err := encodeMarker(payload)
 	if err != nil {
-		return fmt.Errorf("读取document.xml失败: %w", err)
+		return err
 	}
 
-	// 存储水印信息到文档属性
-	// 查找文档属性位置
-	corePropsPath := filepath.Join(tempDir, "docProps", "core.xml")
-	if _, err := os.Stat(corePropsPath); err == nil {
-		coreContent, err := os.ReadFile(corePropsPath)
-		if err == nil {
-			// 在关键词部分添加水印信息
-			modified := false
-			if bytes.Contains(coreContent, []byte("<cp:keywords>")) {
-				newContent := bytes.Replace(
-					coreContent,
+	err = rewriteZip(ctx, src, size, dst, func(name string, content []byte) ([]byte, error) {
+		switch name {
+		case "docProps/core.xml":
+			// 存储水印信息到文档属性，在关键词部分添加水印信息
+			if bytes.Contains(content, []byte("<cp:keywords>")) {
+				return bytes.Replace(
+					content,
 					[]byte("<cp:keywords>"),
-					[]byte(fmt.Sprintf("<cp:keywords>Watermark:%s ", watermarkText)),
-					1,
-				)
-				if !bytes.Equal(newContent, coreContent) {
-					coreContent = newContent
-					modified = true
-				}
-			} else if bytes.Contains(coreContent, []byte("</cp:coreProperties>")) {
-				// 如果没有关键词标签，添加一个
-				newContent := bytes.Replace(
-					coreContent,
-					[]byte("</cp:coreProperties>"),
-					[]byte(fmt.Sprintf("<cp:keywords>Watermark:%s</cp:keywords></cp:coreProperties>", watermarkText)),
+					[]byte(fmt.Sprintf("<cp:keywords>%s%s ", markerPrefix, encoded)),
 					1,
-				)
-				if !bytes.Equal(newContent, coreContent) {
-					coreContent = newContent
-					modified = true
-				}
+				), nil
 			}
-
-			if modified {
-				err = os.WriteFile(corePropsPath, coreContent, 0644)
-				if err != nil {
-					return fmt.Errorf("写入core.xml失败: %w", err)
-				}
-			}
-		}
-	}
-
-	// 添加简单的水印标记到文档内容
-	// 注意：这是一个简化版本，只是在文档中添加一个不可见的标记
-	watermarkTag := fmt.Sprintf("<!-- Watermark: %s -->", watermarkText)
-	if bytes.Contains(docContent, []byte("<w:body>")) {
-		docContent = bytes.Replace(
-			docContent,
-			[]byte("<w:body>"),
-			[]byte(fmt.Sprintf("<w:body>%s", watermarkTag)),
-			1,
-		)
-		err = os.WriteFile(documentPath, docContent, 0644)
-		if err != nil {
-			return fmt.Errorf("写入document.xml失败: %w", err)
+			// 如果没有关键词标签，添加一个
+			return bytes.Replace(
+				content,
+				[]byte("</cp:coreProperties>"),
+				[]byte(fmt.Sprintf("<cp:keywords>%s%s</cp:keywords></cp:coreProperties>", markerPrefix, encoded)),
+				1,
+			), nil
+
+		case "word/document.xml":
+			// 添加简单的水印标记到文档内容
+			// 注意：这是一个简化版本，只是在文档中添加一个不可见的标记
+			watermarkTag := fmt.Sprintf("<!-- %s %s -->", markerPrefix, encoded)
+			return bytes.Replace(
+				content,
+				[]byte("<w:body>"),
+				[]byte(fmt.Sprintf("<w:body>%s", watermarkTag)),
+				1,
+			), nil
 		}
-	}
-
-	// 重新打包DOCX文件
-	err = zipDir(tempDir, outputFile)
+		return content, nil
+	})
 	if err != nil {
-		return fmt.Errorf("重新打包DOCX文件失败: %w", err)
+		return fmt.Errorf("处理DOCX文件失败: %w", err)
 	}
 
 	return nil
 }
 
-// ExtractWatermark 从DOCX文档中提取水印
-func (d *DOCXWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	// 创建临时目录
-	tempDir, err := os.MkdirTemp("", "docx-extract-*")
+// ExtractWatermarkStream 从DOCX文档数据流中提取水印
+func (d *DOCXWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
-		return "", "", fmt.Errorf("创建临时目录失败: %w", err)
+		return nil, fmt.Errorf("解压DOCX文件失败: %w", err)
 	}
-	defer os.RemoveAll(tempDir)
-
-	// 解压DOCX文件
-	err = unzipFile(inputFile, tempDir)
-	if err != nil {
-		return "", "", fmt.Errorf("解压DOCX文件失败: %w", err)
-	}
-
-	// 默认时间戳
-	timestamp := time.Now().Format(time.RFC3339)
 
 	// 首先检查文档属性
-	corePropsPath := filepath.Join(tempDir, "docProps", "core.xml")
-	if _, err := os.Stat(corePropsPath); err == nil {
-		coreContent, err := os.ReadFile(corePropsPath)
-		if err == nil {
-			// 查找时间戳信息
-			timeStampPrefix := "TimeStamp:"
-			if tsIdx := bytes.Index(coreContent, []byte(timeStampPrefix)); tsIdx > 0 {
-				tsStart := tsIdx + len(timeStampPrefix)
-				tsEnd := tsStart
-				for i := tsStart; i < len(coreContent) && i < tsStart+50; i++ {
-					if coreContent[i] == '<' || coreContent[i] == ' ' {
-						tsEnd = i
-						break
-					}
-				}
-				if tsEnd > tsStart {
-					timestamp = string(coreContent[tsStart:tsEnd])
-				}
-			}
-
-			// 查找水印信息
-			watermarkPrefix := "Watermark:"
-			if idx := bytes.Index(coreContent, []byte(watermarkPrefix)); idx > 0 {
-				start := idx + len(watermarkPrefix)
-				end := start
-				for i := start; i < len(coreContent) && i < start+100; i++ {
-					if coreContent[i] == '<' || coreContent[i] == ' ' {
-						end = i
-						break
-					}
-				}
-				if end > start {
-					return string(coreContent[start:end]), timestamp, nil
-				}
-			}
+	coreContent, err := readZipEntry(reader, "docProps/core.xml")
+	if err == nil {
+		if value, ok := findMarker(coreContent, []byte(markerPrefix), []byte("<"), []byte(" ")); ok {
+			return decodeMarker(value)
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// 如果在文档属性中没找到，查找文档内容
-	documentPath := filepath.Join(tempDir, "word", "document.xml")
-	docContent, err := os.ReadFile(documentPath)
+	docContent, err := readZipEntry(reader, "word/document.xml")
 	if err != nil {
-		return "", "", fmt.Errorf("读取document.xml失败: %w", err)
+		return nil, fmt.Errorf("读取document.xml失败: %w", err)
 	}
 
-	// 查找时间戳标记
-	timeStampTagPrefix := "<!-- TimeStamp: "
-	if tsIdx := bytes.Index(docContent, []byte(timeStampTagPrefix)); tsIdx > 0 {
-		tsStart := tsIdx + len(timeStampTagPrefix)
-		tsEnd := tsStart
-		for i := tsStart; i < len(docContent) && i < tsStart+50; i++ {
-			if docContent[i] == '-' && i+2 < len(docContent) && docContent[i+1] == '-' && docContent[i+2] == '>' {
-				tsEnd = i
-				break
-			}
-		}
-		if tsEnd > tsStart {
-			timestamp = string(docContent[tsStart:tsEnd])
-		}
+	// 查找水印标记
+	if value, ok := findMarker(docContent, []byte("<!-- "+markerPrefix+" "), []byte(" -->")); ok {
+		return decodeMarker(value)
 	}
 
-	// 查找水印标记
-	watermarkTagPrefix := "<!-- Watermark: "
-	if idx := bytes.Index(docContent, []byte(watermarkTagPrefix)); idx > 0 {
-		start := idx + len(watermarkTagPrefix)
-		end := start
-		for i := start; i < len(docContent) && i < start+100; i++ {
-			if docContent[i] == '-' && i+2 < len(docContent) && docContent[i+1] == '-' && docContent[i+2] == '>' {
-				end = i
-				break
-			}
-		}
-		if end > start {
-			return string(docContent[start:end]), timestamp, nil
+	return nil, watermark.ErrNoWatermark
+}
+
+// RemoveWatermark 移除Word文档中的水印
+func (d *DOCXWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), d, inputFile, outputFile)
+}
+
+// RemoveWatermarkStream 删除Word文档数据流中文档属性和文档内容里的水印标记
+func (d *DOCXWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	found := false
+	err := rewriteZip(ctx, src, size, dst, func(name string, content []byte) ([]byte, error) {
+		var removed bool
+		switch name {
+		case "docProps/core.xml":
+			content, removed = removeMarkers(content, keywordMarkerPattern)
+		case "word/document.xml":
+			content, removed = removeMarkers(content, commentMarkerPattern)
 		}
+		found = found || removed
+		return content, nil
+	})
+	if err != nil {
+		return fmt.Errorf("处理DOCX文件失败: %w", err)
+	}
+	if !found {
+		return watermark.ErrNoWatermark
 	}
 
-	return "", "", fmt.Errorf("未找到水印信息")
+	return nil
 }
 
 // GetSupportedType 返回支持的文件类型
@@ -217,104 +151,150 @@ func (d *DOCXWatermarker) GetSupportedType() string {
 	return "docx"
 }
 
-// unzipFile 解压文件到指定目录
-func unzipFile(zipFile, destDir string) error {
-	reader, err := zip.OpenReader(zipFile)
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
+// Capabilities 返回嵌入方式的能力
+func (d *DOCXWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入文档关键词和XML注释", Locate: true, Lossless: true}
+}
 
-	for _, file := range reader.File {
-		path := filepath.Join(destDir, file.Name)
+// 水印标记前缀
+const markerPrefix = "Watermark:"
 
-		// 创建目录
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, 0755)
-			continue
-		}
+// encodeMarker 将水印载荷封装为可以直接写入XML的信封
+func encodeMarker(payload *watermark.Payload) (string, error) {
+	return watermark.SealPayload(payload)
+}
 
-		// 确保父目录存在
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return err
+// decodeMarker 解析水印标记
+// 旧版本的标记是Base64编码的JSON载荷，或者是未编码的水印文本，都没有签名
+func decodeMarker(value string) (*watermark.Payload, error) {
+	if envelope.IsArmored(value) {
+		return watermark.OpenPayload(value)
+	}
+	if data, err := base64.StdEncoding.DecodeString(value); err == nil && len(data) > 0 && data[0] == '{' {
+		if payload, err := watermark.UnmarshalPayload(data); err == nil {
+			payload.Verification = &watermark.Verification{Status: watermark.StatusUnsigned}
+			return payload, nil
 		}
+	}
+	return &watermark.Payload{Text: value, Verification: &watermark.Verification{Status: watermark.StatusUnsigned}}, nil
+}
 
-		// 解压文件
-		fileReader, err := file.Open()
-		if err != nil {
-			return err
+// 水印标记的正则表达式，与 findMarker 查找的范围一致
+var (
+	// keywordMarkerPattern 匹配文档属性关键词中的水印标记及其后的分隔空格
+	keywordMarkerPattern = regexp.MustCompile(regexp.QuoteMeta(markerPrefix) + `[^<\s]+ ?`)
+	// commentMarkerPattern 匹配文档内容中的水印注释
+	commentMarkerPattern = regexp.MustCompile(`(?s)<!-- ` + regexp.QuoteMeta(markerPrefix) + ` .*? -->`)
+)
+
+// removeMarkers 删除content中匹配pattern的水印标记，返回删除后的内容和是否删除了标记
+func removeMarkers(content []byte, pattern *regexp.Regexp) ([]byte, bool) {
+	if !pattern.Match(content) {
+		return content, false
+	}
+	return pattern.ReplaceAllLiteral(content, nil), true
+}
+
+// findMarker 查找prefix之后、最近的一个terminator之前的内容
+func findMarker(content, prefix []byte, terminators ...[]byte) (string, bool) {
+	idx := bytes.Index(content, prefix)
+	if idx < 0 {
+		return "", false
+	}
+
+	start := idx + len(prefix)
+	end := -1
+	for _, terminator := range terminators {
+		if i := bytes.Index(content[start:], terminator); i >= 0 && (end < 0 || i < end) {
+			end = i
 		}
+	}
+	if end <= 0 {
+		return "", false
+	}
 
-		targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			fileReader.Close()
-			return err
+	return string(content[start : start+end]), true
+}
+
+// readZipEntry 读取ZIP中指定文件的全部内容
+func readZipEntry(reader *zip.Reader, name string) ([]byte, error) {
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
 		}
 
-		_, err = io.Copy(targetFile, fileReader)
-		targetFile.Close()
-		fileReader.Close()
+		rc, err := file.Open()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		defer rc.Close()
+
+		return io.ReadAll(rc)
 	}
 
-	return nil
+	return nil, fmt.Errorf("未找到文件: %s", name)
 }
 
-// zipDir 压缩目录为ZIP文件
-func zipDir(sourceDir, zipFile string) error {
-	// 创建ZIP文件
-	file, err := os.Create(zipFile)
+// rewriteZip 逐个复制ZIP中的文件到dst，modify可以替换文件内容
+// 每处理一个文件检查一次ctx
+func rewriteZip(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, modify func(name string, content []byte) ([]byte, error)) error {
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	writer := zip.NewWriter(file)
-	defer writer.Close()
 
-	// 遍历源目录
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	writer := zip.NewWriter(dst)
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		// 获取相对路径
-		relPath, err := filepath.Rel(sourceDir, path)
+		rc, err := file.Open()
 		if err != nil {
 			return err
 		}
-
-		// 跳过根目录本身
-		if relPath == "." {
-			return nil
-		}
-
-		// 使用标准的路径分隔符
-		relPath = strings.ReplaceAll(relPath, "\\", "/")
-
-		// 处理目录
-		if info.IsDir() {
-			_, err = writer.Create(relPath + "/")
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
 			return err
 		}
 
-		// 处理文件
-		fileToZip, err := os.Open(path)
+		content, err = modify(file.Name, content)
 		if err != nil {
 			return err
 		}
-		defer fileToZip.Close()
 
-		// 创建ZIP内的文件
-		zipEntry, err := writer.Create(relPath)
+		header := file.FileHeader
+		entry, err := writer.CreateHeader(&header)
 		if err != nil {
 			return err
 		}
+		if _, err := entry.Write(content); err != nil {
+			return err
+		}
+	}
 
-		// 复制文件内容
-		_, err = io.Copy(zipEntry, fileToZip)
-		return err
-	})
+	return writer.Close()
+}
+
+// LocateWatermarks 返回Word文档数据流中包含水印标记的文件
+func (d *DOCXWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	reader, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, fmt.Errorf("解压DOCX文件失败: %w", err)
+	}
+
+	var locations []string
+	for _, part := range []struct {
+		name    string
+		pattern *regexp.Regexp
+	}{
+		{"docProps/core.xml", keywordMarkerPattern},
+		{"word/document.xml", commentMarkerPattern},
+	} {
+		if content, err := readZipEntry(reader, part.name); err == nil && part.pattern.Match(content) {
+			locations = append(locations, part.name)
+		}
+	}
+	return locations, nil
 }
@@ -0,0 +1,322 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Magic 信封的起始标记
+const Magic = "WMKE"
+
+// 信封版本
+const (
+	Version1       uint8 = 1
+	CurrentVersion       = Version1
+)
+
+// 信封大小限制
+const (
+	MaxKeyIDLength = 255     // 密钥ID的最大字节数
+	MaxMACLength   = 255     // MAC的最大字节数
+	MaxPayloadSize = 1 << 20 // 载荷的最大字节数
+)
+
+// Flags 描述信封中载荷的处理方式
+type Flags uint8
+
+// 信封标志位
+const (
+	// FlagEncrypted 载荷已使用KeyID对应的密钥加密
+	FlagEncrypted Flags = 1 << iota
+	// FlagKeyedMAC MAC使用KeyID对应的密钥计算，未设置时为SHA-256摘要
+	FlagKeyedMAC
+	// FlagSigned MAC字段为KeyID对应密钥的Ed25519签名
+	FlagSigned
+)
+
+// MACFunc 使用密钥计算数据的MAC或签名
+type MACFunc func(data []byte) ([]byte, error)
+
+// VerifyFunc 校验数据的签名
+type VerifyFunc func(data, signature []byte) error
+
+// Has 判断是否设置了指定的标志位
+func (f Flags) Has(flag Flags) bool {
+	return f&flag == flag
+}
+
+// 定义信封相关的错误
+var (
+	ErrInvalidMagic       = errors.New("不是有效的水印信封")
+	ErrUnsupportedVersion = errors.New("不支持的水印信封版本")
+	ErrTruncated          = errors.New("水印信封数据不完整")
+	ErrMACMismatch        = errors.New("水印信封校验失败，数据可能被篡改")
+	ErrMissingMACKey      = errors.New("缺少校验水印信封的密钥")
+)
+
+// Envelope 所有格式共用的水印信封
+//
+// 二进制布局（多字节整数均为大端序）：
+//
+//	magic    4字节  "WMKE"
+//	version  1字节
+//	flags    1字节
+//	keyID    1字节长度 + 内容
+//	payload  4字节长度 + 内容
+//	mac      1字节长度 + 内容
+//
+// MAC覆盖从magic到payload的全部字节。
+// 处理器只负责把信封放到各自格式的容器中，解析逻辑全部在这里，
+// 以后的格式变化通过版本号区分，不会导致旧文件无法读取。
+type Envelope struct {
+	Version uint8
+	Flags   Flags
+	KeyID   string
+	Payload []byte
+	MAC     []byte
+}
+
+// New 创建当前版本的信封
+func New(payload []byte) *Envelope {
+	return &Envelope{
+		Version: CurrentVersion,
+		Payload: payload,
+	}
+}
+
+// AuthenticatedData 返回MAC覆盖的数据
+func (e *Envelope) AuthenticatedData() ([]byte, error) {
+	if len(e.KeyID) > MaxKeyIDLength {
+		return nil, fmt.Errorf("密钥ID过长: %d字节", len(e.KeyID))
+	}
+	if len(e.Payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("水印信封载荷过大: %d字节", len(e.Payload))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	buf.WriteByte(e.Version)
+	buf.WriteByte(byte(e.Flags))
+	buf.WriteByte(byte(len(e.KeyID)))
+	buf.WriteString(e.KeyID)
+	binary.Write(&buf, binary.BigEndian, uint32(len(e.Payload)))
+	buf.Write(e.Payload)
+
+	return buf.Bytes(), nil
+}
+
+// Seal 计算并设置信封的MAC
+// mac为nil时使用SHA-256摘要，只能发现数据损坏或误改，不能防止伪造
+func (e *Envelope) Seal(mac MACFunc) error {
+	e.Flags &^= FlagSigned
+	if mac != nil {
+		e.Flags |= FlagKeyedMAC
+	} else {
+		e.Flags &^= FlagKeyedMAC
+	}
+
+	sum, err := e.computeMAC(mac)
+	if err != nil {
+		return err
+	}
+	e.MAC = sum
+	return nil
+}
+
+// Sign 使用签名算法计算信封的校验值
+func (e *Envelope) Sign(sign MACFunc) error {
+	e.Flags = e.Flags&^FlagKeyedMAC | FlagSigned
+
+	data, err := e.AuthenticatedData()
+	if err != nil {
+		return err
+	}
+	signature, err := sign(data)
+	if err != nil {
+		return err
+	}
+	e.MAC = signature
+	return nil
+}
+
+// VerifySignature 校验信封的签名
+func (e *Envelope) VerifySignature(verify VerifyFunc) error {
+	if !e.Flags.Has(FlagSigned) {
+		return errors.New("水印信封未签名")
+	}
+
+	data, err := e.AuthenticatedData()
+	if err != nil {
+		return err
+	}
+	return verify(data, e.MAC)
+}
+
+// Verify 校验信封的MAC，设置了FlagKeyedMAC时必须提供mac
+// 签名的信封应使用 VerifySignature 校验
+func (e *Envelope) Verify(mac MACFunc) error {
+	if e.Flags.Has(FlagSigned) {
+		return errors.New("水印信封使用签名校验")
+	}
+	if !e.Flags.Has(FlagKeyedMAC) {
+		mac = nil
+	} else if mac == nil {
+		return ErrMissingMACKey
+	}
+
+	sum, err := e.computeMAC(mac)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(sum, e.MAC) != 1 {
+		return ErrMACMismatch
+	}
+	return nil
+}
+
+// computeMAC 计算MAC覆盖数据的MAC
+func (e *Envelope) computeMAC(mac MACFunc) ([]byte, error) {
+	data, err := e.AuthenticatedData()
+	if err != nil {
+		return nil, err
+	}
+	if mac != nil {
+		return mac(data)
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// Marshal 将信封编码为二进制数据
+func (e *Envelope) Marshal() ([]byte, error) {
+	if len(e.MAC) > MaxMACLength {
+		return nil, fmt.Errorf("MAC过长: %d字节", len(e.MAC))
+	}
+
+	data, err := e.AuthenticatedData()
+	if err != nil {
+		return nil, err
+	}
+
+	data = append(data, byte(len(e.MAC)))
+	return append(data, e.MAC...), nil
+}
+
+// Unmarshal 从二进制数据中解析信封
+func Unmarshal(data []byte) (*Envelope, error) {
+	if len(data) < len(Magic) || string(data[:len(Magic)]) != Magic {
+		return nil, ErrInvalidMagic
+	}
+
+	r := reader{data: data[len(Magic):]}
+	e := &Envelope{}
+
+	version, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 || version > CurrentVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	e.Version = version
+
+	flags, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	e.Flags = Flags(flags)
+
+	keyIDLength, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := r.next(int(keyIDLength))
+	if err != nil {
+		return nil, err
+	}
+	e.KeyID = string(keyID)
+
+	lengthBytes, err := r.next(4)
+	if err != nil {
+		return nil, err
+	}
+	payloadLength := binary.BigEndian.Uint32(lengthBytes)
+	if payloadLength > MaxPayloadSize {
+		return nil, fmt.Errorf("水印信封载荷过大: %d字节", payloadLength)
+	}
+	if e.Payload, err = r.next(int(payloadLength)); err != nil {
+		return nil, err
+	}
+
+	macLength, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if e.MAC, err = r.next(int(macLength)); err != nil {
+		return nil, err
+	}
+
+	if len(r.data) != 0 {
+		return nil, fmt.Errorf("水印信封末尾有多余的%d字节", len(r.data))
+	}
+
+	return e, nil
+}
+
+// Armor 将信封编码为可以直接写入文本格式的Base64字符串
+func (e *Envelope) Armor() (string, error) {
+	data, err := e.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Dearmor 解析Armor生成的字符串
+func Dearmor(s string) (*Envelope, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMagic, err)
+	}
+	return Unmarshal(data)
+}
+
+// IsArmored 判断字符串是否为Armor生成的信封，用于区分旧版本的水印格式
+func IsArmored(s string) bool {
+	// Magic为4字节，对应Base64的前8个字符（含2字节的版本和标志位）
+	if len(s) < 8 {
+		return false
+	}
+	prefix, err := base64.StdEncoding.DecodeString(s[:8])
+	if err != nil {
+		return false
+	}
+	return string(prefix[:len(Magic)]) == Magic
+}
+
+// reader 按顺序读取信封中的字段
+type reader struct {
+	data []byte
+}
+
+func (r *reader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *reader) next(n int) ([]byte, error) {
+	if n > len(r.data) {
+		return nil, ErrTruncated
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b, nil
+}
@@ -0,0 +1,124 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	env := New([]byte(`{"text":"机密文件"}`))
+	env.KeyID = "k1"
+	env.Flags |= FlagEncrypted
+	if err := env.Seal(nil); err != nil {
+		t.Fatalf("计算MAC失败: %v", err)
+	}
+
+	armored, err := env.Armor()
+	if err != nil {
+		t.Fatalf("编码信封失败: %v", err)
+	}
+	if !IsArmored(armored) {
+		t.Fatalf("IsArmored 未识别编码后的信封: %s", armored)
+	}
+
+	decoded, err := Dearmor(armored)
+	if err != nil {
+		t.Fatalf("解析信封失败: %v", err)
+	}
+	if err := decoded.Verify(nil); err != nil {
+		t.Fatalf("校验信封失败: %v", err)
+	}
+	if decoded.Version != CurrentVersion || decoded.KeyID != "k1" || !decoded.Flags.Has(FlagEncrypted) {
+		t.Errorf("信封头部不一致: %+v", decoded)
+	}
+	if !bytes.Equal(decoded.Payload, env.Payload) {
+		t.Errorf("载荷为 %q，期望 %q", decoded.Payload, env.Payload)
+	}
+}
+
+func TestEnvelopeRejectsInvalidData(t *testing.T) {
+	env := New([]byte("payload"))
+	if err := env.Seal(nil); err != nil {
+		t.Fatalf("计算MAC失败: %v", err)
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		t.Fatalf("编码信封失败: %v", err)
+	}
+
+	// 篡改载荷
+	tampered := bytes.Clone(data)
+	tampered[len(Magic)+7] ^= 0xFF
+	decoded, err := Unmarshal(tampered)
+	if err != nil {
+		t.Fatalf("解析信封失败: %v", err)
+	}
+	if err := decoded.Verify(nil); !errors.Is(err, ErrMACMismatch) {
+		t.Errorf("期望返回 ErrMACMismatch，实际为: %v", err)
+	}
+
+	// 未知版本
+	future := bytes.Clone(data)
+	future[len(Magic)] = CurrentVersion + 1
+	if _, err := Unmarshal(future); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("期望返回 ErrUnsupportedVersion，实际为: %v", err)
+	}
+
+	// 数据不完整
+	if _, err := Unmarshal(data[:len(data)-1]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("期望返回 ErrTruncated，实际为: %v", err)
+	}
+
+	// 旧版本水印
+	if IsArmored("eyJ0ZXh0Ijoi5py65a+GIn0=") {
+		t.Error("旧版本的Base64 JSON不应被识别为信封")
+	}
+	if _, err := Dearmor("not base64!"); !errors.Is(err, ErrInvalidMagic) {
+		t.Errorf("期望返回 ErrInvalidMagic，实际为: %v", err)
+	}
+}
+
+func TestEnvelopeSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("生成签名密钥失败: %v", err)
+	}
+	verify := func(data, signature []byte) error {
+		if !ed25519.Verify(publicKey, data, signature) {
+			return ErrMACMismatch
+		}
+		return nil
+	}
+
+	env := New([]byte("payload"))
+	env.KeyID = "k1"
+	if err := env.Sign(func(data []byte) ([]byte, error) { return ed25519.Sign(privateKey, data), nil }); err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		t.Fatalf("编码信封失败: %v", err)
+	}
+
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("解析信封失败: %v", err)
+	}
+	if !decoded.Flags.Has(FlagSigned) || decoded.Flags.Has(FlagKeyedMAC) {
+		t.Errorf("签名信封的标志不正确: %08b", decoded.Flags)
+	}
+	if err := decoded.VerifySignature(verify); err != nil {
+		t.Errorf("校验签名失败: %v", err)
+	}
+	if err := decoded.Verify(nil); err == nil {
+		t.Error("签名信封不应通过摘要校验")
+	}
+
+	// 修改密钥ID后签名失效
+	decoded.KeyID = "k2"
+	if err := decoded.VerifySignature(verify); !errors.Is(err, ErrMACMismatch) {
+		t.Errorf("期望返回 ErrMACMismatch，实际为: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package gif
+
+import (
+	"bytes"
+	"errors"
+)
+
+// GIF文件头
+var (
+	gif87a = []byte("GIF87a")
+	gif89a = []byte("GIF89a")
+)
+
+// 块的引导字节和扩展块标签
+const (
+	introducerExtension = 0x21
+	introducerImage     = 0x2C
+	gifTrailer          = 0x3B
+
+	labelGraphicControl = 0xF9
+	labelComment        = 0xFE
+	labelApplication    = 0xFF
+)
+
+// block GIF文件头之后的一个块
+type block struct {
+	// Introducer 引导字节，扩展块为0x21，图像为0x2C
+	Introducer byte
+	// Label 扩展块的标签，图像块为0
+	Label byte
+	// Offset 块在文件中的偏移
+	Offset int
+	// Raw 块的原始字节，包括引导字节和结尾的空子块
+	Raw []byte
+	// DataOffset 图像块中LZW最小码长所在的偏移，相对于块的开头，其他块为0
+	DataOffset int
+}
+
+// parseBlocks 按顺序解析文件头、逻辑屏幕描述符和全局颜色表之后的所有块，直到结束标记，
+// 返回文件头部分的长度、各个块和结束标记之后的数据（不包括结束标记）
+func parseBlocks(data []byte) (int, []block, []byte, error) {
+	if !bytes.HasPrefix(data, gif87a) && !bytes.HasPrefix(data, gif89a) {
+		return 0, nil, nil, errors.New("不是有效的GIF文件")
+	}
+	if len(data) < 13 {
+		return 0, nil, nil, errors.New("GIF文件头不完整")
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+	if pos > len(data) {
+		return 0, nil, nil, errors.New("GIF全局颜色表不完整")
+	}
+	headerLength := pos
+
+	var blocks []block
+	for {
+		if pos >= len(data) {
+			return 0, nil, nil, errors.New("GIF文件缺少结束标记")
+		}
+		start := pos
+		b := block{Introducer: data[pos], Offset: pos}
+		switch data[pos] {
+		case gifTrailer:
+			return headerLength, blocks, data[pos+1:], nil
+		case introducerExtension:
+			if pos+2 > len(data) {
+				return 0, nil, nil, errors.New("GIF扩展块不完整")
+			}
+			b.Label = data[pos+1]
+			pos += 2
+		case introducerImage:
+			if pos+10 > len(data) {
+				return 0, nil, nil, errors.New("GIF图像描述符不完整")
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			b.DataOffset = pos - start
+			// LZW最小码长
+			pos++
+		default:
+			return 0, nil, nil, errors.New("GIF文件中有无法识别的块")
+		}
+
+		end, err := skipSubBlocks(data, pos)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		b.Raw = data[start:end]
+		blocks = append(blocks, b)
+		pos = end
+	}
+}
+
+// skipSubBlocks 跳过从pos开始的数据子块序列，返回结尾的空子块之后的偏移
+func skipSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errors.New("GIF数据子块不完整")
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+// subBlockData 连接数据子块的内容
+func subBlockData(data []byte) []byte {
+	var output []byte
+	for pos := 0; pos < len(data) && data[pos] != 0; pos += 1 + int(data[pos]) {
+		end := min(pos+1+int(data[pos]), len(data))
+		output = append(output, data[pos+1:end]...)
+	}
+	return output
+}
+
+// appendSubBlocks 将数据拆分为最多255字节的子块追加到dst，并以空子块结尾
+func appendSubBlocks(dst, data []byte) []byte {
+	for len(data) > 0 {
+		n := min(len(data), 255)
+		dst = append(dst, byte(n))
+		dst = append(dst, data[:n]...)
+		data = data[n:]
+	}
+	return append(dst, 0)
+}
@@ -0,0 +1,168 @@
+// Package gif 提供GIF图片（包括动画GIF）的水印处理
+package gif
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"watermark-tool/internal/watermark"
+)
+
+// pixelPriority 像素水印的优先级，低于元数据水印，需要时通过嵌入方式"pixel"指定
+const pixelPriority = -10
+
+func init() {
+	watermark.RegisterStreamWatermarker(NewGIFWatermarker())
+	watermark.RegisterStrategy(watermark.Strategy{Method: "pixel", Priority: pixelPriority, Watermarker: NewPixelWatermarker()})
+}
+
+// applicationID 保存水印信封的应用扩展块的应用标识和验证码
+var applicationID = []byte("WATERMRK1.0")
+
+// GIFWatermarker 提供对GIF图片的水印操作
+type GIFWatermarker struct{}
+
+// NewGIFWatermarker 创建一个新的GIF水印处理器
+func NewGIFWatermarker() *GIFWatermarker {
+	return &GIFWatermarker{}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (w *GIFWatermarker) GetSupportedType() string {
+	return "gif"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (w *GIFWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入应用扩展块", Locate: true, Lossless: true}
+}
+
+// AddWatermarkStream 添加水印到GIF数据流
+// 水印信封保存在第一帧之前的应用扩展块中，循环次数等已有的扩展块保持在前面，
+// 其他块原样复制，帧延迟、处置方式和循环次数都不会改变；GIF87a文件的版本号改为GIF89a
+func (w *GIFWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	headerLength, blocks, trailer, err := parseBlocks(data)
+	if err != nil {
+		return err
+	}
+
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
+	extension := encodeApplication([]byte(armored))
+
+	output := make([]byte, 0, len(data)+len(extension))
+	output = append(output, data[:headerLength]...)
+	copy(output, gif89a)
+	inserted := false
+	for _, b := range blocks {
+		if !inserted && (b.Introducer == introducerImage || b.Label == labelGraphicControl) {
+			output = append(output, extension...)
+			inserted = true
+		}
+		output = append(output, b.Raw...)
+	}
+	if !inserted {
+		output = append(output, extension...)
+	}
+	output = append(output, gifTrailer)
+	output = append(output, trailer...)
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// ExtractWatermarkStream 从GIF数据流的应用扩展块中提取水印
+func (w *GIFWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	_, blocks, _, err := parseBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range blocks {
+		if isWatermarkBlock(b) {
+			return watermark.OpenPayload(string(subBlockData(b.Raw[3+len(applicationID):])))
+		}
+	}
+	return nil, watermark.ErrNoWatermark
+}
+
+// RemoveWatermarkStream 删除GIF数据流中的水印扩展块，其他数据原样保留
+func (w *GIFWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	headerLength, blocks, trailer, err := parseBlocks(data)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	output := make([]byte, 0, len(data))
+	output = append(output, data[:headerLength]...)
+	for _, b := range blocks {
+		if isWatermarkBlock(b) {
+			count++
+			continue
+		}
+		output = append(output, b.Raw...)
+	}
+	if count == 0 {
+		return watermark.ErrNoWatermark
+	}
+	output = append(output, gifTrailer)
+	output = append(output, trailer...)
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// LocateWatermarks 返回GIF数据流中水印扩展块的偏移
+func (w *GIFWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	_, blocks, _, err := parseBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for _, b := range blocks {
+		if isWatermarkBlock(b) {
+			locations = append(locations, fmt.Sprintf("APP@%d", b.Offset))
+		}
+	}
+	return locations, nil
+}
+
+// isWatermarkBlock 判断块是否为保存水印信封的应用扩展块
+func isWatermarkBlock(b block) bool {
+	return b.Introducer == introducerExtension && b.Label == labelApplication &&
+		len(b.Raw) > 3+len(applicationID) && int(b.Raw[2]) == len(applicationID) &&
+		bytes.Equal(b.Raw[3:3+len(applicationID)], applicationID)
+}
+
+// encodeApplication 编码保存数据的应用扩展块
+func encodeApplication(data []byte) []byte {
+	output := []byte{introducerExtension, labelApplication, byte(len(applicationID))}
+	output = append(output, applicationID...)
+	return appendSubBlocks(output, data)
+}
@@ -0,0 +1,159 @@
+package gif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+// testGIF 生成三帧的动画GIF：两帧覆盖整个画布，中间一帧只更新局部，
+// 每帧的延迟和处置方式不同，循环3次，第一帧之前有一个注释扩展块
+func testGIF(t *testing.T) []byte {
+	palette := color.Palette{color.RGBA{}}
+	for i := 1; i < 64; i++ {
+		palette = append(palette, color.RGBA{R: uint8(i * 4), G: uint8(255 - i*4), B: uint8(i * 16), A: 255})
+	}
+	frame := func(bounds image.Rectangle, shift int) *image.Paletted {
+		img := image.NewPaletted(bounds, palette)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				img.SetColorIndex(x, y, uint8(1+(x/5+y/7+shift)%63))
+			}
+		}
+		// 左上角透明
+		img.SetColorIndex(bounds.Min.X, bounds.Min.Y, 0)
+		return img
+	}
+
+	canvas := image.Rect(0, 0, 160, 120)
+	animation := &gif.GIF{
+		Image:     []*image.Paletted{frame(canvas, 0), frame(image.Rect(20, 20, 60, 50), 3), frame(canvas, 9)},
+		Delay:     []int{10, 25, 40},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious},
+		LoopCount: 3,
+	}
+	var buffer bytes.Buffer
+	if err := gif.EncodeAll(&buffer, animation); err != nil {
+		t.Fatalf("编码测试图片失败: %v", err)
+	}
+
+	headerLength, blocks, _, err := parseBlocks(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("解析测试图片失败: %v", err)
+	}
+	output := append([]byte(nil), buffer.Bytes()[:headerLength]...)
+	for i, b := range blocks {
+		if i > 0 && b.Label == labelGraphicControl && blocks[i-1].Label == labelApplication {
+			output = appendSubBlocks(append(output, introducerExtension, labelComment), []byte("recorded by screen tool"))
+		}
+		output = append(output, b.Raw...)
+	}
+	return append(output, gifTrailer)
+}
+
+// checkAnimation 检查帧延迟、处置方式和循环次数与原图相同
+func checkAnimation(t *testing.T, original, marked []byte) *gif.GIF {
+	t.Helper()
+	want, _ := gif.DecodeAll(bytes.NewReader(original))
+	got, err := gif.DecodeAll(bytes.NewReader(marked))
+	if err != nil {
+		t.Fatalf("解码带水印的图片失败: %v", err)
+	}
+	if len(got.Image) != len(want.Image) || got.LoopCount != want.LoopCount {
+		t.Fatalf("帧数为%d、循环次数为%d，期望%d、%d", len(got.Image), got.LoopCount, len(want.Image), want.LoopCount)
+	}
+	for i := range want.Image {
+		if got.Delay[i] != want.Delay[i] || got.Disposal[i] != want.Disposal[i] || got.Image[i].Bounds() != want.Image[i].Bounds() {
+			t.Errorf("第%d帧的延迟、处置方式或范围改变", i+1)
+		}
+	}
+	return got
+}
+
+func TestGIFApplicationExtension(t *testing.T) {
+	ctx := context.Background()
+	w := NewGIFWatermarker()
+	data := testGIF(t)
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("录屏")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+	checkAnimation(t, data, marked.Bytes())
+
+	// 水印扩展块插入在循环次数和注释扩展块之后、第一帧之前，其他数据原样保留
+	_, blocks, _, err := parseBlocks(marked.Bytes())
+	if err != nil {
+		t.Fatalf("解析带水印的图片失败: %v", err)
+	}
+	if !isWatermarkBlock(blocks[2]) || blocks[0].Label != labelApplication || blocks[1].Label != labelComment {
+		t.Error("水印扩展块的位置不正确")
+	}
+	if !bytes.Equal(bytes.Replace(marked.Bytes(), blocks[2].Raw, nil, 1), data) {
+		t.Error("去掉水印扩展块后与原文件不一致")
+	}
+
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()))
+	if err != nil || payload.Text != "录屏" {
+		t.Errorf("提取水印结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if !bytes.Equal(stripped.Bytes(), data) {
+		t.Error("移除水印后的文件与原文件不一致")
+	}
+}
+
+func TestGIFPixelWatermark(t *testing.T) {
+	ctx := context.Background()
+	w := NewPixelWatermarker()
+	data := testGIF(t)
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("录屏")); err != nil {
+		t.Fatalf("添加像素水印失败: %v", err)
+	}
+	decoded := checkAnimation(t, data, marked.Bytes())
+
+	// 注释扩展块保留，局部帧和透明像素不变
+	if !bytes.Contains(marked.Bytes(), []byte("recorded by screen tool")) {
+		t.Error("注释扩展块丢失")
+	}
+	original, _ := gif.DecodeAll(bytes.NewReader(data))
+	if !bytes.Equal(decoded.Image[1].Pix, original.Image[1].Pix) {
+		t.Error("局部帧的像素被修改")
+	}
+	if decoded.Image[0].ColorIndexAt(0, 0) != 0 {
+		t.Error("透明像素被修改")
+	}
+	if locations, err := w.LocateWatermarks(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len())); err != nil || len(locations) != 2 {
+		t.Errorf("水印位置为 %v, %v，期望两个完整帧", locations, err)
+	}
+
+	// 用标准库重新编码，扩展块全部丢失，只保留第一帧后仍可提取
+	var resaved bytes.Buffer
+	if err := gif.Encode(&resaved, decoded.Image[0], nil); err != nil {
+		t.Fatalf("重新编码图片失败: %v", err)
+	}
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(resaved.Bytes()), int64(resaved.Len()))
+	if err != nil || payload.Text != "录屏" {
+		t.Fatalf("从重新编码的图片提取水印结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()), &stripped); err != nil {
+		t.Fatalf("移除像素水印失败: %v", err)
+	}
+	if _, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+}
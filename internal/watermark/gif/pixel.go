@@ -0,0 +1,497 @@
+package gif
+
+import (
+	"bytes"
+	"compress/lzw"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math/rand/v2"
+	"sort"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
+)
+
+// 像素水印的参数
+// 每个像素按其颜色在调色板中的亮度排名的奇偶性表示一位，嵌入时把像素换成颜色最接近、奇偶性相反的调色板颜色。
+// 水印重复嵌入在每个覆盖整个画布的帧中，帧内使用的像素由密钥派生的伪随机序列决定
+const (
+	headerBits       = 32     // 帧头：16位标记 + 16位数据长度
+	headerCopies     = 8      // 帧头在每帧中的重复次数
+	frameMagic       = 0x5AC3 // 帧头标记
+	minPaletteColors = 16     // 调色板中不透明颜色少于该数量的帧不嵌入，避免颜色变化明显
+)
+
+// pixelSeedLabel 派生像素位置序列时使用的标签
+var pixelSeedLabel = []byte("watermark-gif-palette")
+
+// PixelWatermarker 将水印嵌入GIF各帧像素的调色板索引
+// 水印不依赖扩展块，清除元数据或被其他工具去掉扩展块后仍然可以提取
+type PixelWatermarker struct{}
+
+// NewPixelWatermarker 创建一个新的GIF像素水印处理器
+func NewPixelWatermarker() *PixelWatermarker {
+	return &PixelWatermarker{}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (w *PixelWatermarker) GetSupportedType() string {
+	return "gif"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (w *PixelWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "在完整帧的调色板索引中重复嵌入，清除扩展块后仍可提取", Locate: true, Robust: true}
+}
+
+// animation 解码后的GIF和各帧所在的块
+type animation struct {
+	data         []byte
+	headerLength int
+	blocks       []block
+	trailer      []byte
+	// frames 覆盖整个画布、调色板颜色足够多的帧
+	frames []*frame
+}
+
+// frame 可以嵌入像素水印的帧
+type frame struct {
+	// index 帧的序号，从0开始
+	index int
+	// block 帧的图像块在 animation.blocks 中的下标
+	block int
+	img   *image.Paletted
+	// parity 各调色板颜色表示的位，透明色为-1
+	parity []int
+	// nearest 与各调色板颜色最接近、奇偶性相反的颜色
+	nearest []uint8
+	// modified 帧的像素是否被修改，修改后需要重新编码图像块
+	modified bool
+}
+
+// pixelMark GIF中找到的像素水印
+type pixelMark struct {
+	layout []int
+	frames []*frame
+	data   []byte
+}
+
+// AddWatermarkStream 将水印信封嵌入GIF各完整帧的像素
+// 只重新编码被修改的图像块，扩展块、帧延迟、处置方式、循环次数和调色板都保持不变
+func (w *PixelWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	anim, err := decodeAnimation(ctx, src, size)
+	if err != nil {
+		return err
+	}
+
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
+	env, err := envelope.Dearmor(armored)
+	if err != nil {
+		return err
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0xFFFF {
+		return errors.New("水印载荷过大")
+	}
+
+	layout, err := frameLayout(watermark.GetKeyProvider().ActiveKeyID(), anim.canvasPixels())
+	if err != nil {
+		return err
+	}
+
+	header := binary.BigEndian.AppendUint16(nil, frameMagic)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(data)))
+	body := binary.BigEndian.AppendUint32(append([]byte(nil), data...), crc32.ChecksumIEEE(data))
+	embedded := 0
+	for _, f := range anim.frames {
+		slots := f.slots(layout)
+		copies := frameCopies(len(slots), len(data))
+		if copies < 1 {
+			continue
+		}
+		for i := 0; i < headerCopies; i++ {
+			slots = f.writeBits(slots, header)
+		}
+		for ; copies > 0; copies-- {
+			slots = f.writeBits(slots, body)
+		}
+		embedded++
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if embedded == 0 {
+		return errors.New("GIF中没有足够大的完整帧，无法嵌入像素水印")
+	}
+
+	return anim.encode(dst)
+}
+
+// ExtractWatermarkStream 从GIF的帧像素中提取水印
+func (w *PixelWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	anim, err := decodeAnimation(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+	mark, err := anim.findMark(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := envelope.Unmarshal(mark.data)
+	if err != nil {
+		return nil, fmt.Errorf("解析像素水印失败: %w", err)
+	}
+	armored, err := env.Armor()
+	if err != nil {
+		return nil, err
+	}
+	return watermark.OpenPayload(armored)
+}
+
+// RemoveWatermarkStream 用随机数据覆盖像素水印所在的位
+// 原来的调色板索引无法恢复，移除后的图片与添加水印前不完全相同，但差异不明显
+func (w *PixelWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	anim, err := decodeAnimation(ctx, src, size)
+	if err != nil {
+		return err
+	}
+	mark, err := anim.findMark(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range mark.frames {
+		slots := f.slots(mark.layout)
+		used := headerBits*headerCopies + frameCopies(len(slots), len(mark.data))*frameBits(len(mark.data))
+		// 帧头和数据都按字节嵌入，used是8的倍数
+		noise := make([]byte, used/8)
+		for i := range noise {
+			noise[i] = byte(rand.IntN(256))
+		}
+		f.writeBits(slots, noise)
+	}
+	return anim.encode(dst)
+}
+
+// LocateWatermarks 返回包含像素水印的帧
+func (w *PixelWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	anim, err := decodeAnimation(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+	mark, err := anim.findMark(ctx)
+	if errors.Is(err, watermark.ErrNoWatermark) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for _, f := range mark.frames {
+		locations = append(locations, fmt.Sprintf("frame@%d", f.index))
+	}
+	return locations, nil
+}
+
+// decodeAnimation 解码GIF的所有帧，找出可以嵌入像素水印的完整帧
+func decodeAnimation(ctx context.Context, src io.ReaderAt, size int64) (*animation, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	headerLength, blocks, trailer, err := parseBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	anim := &animation{data: data, headerLength: headerLength, blocks: blocks, trailer: trailer}
+	canvas := image.Rect(0, 0, decoded.Config.Width, decoded.Config.Height)
+	index := 0
+	for i, b := range blocks {
+		if b.Introducer != introducerImage {
+			continue
+		}
+		if index >= len(decoded.Image) {
+			break
+		}
+		img := decoded.Image[index]
+		if img.Bounds() == canvas && !canvas.Empty() {
+			if parity, nearest, ok := paletteParity(img.Palette); ok {
+				anim.frames = append(anim.frames, &frame{index: index, block: i, img: img, parity: parity, nearest: nearest})
+			}
+		}
+		index++
+	}
+	return anim, nil
+}
+
+// canvasPixels 返回画布的像素数
+func (a *animation) canvasPixels() int {
+	if len(a.frames) == 0 {
+		return 0
+	}
+	return len(a.frames[0].img.Pix)
+}
+
+// findMark 依次使用各密钥的位置序列在各完整帧中查找像素水印，返回包含同一水印的所有帧
+func (a *animation) findMark(ctx context.Context) (*pixelMark, error) {
+	if len(a.frames) == 0 {
+		return nil, watermark.ErrNoWatermark
+	}
+
+	provider := watermark.GetKeyProvider()
+	keyIDs := append([]string{provider.ActiveKeyID()}, provider.KeyIDs()...)
+	tried := make(map[string]bool)
+	for _, keyID := range keyIDs {
+		if tried[keyID] {
+			continue
+		}
+		tried[keyID] = true
+
+		layout, err := frameLayout(keyID, a.canvasPixels())
+		if err != nil {
+			return nil, err
+		}
+		var mark *pixelMark
+		for _, f := range a.frames {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			data, ok := f.readFrame(layout)
+			if !ok {
+				continue
+			}
+			if mark == nil {
+				mark = &pixelMark{layout: layout, data: data}
+			}
+			if bytes.Equal(data, mark.data) {
+				mark.frames = append(mark.frames, f)
+			}
+		}
+		if mark != nil {
+			return mark, nil
+		}
+	}
+	return nil, watermark.ErrNoWatermark
+}
+
+// encode 写出GIF，被修改的帧重新编码图像数据，其他块原样复制
+func (a *animation) encode(dst io.Writer) error {
+	modified := make(map[int]*frame)
+	for _, f := range a.frames {
+		if f.modified {
+			modified[f.block] = f
+		}
+	}
+
+	output := make([]byte, 0, len(a.data))
+	output = append(output, a.data[:a.headerLength]...)
+	for i, b := range a.blocks {
+		f, ok := modified[i]
+		if !ok {
+			output = append(output, b.Raw...)
+			continue
+		}
+		encoded, err := encodeImageBlock(b, f.img)
+		if err != nil {
+			return err
+		}
+		output = append(output, encoded...)
+	}
+	output = append(output, gifTrailer)
+	output = append(output, a.trailer...)
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// encodeImageBlock 按原图像块的描述符和颜色表重新编码帧的像素，不再使用交错
+func encodeImageBlock(b block, img *image.Paletted) ([]byte, error) {
+	output := append([]byte(nil), b.Raw[:b.DataOffset]...)
+	output[9] &^= 0x40
+	litWidth := int(b.Raw[b.DataOffset])
+	if litWidth < 2 || litWidth > 8 {
+		return nil, fmt.Errorf("GIF图像块的LZW码长%d无效", litWidth)
+	}
+	output = append(output, byte(litWidth))
+
+	var compressed bytes.Buffer
+	writer := lzw.NewWriter(&compressed, lzw.LSB, litWidth)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		offset := img.PixOffset(bounds.Min.X, y)
+		if _, err := writer.Write(img.Pix[offset : offset+bounds.Dx()]); err != nil {
+			return nil, fmt.Errorf("编码图片失败: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("编码图片失败: %w", err)
+	}
+	return appendSubBlocks(output, compressed.Bytes()), nil
+}
+
+// paletteParity 按亮度对调色板中的不透明颜色排序，排名的奇偶性为颜色表示的位，
+// 同时为每种颜色找出最接近的、奇偶性相反的颜色；不透明颜色太少时返回false
+func paletteParity(palette color.Palette) ([]int, []uint8, bool) {
+	var opaque []int
+	for i, c := range palette {
+		if _, _, _, a := c.RGBA(); a != 0 {
+			opaque = append(opaque, i)
+		}
+	}
+	if len(opaque) < minPaletteColors {
+		return nil, nil, false
+	}
+
+	rgb := func(i int) [3]int {
+		r, g, b, _ := palette[i].RGBA()
+		return [3]int{int(r >> 8), int(g >> 8), int(b >> 8)}
+	}
+	// 排名只取决于颜色本身，调色板被重新排列后仍然相同
+	sort.SliceStable(opaque, func(i, j int) bool {
+		a, b := rgb(opaque[i]), rgb(opaque[j])
+		la, lb := 299*a[0]+587*a[1]+114*a[2], 299*b[0]+587*b[1]+114*b[2]
+		if la != lb {
+			return la < lb
+		}
+		for k := 0; k < 3; k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	parity := make([]int, len(palette))
+	for i := range parity {
+		parity[i] = -1
+	}
+	for rank, i := range opaque {
+		parity[i] = rank & 1
+	}
+
+	nearest := make([]uint8, len(palette))
+	for _, i := range opaque {
+		best, bestDistance := i, -1
+		a := rgb(i)
+		for _, j := range opaque {
+			if parity[j] == parity[i] {
+				continue
+			}
+			b := rgb(j)
+			distance := (a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2])
+			if bestDistance < 0 || distance < bestDistance {
+				best, bestDistance = j, distance
+			}
+		}
+		nearest[i] = uint8(best)
+	}
+	return parity, nearest, true
+}
+
+// frameLayout 返回画布内像素的嵌入顺序，序列由密钥的MAC派生
+func frameLayout(keyID string, pixels int) ([]int, error) {
+	seed, err := watermark.GetKeyProvider().MAC(keyID, pixelSeedLabel)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) < 32 {
+		return nil, errors.New("密钥MAC长度不足")
+	}
+	return rand.New(rand.NewChaCha8([32]byte(seed[:32]))).Perm(pixels), nil
+}
+
+// frameBits 返回数据和CRC占用的位数
+func frameBits(length int) int {
+	return (length + crc32.Size) * 8
+}
+
+// frameCopies 返回数据在一帧中的重复次数
+func frameCopies(slots, length int) int {
+	return (slots - headerBits*headerCopies) / frameBits(length)
+}
+
+// slots 按位置序列返回帧中不透明的像素，透明像素在嵌入前后不变，因此两边得到的序列相同
+func (f *frame) slots(layout []int) []int {
+	slots := make([]int, 0, len(layout))
+	for _, pixel := range layout {
+		if f.parity[f.img.Pix[pixel]] >= 0 {
+			slots = append(slots, pixel)
+		}
+	}
+	return slots
+}
+
+// writeBits 按位写入数据，返回剩余的位置
+func (f *frame) writeBits(slots []int, data []byte) []int {
+	for i := 0; i < len(data)*8; i++ {
+		pixel := slots[i]
+		index := f.img.Pix[pixel]
+		if f.parity[index] != int(data[i/8]>>(7-i%8)&1) {
+			f.img.Pix[pixel] = f.nearest[index]
+			f.modified = true
+		}
+	}
+	return slots[len(data)*8:]
+}
+
+// readBits 读取多份重复的数据，每一位按多数表决
+func (f *frame) readBits(slots []int, length, copies int) []byte {
+	bits := length * 8
+	data := make([]byte, length)
+	for i := 0; i < bits; i++ {
+		ones := 0
+		for k := 0; k < copies; k++ {
+			ones += f.parity[f.img.Pix[slots[k*bits+i]]]
+		}
+		if ones*2 > copies {
+			data[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return data
+}
+
+// readFrame 读取帧中的水印，帧头标记或CRC不匹配时返回false
+func (f *frame) readFrame(layout []int) ([]byte, bool) {
+	slots := f.slots(layout)
+	if len(slots) < headerBits*headerCopies {
+		return nil, false
+	}
+	header := f.readBits(slots, headerBits/8, headerCopies)
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	copies := frameCopies(len(slots), length)
+	if binary.BigEndian.Uint16(header) != frameMagic || copies < 1 {
+		return nil, false
+	}
+
+	body := f.readBits(slots[headerBits*headerCopies:], length+crc32.Size, copies)
+	data := body[:length]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(body[length:]) {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,423 @@
+package jpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/rand/v2"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// DCT水印的参数
+// 水印嵌入亮度通道每个8×8块的几个中频DCT系数，使用量化索引调制（QIM）：
+// 系数被量化到步长为 qimStep 的两组格点之一，格点组表示0或1，提取时判断系数离哪组格点更近，不需要原图。
+// 重新压缩引入的系数误差小于 qimStep/4 时不会改变结果，再加上多份重复和多数表决，
+// 质量不低于75左右的重新压缩后仍然可以提取
+const (
+	qimStep       = 24.0 // 量化步长
+	headerBits    = 32   // 帧头：16位标记 + 16位数据长度
+	headerCopies  = 16   // 帧头的重复次数
+	frameMagic    = 0x5A3C
+	encodeQuality = 95 // 嵌入后重新编码使用的质量
+)
+
+// dctCoefficients 嵌入水印的中频系数在8×8块中的位置(u, v)
+// 这些位置在标准亮度量化表中的步长较小，压缩时损失较少，修改后也不容易被察觉
+var dctCoefficients = [][2]int{{0, 2}, {2, 0}, {1, 2}, {2, 1}}
+
+// dctSeedLabel 派生系数顺序时使用的标签
+var dctSeedLabel = []byte("watermark-jpeg-dct")
+
+// dctBasis 8×8正交DCT的基函数，dctBasis[i][y*8+x] 为第i个系数在(x, y)处的值
+var dctBasis = func() [][64]float64 {
+	basis := make([][64]float64, len(dctCoefficients))
+	for i, c := range dctCoefficients {
+		u, v := c[0], c[1]
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				basis[i][y*8+x] = dctScale(u) * dctScale(v) *
+					math.Cos(float64(2*x+1)*float64(u)*math.Pi/16) *
+					math.Cos(float64(2*y+1)*float64(v)*math.Pi/16)
+			}
+		}
+	}
+	return basis
+}()
+
+// dctScale 正交DCT的归一化系数
+func dctScale(k int) float64 {
+	if k == 0 {
+		return math.Sqrt(1.0 / 8)
+	}
+	return 0.5
+}
+
+// DCTWatermarker 将水印嵌入JPG图片的DCT系数
+// 水印随图像内容保存，元数据被清除或图片被重新压缩后仍然可以提取，但裁剪和缩放会破坏水印
+type DCTWatermarker struct{}
+
+// NewDCTWatermarker 创建一个新的JPG DCT水印处理器
+func NewDCTWatermarker() *DCTWatermarker {
+	return &DCTWatermarker{}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (w *DCTWatermarker) GetSupportedType() string {
+	return "jpg"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (w *DCTWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "用QIM嵌入亮度中频DCT系数，重新压缩后仍可提取", Robust: true, Visible: true}
+}
+
+// lumaPlane 图像的亮度通道
+type lumaPlane struct {
+	pix    []uint8
+	stride int
+	width  int
+	height int
+}
+
+// block 返回第i个8×8块左上角像素的下标
+func (l *lumaPlane) block(i int) int {
+	blocksX := l.width / 8
+	return (i/blocksX)*8*l.stride + (i%blocksX)*8
+}
+
+// blocks 返回完整的8×8块数
+func (l *lumaPlane) blocks() int {
+	return (l.width / 8) * (l.height / 8)
+}
+
+// coefficient 计算第i个块的第k个嵌入系数
+func (l *lumaPlane) coefficient(i, k int) float64 {
+	origin := l.block(i)
+	sum := 0.0
+	for y := 0; y < 8; y++ {
+		row := l.pix[origin+y*l.stride:]
+		for x := 0; x < 8; x++ {
+			sum += (float64(row[x]) - 128) * dctBasis[k][y*8+x]
+		}
+	}
+	return sum
+}
+
+// setCoefficient 将第i个块的第k个嵌入系数修改为value，其他系数不变
+func (l *lumaPlane) setCoefficient(i, k int, value float64) {
+	delta := value - l.coefficient(i, k)
+	origin := l.block(i)
+	for y := 0; y < 8; y++ {
+		row := l.pix[origin+y*l.stride:]
+		for x := 0; x < 8; x++ {
+			p := float64(row[x]) + delta*dctBasis[k][y*8+x]
+			row[x] = uint8(math.Max(0, math.Min(255, math.Round(p))))
+		}
+	}
+}
+
+// dctMark 图像中找到的DCT水印
+type dctMark struct {
+	layout []int
+	data   []byte
+}
+
+// AddWatermarkStream 将水印信封嵌入JPG图片的DCT系数并重新编码
+func (w *DCTWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	img, err := decodeLuma(ctx, src, size)
+	if err != nil {
+		return err
+	}
+	// 先绘制可见水印，再把隐水印嵌入绘制后的图像
+	if opts, ok := payload.OverlayOptions(); ok {
+		if img, err = img.withOverlay(opts); err != nil {
+			return err
+		}
+	}
+	luma := img.luma
+
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
+	env, err := envelope.Dearmor(armored)
+	if err != nil {
+		return err
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		return err
+	}
+
+	slots := luma.blocks() * len(dctCoefficients)
+	if len(data) > 0xFFFF || frameCopies(slots, len(data)) < 1 {
+		return fmt.Errorf("图片尺寸太小，无法嵌入%d字节的DCT水印", len(data))
+	}
+
+	layout, err := coefficientLayout(watermark.GetKeyProvider().ActiveKeyID(), slots)
+	if err != nil {
+		return err
+	}
+
+	header := binary.BigEndian.AppendUint16(nil, frameMagic)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(data)))
+	body := binary.BigEndian.AppendUint32(append([]byte(nil), data...), crc32.ChecksumIEEE(data))
+
+	next := layout
+	for i := 0; i < headerCopies; i++ {
+		next = embedBits(luma, next, header)
+	}
+	for i := frameCopies(slots, len(data)); i > 0; i-- {
+		next = embedBits(luma, next, body)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return img.encode(dst)
+}
+
+// ExtractWatermarkStream 从JPG图片的DCT系数中提取水印，不需要原图
+func (w *DCTWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	img, err := decodeLuma(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+
+	mark, err := findDCTMark(ctx, img.luma)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := envelope.Unmarshal(mark.data)
+	if err != nil {
+		return nil, fmt.Errorf("解析DCT水印失败: %w", err)
+	}
+	armored, err := env.Armor()
+	if err != nil {
+		return nil, err
+	}
+	return watermark.OpenPayload(armored)
+}
+
+// RemoveWatermarkStream 用随机数据覆盖DCT水印所在的系数并重新编码
+func (w *DCTWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	img, err := decodeLuma(ctx, src, size)
+	if err != nil {
+		return err
+	}
+
+	mark, err := findDCTMark(ctx, img.luma)
+	if err != nil {
+		return err
+	}
+
+	noise := make([]byte, len(mark.layout)/8)
+	for i := range noise {
+		noise[i] = byte(rand.IntN(256))
+	}
+	embedBits(img.luma, mark.layout, noise)
+
+	return img.encode(dst)
+}
+
+// dctImage 解码后的JPG图片
+type dctImage struct {
+	image.Image
+	// luma 可以直接修改的亮度通道，修改后编码时生效
+	luma *lumaPlane
+	// original 原文件数据，用于保留元数据段
+	original []byte
+	// cmyk 原图是否为CMYK图片，转换为YCbCr后原来的ICC配置文件不再适用
+	cmyk bool
+}
+
+// decodeLuma 解码JPG图片，返回可以直接修改亮度通道的图像
+// 彩色图片解码后为YCbCr，灰度图片为Gray，其他颜色模型转换为YCbCr
+func decodeLuma(ctx context.Context, src io.ReaderAt, size int64) (*dctImage, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, cmyk := img.(*image.CMYK)
+	return newDCTImage(img, data, cmyk), nil
+}
+
+// newDCTImage 返回可以直接修改亮度通道的图像，YCbCr和Gray图像直接使用，其他图像转换为YCbCr
+func newDCTImage(img image.Image, original []byte, cmyk bool) *dctImage {
+	bounds := img.Bounds()
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return &dctImage{Image: m, luma: &lumaPlane{pix: m.Y, stride: m.YStride, width: bounds.Dx(), height: bounds.Dy()}, original: original, cmyk: cmyk}
+	case *image.Gray:
+		return &dctImage{Image: m, luma: &lumaPlane{pix: m.Pix, stride: m.Stride, width: bounds.Dx(), height: bounds.Dy()}, original: original, cmyk: cmyk}
+	}
+
+	converted := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio444)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.YCbCrModel.Convert(img.At(x, y)).(color.YCbCr)
+			converted.Y[converted.YOffset(x, y)] = c.Y
+			converted.Cb[converted.COffset(x, y)] = c.Cb
+			converted.Cr[converted.COffset(x, y)] = c.Cr
+		}
+	}
+	luma := &lumaPlane{pix: converted.Y, stride: converted.YStride, width: bounds.Dx(), height: bounds.Dy()}
+	return &dctImage{Image: converted, luma: luma, original: original, cmyk: cmyk}
+}
+
+// withOverlay 返回绘制了可见水印的图像，亮度通道从绘制后的图像重新取得
+func (d *dctImage) withOverlay(opts overlay.Options) (*dctImage, error) {
+	rendered, err := applyOverlay(d.Image, opts, d.original)
+	if err != nil {
+		return nil, err
+	}
+	return newDCTImage(rendered, d.original, d.cmyk), nil
+}
+
+// encode 重新编码图片，并保留原文件中的EXIF、ICC配置文件、XMP和注释等元数据段
+func (d *dctImage) encode(dst io.Writer) error {
+	output, err := encodeJPEG(d.Image, d.original, d.cmyk)
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入JPEG数据失败: %w", err)
+	}
+	return nil
+}
+
+// encodeJPEG 以 encodeQuality 重新编码图片，并插入原文件中需要保留的元数据段
+func encodeJPEG(img image.Image, original []byte, cmyk bool) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: encodeQuality}); err != nil {
+		return nil, fmt.Errorf("编码图片失败: %w", err)
+	}
+
+	// 编码器输出的SOI之后没有APP段，元数据段紧跟SOI插入
+	return spliceSegments(buffer.Bytes(), 2, preservedSegments(original, !cmyk)), nil
+}
+
+// coefficientLayout 返回各位的嵌入系数顺序，顺序由密钥的MAC派生，使每一位的多份副本分散在整幅图像中
+func coefficientLayout(keyID string, slots int) ([]int, error) {
+	seed, err := watermark.GetKeyProvider().MAC(keyID, dctSeedLabel)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) < 32 {
+		return nil, errors.New("密钥MAC长度不足")
+	}
+	return rand.New(rand.NewChaCha8([32]byte(seed[:32]))).Perm(slots), nil
+}
+
+// frameCopies 返回数据和CRC的重复次数
+func frameCopies(slots, length int) int {
+	return (slots - headerBits*headerCopies) / ((length + crc32.Size) * 8)
+}
+
+// embedBits 按位将数据嵌入系数，返回剩余的系数位置
+func embedBits(luma *lumaPlane, slots []int, data []byte) []int {
+	for i := 0; i < len(data)*8; i++ {
+		slot := slots[i]
+		block, k := slot/len(dctCoefficients), slot%len(dctCoefficients)
+		bit := data[i/8] >> (7 - i%8) & 1
+		luma.setCoefficient(block, k, quantize(luma.coefficient(block, k), bit))
+	}
+	return slots[len(data)*8:]
+}
+
+// quantize 将系数量化到表示bit的格点，0对应 qimStep 的整数倍，1对应偏移半个步长的格点
+func quantize(value float64, bit byte) float64 {
+	offset := float64(bit) * qimStep / 2
+	return math.Round((value-offset)/qimStep)*qimStep + offset
+}
+
+// detectBit 判断系数离哪组格点更近
+func detectBit(value float64) byte {
+	if math.Abs(value-quantize(value, 0)) <= math.Abs(value-quantize(value, 1)) {
+		return 0
+	}
+	return 1
+}
+
+// findDCTMark 依次使用各密钥的系数顺序查找DCT水印
+func findDCTMark(ctx context.Context, luma *lumaPlane) (*dctMark, error) {
+	slots := luma.blocks() * len(dctCoefficients)
+	if slots < headerBits*headerCopies {
+		return nil, watermark.ErrNoWatermark
+	}
+
+	// 所有系数只计算一次，不同密钥只是读取顺序不同
+	bits := make([]byte, slots)
+	for i := range bits {
+		bits[i] = detectBit(luma.coefficient(i/len(dctCoefficients), i%len(dctCoefficients)))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	provider := watermark.GetKeyProvider()
+	tried := make(map[string]bool)
+	for _, keyID := range append([]string{provider.ActiveKeyID()}, provider.KeyIDs()...) {
+		if tried[keyID] {
+			continue
+		}
+		tried[keyID] = true
+
+		layout, err := coefficientLayout(keyID, slots)
+		if err != nil {
+			return nil, err
+		}
+
+		header := voteBits(bits, layout, 0, headerBits/8, headerCopies)
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		if binary.BigEndian.Uint16(header) != frameMagic || frameCopies(slots, length) < 1 {
+			continue
+		}
+
+		body := voteBits(bits, layout, headerBits*headerCopies, length+crc32.Size, frameCopies(slots, length))
+		data := body[:length]
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(body[length:]) {
+			continue
+		}
+		return &dctMark{layout: layout, data: data}, nil
+	}
+
+	return nil, watermark.ErrNoWatermark
+}
+
+// voteBits 读取多份重复的数据，每一位按多数表决
+func voteBits(bits []byte, layout []int, start, length, copies int) []byte {
+	n := length * 8
+	data := make([]byte, length)
+	for i := 0; i < n; i++ {
+		ones := 0
+		for k := 0; k < copies; k++ {
+			ones += int(bits[layout[start+k*n+i]])
+		}
+		if ones*2 > copies {
+			data[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return data
+}
@@ -2,10 +2,8 @@ package jpg
 
 import (
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
+	"context"
 	"crypto/md5"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -14,15 +12,20 @@ import (
 	"image"
 	"image/jpeg"
 	"io"
-	"os"
-	"strings"
-	"time"
+	"strconv"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
+	"watermark-tool/internal/watermark/overlay"
+	"watermark-tool/internal/watermark/xmp"
 )
 
+// dctPriority DCT水印的优先级，低于元数据水印，需要时通过嵌入方式"dct"指定
+const dctPriority = -10
+
 func init() {
 	watermark.RegisterWatermarker(NewJPGWatermarker())
+	watermark.RegisterStrategy(watermark.Strategy{Method: "dct", Priority: dctPriority, Watermarker: NewDCTWatermarker()})
 }
 
 // JPGWatermarker 提供对JPG图片的水印操作
@@ -38,6 +41,14 @@ func (w *JPGWatermarker) GetSupportedType() string {
 	return "jpg"
 }
 
+// Capabilities 返回嵌入方式的能力
+func (w *JPGWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入COM注释段和XMP元数据", Locate: true, Lossless: true, Visible: true}
+}
+
+// commentPrefix 水印注释段内容的前缀
+const commentPrefix = "WATERMARK:"
+
 // WatermarkMetadata 存储水印元数据
 type WatermarkMetadata struct {
 	Timestamp int64  `json:"timestamp"`
@@ -47,88 +58,49 @@ type WatermarkMetadata struct {
 
 // AddWatermark 添加水印到JPG图片
 func (w *JPGWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("输入文件不存在: %s", inputFile)
-	}
+	return watermark.AddWatermarkFile(context.Background(), w, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
 
-	// 打开JPG文件
-	file, err := os.Open(inputFile)
+// ExtractWatermark 从JPG图片中提取水印
+func (w *JPGWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), w, inputFile)
 	if err != nil {
-		return fmt.Errorf("打开图片文件失败: %w", err)
+		return "", "", err
 	}
-	defer file.Close()
+	return payload.Text, payload.Timestamp(), nil
+}
 
-	// 读取整个文件内容
-	jpegData, err := io.ReadAll(file)
+// AddWatermarkStream 添加水印到JPG数据流
+// 水印注释段直接插入原始数据，并合并到APP1段的XMP数据包中，
+// 图像数据和EXIF、ICC等元数据段原样保留，不会重新编码；只有绘制可见水印时才重新编码图像
+func (w *JPGWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	// 读取全部图片数据
+	jpegData, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
 		return fmt.Errorf("读取图片文件失败: %w", err)
 	}
 
-	// 检查是否为JPEG文件
-	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != 0xD8 {
-		return errors.New("无效的JPEG文件格式")
-	}
-
-	// 解码JPG图片以验证其有效性
-	_, err = file.Seek(0, 0) // 重置文件指针到开始
-	if err != nil {
-		return fmt.Errorf("重置文件指针失败: %w", err)
-	}
-
-	img, _, err := image.Decode(file)
-	if err != nil {
-		return fmt.Errorf("解码图片失败: %w", err)
-	}
-
-	// 加密水印文本
-	encryptedText, err := encryptWatermark(watermarkText)
-	if err != nil {
-		return fmt.Errorf("加密水印失败: %w", err)
-	}
-
-	// 准备水印元数据
-	metadata := WatermarkMetadata{
-		Timestamp: time.Now().Unix(),
-		Checksum:  generateChecksum(watermarkText),
-		Content:   encryptedText,
-	}
-
-	// 将元数据序列化为JSON
-	metadataJSON, err := json.Marshal(metadata)
-	if err != nil {
-		return fmt.Errorf("序列化水印元数据失败: %w", err)
+	// 需要可见水印时绘制后重新编码，元数据段保留
+	if opts, ok := payload.OverlayOptions(); ok {
+		if jpegData, err = renderOverlay(jpegData, opts); err != nil {
+			return err
+		}
 	}
 
-	// 将元数据编码为Base64
-	metadataBase64 := base64.StdEncoding.EncodeToString(metadataJSON)
-
-	// 注释内容前缀
-	prefix := "WATERMARK:"
-	commentContent := prefix + metadataBase64
-
-	// 创建一个新的JPEG图像，保留原始图像的质量
-	var outputBuffer bytes.Buffer
-	err = jpeg.Encode(&outputBuffer, img, &jpeg.Options{Quality: 95})
+	// 检查JPEG文件的标记段结构
+	segments, err := readSegments(jpegData)
 	if err != nil {
-		return fmt.Errorf("编码图片失败: %w", err)
+		return err
 	}
 
-	// 获取新编码的JPEG数据
-	newJpegData := outputBuffer.Bytes()
-
-	// 创建输出文件
-	output, err := os.Create(outputFile)
+	// 将水印载荷加密并封装为信封
+	armored, err := watermark.SealPayload(payload)
 	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %w", err)
+		return err
 	}
-	defer output.Close()
 
-	// 写入JPEG文件头 (FF D8)
-	_, err = output.Write(newJpegData[:2])
-	if err != nil {
-		return fmt.Errorf("写入JPEG头部失败: %w", err)
-	}
+	// 注释内容
+	commentContent := commentPrefix + armored
 
 	// 构建注释段
 	// JPEG注释段以标记FF FE开始，然后是2字节长度（包括长度字段本身）
@@ -139,227 +111,212 @@ func (w *JPGWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 		return fmt.Errorf("水印数据太长，无法添加到JPEG注释中")
 	}
 
-	// 写入注释标记和长度
-	commentHeader := []byte{0xFF, 0xFE, byte(commentLength >> 8), byte(commentLength & 0xFF)}
-	_, err = output.Write(commentHeader)
-	if err != nil {
-		return fmt.Errorf("写入注释头部失败: %w", err)
-	}
+	comment := []byte{0xFF, markerCOM, byte(commentLength >> 8), byte(commentLength & 0xFF)}
+	comment = append(comment, commentContent...)
 
-	// 写入注释内容
-	_, err = output.Write([]byte(commentContent))
+	// 注释段插入到文件开头的APP段之后
+	output := spliceSegments(jpegData, insertionPoint(segments), [][]byte{comment})
+
+	// 同时写入XMP数据包，供读取XMP的图片管理软件识别
+	output, err = mergeXMP(output, watermark.XMPProperties(payload, armored))
 	if err != nil {
-		return fmt.Errorf("写入注释内容失败: %w", err)
+		return err
 	}
 
-	// 写入剩余的JPEG数据（跳过原始的FF D8头部）
-	_, err = output.Write(newJpegData[2:])
-	if err != nil {
+	if _, err := dst.Write(output); err != nil {
 		return fmt.Errorf("写入JPEG数据失败: %w", err)
 	}
 
 	return nil
 }
 
-// ExtractWatermark 从JPG图片中提取水印
-func (w *JPGWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("输入文件不存在: %s", inputFile)
+// renderOverlay 在JPG图片上绘制可见水印并重新编码，保留原文件的元数据段
+func renderOverlay(jpegData []byte, opts overlay.Options) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(jpegData))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+	rendered, err := applyOverlay(img, opts, jpegData)
+	if err != nil {
+		return nil, err
 	}
+	_, cmyk := img.(*image.CMYK)
+	return encodeJPEG(rendered, jpegData, cmyk)
+}
+
+// applyOverlay 返回绘制了可见水印的图片副本
+// 图片先按EXIF方向旋转到显示时的方向再绘制，使显示时水印的角度和标志的位置与参数一致，镜像的方向不调整
+func applyOverlay(img image.Image, opts overlay.Options, jpegData []byte) (*image.NRGBA, error) {
+	var turns int
+	switch exifOrientation(jpegData) {
+	case 3:
+		turns = 2
+	case 6:
+		// 显示时顺时针旋转90度
+		turns = 1
+	case 8:
+		turns = 3
+	default:
+		return overlay.Apply(img, opts)
+	}
+	displayed := overlay.Rotate(img, turns)
+	if err := overlay.Draw(displayed, opts); err != nil {
+		return nil, err
+	}
+	return overlay.Rotate(displayed, -turns), nil
+}
 
-	// 读取图片文件
-	jpegData, err := os.ReadFile(inputFile)
+// ExtractWatermarkStream 从JPG数据流中提取水印
+func (w *JPGWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	// 读取图片数据
+	jpegData, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
-		return "", "", fmt.Errorf("读取图片文件失败: %w", err)
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
 	}
 
 	// 检查是否为JPEG文件
 	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != 0xD8 {
-		return "", "", errors.New("无效的JPEG文件格式")
+		return nil, errors.New("无效的JPEG文件格式")
 	}
 
-	// 打印调试信息
-	fmt.Printf("JPEG文件大小: %d 字节\n", len(jpegData))
-
-	// 查找注释段（标记FF FE）
-	var commentData []byte
-	i := 2 // 跳过文件头的FF D8
-	for i < len(jpegData)-4 {
-		// 检查是否为段标记（所有段都以FF开始）
-		if jpegData[i] == 0xFF {
-			segmentType := jpegData[i+1]
-			fmt.Printf("在位置 %d 找到段标记: 0x%02X\n", i, segmentType)
-
-			// 检查是否为注释段 (0xFE)
-			if segmentType == 0xFE {
-				// 读取注释长度（包括长度字段自身的2字节）
-				length := int(jpegData[i+2])<<8 | int(jpegData[i+3])
-				fmt.Printf("注释段长度: %d 字节\n", length)
-
-				if i+4+length-2 <= len(jpegData) {
-					// 提取注释内容（不包括长度字段）
-					comment := string(jpegData[i+4 : i+2+length])
-					fmt.Printf("注释内容前缀: %s\n", comment[:min(20, len(comment))])
-
-					if strings.HasPrefix(comment, "WATERMARK:") {
-						commentData = []byte(strings.TrimPrefix(comment, "WATERMARK:"))
-						fmt.Printf("找到水印数据，长度: %d 字节\n", len(commentData))
-						break
-					}
-				}
-				// 跳到下一个段
-				i += 2 + length
-			} else if segmentType >= 0xE0 && segmentType <= 0xEF {
-				// APP段 (APP0-APP15)
-				if i+4 < len(jpegData) {
-					length := int(jpegData[i+2])<<8 | int(jpegData[i+3])
-					i += 2 + length
-				} else {
-					i += 2
-				}
-			} else if segmentType == 0xDA {
-				// 扫描行开始 (SOS)，之后是图像数据，不再有元数据段
-				break
-			} else {
-				// 其他段，读取长度并跳过
-				if i+4 < len(jpegData) {
-					length := int(jpegData[i+2])<<8 | int(jpegData[i+3])
-					i += 2 + length
-				} else {
-					i += 2
-				}
-			}
-		} else {
-			i++
-		}
+	// 查找水印注释段，没有时读取XMP数据包
+	segStart, segEnd, ok := findWatermarkSegment(jpegData, 2)
+	if !ok {
+		return extractXMP(jpegData)
 	}
+	commentData := jpegData[segStart+4+len(commentPrefix) : segEnd]
 
-	if commentData == nil {
-		return "", "", errors.New("未找到水印数据")
+	// 解析水印信封
+	if envelope.IsArmored(string(commentData)) {
+		return watermark.OpenPayload(string(commentData))
 	}
 
+	// 旧版本格式：Base64编码的JSON元数据
+
 	// 解码Base64
 	metadataJSON, err := base64.StdEncoding.DecodeString(string(commentData))
 	if err != nil {
-		return "", "", fmt.Errorf("解码水印元数据失败: %w", err)
+		return nil, fmt.Errorf("解码水印元数据失败: %w", err)
 	}
 
 	// 解析元数据
 	var metadata WatermarkMetadata
 	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
-		return "", "", fmt.Errorf("解析水印元数据失败: %w", err)
+		return nil, fmt.Errorf("解析水印元数据失败: %w", err)
 	}
 
 	// 解密水印内容
-	watermarkText, err := decryptWatermark(metadata.Content)
+	decrypted, err := decryptWatermark(metadata.Content)
 	if err != nil {
-		return "", "", fmt.Errorf("解密水印失败: %w", err)
+		return nil, fmt.Errorf("解密水印失败: %w", err)
 	}
 
 	// 验证校验和
-	if generateChecksum(watermarkText) != metadata.Checksum {
-		return "", "", errors.New("水印校验和不匹配，文件可能被篡改")
+	if generateChecksum(decrypted) != metadata.Checksum {
+		return nil, errors.New("水印校验和不匹配，文件可能被篡改")
 	}
 
-	// 将时间戳转换为字符串
-	timestamp := time.Unix(metadata.Timestamp, 0).Format(time.RFC3339)
+	// 旧版本只加密了水印文本，使用元数据中的时间戳
+	timestamp := strconv.FormatInt(metadata.Timestamp, 10)
 
-	return watermarkText, timestamp, nil
+	return watermark.DecodePayload([]byte(decrypted), timestamp), nil
 }
 
-// min 返回两个整数中的较小值
-func min(a, b int) int {
-	if a < b {
-		return a
+// extractXMP 从APP1段的XMP数据包中提取水印
+func extractXMP(jpegData []byte) (*watermark.Payload, error) {
+	segments, err := readSegments(jpegData)
+	if err != nil {
+		return nil, watermark.ErrNoWatermark
 	}
-	return b
-}
-
-// 加密水印文本
-func encryptWatermark(text string) (string, error) {
-	// 定义密钥（实际应用中应从安全来源获取）
-	// 使用固定长度的密钥（32字节/256位）
-	originalKey := "watermark-security-key-for-encryption"
-	// 确保密钥长度为32字节（AES-256）
-	key := make([]byte, 32)
-	// 复制原始密钥，如果原始密钥较短则重复使用，较长则截断
-	for i := 0; i < 32; i++ {
-		key[i] = originalKey[i%len(originalKey)]
+	s, found := findXMPSegment(jpegData, segments)
+	if !found {
+		return nil, watermark.ErrNoWatermark
 	}
+	return watermark.OpenXMP(xmpPacket(jpegData, s))
+}
 
-	plaintext := []byte(text)
+// RemoveWatermark 移除JPG图片中的水印
+func (w *JPGWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), w, inputFile, outputFile)
+}
 
-	// 创建一个新的AES加密块
-	block, err := aes.NewCipher(key)
+// RemoveWatermarkStream 移除JPG数据流中的水印注释段和XMP水印属性
+// 只删除水印数据，图像数据和XMP中的其他属性原样保留，不会重新编码
+func (w *JPGWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	jpegData, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
-		return "", fmt.Errorf("创建AES加密块失败: %w", err)
+		return fmt.Errorf("读取图片文件失败: %w", err)
 	}
 
-	// 创建一个新的GCM模式
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("创建GCM模式失败: %w", err)
+	// 检查是否为JPEG文件
+	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != 0xD8 {
+		return errors.New("无效的JPEG文件格式")
 	}
 
-	// 创建随机数作为nonce
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("生成nonce失败: %w", err)
+	// 删除所有水印注释段
+	found := false
+	for {
+		segStart, segEnd, ok := findWatermarkSegment(jpegData, 2)
+		if !ok {
+			break
+		}
+		jpegData = append(jpegData[:segStart:segStart], jpegData[segEnd:]...)
+		found = true
+	}
+	jpegData, removed := removeXMP(jpegData)
+	if !found && !removed {
+		return watermark.ErrNoWatermark
 	}
 
-	// 加密数据
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
+	if _, err := dst.Write(jpegData); err != nil {
+		return fmt.Errorf("写入JPEG数据失败: %w", err)
+	}
 
-	// 将结果编码为base64字符串
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return nil
 }
 
-// 解密水印文本
-func decryptWatermark(encryptedText string) (string, error) {
-	// 定义密钥（必须与加密时使用的相同）
-	// 使用固定长度的密钥（32字节/256位）
-	originalKey := "watermark-security-key-for-encryption"
-	// 确保密钥长度为32字节（AES-256）
-	key := make([]byte, 32)
-	// 复制原始密钥，如果原始密钥较短则重复使用，较长则截断
-	for i := 0; i < 32; i++ {
-		key[i] = originalKey[i%len(originalKey)]
-	}
+// findWatermarkSegment 从from开始查找水印注释段，返回段在数据中的起止位置（包括FF FE标记和长度字段）
+// from应为段的起始位置，从文件开头查找时为2，跳过文件头的FF D8
+func findWatermarkSegment(jpegData []byte, from int) (int, int, bool) {
+	i := from
+	for i < len(jpegData)-4 {
+		// 所有段都以FF开始
+		if jpegData[i] != 0xFF {
+			i++
+			continue
+		}
 
-	// 解码base64字符串
-	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
-	if err != nil {
-		return "", fmt.Errorf("base64解码失败: %w", err)
-	}
+		segmentType := jpegData[i+1]
+		// 扫描行开始 (SOS)，之后是图像数据，不再有元数据段
+		if segmentType == 0xDA {
+			break
+		}
 
-	// 创建一个新的AES加密块
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("创建AES加密块失败: %w", err)
-	}
+		// 读取段长度（包括长度字段自身的2字节）
+		length := int(jpegData[i+2])<<8 | int(jpegData[i+3])
+		end := i + 2 + length
 
-	// 创建一个新的GCM模式
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("创建GCM模式失败: %w", err)
+		// 注释段 (0xFE)
+		if segmentType == 0xFE && end <= len(jpegData) && bytes.HasPrefix(jpegData[i+4:end], []byte(commentPrefix)) {
+			return i, end, true
+		}
+
+		i = end
 	}
 
-	// 获取nonce大小
-	nonceSize := aesGCM.NonceSize()
+	return 0, 0, false
+}
 
-	// 检查密文长度
-	if len(ciphertext) < nonceSize {
-		return "", errors.New("密文长度不足")
+// decryptWatermark 使用旧版本的内置密钥解密Base64编码的水印文本
+func decryptWatermark(encryptedText string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
+	if err != nil {
+		return "", fmt.Errorf("base64解码失败: %w", err)
 	}
 
-	// 提取nonce和实际密文
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-
-	// 解密数据
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := watermark.DecryptLegacy(ciphertext)
 	if err != nil {
-		return "", fmt.Errorf("解密数据失败: %w", err)
+		return "", err
 	}
 
 	return string(plaintext), nil
@@ -371,3 +328,30 @@ func generateChecksum(text string) string {
 	hasher.Write([]byte(text))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
+
+// LocateWatermarks 返回JPG数据流中水印注释段和XMP段的偏移
+func (w *JPGWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	jpegData, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+
+	var locations []string
+	for offset := 2; ; {
+		segStart, segEnd, ok := findWatermarkSegment(jpegData, offset)
+		if !ok {
+			break
+		}
+		locations = append(locations, fmt.Sprintf("COM@%d", segStart))
+		offset = segEnd
+	}
+
+	if segments, err := readSegments(jpegData); err == nil {
+		if s, found := findXMPSegment(jpegData, segments); found {
+			if _, ok := xmp.Envelope(xmpPacket(jpegData, s)); ok {
+				locations = append(locations, fmt.Sprintf("XMP@%d", s.start))
+			}
+		}
+	}
+	return locations, nil
+}
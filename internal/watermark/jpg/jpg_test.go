@@ -0,0 +1,203 @@
+package jpg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// photoJPG 生成有纹理的照片式图片
+func photoJPG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := 128 + 60*math.Sin(float64(x)/17) + 40*math.Cos(float64(y)/11)
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(255 - v), B: uint8(x * y % 256), A: 255})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("编码测试图片失败: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// recompress 以指定质量重新压缩图片，模拟上传到社交平台
+func recompress(t *testing.T, data []byte, quality int) []byte {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("解码图片失败: %v", err)
+	}
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("重新压缩图片失败: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDCTWatermark(t *testing.T) {
+	ctx := context.Background()
+	w := NewDCTWatermarker()
+	data := photoJPG(t, 640, 480)
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("内部照片")); err != nil {
+		t.Fatalf("添加DCT水印失败: %v", err)
+	}
+
+	for _, quality := range []int{95, 85, 75} {
+		compressed := recompress(t, marked.Bytes(), quality)
+		payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(compressed), int64(len(compressed)))
+		if err != nil || payload.Text != "内部照片" {
+			t.Errorf("质量%d重新压缩后提取水印结果为 %v, %v", quality, payload, err)
+		}
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()), &stripped); err != nil {
+		t.Fatalf("移除DCT水印失败: %v", err)
+	}
+	if _, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+	if _, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(data), int64(len(data))); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("没有水印时期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+}
+
+// withMetadata 在JPEG文件头之后插入EXIF、ICC配置文件和Adobe段
+func withMetadata(data []byte) ([]byte, [][]byte) {
+	segment := func(marker byte, content string) []byte {
+		length := len(content) + 2
+		return append([]byte{0xFF, marker, byte(length >> 8), byte(length)}, content...)
+	}
+	exif := segment(0xE1, "Exif\x00\x00MM\x00\x2a orientation=6")
+	icc := segment(markerAPP2, "ICC_PROFILE\x00\x01\x01 sRGB")
+	adobe := segment(markerAPP14, "Adobe\x00\x64\x00\x00\x00\x00\x00")
+	return spliceSegments(data, 2, [][]byte{exif, icc, adobe}), [][]byte{exif, icc}
+}
+
+func TestJPGMetadataSplice(t *testing.T) {
+	ctx := context.Background()
+	data, preserved := withMetadata(photoJPG(t, 256, 192))
+
+	var marked bytes.Buffer
+	if err := NewJPGWatermarker().AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("原图")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	// XMP段和注释段插入在APP段之后，其余数据原样保留
+	segments, err := readSegments(marked.Bytes())
+	if err != nil {
+		t.Fatalf("解析带水印的图片失败: %v", err)
+	}
+	if _, found := findXMPSegment(marked.Bytes(), segments); !found || segments[3].marker != markerAPP1 {
+		t.Errorf("第4个标记段为 %X，期望为XMP段", segments[3].marker)
+	}
+	if segments[4].marker != markerCOM {
+		t.Errorf("第5个标记段为 %X，期望为注释段", segments[4].marker)
+	}
+	inserted := marked.Bytes()[segments[3].start:segments[4].end]
+	if !bytes.Equal(bytes.Replace(marked.Bytes(), inserted, nil, 1), data) {
+		t.Error("去掉XMP段和注释段后与原文件不一致")
+	}
+
+	// 重新编码时保留EXIF和ICC配置文件，不保留Adobe段
+	var encoded bytes.Buffer
+	if err := NewDCTWatermarker().AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &encoded, watermark.NewPayload("原图")); err != nil {
+		t.Fatalf("添加DCT水印失败: %v", err)
+	}
+	segments, err = readSegments(encoded.Bytes())
+	if err != nil {
+		t.Fatalf("解析重新编码的图片失败: %v", err)
+	}
+	for i, want := range preserved {
+		if got := encoded.Bytes()[segments[i].start:segments[i].end]; !bytes.Equal(got, want) {
+			t.Errorf("第%d个标记段为 %q，期望 %q", i+1, got, want)
+		}
+	}
+	for _, s := range segments {
+		if s.marker == markerAPP14 {
+			t.Error("重新编码后不应保留Adobe段")
+		}
+	}
+}
+
+func TestJPGVisibleOverlay(t *testing.T) {
+	// 小端序的EXIF段，只有方向一个标记，值为6，即显示时顺时针旋转90度
+	exif := []byte("Exif\x00\x00II\x2a\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00\x00")
+	segment := append([]byte{0xFF, markerAPP1, 0, byte(len(exif) + 2)}, exif...)
+	data := spliceSegments(photoJPG(t, 320, 240), 2, [][]byte{segment})
+	if orientation := exifOrientation(data); orientation != 6 {
+		t.Fatalf("EXIF方向为%d，期望6", orientation)
+	}
+
+	opts := overlay.DefaultOptions()
+	opts.Text = "SAMPLE"
+	opts.Opacity = 0.8
+	payload := watermark.NewPayload("样片")
+	payload.Overlay = &opts
+	w := NewJPGWatermarker()
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &marked, payload); err != nil {
+		t.Fatalf("添加可见水印失败: %v", err)
+	}
+
+	// 重新编码后保留EXIF段，隐水印仍可提取
+	segments, err := readSegments(marked.Bytes())
+	if err != nil {
+		t.Fatalf("解析带水印的图片失败: %v", err)
+	}
+	if got := marked.Bytes()[segments[0].start:segments[0].end]; !bytes.Equal(got, segment) {
+		t.Error("绘制可见水印后EXIF段丢失")
+	}
+	payload, err = w.ExtractWatermarkStream(context.Background(), bytes.NewReader(marked.Bytes()), int64(marked.Len()))
+	if err != nil || payload.Text != "样片" {
+		t.Errorf("提取水印结果为 %v, %v", payload, err)
+	}
+
+	// 可见水印使部分像素明显变化
+	original, _ := jpeg.Decode(bytes.NewReader(data))
+	rendered, err := jpeg.Decode(bytes.NewReader(marked.Bytes()))
+	if err != nil {
+		t.Fatalf("解码带水印的图片失败: %v", err)
+	}
+	changed := 0
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			r1, _, _, _ := original.At(x, y).RGBA()
+			r2, _, _, _ := rendered.At(x, y).RGBA()
+			if diff := int(r1>>8) - int(r2>>8); diff > 40 || diff < -40 {
+				changed++
+			}
+		}
+	}
+	if changed < 320*240/100 {
+		t.Errorf("只有%d个像素明显变化", changed)
+	}
+
+	// 显示时位于右下角的标志在原图中位于右上角
+	logo := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for i := range logo.Pix {
+		logo.Pix[i] = 0xFF
+	}
+	black := image.NewGray(image.Rect(0, 0, 320, 240))
+	stamped, err := applyOverlay(black, overlay.Options{Logo: &overlay.Logo{Image: logo, Anchor: overlay.AnchorBottomRight, Scale: 0.1, Opacity: 1}}, data)
+	if err != nil {
+		t.Fatalf("绘制标志失败: %v", err)
+	}
+	if stamped.Bounds() != black.Bounds() {
+		t.Fatalf("绘制标志后图片大小为 %v", stamped.Bounds())
+	}
+	if stamped.NRGBAAt(310, 10).R != 0xFF || stamped.NRGBAAt(310, 230).R != 0 {
+		t.Error("标志没有按EXIF方向绘制在显示时的右下角")
+	}
+}
@@ -0,0 +1,161 @@
+package jpg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// JPEG标记
+const (
+	markerSOI   = 0xD8
+	markerSOS   = 0xDA
+	markerAPP0  = 0xE0
+	markerAPP2  = 0xE2
+	markerAPP14 = 0xEE
+	markerAPP15 = 0xEF
+	markerCOM   = 0xFE
+)
+
+// segment JPEG标记段在数据中的位置，包括FF、标记和长度字段
+type segment struct {
+	marker byte
+	start  int
+	end    int
+}
+
+// readSegments 读取SOI之后、SOS之前的所有标记段
+func readSegments(data []byte) ([]segment, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, errors.New("无效的JPEG文件格式")
+	}
+
+	var segments []segment
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, errors.New("JPEG标记段格式无效")
+		}
+		marker := data[i+1]
+		// 标记前可以有任意个FF填充字节
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == markerSOS {
+			return segments, nil
+		}
+
+		length := int(data[i+2])<<8 | int(data[i+3])
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errors.New("JPEG标记段长度无效")
+		}
+		segments = append(segments, segment{marker: marker, start: i, end: end})
+		i = end
+	}
+
+	return nil, errors.New("JPEG文件缺少图像数据")
+}
+
+// isAPP 判断是否为APPn段
+func isAPP(marker byte) bool {
+	return marker >= markerAPP0 && marker <= markerAPP15
+}
+
+// insertionPoint 返回插入新标记段的位置：紧跟在文件开头的APPn段之后
+// JFIF和EXIF要求各自的APP段紧跟SOI，插入到它们之前会导致部分软件无法识别
+func insertionPoint(segments []segment) int {
+	pos := 2
+	for _, s := range segments {
+		if !isAPP(s.marker) {
+			break
+		}
+		pos = s.end
+	}
+	return pos
+}
+
+// preservedSegments 返回重新编码时需要保留的元数据段，如EXIF（包括方向）、ICC配置文件、XMP和注释
+// Adobe的APP14段描述原文件的颜色变换，与重新编码后的数据不一致，因此不保留；
+// CMYK图片转换为YCbCr后，原来的ICC配置文件也不再适用
+func preservedSegments(data []byte, keepICC bool) [][]byte {
+	segments, err := readSegments(data)
+	if err != nil {
+		return nil
+	}
+
+	var preserved [][]byte
+	for _, s := range segments {
+		switch {
+		case s.marker == markerAPP14:
+		case s.marker == markerAPP2 && !keepICC:
+		case isAPP(s.marker) || s.marker == markerCOM:
+			preserved = append(preserved, data[s.start:s.end])
+		}
+	}
+	return preserved
+}
+
+// spliceSegments 将标记段插入到数据中的指定位置，原数据不会被修改
+func spliceSegments(data []byte, pos int, segments [][]byte) []byte {
+	size := len(data)
+	for _, s := range segments {
+		size += len(s)
+	}
+
+	output := make([]byte, 0, size)
+	output = append(output, data[:pos]...)
+	for _, s := range segments {
+		output = append(output, s...)
+	}
+	return append(output, data[pos:]...)
+}
+
+// exifOrientation 读取EXIF中的方向标记，没有EXIF或无法解析时返回1（正常方向）
+func exifOrientation(data []byte) int {
+	segments, err := readSegments(data)
+	if err != nil {
+		return 1
+	}
+	for _, s := range segments {
+		content := data[s.start+4 : s.end]
+		if s.marker != markerAPP1 || !bytes.HasPrefix(content, []byte("Exif\x00\x00")) {
+			continue
+		}
+		tiff := content[6:]
+		if len(tiff) < 8 {
+			return 1
+		}
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 1
+		}
+
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+		count := int(order.Uint16(tiff[ifd:]))
+		for i := 0; i < count; i++ {
+			entry := ifd + 2 + 12*i
+			if entry+12 > len(tiff) {
+				return 1
+			}
+			// 方向标记0x0112为SHORT类型，值保存在条目的前2字节中
+			if order.Uint16(tiff[entry:]) == 0x0112 {
+				if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+					return orientation
+				}
+				return 1
+			}
+		}
+		return 1
+	}
+	return 1
+}
@@ -0,0 +1,99 @@
+package jpg
+
+import (
+	"bytes"
+	"errors"
+
+	"watermark-tool/internal/watermark/xmp"
+)
+
+// markerAPP1 EXIF和XMP使用的APP1段
+const markerAPP1 = 0xE1
+
+// xmpHeader APP1段中XMP数据包的命名空间前缀
+const xmpHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+// findXMPSegment 查找保存XMP数据包的APP1段
+func findXMPSegment(data []byte, segments []segment) (segment, bool) {
+	for _, s := range segments {
+		if s.marker == markerAPP1 && bytes.HasPrefix(data[s.start+4:s.end], []byte(xmpHeader)) {
+			return s, true
+		}
+	}
+	return segment{}, false
+}
+
+// xmpPacket 返回APP1段中的XMP数据包
+func xmpPacket(data []byte, s segment) []byte {
+	return data[s.start+4+len(xmpHeader) : s.end]
+}
+
+// encodeXMPSegment 将XMP数据包编码为APP1段
+func encodeXMPSegment(packet []byte) ([]byte, error) {
+	length := 2 + len(xmpHeader) + len(packet)
+	if length > 65535 {
+		return nil, errors.New("XMP数据包太长，无法写入APP1段")
+	}
+
+	output := []byte{0xFF, markerAPP1, byte(length >> 8), byte(length & 0xFF)}
+	output = append(output, xmpHeader...)
+	return append(output, packet...), nil
+}
+
+// replaceSegment 用新的内容替换标记段，replacement为nil时删除该段
+func replaceSegment(data []byte, s segment, replacement []byte) []byte {
+	output := make([]byte, 0, len(data)-(s.end-s.start)+len(replacement))
+	output = append(output, data[:s.start]...)
+	output = append(output, replacement...)
+	return append(output, data[s.end:]...)
+}
+
+// mergeXMP 将水印属性写入JPEG的XMP数据包，已有XMP段时就地合并，否则在文件开头的APP段之后插入新的APP1段
+func mergeXMP(data []byte, props xmp.Properties) ([]byte, error) {
+	segments, err := readSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, found := findXMPSegment(data, segments)
+	var packet []byte
+	if found {
+		packet = xmpPacket(data, existing)
+	}
+	merged, err := xmp.Merge(packet, props)
+	if err != nil {
+		return nil, err
+	}
+	app1, err := encodeXMPSegment(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	if found {
+		return replaceSegment(data, existing, app1), nil
+	}
+	return spliceSegments(data, insertionPoint(segments), [][]byte{app1}), nil
+}
+
+// removeXMP 删除XMP数据包中的水印属性，数据包中没有其他属性时删除整个APP1段
+func removeXMP(data []byte) ([]byte, bool) {
+	segments, err := readSegments(data)
+	if err != nil {
+		return data, false
+	}
+	s, found := findXMPSegment(data, segments)
+	if !found {
+		return data, false
+	}
+
+	rest, removed := xmp.Remove(xmpPacket(data, s))
+	if !removed {
+		return data, false
+	}
+	if rest == nil {
+		return replaceSegment(data, s, nil), true
+	}
+	// 删除属性后数据包变短，不会超过APP1段的长度限制
+	app1, _ := encodeXMPSegment(rest)
+	return replaceSegment(data, s, app1), true
+}
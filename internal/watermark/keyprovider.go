@@ -0,0 +1,44 @@
+package watermark
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"watermark-tool/internal/watermark/keys"
+)
+
+var (
+	keyProviderMu     sync.RWMutex
+	keyProvider       keys.KeyProvider
+	legacyWarningOnce sync.Once
+)
+
+// SetKeyProvider 设置加解密水印使用的密钥提供者，应在处理文件之前调用
+func SetKeyProvider(p keys.KeyProvider) {
+	keyProviderMu.Lock()
+	defer keyProviderMu.Unlock()
+	keyProvider = p
+}
+
+// GetKeyProvider 返回当前的密钥提供者
+// 未设置时使用旧版本的内置密钥，内置密钥是公开的，无法防止水印被读取或伪造
+func GetKeyProvider() keys.KeyProvider {
+	keyProviderMu.RLock()
+	p := keyProvider
+	keyProviderMu.RUnlock()
+	if p != nil {
+		return p
+	}
+
+	legacyWarningOnce.Do(func() {
+		fmt.Fprintf(os.Stderr, "警告: 未配置水印密钥，正在使用公开的内置密钥，请设置 %s、%s 或 %s\n",
+			keys.EnvKMS, keys.EnvKeyring, keys.EnvKeys)
+	})
+	return keys.NewLegacyKeyring()
+}
+
+// DecryptLegacy 使用旧版本的内置密钥解密未使用信封的旧水印
+func DecryptLegacy(ciphertext []byte) ([]byte, error) {
+	return GetKeyProvider().Decrypt(keys.LegacyKeyID, ciphertext)
+}
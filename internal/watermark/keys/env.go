@@ -0,0 +1,26 @@
+package keys
+
+import "os"
+
+// EnvKeyring 密钥环文件路径的环境变量名
+const EnvKeyring = "WATERMARK_KEYRING"
+
+// FromEnvironment 根据环境变量创建密钥提供者，按以下顺序查找：
+//
+//	WATERMARK_KMS      本地KMS密钥文件路径
+//	WATERMARK_KEYRING  密钥环文件路径
+//	WATERMARK_KEYS     直接在环境变量中配置的密钥
+//
+// 都未配置时返回nil
+func FromEnvironment() (KeyProvider, error) {
+	if path := os.Getenv(EnvKMS); path != "" {
+		return OpenLocalKMS(path)
+	}
+	if path := os.Getenv(EnvKeyring); path != "" {
+		return LoadKeyringFile(path)
+	}
+	if os.Getenv(EnvKeys) != "" {
+		return KeyringFromEnv()
+	}
+	return nil, nil
+}
@@ -0,0 +1,291 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 环境变量名
+const (
+	EnvKeys      = "WATERMARK_KEYS"       // 格式为 "id1:base64密钥[:base64签名密钥],id2:..."
+	EnvActiveKey = "WATERMARK_ACTIVE_KEY" // 当前使用的密钥ID
+)
+
+// Keyring 在内存中保存一组密钥，使用AES-256-GCM加密
+// 每个密钥可以有独立生成的Ed25519签名密钥，没有时新水印只计算MAC。
+// 旧版本的内置密钥总是作为已停用的密钥加入，只用于读取旧文件
+type Keyring struct {
+	active  string
+	keys    map[string][]byte
+	signing map[string]ed25519.PrivateKey
+	// public 只有公钥的密钥，只能校验签名，见 NewPublicKeyring
+	public map[string]ed25519.PublicKey
+}
+
+// NewKeyring 创建密钥环，active为新水印使用的密钥ID
+func NewKeyring(active string, keys map[string][]byte) (*Keyring, error) {
+	if active == "" {
+		return nil, ErrNoActiveKey
+	}
+	if active == LegacyKeyID {
+		return nil, fmt.Errorf("%w: %s 只能用于读取旧文件", ErrInvalidKey, LegacyKeyID)
+	}
+
+	k := NewLegacyKeyring()
+	k.active = active
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("%w: 密钥ID长度无效", ErrInvalidKey)
+		}
+		if id == LegacyKeyID {
+			return nil, fmt.Errorf("%w: 密钥ID %s 已被保留", ErrInvalidKey, LegacyKeyID)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("%w: 密钥 %s 的长度为%d字节，应为%d字节", ErrInvalidKey, id, len(key), KeySize)
+		}
+		k.keys[id] = key
+	}
+
+	if _, ok := k.keys[active]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, active)
+	}
+
+	return k, nil
+}
+
+// NewLegacyKeyring 创建只包含旧版本内置密钥的密钥环
+// 内置密钥是公开的，任何人都可以读取和伪造使用它的水印，只用于未配置密钥时保持兼容
+func NewLegacyKeyring() *Keyring {
+	return &Keyring{
+		active:  LegacyKeyID,
+		keys:    map[string][]byte{LegacyKeyID: legacyKey()},
+		signing: make(map[string]ed25519.PrivateKey),
+		public:  make(map[string]ed25519.PublicKey),
+	}
+}
+
+// NewPublicKeyring 创建只包含签名公钥的密钥环，供第三方校验水印的来源
+// 公钥只能校验签名，不能解密水印内容，也不能签发水印；
+// 由密钥决定嵌入位置的像素和频域水印无法只用公钥找到
+func NewPublicKeyring(publicKeys map[string]ed25519.PublicKey) (*Keyring, error) {
+	k := NewLegacyKeyring()
+	for id, publicKey := range publicKeys {
+		if id == "" || len(id) > 255 || id == LegacyKeyID {
+			return nil, fmt.Errorf("%w: 密钥ID %q 无效", ErrInvalidKey, id)
+		}
+		if len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: 公钥 %s 的长度为%d字节，应为%d字节", ErrInvalidKey, id, len(publicKey), ed25519.PublicKeySize)
+		}
+		k.public[id] = publicKey
+	}
+	return k, nil
+}
+
+// AddSigningKey 为已有的密钥设置独立生成的Ed25519签名私钥，seed为 GenerateSigningKey 生成的种子
+// 应在密钥环开始使用之前调用
+func (k *Keyring) AddSigningKey(keyID string, seed []byte) error {
+	if _, err := k.key(keyID); err != nil {
+		return err
+	}
+	if keyID == LegacyKeyID {
+		return fmt.Errorf("%w: %s 是公开的内置密钥，不能签名", ErrInvalidKey, LegacyKeyID)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return fmt.Errorf("%w: 签名密钥 %s 的长度为%d字节，应为%d字节", ErrInvalidKey, keyID, len(seed), ed25519.SeedSize)
+	}
+	k.signing[keyID] = ed25519.NewKeyFromSeed(seed)
+	return nil
+}
+
+// ActiveKeyID 返回当前使用的密钥ID
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// KeyIDs 返回所有密钥ID，不包括只有公钥的密钥
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Encrypt 使用指定密钥加密数据
+func (k *Keyring) Encrypt(keyID string, plaintext []byte) ([]byte, error) {
+	key, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return sealGCM(key, plaintext)
+}
+
+// Decrypt 使用指定密钥解密数据
+func (k *Keyring) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	key, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return openGCM(key, ciphertext)
+}
+
+// MAC 使用指定密钥计算数据的HMAC-SHA256
+func (k *Keyring) MAC(keyID string, data []byte) ([]byte, error) {
+	key, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return computeMAC(key, data), nil
+}
+
+// Sign 使用指定密钥的签名私钥签名，密钥没有独立的签名密钥时返回 ErrNoSigningKey
+func (k *Keyring) Sign(keyID string, data []byte) ([]byte, error) {
+	if privateKey, ok := k.signing[keyID]; ok {
+		return ed25519.Sign(privateKey, data), nil
+	}
+	if _, err := k.key(keyID); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSigningKey, keyID)
+}
+
+// PublicKey 返回指定密钥的签名公钥，没有独立签名密钥时返回旧版本从密钥派生的公钥
+func (k *Keyring) PublicKey(keyID string) (ed25519.PublicKey, error) {
+	if privateKey, ok := k.signing[keyID]; ok {
+		return privateKey.Public().(ed25519.PublicKey), nil
+	}
+	if publicKey, ok := k.public[keyID]; ok {
+		return publicKey, nil
+	}
+	key, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return derivedSigningKey(key).Public().(ed25519.PublicKey), nil
+}
+
+// HasSigningKey 返回指定密钥是否有独立生成的签名密钥或公钥
+func (k *Keyring) HasSigningKey(keyID string) bool {
+	_, signing := k.signing[keyID]
+	_, public := k.public[keyID]
+	return signing || public
+}
+
+// key 返回指定ID的密钥
+func (k *Keyring) key(keyID string) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return key, nil
+}
+
+// keyringFile 密钥环文件的格式
+type keyringFile struct {
+	// Active 当前使用的密钥ID
+	Active string `json:"active"`
+	// Keys 密钥ID到Base64编码密钥的映射，轮换后的旧密钥应保留在这里
+	Keys map[string]string `json:"keys"`
+	// SigningKeys 密钥ID到Base64编码的Ed25519签名私钥种子的映射
+	SigningKeys map[string]string `json:"signing_keys,omitempty"`
+}
+
+// LoadKeyringFile 从JSON文件中加载密钥环，文件格式为：
+//
+//	{"active": "2025-01", "keys": {"2024-06": "<base64>", "2025-01": "<base64>"}, "signing_keys": {"2025-01": "<base64>"}}
+func LoadKeyringFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+
+	keys, err := decodeKeys(file.Keys)
+	if err != nil {
+		return nil, err
+	}
+	signingKeys, err := decodeKeys(file.SigningKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigningKeyring(file.Active, keys, signingKeys)
+}
+
+// newSigningKeyring 创建密钥环并设置各密钥的签名私钥
+func newSigningKeyring(active string, keys, signingKeys map[string][]byte) (*Keyring, error) {
+	ring, err := NewKeyring(active, keys)
+	if err != nil {
+		return nil, err
+	}
+	for id, seed := range signingKeys {
+		if err := ring.AddSigningKey(id, seed); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// KeyringFromEnv 从环境变量中加载密钥环
+// 每个密钥的格式为 id:base64密钥:base64签名密钥，没有签名密钥时可以省略最后一项；
+// 只配置了一个密钥时可以不设置 WATERMARK_ACTIVE_KEY
+func KeyringFromEnv() (*Keyring, error) {
+	value := os.Getenv(EnvKeys)
+	if value == "" {
+		return nil, fmt.Errorf("未设置环境变量 %s", EnvKeys)
+	}
+
+	encoded := make(map[string]string)
+	encodedSigning := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("%w: %s 的格式应为 id:base64密钥[:base64签名密钥]", ErrInvalidKey, EnvKeys)
+		}
+		encoded[parts[0]] = parts[1]
+		if len(parts) == 3 {
+			encodedSigning[parts[0]] = parts[2]
+		}
+	}
+
+	keys, err := decodeKeys(encoded)
+	if err != nil {
+		return nil, err
+	}
+	signingKeys, err := decodeKeys(encodedSigning)
+	if err != nil {
+		return nil, err
+	}
+
+	active := os.Getenv(EnvActiveKey)
+	if active == "" && len(keys) == 1 {
+		for id := range keys {
+			active = id
+		}
+	}
+
+	return newSigningKeyring(active, keys, signingKeys)
+}
+
+// decodeKeys 解码Base64编码的密钥
+func decodeKeys(encoded map[string]string) (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(encoded))
+	for id, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 密钥 %s 不是有效的Base64", ErrInvalidKey, id)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
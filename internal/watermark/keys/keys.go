@@ -0,0 +1,151 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LegacyKeyID 旧版本内置密钥的ID，该密钥只用于读取旧文件
+const LegacyKeyID = "legacy"
+
+// KeySize 密钥长度（AES-256）
+const KeySize = 32
+
+// 定义密钥相关的错误
+var (
+	ErrUnknownKey  = errors.New("未知的密钥ID")
+	ErrNoActiveKey = errors.New("未设置当前使用的密钥")
+	ErrInvalidKey  = errors.New("密钥无效")
+	// ErrNoSigningKey 密钥没有独立生成的签名密钥，只能计算MAC
+	ErrNoSigningKey = errors.New("密钥没有独立的签名密钥")
+)
+
+// KeyProvider 提供水印加解密和校验使用的密钥
+// 密钥通过ID引用，ID会写入水印中，因此密钥轮换后旧文件仍可以用已停用的密钥读取
+type KeyProvider interface {
+	// ActiveKeyID 返回为新水印加密时使用的密钥ID
+	ActiveKeyID() string
+	// KeyIDs 返回所有可用的密钥ID，包括已停用的密钥
+	KeyIDs() []string
+	// Encrypt 使用指定密钥加密数据
+	Encrypt(keyID string, plaintext []byte) ([]byte, error)
+	// Decrypt 使用指定密钥解密数据
+	Decrypt(keyID string, ciphertext []byte) ([]byte, error)
+	// MAC 使用指定密钥计算数据的HMAC-SHA256
+	MAC(keyID string, data []byte) ([]byte, error)
+	// Sign 使用指定密钥的Ed25519签名私钥签名，密钥没有独立的签名密钥时返回 ErrNoSigningKey
+	Sign(keyID string, data []byte) ([]byte, error)
+	// PublicKey 返回指定密钥的Ed25519公钥，用于校验签名
+	// 没有独立签名密钥的密钥返回旧版本从密钥派生的公钥，只用于校验旧版本签名的水印
+	PublicKey(keyID string) (ed25519.PublicKey, error)
+	// HasSigningKey 返回指定密钥是否有独立生成的签名密钥，只有这种密钥的公钥可以公开给第三方
+	HasSigningKey(keyID string) bool
+}
+
+// legacyKey 返回旧版本硬编码在各处理器中的密钥
+// 原始密钥长度不是合法的AES密钥长度，较短时重复使用，较长时截断
+func legacyKey() []byte {
+	originalKey := "watermark-security-key-for-encryption"
+	key := make([]byte, KeySize)
+	for i := 0; i < KeySize; i++ {
+		key[i] = originalKey[i%len(originalKey)]
+	}
+	return key
+}
+
+// GenerateKey 生成一个随机密钥
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %w", err)
+	}
+	return key, nil
+}
+
+// GenerateSigningKey 生成一个随机的Ed25519签名私钥，返回32字节的种子
+// 签名私钥与加密密钥相互独立，持有公钥的第三方只能校验签名，不能签发水印
+func GenerateSigningKey() ([]byte, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %w", err)
+	}
+	return seed, nil
+}
+
+// deriveKey 从密钥派生指定用途的子密钥，避免同一个密钥同时用于加密和MAC
+func deriveKey(secret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// derivedSigningKey 旧版本从密钥派生的Ed25519私钥
+// 任何能校验签名的人都持有密钥，也就能计算出私钥，因此只用于校验旧版本签名的水印
+func derivedSigningKey(secret []byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(deriveKey(secret, "watermark-ed25519"))
+}
+
+// computeMAC 计算HMAC-SHA256
+func computeMAC(secret, data []byte) []byte {
+	mac := hmac.New(sha256.New, deriveKey(secret, "watermark-mac"))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// sealGCM 使用AES-GCM加密数据，返回nonce和密文
+func sealGCM(key, plaintext []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("生成nonce失败: %w", err)
+	}
+
+	return aesGCM.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openGCM 解密sealGCM生成的数据
+func openGCM(key, ciphertext []byte) ([]byte, error) {
+	aesGCM, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aesGCM.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("密文长度不足")
+	}
+
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("解密数据失败: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// newGCM 创建AES-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES加密块失败: %w", err)
+	}
+
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建GCM模式失败: %w", err)
+	}
+
+	return aesGCM, nil
+}
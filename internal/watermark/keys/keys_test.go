@@ -0,0 +1,192 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	k1, _ := GenerateKey()
+	k2, _ := GenerateKey()
+	s1, _ := GenerateSigningKey()
+
+	old, err := newSigningKeyring("k1", map[string][]byte{"k1": k1}, map[string][]byte{"k1": s1})
+	if err != nil {
+		t.Fatalf("创建密钥环失败: %v", err)
+	}
+	ciphertext, err := old.Encrypt(old.ActiveKeyID(), []byte("机密"))
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	mac, err := old.MAC("k1", []byte("data"))
+	if err != nil {
+		t.Fatalf("计算MAC失败: %v", err)
+	}
+	signature, err := old.Sign("k1", []byte("data"))
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+
+	// 轮换后k1作为停用密钥保留，仍然可以解密旧数据
+	rotated, err := newSigningKeyring("k2", map[string][]byte{"k1": k1, "k2": k2}, map[string][]byte{"k1": s1})
+	if err != nil {
+		t.Fatalf("创建密钥环失败: %v", err)
+	}
+	plaintext, err := rotated.Decrypt("k1", ciphertext)
+	if err != nil || string(plaintext) != "机密" {
+		t.Errorf("使用停用密钥解密失败: %q, %v", plaintext, err)
+	}
+	if again, _ := rotated.MAC("k1", []byte("data")); !bytes.Equal(mac, again) {
+		t.Error("同一密钥计算的MAC不一致")
+	}
+	if publicKey, err := rotated.PublicKey("k1"); err != nil || !ed25519.Verify(publicKey, []byte("data"), signature) {
+		t.Errorf("轮换后无法使用停用密钥的公钥验证签名: %v", err)
+	}
+
+	// 删除k1之后无法解密
+	removed, err := NewKeyring("k2", map[string][]byte{"k2": k2})
+	if err != nil {
+		t.Fatalf("创建密钥环失败: %v", err)
+	}
+	if _, err := removed.Decrypt("k1", ciphertext); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("期望返回 ErrUnknownKey，实际为: %v", err)
+	}
+
+	// 旧版本内置密钥总是可以用于解密，但不能作为当前密钥
+	if _, err := NewKeyring(LegacyKeyID, nil); err == nil {
+		t.Error("内置密钥不应被设为当前密钥")
+	}
+	legacy, err := sealGCM(legacyKey(), []byte("old"))
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if plaintext, err := removed.Decrypt(LegacyKeyID, legacy); err != nil || string(plaintext) != "old" {
+		t.Errorf("使用内置密钥解密失败: %q, %v", plaintext, err)
+	}
+}
+
+func TestSigningKeys(t *testing.T) {
+	k1, _ := GenerateKey()
+	k2, _ := GenerateKey()
+	s2, _ := GenerateSigningKey()
+	ring, err := newSigningKeyring("k2", map[string][]byte{"k1": k1, "k2": k2}, map[string][]byte{"k2": s2})
+	if err != nil {
+		t.Fatalf("创建密钥环失败: %v", err)
+	}
+
+	// 签名私钥与加密密钥无关，公钥就是独立生成的私钥的公钥
+	signature, err := ring.Sign("k2", []byte("data"))
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	publicKey, err := ring.PublicKey("k2")
+	if err != nil || !bytes.Equal(publicKey, ed25519.NewKeyFromSeed(s2).Public().(ed25519.PublicKey)) || !ring.HasSigningKey("k2") {
+		t.Fatalf("公钥为 %x, %v", publicKey, err)
+	}
+
+	// 没有签名密钥时不能签名，公钥只用于校验旧版本签名的水印
+	if _, err := ring.Sign("k1", []byte("data")); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("期望返回 ErrNoSigningKey，实际为: %v", err)
+	}
+	if publicKey, err := ring.PublicKey("k1"); err != nil || !bytes.Equal(publicKey, derivedSigningKey(k1).Public().(ed25519.PublicKey)) || ring.HasSigningKey("k1") {
+		t.Errorf("旧版本的公钥为 %x, %v", publicKey, err)
+	}
+	if err := ring.AddSigningKey(LegacyKeyID, s2); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("内置密钥不应设置签名密钥，实际返回: %v", err)
+	}
+
+	// 只有公钥时可以校验签名，但不能签名、解密或计算MAC
+	verifier, err := NewPublicKeyring(map[string]ed25519.PublicKey{"k2": publicKey})
+	if err != nil {
+		t.Fatalf("创建公钥密钥环失败: %v", err)
+	}
+	if got, err := verifier.PublicKey("k2"); err != nil || !ed25519.Verify(got, []byte("data"), signature) {
+		t.Errorf("使用公钥校验签名失败: %v", err)
+	}
+	ciphertext, _ := ring.Encrypt("k2", []byte("机密"))
+	if _, err := verifier.Decrypt("k2", ciphertext); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("期望返回 ErrUnknownKey，实际为: %v", err)
+	}
+	if _, err := verifier.Sign("k2", []byte("data")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("期望返回 ErrUnknownKey，实际为: %v", err)
+	}
+	if ids := verifier.KeyIDs(); len(ids) != 1 || ids[0] != LegacyKeyID {
+		t.Errorf("公钥密钥环的密钥ID为 %v", ids)
+	}
+
+	// 签名密钥随密钥环文件保存和加载
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	if err := saveKeyringFile(path, ring); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKeyringFile(path)
+	if err != nil {
+		t.Fatalf("加载密钥环失败: %v", err)
+	}
+	if got, _ := loaded.PublicKey("k2"); !bytes.Equal(got, publicKey) || loaded.HasSigningKey("k1") {
+		t.Error("加载后的签名密钥不一致")
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	k1, _ := GenerateKey()
+	k2, _ := GenerateKey()
+	s2, _ := GenerateSigningKey()
+	t.Setenv(EnvKeys, "k1:"+base64.StdEncoding.EncodeToString(k1)+", k2:"+base64.StdEncoding.EncodeToString(k2)+":"+base64.StdEncoding.EncodeToString(s2))
+	t.Setenv(EnvActiveKey, "k2")
+
+	ring, err := KeyringFromEnv()
+	if err != nil {
+		t.Fatalf("加载密钥环失败: %v", err)
+	}
+	if ring.ActiveKeyID() != "k2" || len(ring.KeyIDs()) != 3 || ring.HasSigningKey("k1") || !ring.HasSigningKey("k2") {
+		t.Errorf("密钥环内容不正确: %s %v", ring.ActiveKeyID(), ring.KeyIDs())
+	}
+
+	t.Setenv(EnvActiveKey, "")
+	if _, err := KeyringFromEnv(); !errors.Is(err, ErrNoActiveKey) {
+		t.Errorf("配置多个密钥时必须指定当前密钥，实际返回: %v", err)
+	}
+}
+
+func TestLocalKMSRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kms.json")
+
+	kms, err := OpenLocalKMS(path)
+	if err != nil {
+		t.Fatalf("打开本地KMS失败: %v", err)
+	}
+	oldKeyID := kms.ActiveKeyID()
+	ciphertext, err := kms.Encrypt(oldKeyID, []byte("机密"))
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+
+	newKeyID, err := kms.RotateKey()
+	if err != nil {
+		t.Fatalf("轮换密钥失败: %v", err)
+	}
+	if newKeyID == oldKeyID {
+		t.Fatalf("轮换后的密钥ID未变化: %s", newKeyID)
+	}
+
+	// 重新打开后仍然可以使用旧的主密钥解密
+	reopened, err := OpenLocalKMS(path)
+	if err != nil {
+		t.Fatalf("重新打开本地KMS失败: %v", err)
+	}
+	if reopened.ActiveKeyID() != newKeyID {
+		t.Errorf("当前密钥为 %s，期望 %s", reopened.ActiveKeyID(), newKeyID)
+	}
+	if !reopened.HasSigningKey(oldKeyID) || !reopened.HasSigningKey(newKeyID) {
+		t.Error("轮换生成的主密钥应当有独立的签名密钥")
+	}
+	plaintext, err := reopened.Decrypt(oldKeyID, ciphertext)
+	if err != nil || string(plaintext) != "机密" {
+		t.Errorf("使用旧主密钥解密失败: %q, %v", plaintext, err)
+	}
+}
@@ -0,0 +1,211 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// EnvKMS 本地KMS密钥文件路径的环境变量名
+const EnvKMS = "WATERMARK_KMS"
+
+// LocalKMS 本地的KMS替代实现
+// 用法与云厂商的KMS一致：主密钥不直接用于加密数据，每次加密都生成随机的数据密钥，
+// 数据密钥用主密钥加密后与密文保存在一起。主密钥保存在本地JSON文件中，
+// 便于在没有KMS服务的环境中开发和测试，以后可以替换为真正的KMS客户端。
+type LocalKMS struct {
+	mu   sync.RWMutex
+	path string
+	ring *Keyring
+}
+
+// OpenLocalKMS 打开本地KMS的密钥文件，文件不存在时创建并生成第一个主密钥
+func OpenLocalKMS(path string) (*LocalKMS, error) {
+	kms := &LocalKMS{path: path}
+
+	ring, err := LoadKeyringFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := kms.RotateKey(); err != nil {
+			return nil, err
+		}
+		return kms, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kms.ring = ring
+	return kms, nil
+}
+
+// RotateKey 生成新的主密钥和签名密钥并设为当前密钥，旧的主密钥和签名密钥保留用于解密和校验
+func (k *LocalKMS) RotateKey() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := make(map[string][]byte)
+	signingKeys := make(map[string][]byte)
+	if k.ring != nil {
+		for id, key := range k.ring.keys {
+			if id != LegacyKeyID {
+				keys[id] = key
+			}
+		}
+		for id, privateKey := range k.ring.signing {
+			signingKeys[id] = privateKey.Seed()
+		}
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	seed, err := GenerateSigningKey()
+	if err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("kms-%d", len(keys)+1)
+	keys[id] = key
+	signingKeys[id] = seed
+
+	ring, err := newSigningKeyring(id, keys, signingKeys)
+	if err != nil {
+		return "", err
+	}
+	if err := saveKeyringFile(k.path, ring); err != nil {
+		return "", err
+	}
+
+	k.ring = ring
+	return id, nil
+}
+
+// ActiveKeyID 返回当前使用的主密钥ID
+func (k *LocalKMS) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.ring.ActiveKeyID()
+}
+
+// KeyIDs 返回所有主密钥ID
+func (k *LocalKMS) KeyIDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.ring.KeyIDs()
+}
+
+// Encrypt 生成数据密钥加密数据，并用指定的主密钥加密数据密钥
+// 输出格式为：2字节加密后的数据密钥长度 + 加密后的数据密钥 + 密文
+func (k *LocalKMS) Encrypt(keyID string, plaintext []byte) ([]byte, error) {
+	k.mu.RLock()
+	ring := k.ring
+	k.mu.RUnlock()
+
+	// 旧版本内置密钥直接加密，与旧文件保持一致
+	if keyID == LegacyKeyID {
+		return ring.Encrypt(keyID, plaintext)
+	}
+
+	dataKey, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := ring.Encrypt(keyID, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := sealGCM(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	output := binary.BigEndian.AppendUint16(nil, uint16(len(wrappedKey)))
+	output = append(output, wrappedKey...)
+	return append(output, ciphertext...), nil
+}
+
+// Decrypt 用主密钥解密数据密钥，再解密数据
+func (k *LocalKMS) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	k.mu.RLock()
+	ring := k.ring
+	k.mu.RUnlock()
+
+	if keyID == LegacyKeyID {
+		return ring.Decrypt(keyID, ciphertext)
+	}
+
+	if len(ciphertext) < 2 {
+		return nil, errors.New("密文长度不足")
+	}
+	length := int(binary.BigEndian.Uint16(ciphertext))
+	if len(ciphertext) < 2+length {
+		return nil, errors.New("密文长度不足")
+	}
+
+	dataKey, err := ring.Decrypt(keyID, ciphertext[2:2+length])
+	if err != nil {
+		return nil, fmt.Errorf("解密数据密钥失败: %w", err)
+	}
+
+	return openGCM(dataKey, ciphertext[2+length:])
+}
+
+// MAC 使用指定的主密钥计算数据的HMAC-SHA256
+func (k *LocalKMS) MAC(keyID string, data []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.ring.MAC(keyID, data)
+}
+
+// Sign 使用指定主密钥的签名私钥签名
+func (k *LocalKMS) Sign(keyID string, data []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.ring.Sign(keyID, data)
+}
+
+// PublicKey 返回指定主密钥的签名公钥
+func (k *LocalKMS) PublicKey(keyID string) (ed25519.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.ring.PublicKey(keyID)
+}
+
+// HasSigningKey 返回指定主密钥是否有独立生成的签名密钥，旧版本创建的主密钥没有
+func (k *LocalKMS) HasSigningKey(keyID string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.ring.HasSigningKey(keyID)
+}
+
+// saveKeyringFile 将密钥环保存为JSON文件，不包含旧版本内置密钥
+func saveKeyringFile(path string, ring *Keyring) error {
+	file := keyringFile{
+		Active:      ring.active,
+		Keys:        make(map[string]string, len(ring.keys)),
+		SigningKeys: make(map[string]string, len(ring.signing)),
+	}
+	for id, key := range ring.keys {
+		if id != LegacyKeyID {
+			file.Keys[id] = base64.StdEncoding.EncodeToString(key)
+		}
+	}
+	for id, privateKey := range ring.signing {
+		file.SigningKeys[id] = base64.StdEncoding.EncodeToString(privateKey.Seed())
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥文件失败: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("保存密钥文件失败: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+// Package lsb 实现PNG和BMP共用的像素最低位水印
+// 图像按 TileSize 划分为区块，水印在每个完整的区块中重复嵌入，裁剪后只要保留一个完整区块即可提取。
+// 区块内使用的位置由密钥派生的伪随机序列决定，没有密钥无法定位水印所在的像素。
+// 各格式使用不同的帧头标记和位置序列标签，同一个密钥在不同格式中的嵌入位置不同
+package lsb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"math/rand/v2"
+
+	"watermark-tool/internal/watermark"
+)
+
+// 像素水印的参数
+const (
+	TileSize     = 128                     // 区块边长
+	tileSlots    = TileSize * TileSize * 3 // 每个区块可用的位数，每个像素使用三个颜色通道的最低位
+	headerBits   = 32                      // 帧头：16位标记 + 16位数据长度
+	headerCopies = 8                       // 帧头在每个区块中的重复次数
+)
+
+// Pixels 可以读写颜色通道最低位的图像
+type Pixels interface {
+	// Bounds 返回图像的范围
+	Bounds() image.Rectangle
+	// Bit 读取像素(x, y)第channel个颜色通道的最低位，channel为0到2
+	Bit(x, y, channel int) byte
+	// SetBit 设置像素(x, y)第channel个颜色通道的最低位
+	SetBit(x, y, channel int, bit byte)
+}
+
+// NRGBA 将8位RGBA图片包装为 Pixels，使用R、G、B三个通道
+type NRGBA struct {
+	*image.NRGBA
+}
+
+// Bit 读取像素(x, y)第channel个颜色通道的最低位
+func (p NRGBA) Bit(x, y, channel int) byte {
+	return p.Pix[p.PixOffset(x, y)+channel] & 1
+}
+
+// SetBit 设置像素(x, y)第channel个颜色通道的最低位
+func (p NRGBA) SetBit(x, y, channel int, bit byte) {
+	offset := p.PixOffset(x, y) + channel
+	p.Pix[offset] = p.Pix[offset]&^1 | bit
+}
+
+// Format 一种文件格式的像素水印参数
+type Format struct {
+	// Magic 帧头标记
+	Magic uint16
+	// SeedLabel 派生位置序列时使用的标签
+	SeedLabel []byte
+}
+
+// Mark 图像中找到的像素水印
+type Mark struct {
+	KeyID   string
+	OriginX int // 区块网格相对于图像左上角的起点，图片被裁剪后不一定为0
+	OriginY int
+	Data    []byte
+	layout  []int
+}
+
+// Embed 使用keyID的位置序列，在图像的每个完整区块中嵌入帧头和重复的数据
+func (f Format) Embed(img Pixels, keyID string, data []byte) error {
+	if len(data) > 0xFFFF || frameCopies(len(data)) < 1 {
+		return fmt.Errorf("水印载荷过大，每个%d×%d像素的区块最多嵌入%d字节", TileSize, TileSize,
+			(tileSlots-headerBits*headerCopies)/8-crc32.Size)
+	}
+
+	origins := Tiles(img, 0, 0)
+	if len(origins) == 0 {
+		return fmt.Errorf("图片尺寸小于%d×%d像素，无法嵌入像素水印", TileSize, TileSize)
+	}
+
+	layout, err := f.tileLayout(keyID)
+	if err != nil {
+		return err
+	}
+
+	header := binary.BigEndian.AppendUint16(nil, f.Magic)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(data)))
+	body := binary.BigEndian.AppendUint32(append([]byte(nil), data...), crc32.ChecksumIEEE(data))
+
+	for _, origin := range origins {
+		slots := layout
+		for i := 0; i < headerCopies; i++ {
+			slots = writeBits(img, origin, slots, header)
+		}
+		for i := frameCopies(len(data)); i > 0; i-- {
+			slots = writeBits(img, origin, slots, body)
+		}
+	}
+	return nil
+}
+
+// Find 依次使用各密钥的位置序列查找像素水印，没有找到时返回 watermark.ErrNoWatermark
+// 图片可能被裁剪过，区块网格的起点未知，因此需要尝试区块内的每个起点
+func (f Format) Find(ctx context.Context, img Pixels) (*Mark, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() < TileSize || bounds.Dy() < TileSize {
+		return nil, watermark.ErrNoWatermark
+	}
+
+	provider := watermark.GetKeyProvider()
+	keyIDs := append([]string{provider.ActiveKeyID()}, provider.KeyIDs()...)
+	tried := make(map[string]bool)
+
+	for _, keyID := range keyIDs {
+		if tried[keyID] {
+			continue
+		}
+		tried[keyID] = true
+
+		layout, err := f.tileLayout(keyID)
+		if err != nil {
+			return nil, err
+		}
+
+		for originY := 0; originY < TileSize && originY+TileSize <= bounds.Dy(); originY++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			for originX := 0; originX < TileSize && originX+TileSize <= bounds.Dx(); originX++ {
+				if data, ok := f.readFrame(img, layout, originX, originY); ok {
+					return &Mark{KeyID: keyID, OriginX: originX, OriginY: originY, Data: data, layout: layout}, nil
+				}
+			}
+		}
+	}
+
+	return nil, watermark.ErrNoWatermark
+}
+
+// Erase 用随机数据覆盖水印所在的位
+// 原始像素的最低位无法恢复，覆盖后的图片与添加水印前不完全相同，但差异不可见
+func Erase(img Pixels, mark *Mark) {
+	used := headerBits*headerCopies + frameCopies(len(mark.Data))*frameBits(len(mark.Data))
+	for _, origin := range Tiles(img, mark.OriginX, mark.OriginY) {
+		for _, slot := range mark.layout[:used] {
+			setBit(img, origin, slot, byte(rand.IntN(2)))
+		}
+	}
+}
+
+// Tiles 返回以(originX, originY)为起点的网格中所有完整区块的左上角
+func Tiles(img Pixels, originX, originY int) []image.Point {
+	bounds := img.Bounds()
+	var origins []image.Point
+	for y := bounds.Min.Y + originY; y+TileSize <= bounds.Max.Y; y += TileSize {
+		for x := bounds.Min.X + originX; x+TileSize <= bounds.Max.X; x += TileSize {
+			origins = append(origins, image.Point{X: x, Y: y})
+		}
+	}
+	return origins
+}
+
+// tileLayout 返回区块内各位的嵌入位置，位置序列由密钥的MAC派生
+func (f Format) tileLayout(keyID string) ([]int, error) {
+	seed, err := watermark.GetKeyProvider().MAC(keyID, f.SeedLabel)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) < 32 {
+		return nil, errors.New("密钥MAC长度不足")
+	}
+	return rand.New(rand.NewChaCha8([32]byte(seed[:32]))).Perm(tileSlots), nil
+}
+
+// frameBits 返回数据和CRC占用的位数
+func frameBits(length int) int {
+	return (length + crc32.Size) * 8
+}
+
+// frameCopies 返回数据在每个区块中的重复次数
+func frameCopies(length int) int {
+	return (tileSlots - headerBits*headerCopies) / frameBits(length)
+}
+
+// getBit 读取区块内某一位
+func getBit(img Pixels, origin image.Point, slot int) byte {
+	pixel := slot / 3
+	return img.Bit(origin.X+pixel%TileSize, origin.Y+pixel/TileSize, slot%3)
+}
+
+// setBit 设置区块内某一位
+func setBit(img Pixels, origin image.Point, slot int, bit byte) {
+	pixel := slot / 3
+	img.SetBit(origin.X+pixel%TileSize, origin.Y+pixel/TileSize, slot%3, bit)
+}
+
+// writeBits 按位写入数据，返回剩余的位置
+func writeBits(img Pixels, origin image.Point, slots []int, data []byte) []int {
+	for i := 0; i < len(data)*8; i++ {
+		setBit(img, origin, slots[i], data[i/8]>>(7-i%8)&1)
+	}
+	return slots[len(data)*8:]
+}
+
+// readBits 读取多份重复的数据，每一位按多数表决
+// copies为每个区块中的重复次数，start为第一份数据在位置序列中的下标
+func readBits(img Pixels, origins []image.Point, layout []int, start, length, copies int) []byte {
+	bits := length * 8
+	data := make([]byte, length)
+	for i := 0; i < bits; i++ {
+		ones := 0
+		for _, origin := range origins {
+			for k := 0; k < copies; k++ {
+				ones += int(getBit(img, origin, layout[start+k*bits+i]))
+			}
+		}
+		if ones*2 > len(origins)*copies {
+			data[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return data
+}
+
+// readFrame 读取以(originX, originY)为起点的网格中的帧，帧头标记或CRC不匹配时返回false
+func (f Format) readFrame(img Pixels, layout []int, originX, originY int) ([]byte, bool) {
+	// 先只读取第一个区块的帧头，绝大多数起点在这里就会被排除
+	bounds := img.Bounds()
+	first := []image.Point{{X: bounds.Min.X + originX, Y: bounds.Min.Y + originY}}
+	header := readBits(img, first, layout, 0, headerBits/8, headerCopies)
+	if binary.BigEndian.Uint16(header) != f.Magic {
+		return nil, false
+	}
+
+	origins := Tiles(img, originX, originY)
+	header = readBits(img, origins, layout, 0, headerBits/8, headerCopies)
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if binary.BigEndian.Uint16(header) != f.Magic || frameCopies(length) < 1 {
+		return nil, false
+	}
+
+	body := readBits(img, origins, layout, headerBits*headerCopies, length+crc32.Size, frameCopies(length))
+	data := body[:length]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(body[length:]) {
+		return nil, false
+	}
+	return data, true
+}
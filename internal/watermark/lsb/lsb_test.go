@@ -0,0 +1,84 @@
+package lsb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+var testFormat = Format{Magic: 0x1234, SeedLabel: []byte("watermark-test-lsb")}
+
+// testImage 生成渐变图片，图像范围从(min, min)开始
+func testImage(min, width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(min, min, min+width, min+height))
+	for y := min; y < min+height; y++ {
+		for x := min; x < min+width; x++ {
+			offset := img.PixOffset(x, y)
+			copy(img.Pix[offset:], []byte{byte(x), byte(y), byte(x + y), 0xFF})
+		}
+	}
+	return img
+}
+
+func TestEmbedFind(t *testing.T) {
+	ctx := context.Background()
+	keyID := watermark.GetKeyProvider().ActiveKeyID()
+	data := []byte("像素水印")
+
+	// 图像范围不从原点开始时，区块网格相对于图像左上角
+	img := testImage(7, 300, 200)
+	original := append([]byte(nil), img.Pix...)
+	if err := testFormat.Embed(NRGBA{img}, keyID, data); err != nil {
+		t.Fatalf("嵌入失败: %v", err)
+	}
+	for i := range img.Pix {
+		if img.Pix[i]&^1 != original[i]&^1 || (i%4 == 3 && img.Pix[i] != original[i]) {
+			t.Fatalf("偏移%d处的字节从%#x变为%#x", i, original[i], img.Pix[i])
+		}
+	}
+
+	mark, err := testFormat.Find(ctx, NRGBA{img})
+	if err != nil || !bytes.Equal(mark.Data, data) || mark.KeyID != keyID || mark.OriginX != 0 || mark.OriginY != 0 {
+		t.Fatalf("查找失败: %v", err)
+	}
+	if tiles := Tiles(NRGBA{img}, mark.OriginX, mark.OriginY); len(tiles) != 2 || tiles[0] != image.Pt(7, 7) {
+		t.Errorf("区块为 %v", tiles)
+	}
+
+	// 帧头标记不同的格式无法读取
+	other := Format{Magic: 0x4321, SeedLabel: testFormat.SeedLabel}
+	if _, err := other.Find(ctx, NRGBA{img}); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+
+	// 裁掉左边后网格起点改变，保留了第二个完整区块
+	cropped := img.SubImage(image.Rect(50, 7, 307, 207)).(*image.NRGBA)
+	mark, err = testFormat.Find(ctx, NRGBA{cropped})
+	if err != nil || !bytes.Equal(mark.Data, data) || mark.OriginX != 85 || mark.OriginY != 0 {
+		t.Fatalf("从裁剪后的图片查找失败: %v", err)
+	}
+
+	// 覆盖后所有区块中的水印都无法读取
+	mark, _ = testFormat.Find(ctx, NRGBA{img})
+	Erase(NRGBA{img}, mark)
+	if _, err := testFormat.Find(ctx, NRGBA{img}); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("覆盖后期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+}
+
+func TestEmbedTooSmall(t *testing.T) {
+	keyID := watermark.GetKeyProvider().ActiveKeyID()
+	if err := testFormat.Embed(NRGBA{testImage(0, 127, 300)}, keyID, []byte("x")); err == nil {
+		t.Error("图片小于一个区块时应当返回错误")
+	}
+	if err := testFormat.Embed(NRGBA{testImage(0, 128, 128)}, keyID, make([]byte, tileSlots/8)); err == nil {
+		t.Error("载荷超过区块容量时应当返回错误")
+	}
+	if _, err := testFormat.Find(context.Background(), NRGBA{testImage(0, 100, 100)}); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+}
@@ -2,22 +2,18 @@ package odt
 
 import (
 	"archive/zip"
-	"crypto/aes"
-	"crypto/cipher"
+	"context"
 	"crypto/md5"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
 	"strings"
-	"time"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
 )
 
 func init() {
@@ -37,35 +33,43 @@ func (w *ODTWatermarker) GetSupportedType() string {
 	return "odt"
 }
 
+// Capabilities 返回嵌入方式的能力
+func (w *ODTWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入独立的XML文件", Locate: true, Lossless: true}
+}
+
 // AddWatermark 添加水印到ODT文档
 func (w *ODTWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("输入文件不存在: %s", inputFile)
-	}
+	return watermark.AddWatermarkFile(context.Background(), w, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
 
-	// 打开ODT文件（实际上是一个ZIP文件）
-	reader, err := zip.OpenReader(inputFile)
+// ExtractWatermark 从ODT文档中提取水印
+func (w *ODTWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), w, inputFile)
 	if err != nil {
-		return fmt.Errorf("打开ODT文件失败: %w", err)
+		return "", "", err
 	}
-	defer reader.Close()
+	return payload.Text, payload.Timestamp(), nil
+}
 
-	// 创建输出文件
-	outputZip, err := os.Create(outputFile)
+// AddWatermarkStream 添加水印到ODT数据流
+func (w *ODTWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	// 打开ODT文档（实际上是一个ZIP文件）
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %w", err)
+		return fmt.Errorf("打开ODT文件失败: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	defer outputZip.Close()
 
 	// 创建一个新的zip写入器
-	zipWriter := zip.NewWriter(outputZip)
-	defer zipWriter.Close()
+	zipWriter := zip.NewWriter(dst)
 
-	// 处理元数据：加密水印信息
-	encryptedWatermark, err := encryptWatermark(watermarkText)
+	// 将水印载荷加密并封装为信封
+	armored, err := watermark.SealPayload(payload)
 	if err != nil {
-		return fmt.Errorf("加密水印失败: %w", err)
+		return err
 	}
 
 	// 创建元数据文件
@@ -76,10 +80,7 @@ func (w *ODTWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 	}
 
 	// 生成水印元数据
-	metaData := fmt.Sprintf("<watermark timestamp=\"%d\" checksum=\"%s\">%s</watermark>",
-		time.Now().Unix(),
-		generateChecksum(watermarkText),
-		encryptedWatermark)
+	metaData := fmt.Sprintf("<watermark>%s</watermark>", armored)
 
 	// 写入水印元数据
 	if _, err := metaEntry.Write([]byte(metaData)); err != nil {
@@ -88,6 +89,10 @@ func (w *ODTWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 
 	// 处理所有现有文件
 	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// 不处理已存在的水印元数据
 		if strings.HasSuffix(file.Name, "watermark-data.xml") {
 			continue
@@ -100,22 +105,20 @@ func (w *ODTWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 		}
 	}
 
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("写入ODT文件失败: %w", err)
+	}
+
 	return nil
 }
 
-// ExtractWatermark 从ODT文档中提取水印
-func (w *ODTWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("输入文件不存在: %s", inputFile)
-	}
-
-	// 打开ODT文件
-	reader, err := zip.OpenReader(inputFile)
+// ExtractWatermarkStream 从ODT数据流中提取水印
+func (w *ODTWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	// 打开ODT文档
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
-		return "", "", fmt.Errorf("打开ODT文件失败: %w", err)
+		return nil, fmt.Errorf("打开ODT文件失败: %w", err)
 	}
-	defer reader.Close()
 
 	// 查找并读取水印元数据文件
 	var watermarkData []byte
@@ -123,20 +126,20 @@ func (w *ODTWatermarker) ExtractWatermark(inputFile string) (string, string, err
 		if strings.HasSuffix(file.Name, "watermark-data.xml") {
 			rc, err := file.Open()
 			if err != nil {
-				return "", "", fmt.Errorf("打开水印元数据文件失败: %w", err)
+				return nil, fmt.Errorf("打开水印元数据文件失败: %w", err)
 			}
 			defer rc.Close()
 
-			watermarkData, err = ioutil.ReadAll(rc)
+			watermarkData, err = io.ReadAll(rc)
 			if err != nil {
-				return "", "", fmt.Errorf("读取水印元数据失败: %w", err)
+				return nil, fmt.Errorf("读取水印元数据失败: %w", err)
 			}
 			break
 		}
 	}
 
 	if watermarkData == nil || len(watermarkData) == 0 {
-		return "", "", errors.New("未找到水印数据")
+		return nil, watermark.ErrNoWatermark
 	}
 
 	// 解析XML数据
@@ -148,21 +151,71 @@ func (w *ODTWatermarker) ExtractWatermark(inputFile string) (string, string, err
 	}
 
 	if err := xml.Unmarshal(watermarkData, &watermarkInfo); err != nil {
-		return "", "", fmt.Errorf("解析水印元数据失败: %w", err)
+		return nil, fmt.Errorf("解析水印元数据失败: %w", err)
+	}
+
+	// 解析水印信封
+	if envelope.IsArmored(watermarkInfo.Data) {
+		return watermark.OpenPayload(watermarkInfo.Data)
 	}
 
-	// 解密水印数据
+	// 旧版本格式：timestamp和checksum属性，内容为加密的水印文本
 	decryptedWatermark, err := decryptWatermark(watermarkInfo.Data)
 	if err != nil {
-		return "", "", fmt.Errorf("解密水印失败: %w", err)
+		return nil, fmt.Errorf("解密水印失败: %w", err)
 	}
 
 	// 验证校验和
 	if generateChecksum(decryptedWatermark) != watermarkInfo.Checksum {
-		return "", "", errors.New("水印校验和不匹配，文件可能被篡改")
+		return nil, errors.New("水印校验和不匹配，文件可能被篡改")
 	}
 
-	return decryptedWatermark, watermarkInfo.Timestamp, nil
+	return watermark.DecodePayload([]byte(decryptedWatermark), watermarkInfo.Timestamp), nil
+}
+
+// RemoveWatermark 移除ODT文档中的水印
+func (w *ODTWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), w, inputFile, outputFile)
+}
+
+// RemoveWatermarkStream 删除ODT数据流中的水印元数据文件
+func (w *ODTWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	// 打开ODT文档
+	reader, err := zip.NewReader(src, size)
+	if err != nil {
+		return fmt.Errorf("打开ODT文件失败: %w", err)
+	}
+
+	found := false
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, "watermark-data.xml") {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return watermark.ErrNoWatermark
+	}
+
+	// 复制水印元数据以外的所有文件
+	zipWriter := zip.NewWriter(dst)
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if strings.HasSuffix(file.Name, "watermark-data.xml") {
+			continue
+		}
+		if err := copyZipFile(file, zipWriter); err != nil {
+			return fmt.Errorf("复制文件内容失败 %s: %w", file.Name, err)
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("写入ODT文件失败: %w", err)
+	}
+
+	return nil
 }
 
 // 复制zip文件内容
@@ -185,73 +238,14 @@ func copyZipFile(file *zip.File, zipWriter *zip.Writer) error {
 	return err
 }
 
-// 加密水印文本
-func encryptWatermark(text string) (string, error) {
-	// 定义密钥（实际应用中应从安全来源获取）
-	key := []byte("watermark-security-key-for-encryption")
-	plaintext := []byte(text)
-
-	// 创建一个新的AES加密块
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	// 创建一个新的GCM模式
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	// 创建随机数作为nonce
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
-
-	// 加密数据
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
-
-	// 将结果编码为base64字符串
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
-}
-
-// 解密水印文本
+// decryptWatermark 使用旧版本的内置密钥解密Base64编码的水印文本
 func decryptWatermark(encryptedText string) (string, error) {
-	// 定义密钥（必须与加密时使用的相同）
-	key := []byte("watermark-security-key-for-encryption")
-
-	// 解码base64字符串
 	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("base64解码失败: %w", err)
 	}
 
-	// 创建一个新的AES加密块
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	// 创建一个新的GCM模式
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	// 获取nonce大小
-	nonceSize := aesGCM.NonceSize()
-
-	// 检查密文长度
-	if len(ciphertext) < nonceSize {
-		return "", errors.New("密文长度不足")
-	}
-
-	// 提取nonce和实际密文
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-
-	// 解密数据
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := watermark.DecryptLegacy(ciphertext)
 	if err != nil {
 		return "", err
 	}
@@ -265,3 +259,19 @@ func generateChecksum(text string) string {
 	hasher.Write([]byte(text))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
+
+// LocateWatermarks 返回ODT数据流中的水印元数据文件
+func (w *ODTWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	reader, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, fmt.Errorf("打开ODT文件失败: %w", err)
+	}
+
+	var locations []string
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, "watermark-data.xml") {
+			locations = append(locations, file.Name)
+		}
+	}
+	return locations, nil
+}
@@ -0,0 +1,112 @@
+package overlay
+
+//go:generate go run gen_font.go -font /usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf
+
+import "math"
+
+// glyph 内置字体的字形
+// contours 中每个轮廓依次保存各点的 x<<1|onCurve 和 y，单位为字体单位，y轴向上，
+// 与TrueType相同，相邻两个控制点之间隐含一个曲线上的点
+type glyph struct {
+	advance  int
+	contours [][]int16
+}
+
+// supported 判断内置字体是否包含字符
+func supported(r rune) bool {
+	_, ok := glyphs[r]
+	return ok
+}
+
+// vec 二维坐标
+type vec struct {
+	x, y float64
+}
+
+func mid(a, b vec) vec {
+	return vec{(a.x + b.x) / 2, (a.y + b.y) / 2}
+}
+
+// walkContour 遍历字形轮廓，transform 将字体单位的坐标转换为图像坐标，
+// lineTo 依次收到轮廓展开成折线后的各点，第一个点为起点，最后回到起点
+func walkContour(points []int16, transform func(x, y float64) vec, lineTo func(p vec)) {
+	n := len(points) / 2
+	if n == 0 {
+		return
+	}
+	at := func(i int) (vec, bool) {
+		i %= n
+		return transform(float64(points[2*i]>>1), float64(points[2*i+1])), points[2*i]&1 != 0
+	}
+
+	// 从第一个曲线上的点开始，全部为控制点时从首尾两个控制点的中点开始
+	start := -1
+	for i := 0; i < n; i++ {
+		if _, on := at(i); on {
+			start = i
+			break
+		}
+	}
+	var first vec
+	var sequence []int
+	if start >= 0 {
+		first, _ = at(start)
+		for k := 1; k <= n; k++ {
+			sequence = append(sequence, start+k)
+		}
+	} else {
+		a, _ := at(n - 1)
+		b, _ := at(0)
+		first = mid(a, b)
+		for k := 0; k <= n; k++ {
+			sequence = append(sequence, k)
+		}
+	}
+
+	current := first
+	lineTo(current)
+	var control *vec
+	for i, index := range sequence {
+		q, on := at(index)
+		if start < 0 && i == n {
+			q, on = first, true
+		}
+		switch {
+		case on && control == nil:
+			lineTo(q)
+		case on:
+			quadTo(current, *control, q, lineTo)
+			control = nil
+		case control == nil:
+			control = &q
+			continue
+		default:
+			m := mid(*control, q)
+			quadTo(current, *control, m, lineTo)
+			current = m
+			control = &q
+			continue
+		}
+		current = q
+	}
+}
+
+// flattenTolerance 二次曲线展开成折线时允许的最大误差（像素）
+const flattenTolerance = 0.1
+
+// quadTo 将二次曲线展开为折线，分段数使误差不超过 flattenTolerance
+func quadTo(p0, c, p1 vec, lineTo func(p vec)) {
+	dd := math.Hypot(p0.x-2*c.x+p1.x, p0.y-2*c.y+p1.y)
+	segments := int(math.Ceil(math.Sqrt(dd / (8 * flattenTolerance))))
+	if segments < 1 {
+		segments = 1
+	}
+	for i := 1; i <= segments; i++ {
+		t := float64(i) / float64(segments)
+		u := 1 - t
+		lineTo(vec{
+			x: u*u*p0.x + 2*u*t*c.x + t*t*p1.x,
+			y: u*u*p0.y + 2*u*t*c.y + t*t*p1.y,
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Code generated by gen_font.go from DejaVuSans-Bold.ttf; DO NOT EDIT.
+
+// 字形轮廓来自DejaVu字体，DejaVu字体的修改基于Bitstream Vera字体，按Bitstream Vera字体许可证发布，
+// 允许复制、修改和再发布。Bitstream Vera is a trademark of Bitstream, Inc.
+
+package overlay
+
+const (
+	unitsPerEm  = 2048
+	fontAscent  = 1901
+	fontDescent = -483
+)
+
+var glyphs = map[rune]glyph{
+	' ':  {advance: 713, contours: [][]int16{}},
+	'!':  {advance: 934, contours: [][]int16{{575, 1493, 1295, 1493, 1295, 920, 1193, 502, 677, 502, 575, 920}, {575, 356, 1295, 356, 1295, 0, 575, 0}}},
+	'"':  {advance: 1067, contours: [][]int16{{1745, 1493, 1745, 938, 1271, 938, 1271, 1493}, {865, 1493, 865, 938, 391, 938, 391, 1493}}},
+	'#':  {advance: 1716, contours: [][]int16{{1823, 1470, 1631, 1085, 2159, 1085, 2353, 1470, 2795, 1470, 2601, 1085, 3155, 1085, 3155, 872, 2495, 872, 2357, 598, 2925, 598, 2925, 383, 2253, 383, 2061, 0, 1619, 0, 1811, 383, 1283, 383, 1091, 0, 645, 0, 837, 383, 279, 383, 279, 598, 935, 598, 1075, 872, 509, 872, 509, 1085, 1185, 1085, 1377, 1470}, {2049, 872, 1521, 872, 1381, 598, 1909, 598}}},
+	'$':  {advance: 1425, contours: [][]int16{{1591, -301, 1267, -301, 1265, 0, 1014, 5, 546, 51, 325, 92, 325, 354, 554, 295, 1024, 232, 1267, 228, 1267, 539, 1201, 545, 722, 587, 320, 767, 321, 936, 320, 1115, 810, 1316, 1265, 1325, 1267, 1556, 1591, 1556, 1591, 1329, 1790, 1321, 2190, 1287, 2393, 1260, 2393, 1006, 2192, 1048, 1792, 1095, 1591, 1100, 1591, 813, 1655, 807, 2162, 767, 2572, 580, 2573, 397, 2572, 213, 2084, 16, 1591, 2}, {1267, 836, 1267, 1097, 1124, 1093, 954, 1024, 955, 971, 954, 912, 1110, 845}, {1591, 510, 1591, 232, 1764, 233, 1938, 299, 1939, 365, 1938, 433, 1778, 500}}},
+	'%':  {advance: 2052, contours: [][]int16{{3175, 616, 3032, 616, 2876, 493, 2877, 379, 2876, 264, 3030, 141, 3175, 141, 3318, 141, 3470, 264, 3471, 379, 3470, 493, 3316, 616}, {3175, 784, 3546, 784, 3974, 568, 3975, 379, 3974, 190, 3546, -29, 3175, -29, 2802, -29, 2372, 190, 2373, 379, 2372, 567, 2802, 784}, {1341, -29, 899, -29, 2765, 1520, 3209, 1520}, {931, 1520, 1302, 1520, 1728, 1303, 1729, 1114, 1728, 925, 1302, 707, 931, 707, 558, 707, 132, 925, 133, 1114, 132, 1303, 558, 1520}, {931, 1352, 786, 1352, 630, 1228, 631, 1114, 630, 999, 786, 874, 931, 874, 1074, 874, 1228, 999, 1229, 1114, 1228, 1228, 1072, 1352}}},
+	'&':  {advance: 1786, contours: [][]int16{{1599, 991, 2417, 541, 2522, 611, 2632, 785, 2643, 895, 3265, 895, 3234, 713, 3012, 429, 2815, 322, 3401, 0, 2553, 0, 2357, 109, 2146, 39, 1682, -29, 1423, -29, 896, -29, 246, 248, 247, 467, 246, 613, 532, 838, 857, 944, 772, 997, 692, 1103, 693, 1161, 692, 1324, 1200, 1520, 1623, 1520, 1804, 1520, 2198, 1491, 2413, 1462, 2413, 1184, 2224, 1232, 1888, 1278, 1729, 1278, 1574, 1278, 1404, 1219, 1405, 1165, 1404, 1131, 1502, 1044}, {1201, 743, 1070, 696, 938, 577, 939, 506, 938, 391, 1278, 229, 1517, 229, 1650, 229, 1882, 270, 1983, 311}}},
+	'\'': {advance: 627, contours: [][]int16{{865, 1493, 865, 938, 391, 938, 391, 1493}}},
+	'(':  {advance: 936, contours: [][]int16{{1545, -270, 951, -270, 644, -23, 352, 422, 353, 641, 352, 860, 646, 1309, 951, 1554, 1545, 1554, 1288, 1317, 1032, 864, 1033, 643, 1032, 422, 1286, -32}}},
+	')':  {advance: 936, contours: [][]int16{{329, -270, 584, -32, 840, 422, 841, 643, 840, 864, 584, 1317, 329, 1554, 923, 1554, 1226, 1309, 1520, 860, 1521, 641, 1520, 422, 1228, -23, 923, -270}}},
+	'*':  {advance: 1071, contours: [][]int16{{2061, 1217, 1401, 1044, 2061, 870, 1909, 729, 1243, 913, 1243, 569, 903, 569, 903, 913, 235, 729, 83, 870, 751, 1044, 83, 1217, 235, 1358, 903, 1176, 903, 1520, 1243, 1520, 1243, 1176, 1909, 1358}}},
+	'+':  {advance: 1716, contours: [][]int16{{1955, 1284, 1955, 760, 2999, 760, 2999, 524, 1955, 524, 1955, 0, 1479, 0, 1479, 524, 435, 524, 435, 760, 1479, 760, 1479, 1284}}},
+	',':  {advance: 778, contours: [][]int16{{419, 387, 1139, 387, 1139, 82, 645, -291, 219, -291, 419, 82}}},
+	'-':  {advance: 850, contours: [][]int16{{223, 735, 1479, 735, 1479, 444, 223, 444}}},
+	'.':  {advance: 778, contours: [][]int16{{419, 387, 1139, 387, 1139, 0, 419, 0}}},
+	'/':  {advance: 748, contours: [][]int16{{1053, 1493, 1497, 1493, 443, -190, 1, -190}}},
+	'0':  {advance: 1425, contours: [][]int16{{1885, 748, 1884, 1028, 1674, 1257, 1427, 1257, 1178, 1257, 966, 1028, 967, 748, 966, 465, 1178, 233, 1427, 233, 1672, 233, 1884, 465}, {2655, 745, 2654, 374, 2014, -29, 1427, -29, 836, -29, 196, 374, 197, 745, 196, 1117, 836, 1520, 1427, 1520, 2014, 1520, 2654, 1117}}},
+	'1':  {advance: 1425, contours: [][]int16{{481, 266, 1161, 266, 1161, 1231, 463, 1159, 463, 1421, 1157, 1493, 1889, 1493, 1889, 266, 2569, 266, 2569, 0, 481, 0}}},
+	'2':  {advance: 1425, contours: [][]int16{{1181, 283, 2495, 283, 2495, 0, 325, 0, 325, 283, 1415, 764, 1560, 830, 1700, 956, 1701, 1024, 1700, 1129, 1418, 1257, 1185, 1257, 1004, 1257, 576, 1180, 333, 1104, 333, 1432, 592, 1475, 1100, 1520, 1345, 1520, 1880, 1520, 2474, 1284, 2475, 1073, 2474, 951, 2222, 740, 1819, 563}}},
+	'3':  {advance: 1425, contours: [][]int16{{1909, 805, 2210, 766, 2524, 573, 2525, 424, 2524, 202, 1844, -29, 1193, -29, 962, -29, 500, 8, 275, 45, 275, 342, 490, 288, 916, 233, 1123, 233, 1428, 233, 1754, 339, 1755, 438, 1754, 540, 1420, 645, 1095, 645, 787, 645, 787, 893, 1111, 893, 1400, 893, 1684, 984, 1685, 1077, 1684, 1163, 1408, 1257, 1157, 1257, 970, 1257, 590, 1215, 403, 1174, 403, 1456, 630, 1488, 1078, 1520, 1295, 1520, 1876, 1520, 2454, 1329, 2455, 1137, 2454, 1006, 2178, 839}}},
+	'4':  {advance: 1425, contours: [][]int16{{1509, 1176, 665, 551, 1509, 551}, {1381, 1493, 2237, 1493, 2237, 551, 2663, 551, 2663, 272, 2237, 272, 2237, 0, 1509, 0, 1509, 272, 185, 272, 185, 602}}},
+	'5':  {advance: 1425, contours: [][]int16{{435, 1493, 2349, 1493, 2349, 1210, 1049, 1210, 1049, 979, 1136, 991, 1314, 1004, 1411, 1004, 1956, 1004, 2564, 731, 2565, 487, 2564, 245, 1902, -29, 1315, -29, 1060, -29, 562, 20, 317, 70, 317, 373, 560, 303, 998, 233, 1193, 233, 1472, 233, 1794, 370, 1795, 487, 1794, 605, 1472, 741, 1193, 741, 1026, 741, 650, 698, 435, 653}}},
+	'6':  {advance: 1425, contours: [][]int16{{1483, 737, 1280, 737, 1078, 606, 1079, 475, 1078, 344, 1280, 213, 1483, 213, 1686, 213, 1888, 344, 1889, 475, 1888, 606, 1686, 737}, {2435, 1454, 2435, 1178, 2244, 1223, 1908, 1266, 1749, 1266, 1404, 1266, 1020, 1075, 989, 887, 1120, 936, 1428, 985, 1611, 985, 2068, 985, 2630, 717, 2631, 500, 2630, 260, 2002, -29, 1475, -29, 892, -29, 254, 364, 255, 725, 254, 1095, 1000, 1518, 1651, 1518, 1856, 1518, 2244, 1486}}},
+	'7':  {advance: 1425, contours: [][]int16{{275, 1493, 2525, 1493, 2525, 1276, 1361, 0, 611, 0, 1713, 1210, 275, 1210}}},
+	'8':  {advance: 1425, contours: [][]int16{{1427, 668, 1210, 668, 978, 550, 979, 440, 978, 330, 1210, 213, 1427, 213, 1640, 213, 1868, 330, 1869, 440, 1868, 551, 1640, 668}, {865, 795, 592, 836, 316, 1006, 317, 1133, 316, 1322, 880, 1520, 1427, 1520, 1968, 1520, 2532, 1323, 2533, 1133, 2532, 1006, 2254, 836, 1983, 795, 2286, 753, 2596, 564, 2597, 420, 2596, 198, 2006, -29, 1427, -29, 844, -29, 250, 198, 251, 420, 250, 564, 560, 753}, {1045, 1094, 1044, 1005, 1242, 909, 1427, 909, 1606, 909, 1802, 1005, 1803, 1094, 1802, 1183, 1606, 1278, 1427, 1278, 1242, 1278, 1044, 1182}}},
+	'9':  {advance: 1425, contours: [][]int16{{411, 33, 411, 309, 594, 266, 930, 223, 1095, 223, 1438, 223, 1822, 414, 1857, 602, 1720, 552, 1412, 502, 1233, 502, 774, 502, 212, 769, 213, 987, 212, 1228, 838, 1518, 1365, 1518, 1948, 1518, 2588, 1124, 2589, 764, 2588, 394, 1840, -29, 1189, -29, 978, -29, 594, 2}, {1361, 752, 1562, 752, 1766, 883, 1767, 1014, 1766, 1144, 1562, 1276, 1361, 1276, 1158, 1276, 954, 1144, 955, 1014, 954, 883, 1158, 752}}},
+	':':  {advance: 819, contours: [][]int16{{459, 1120, 1181, 1120, 1181, 733, 459, 733}, {459, 387, 1181, 387, 1181, 0, 459, 0}}},
+	';':  {advance: 819, contours: [][]int16{{459, 387, 1181, 387, 1181, 82, 685, -291, 259, -291, 459, 82}, {459, 1120, 1181, 1120, 1181, 733, 459, 733}}},
+	'<':  {advance: 1716, contours: [][]int16{{2999, 973, 1071, 641, 2999, 311, 2999, 61, 435, 524, 435, 760, 2999, 1223}}},
+	'=':  {advance: 1716, contours: [][]int16{{435, 987, 2999, 987, 2999, 752, 435, 752}, {435, 532, 2999, 532, 2999, 295, 435, 295}}},
+	'>':  {advance: 1716, contours: [][]int16{{435, 973, 435, 1223, 2999, 760, 2999, 524, 435, 61, 435, 311, 2365, 641}}},
+	'?':  {advance: 1188, contours: [][]int16{{1419, 504, 697, 504, 697, 553, 696, 635, 828, 762, 1041, 860, 1169, 918, 1282, 970, 1388, 1062, 1389, 1108, 1388, 1178, 1196, 1257, 1025, 1257, 862, 1257, 486, 1190, 283, 1124, 283, 1438, 524, 1480, 924, 1520, 1111, 1520, 1598, 1520, 2110, 1321, 2111, 1130, 2110, 1032, 1954, 877, 1767, 788, 1639, 731, 1502, 669, 1418, 594, 1419, 549}, {697, 356, 1419, 356, 1419, 0, 697, 0}}},
+	'@':  {advance: 2048, contours: [][]int16{{1663, 539, 1662, 416, 1872, 274, 2053, 274, 2230, 274, 2442, 417, 2443, 539, 2442, 660, 2228, 801, 2049, 801, 1872, 801, 1662, 660}, {2483, 238, 2422, 167, 2156, 88, 1979, 88, 1634, 88, 1204, 337, 1205, 537, 1204, 737, 1636, 987, 1979, 987, 2156, 987, 2422, 907, 2483, 836, 2483, 967, 2901, 967, 2901, 274, 3148, 293, 3432, 494, 3433, 651, 3432, 751, 3316, 926, 3199, 999, 3008, 1121, 2438, 1253, 2107, 1253, 1874, 1253, 1450, 1192, 1271, 1133, 974, 1035, 644, 724, 645, 543, 644, 394, 858, 133, 1061, 33, 1260, -65, 1778, -168, 2073, -168, 2324, -168, 2828, -74, 3007, 6, 3221, -156, 2970, -253, 2380, -356, 2077, -356, 1706, -356, 1050, -225, 795, -100, 538, 25, 270, 354, 271, 543, 270, 725, 542, 1055, 795, 1180, 1046, 1304, 1716, 1440, 2077, 1440, 2524, 1440, 3256, 1269, 3503, 1108, 3652, 1010, 3806, 781, 3807, 655, 3806, 384, 3154, 84, 2561, 84, 2483, 84}}},
+	'A':  {advance: 1585, contours: [][]int16{{2189, 272, 985, 272, 795, 0, 21, 0, 1127, 1493, 2045, 1493, 3151, 0, 2377, 0}, {1177, 549, 1995, 549, 1587, 1143}}},
+	'B':  {advance: 1561, contours: [][]int16{{1573, 915, 1754, 915, 1942, 995, 1943, 1073, 1942, 1150, 1754, 1231, 1573, 1231, 1147, 1231, 1147, 915}, {1599, 262, 1830, 262, 2064, 360, 2065, 459, 2064, 556, 1832, 653, 1599, 653, 1147, 653, 1147, 262}, {2315, 799, 2562, 763, 2834, 569, 2835, 428, 2834, 212, 2250, 0, 1655, 0, 377, 0, 377, 1493, 1533, 1493, 2154, 1493, 2712, 1305, 2713, 1098, 2712, 989, 2508, 836}}},
+	'C':  {advance: 1503, contours: [][]int16{{2745, 82, 2532, 27, 2072, -29, 1823, -29, 1076, -29, 204, 388, 205, 745, 204, 1103, 1076, 1520, 1823, 1520, 2072, 1520, 2532, 1464, 2745, 1409, 2745, 1100, 2530, 1173, 2114, 1241, 1885, 1241, 1472, 1241, 1000, 977, 1001, 745, 1000, 514, 1472, 250, 1885, 250, 2114, 250, 2530, 318, 2745, 391}}},
+	'D':  {advance: 1700, contours: [][]int16{{1147, 1202, 1147, 291, 1423, 291, 1894, 291, 2392, 525, 2393, 748, 2392, 970, 1896, 1202, 1423, 1202}, {377, 1493, 1189, 1493, 1868, 1493, 2534, 1396, 2773, 1280, 2982, 1179, 3186, 915, 3187, 748, 3186, 579, 2982, 314, 2773, 213, 2532, 97, 1860, 0, 1189, 0, 377, 0}}},
+	'E':  {advance: 1399, contours: [][]int16{{377, 1493, 2455, 1493, 2455, 1202, 1147, 1202, 1147, 924, 2377, 924, 2377, 633, 1147, 633, 1147, 291, 2499, 291, 2499, 0, 377, 0}}},
+	'F':  {advance: 1399, contours: [][]int16{{377, 1493, 2455, 1493, 2455, 1202, 1147, 1202, 1147, 924, 2377, 924, 2377, 633, 1147, 633, 1147, 0, 377, 0}}},
+	'G':  {advance: 1681, contours: [][]int16{{3061, 111, 2772, 41, 2152, -29, 1823, -29, 1076, -29, 204, 388, 205, 745, 204, 1106, 1092, 1520, 1865, 1520, 2162, 1520, 2708, 1464, 2951, 1409, 2951, 1100, 2700, 1171, 2206, 1241, 1959, 1241, 1498, 1241, 1000, 984, 1001, 745, 1000, 508, 1480, 250, 1923, 250, 2042, 250, 2248, 265, 2331, 281, 2331, 571, 1861, 571, 1861, 829, 3061, 829}}},
+	'H':  {advance: 1714, contours: [][]int16{{377, 1493, 1147, 1493, 1147, 924, 2283, 924, 2283, 1493, 3053, 1493, 3053, 0, 2283, 0, 2283, 633, 1147, 633, 1147, 0, 377, 0}}},
+	'I':  {advance: 762, contours: [][]int16{{377, 1493, 1147, 1493, 1147, 0, 377, 0}}},
+	'J':  {advance: 762, contours: [][]int16{{377, 1493, 1147, 1493, 1147, 145, 1146, -134, 540, -410, -73, -410, -229, -410, -229, -119, -109, -119, 130, -119, 376, 15, 377, 145}}},
+	'K':  {advance: 1587, contours: [][]int16{{377, 1493, 1147, 1493, 1147, 948, 2257, 1493, 3151, 1493, 1713, 786, 3299, 0, 2335, 0, 1147, 588, 1147, 0, 377, 0}}},
+	'L':  {advance: 1305, contours: [][]int16{{377, 1493, 1147, 1493, 1147, 291, 2499, 291, 2499, 0, 377, 0}}},
+	'M':  {advance: 2038, contours: [][]int16{{377, 1493, 1357, 1493, 2037, 694, 2721, 1493, 3699, 1493, 3699, 0, 2971, 0, 2971, 1092, 2283, 287, 1795, 287, 1107, 1092, 1107, 0, 377, 0}}},
+	'N':  {advance: 1714, contours: [][]int16{{377, 1493, 1237, 1493, 2323, 469, 2323, 1493, 3053, 1493, 3053, 0, 2193, 0, 1107, 1024, 1107, 0, 377, 0}}},
+	'O':  {advance: 1741, contours: [][]int16{{1741, 1241, 1388, 1241, 1000, 981, 1001, 745, 1000, 510, 1388, 250, 1741, 250, 2094, 250, 2482, 510, 2483, 745, 2482, 981, 2094, 1241}, {1741, 1520, 2460, 1520, 3276, 1108, 3277, 745, 3276, 383, 2460, -29, 1741, -29, 1022, -29, 204, 383, 205, 745, 204, 1108, 1022, 1520}}},
+	'P':  {advance: 1501, contours: [][]int16{{377, 1493, 1655, 1493, 2224, 1493, 2834, 1240, 2835, 1006, 2834, 771, 2224, 518, 1655, 518, 1147, 518, 1147, 0, 377, 0}, {1147, 1214, 1147, 797, 1573, 797, 1796, 797, 2040, 906, 2041, 1006, 2040, 1106, 1796, 1214, 1573, 1214}}},
+	'Q':  {advance: 1741, contours: [][]int16{{1823, -27, 1763, -27, 1024, -27, 204, 381, 205, 745, 204, 1108, 1022, 1520, 1741, 1520, 2466, 1520, 3276, 1112, 3277, 745, 3276, 493, 2846, 129, 2443, 37, 3045, -299, 2311, -299}, {1741, 1241, 1388, 1241, 1000, 981, 1001, 745, 1000, 505, 1380, 250, 1741, 250, 2094, 250, 2482, 510, 2483, 745, 2482, 981, 2094, 1241}}},
+	'R':  {advance: 1577, contours: [][]int16{{1471, 831, 1712, 831, 1922, 921, 1923, 1024, 1922, 1126, 1712, 1214, 1471, 1214, 1147, 1214, 1147, 831}, {1147, 565, 1147, 0, 377, 0, 377, 1493, 1553, 1493, 2142, 1493, 2692, 1295, 2693, 1081, 2692, 933, 2406, 743, 2119, 698, 2276, 680, 2526, 553, 2655, 424, 3073, 0, 2253, 0, 1889, 371, 1778, 483, 1552, 565, 1365, 565}}},
+	'S':  {advance: 1475, contours: [][]int16{{2455, 1446, 2455, 1130, 2208, 1185, 1740, 1241, 1533, 1241, 1256, 1241, 992, 1165, 993, 1085, 992, 1025, 1170, 958, 1405, 934, 1733, 901, 2230, 851, 2650, 647, 2651, 459, 2650, 212, 2064, -29, 1463, -29, 1178, -29, 606, 25, 321, 78, 321, 403, 606, 327, 1140, 250, 1389, 250, 1640, 250, 1908, 334, 1909, 412, 1908, 482, 1726, 558, 1455, 588, 1157, 621, 708, 669, 294, 879, 295, 1057, 294, 1280, 870, 1520, 1411, 1520, 1656, 1520, 2176, 1483}}},
+	'T':  {advance: 1397, contours: [][]int16{{21, 1493, 2773, 1493, 2773, 1202, 1783, 1202, 1783, 0, 1013, 0, 1013, 1202, 21, 1202}}},
+	'U':  {advance: 1663, contours: [][]int16{{377, 1493, 1147, 1493, 1147, 598, 1146, 413, 1388, 254, 1663, 254, 1938, 254, 2180, 413, 2181, 598, 2181, 1493, 2951, 1493, 2951, 598, 2950, 281, 2314, -29, 1663, -29, 1012, -29, 376, 281, 377, 598}}},
+	'V':  {advance: 1585, contours: [][]int16{{21, 1493, 795, 1493, 1587, 391, 2377, 1493, 3151, 1493, 2045, 0, 1127, 0}}},
+	'W':  {advance: 2259, contours: [][]int16{{123, 1493, 861, 1493, 1377, 408, 1889, 1493, 2631, 1493, 3143, 408, 3659, 1493, 4391, 1493, 3687, 0, 2799, 0, 2257, 1135, 1721, 0, 833, 0}}},
+	'X':  {advance: 1579, contours: [][]int16{{2041, 762, 3077, 0, 2275, 0, 1577, 510, 885, 0, 79, 0, 1115, 762, 119, 1493, 923, 1493, 1577, 1012, 2229, 1493, 3037, 1493}}},
+	'Y':  {advance: 1483, contours: [][]int16{{-39, 1493, 803, 1493, 1483, 961, 2163, 1493, 3007, 1493, 1869, 629, 1869, 0, 1099, 0, 1099, 629}}},
+	'Z':  {advance: 1485, contours: [][]int16{{231, 1493, 2741, 1493, 2741, 1260, 1139, 291, 2787, 291, 2787, 0, 185, 0, 185, 233, 1787, 1202, 231, 1202}}},
+	'[':  {advance: 936, contours: [][]int16{{353, 1556, 1595, 1556, 1595, 1331, 1033, 1331, 1033, -45, 1595, -45, 1595, -270, 353, -270}}},
+	'\\': {advance: 748, contours: [][]int16{{1053, -190, 1, 1493, 443, 1493, 1497, -190}}},
+	']':  {advance: 936, contours: [][]int16{{1521, -270, 279, -270, 279, -45, 841, -45, 841, 1331, 279, 1331, 279, 1556, 1521, 1556}}},
+	'^':  {advance: 1716, contours: [][]int16{{1963, 1493, 3019, 936, 2537, 936, 1717, 1237, 899, 936, 415, 936, 1471, 1493}}},
+	'_':  {advance: 1024, contours: [][]int16{{2049, -293, 2049, -483, 1, -483, 1, -293}}},
+	'`':  {advance: 1024, contours: [][]int16{{755, 1638, 1319, 1262, 927, 1262, 189, 1638}}},
+	'a':  {advance: 1382, contours: [][]int16{{1349, 504, 1124, 504, 898, 428, 899, 354, 898, 286, 1080, 209, 1243, 209, 1444, 209, 1720, 354, 1721, 463, 1721, 504}, {2443, 639, 2443, 0, 1721, 0, 1721, 166, 1576, 64, 1216, -29, 959, -29, 610, -29, 176, 174, 177, 336, 176, 533, 718, 717, 1299, 717, 1721, 717, 1721, 745, 1720, 830, 1452, 909, 1169, 909, 938, 909, 542, 863, 373, 817, 373, 1090, 602, 1118, 1066, 1147, 1299, 1147, 1904, 1147, 2442, 908}}},
+	'b':  {advance: 1466, contours: [][]int16{{1537, 231, 1766, 231, 2008, 399, 2009, 559, 2008, 719, 1766, 887, 1537, 887, 1306, 887, 1060, 718, 1061, 559, 1060, 400, 1306, 231}, {1061, 956, 1208, 1054, 1568, 1147, 1803, 1147, 2216, 1147, 2748, 818, 2749, 559, 2748, 300, 2216, -29, 1803, -29, 1568, -29, 1208, 64, 1061, 162, 1061, 0, 345, 0, 345, 1556, 1061, 1556}}},
+	'c':  {advance: 1214, contours: [][]int16{{2155, 1085, 2155, 793, 2008, 843, 1714, 891, 1557, 891, 1256, 891, 922, 716, 923, 559, 922, 402, 1256, 227, 1557, 227, 1724, 227, 2026, 277, 2155, 326, 2155, 33, 1986, 2, 1640, -29, 1467, -29, 860, -29, 176, 282, 177, 559, 176, 836, 860, 1147, 1467, 1147, 1642, 1147, 1984, 1116}}},
+	'd':  {advance: 1466, contours: [][]int16{{1869, 956, 1869, 1556, 2589, 1556, 2589, 0, 1869, 0, 1869, 162, 1720, 63, 1364, -29, 1131, -29, 716, -29, 184, 300, 185, 559, 184, 818, 716, 1147, 1131, 1147, 1362, 1147, 1720, 1054}, {1397, 231, 1626, 231, 1868, 399, 1869, 559, 1868, 719, 1626, 887, 1397, 887, 1168, 887, 926, 719, 927, 559, 926, 399, 1168, 231}}},
+	'e':  {advance: 1389, contours: [][]int16{{2581, 563, 2581, 461, 907, 461, 932, 335, 1244, 209, 1525, 209, 1750, 209, 2224, 276, 2475, 344, 2475, 68, 2220, 20, 1712, -29, 1459, -29, 850, -29, 176, 280, 177, 559, 176, 833, 838, 1147, 1419, 1147, 1946, 1147, 2580, 829}, {1845, 682, 1844, 784, 1606, 909, 1415, 909, 1206, 909, 946, 792, 915, 682}}},
+	'f':  {advance: 891, contours: [][]int16{{1819, 1556, 1819, 1321, 1423, 1321, 1270, 1321, 1150, 1266, 1151, 1198, 1151, 1120, 1763, 1120, 1763, 864, 1151, 864, 1151, 0, 435, 0, 435, 864, 79, 864, 79, 1120, 435, 1120, 435, 1198, 434, 1381, 842, 1556, 1271, 1556}}},
+	'g':  {advance: 1466, contours: [][]int16{{1869, 190, 1720, 92, 1364, 0, 1131, 0, 720, 0, 184, 323, 185, 573, 184, 824, 720, 1145, 1131, 1145, 1364, 1145, 1720, 1053, 1869, 954, 1869, 1120, 2589, 1120, 2589, 113, 2588, -157, 1906, -442, 1259, -442, 1048, -442, 656, -410, 459, -377, 459, -98, 646, -152, 1006, -205, 1189, -205, 1540, -205, 1868, -51, 1869, 113}, {1397, 887, 1174, 887, 926, 723, 927, 573, 926, 419, 1166, 260, 1397, 260, 1620, 260, 1868, 424, 1869, 573, 1868, 723, 1620, 887}}},
+	'h':  {advance: 1458, contours: [][]int16{{2597, 682, 2597, 0, 1877, 0, 1877, 111, 1877, 520, 1876, 667, 1850, 777, 1819, 803, 1776, 838, 1632, 877, 1541, 877, 1316, 877, 1060, 704, 1061, 551, 1061, 0, 345, 0, 345, 1556, 1061, 1556, 1061, 956, 1222, 1054, 1586, 1147, 1807, 1147, 2194, 1147, 2596, 909}}},
+	'i':  {advance: 702, contours: [][]int16{{345, 1120, 1061, 1120, 1061, 0, 345, 0}, {345, 1556, 1061, 1556, 1061, 1264, 345, 1264}}},
+	'j':  {advance: 702, contours: [][]int16{{345, 1120, 1061, 1120, 1061, 20, 1060, -205, 628, -442, 219, -442, -135, -442, -135, -207, -11, -207, 192, -207, 344, -115, 345, 20}, {345, 1556, 1061, 1556, 1061, 1264, 345, 1264}}},
+	'k':  {advance: 1362, contours: [][]int16{{345, 1556, 1061, 1556, 1061, 709, 1885, 1120, 2717, 1120, 1623, 606, 2803, 0, 1935, 0, 1061, 467, 1061, 0, 345, 0}}},
+	'l':  {advance: 702, contours: [][]int16{{345, 1556, 1061, 1556, 1061, 0, 345, 0}}},
+	'm':  {advance: 2134, contours: [][]int16{{2421, 934, 2556, 1038, 2930, 1147, 3155, 1147, 3540, 1147, 3944, 909, 3945, 682, 3945, 0, 3225, 0, 3225, 584, 3226, 597, 3228, 625, 3229, 651, 3228, 770, 3088, 877, 2933, 877, 2728, 877, 2506, 709, 2503, 550, 2503, 0, 1783, 0, 1783, 584, 1782, 770, 1654, 877, 1491, 877, 1284, 877, 1060, 708, 1061, 551, 1061, 0, 341, 0, 341, 1120, 1061, 1120, 1061, 956, 1192, 1051, 1534, 1147, 1741, 1147, 1972, 1147, 2328, 1035}}},
+	'n':  {advance: 1458, contours: [][]int16{{2597, 682, 2597, 0, 1877, 0, 1877, 111, 1877, 522, 1876, 667, 1850, 777, 1819, 803, 1776, 838, 1632, 877, 1541, 877, 1316, 877, 1060, 704, 1061, 551, 1061, 0, 345, 0, 345, 1120, 1061, 1120, 1061, 956, 1222, 1054, 1586, 1147, 1807, 1147, 2194, 1147, 2596, 909}}},
+	'o':  {advance: 1407, contours: [][]int16{{1411, 891, 1172, 891, 922, 720, 923, 559, 922, 398, 1172, 227, 1411, 227, 1644, 227, 1892, 398, 1893, 559, 1892, 720, 1644, 891}, {1411, 1147, 1988, 1147, 2638, 835, 2639, 559, 2638, 283, 1988, -29, 1411, -29, 830, -29, 176, 283, 177, 559, 176, 835, 830, 1147}}},
+	'p':  {advance: 1466, contours: [][]int16{{1061, 162, 1061, -426, 345, -426, 345, 1120, 1061, 1120, 1061, 956, 1208, 1054, 1568, 1147, 1803, 1147, 2216, 1147, 2748, 818, 2749, 559, 2748, 300, 2216, -29, 1803, -29, 1568, -29, 1208, 64}, {1537, 887, 1306, 887, 1060, 718, 1061, 559, 1060, 400, 1306, 231, 1537, 231, 1766, 231, 2008, 399, 2009, 559, 2008, 719, 1766, 887}}},
+	'q':  {advance: 1466, contours: [][]int16{{1397, 887, 1168, 887, 926, 719, 927, 559, 926, 399, 1168, 231, 1397, 231, 1626, 231, 1868, 399, 1869, 559, 1868, 719, 1626, 887}, {1869, 162, 1720, 63, 1364, -29, 1131, -29, 716, -29, 184, 300, 185, 559, 184, 818, 716, 1145, 1131, 1145, 1364, 1145, 1720, 1053, 1869, 954, 1869, 1120, 2589, 1120, 2589, -426, 1869, -426}}},
+	'r':  {advance: 1010, contours: [][]int16{{2009, 815, 1914, 837, 1728, 858, 1635, 858, 1358, 858, 1060, 681, 1061, 516, 1061, 0, 345, 0, 345, 1120, 1061, 1120, 1061, 936, 1198, 1046, 1556, 1147, 1807, 1147, 1842, 1147, 1926, 1144, 2007, 1139}}},
+	's':  {advance: 1219, contours: [][]int16{{2095, 1085, 2095, 813, 1864, 861, 1436, 909, 1247, 909, 1042, 909, 844, 858, 845, 805, 844, 762, 994, 716, 1189, 705, 1315, 696, 1864, 661, 2244, 501, 2245, 330, 2244, 151, 1716, -29, 1193, -29, 970, -29, 496, 6, 247, 41, 247, 313, 460, 261, 910, 209, 1143, 209, 1352, 209, 1564, 267, 1565, 324, 1564, 372, 1418, 419, 1201, 432, 1075, 440, 596, 470, 212, 632, 213, 797, 212, 975, 700, 1147, 1205, 1147, 1402, 1147, 1838, 1117}}},
+	't':  {advance: 979, contours: [][]int16{{1127, 1438, 1127, 1120, 1865, 1120, 1865, 864, 1127, 864, 1127, 389, 1126, 311, 1250, 256, 1435, 256, 1803, 256, 1803, 0, 1189, 0, 764, 0, 410, 177, 411, 389, 411, 864, 55, 864, 55, 1120, 411, 1120, 411, 1438}}},
+	'u':  {advance: 1458, contours: [][]int16{{321, 436, 321, 1120, 1041, 1120, 1041, 1008, 1040, 917, 1036, 642, 1037, 596, 1036, 461, 1064, 342, 1099, 315, 1142, 280, 1284, 242, 1377, 242, 1600, 242, 1856, 414, 1857, 567, 1857, 1120, 2573, 1120, 2573, 0, 1857, 0, 1857, 162, 1694, 64, 1332, -29, 1115, -29, 726, -29, 320, 209}}},
+	'v':  {advance: 1335, contours: [][]int16{{63, 1120, 779, 1120, 1337, 346, 1893, 1120, 2611, 1120, 1729, 0, 943, 0}}},
+	'w':  {advance: 1892, contours: [][]int16{{145, 1120, 841, 1120, 1217, 348, 1595, 1120, 2193, 1120, 2569, 356, 2947, 1120, 3643, 1120, 3053, 0, 2271, 0, 1893, 770, 1517, 0, 735, 0}}},
+	'x':  {advance: 1321, contours: [][]int16{{911, 573, 103, 1120, 861, 1120, 1319, 788, 1783, 1120, 2541, 1120, 1733, 575, 2581, 0, 1823, 0, 1319, 354, 821, 0, 63, 0}}},
+	'y':  {advance: 1335, contours: [][]int16{{51, 1120, 767, 1120, 1369, 360, 1881, 1120, 2597, 1120, 1655, -106, 1512, -293, 1134, -442, 825, -442, 411, -442, 411, -207, 635, -207, 816, -207, 982, -149, 1029, -74, 1049, -43}}},
+	'z':  {advance: 1192, contours: [][]int16{{235, 1120, 2189, 1120, 2189, 870, 1009, 256, 2189, 256, 2189, 0, 185, 0, 185, 250, 1365, 864, 235, 864}}},
+	'{':  {advance: 1458, contours: [][]int16{{2405, -109, 2405, -334, 1971, -334, 1534, -334, 1134, -158, 1135, 35, 1135, 227, 1134, 377, 918, 494, 635, 494, 513, 494, 513, 717, 635, 717, 918, 717, 1134, 833, 1135, 983, 1135, 1188, 1134, 1381, 1534, 1556, 1971, 1556, 2405, 1556, 2405, 1331, 2267, 1331, 1984, 1331, 1814, 1244, 1815, 1102, 1815, 936, 1814, 779, 1634, 637, 1415, 612, 1636, 585, 1814, 443, 1815, 287, 1815, 121, 1814, -22, 1984, -109, 2267, -109}}},
+	'|':  {advance: 748, contours: [][]int16{{975, 1565, 975, -483, 521, -483, 521, 1565}}},
+	'}':  {advance: 1458, contours: [][]int16{{513, -109, 653, -109, 932, -109, 1102, -22, 1103, 121, 1103, 287, 1102, 443, 1282, 585, 1505, 612, 1282, 637, 1102, 779, 1103, 936, 1103, 1102, 1102, 1244, 932, 1331, 653, 1331, 513, 1331, 513, 1556, 947, 1556, 1382, 1556, 1782, 1381, 1783, 1188, 1783, 983, 1782, 833, 1998, 717, 2283, 717, 2405, 717, 2405, 494, 2283, 494, 1998, 494, 1782, 377, 1783, 227, 1783, 35, 1782, -158, 1382, -334, 947, -334, 513, -334}}},
+	'~':  {advance: 1716, contours: [][]int16{{2999, 850, 2999, 606, 2786, 526, 2428, 457, 2237, 457, 2022, 457, 1737, 515, 1708, 521, 1693, 524, 1678, 527, 1649, 533, 1338, 594, 1151, 594, 974, 594, 630, 517, 435, 434, 435, 678, 648, 758, 1004, 827, 1197, 827, 1410, 827, 1697, 769, 1726, 763, 1741, 760, 1754, 757, 1785, 751, 2094, 690, 2283, 690, 2454, 690, 2792, 765}}},
+	'©':  {advance: 2048, contours: [][]int16{{2647, 1126, 2647, 911, 2532, 948, 2310, 983, 2197, 983, 1970, 983, 1716, 855, 1717, 741, 1716, 626, 1968, 500, 2197, 500, 2324, 500, 2554, 536, 2647, 571, 2647, 358, 2516, 336, 2254, 313, 2131, 313, 1708, 313, 1200, 547, 1201, 741, 1200, 936, 1708, 1169, 2131, 1169, 2268, 1169, 2524, 1148}, {2049, 1331, 1806, 1331, 1390, 1244, 1217, 1157, 1042, 1070, 868, 863, 869, 741, 868, 620, 1042, 413, 1217, 326, 1388, 240, 1806, 154, 2049, 154, 2294, 154, 2706, 239, 2881, 326, 3054, 413, 3228, 620, 3229, 741, 3228, 863, 3054, 1070, 2881, 1157, 2704, 1245, 2290, 1331}, {2049, 1485, 2352, 1485, 2878, 1375, 3097, 1266, 3314, 1157, 3530, 895, 3531, 741, 3530, 589, 3314, 328, 3097, 219, 2878, 110, 2352, 0, 2049, 0, 1744, 0, 1218, 110, 1001, 219, 782, 328, 566, 589, 567, 741, 566, 895, 782, 1157, 1001, 1266, 1218, 1375, 1744, 1485}}},
+	'®':  {advance: 2048, contours: [][]int16{{2049, 1331, 1806, 1331, 1390, 1244, 1217, 1157, 1042, 1070, 868, 863, 869, 741, 868, 620, 1042, 413, 1217, 326, 1388, 240, 1806, 154, 2049, 154, 2294, 154, 2706, 239, 2881, 326, 3054, 413, 3228, 620, 3229, 741, 3228, 863, 3054, 1070, 2881, 1157, 2704, 1245, 2290, 1331}, {1935, 1036, 1865, 1036, 1865, 829, 1935, 829, 2090, 829, 2248, 882, 2249, 934, 2248, 986, 2094, 1036}, {2009, 1174, 2360, 1174, 2708, 1055, 2709, 934, 2708, 848, 2498, 736, 2307, 719, 2388, 697, 2530, 617, 2589, 559, 2811, 338, 2353, 338, 2139, 551, 2062, 629, 1946, 694, 1889, 694, 1865, 694, 1865, 338, 1439, 338, 1439, 1174}, {2049, 1485, 2352, 1485, 2878, 1375, 3097, 1266, 3314, 1157, 3530, 895, 3531, 741, 3530, 589, 3314, 328, 3097, 219, 2878, 110, 2352, 0, 2049, 0, 1744, 0, 1218, 110, 1001, 219, 782, 328, 566, 589, 567, 741, 566, 895, 782, 1157, 1001, 1266, 1218, 1375, 1744, 1485}}},
+	'°':  {advance: 1024, contours: [][]int16{{1025, 1372, 880, 1372, 680, 1272, 681, 1200, 680, 1128, 878, 1030, 1025, 1030, 1168, 1030, 1368, 1129, 1369, 1200, 1368, 1272, 1166, 1372}, {1025, 1534, 1156, 1534, 1400, 1483, 1497, 1436, 1590, 1388, 1688, 1268, 1689, 1200, 1688, 1133, 1590, 1012, 1501, 967, 1404, 919, 1156, 868, 1021, 868, 738, 868, 356, 1059, 357, 1200, 356, 1341, 742, 1534}}},
+	'·':  {advance: 778, contours: [][]int16{{419, 905, 1139, 905, 1139, 518, 419, 518}}},
+}
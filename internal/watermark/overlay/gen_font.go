@@ -0,0 +1,281 @@
+//go:build ignore
+
+// gen_font 从TrueType字体中提取ASCII字符的轮廓，生成内置字体数据 font_data.go
+//
+//	go run gen_font.go -font /usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// extraRunes 除可打印ASCII字符以外需要的字符
+var extraRunes = []rune{'©', '®', '°', '·'}
+
+type point struct {
+	x, y int
+	on   bool
+}
+
+type font struct {
+	data       []byte
+	tables     map[string][]byte
+	unitsPerEm int
+	ascent     int
+	descent    int
+}
+
+func main() {
+	path := flag.String("font", "", "TrueType字体文件")
+	output := flag.String("o", "font_data.go", "输出文件")
+	flag.Parse()
+
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := parseFont(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var runes []rune
+	for r := rune(0x20); r <= 0x7E; r++ {
+		runes = append(runes, r)
+	}
+	runes = append(runes, extraRunes...)
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "// Code generated by gen_font.go from %s; DO NOT EDIT.\n\n", filepath.Base(*path))
+	buffer.WriteString("// 字形轮廓来自DejaVu字体，DejaVu字体的修改基于Bitstream Vera字体，按Bitstream Vera字体许可证发布，\n")
+	buffer.WriteString("// 允许复制、修改和再发布。Bitstream Vera is a trademark of Bitstream, Inc.\n\n")
+	buffer.WriteString("package overlay\n\n")
+	fmt.Fprintf(&buffer, "const (\n\tunitsPerEm = %d\n\tfontAscent = %d\n\tfontDescent = %d\n)\n\n", f.unitsPerEm, f.ascent, f.descent)
+	buffer.WriteString("var glyphs = map[rune]glyph{\n")
+	for _, r := range runes {
+		index, err := f.glyphIndex(r)
+		if err != nil {
+			log.Fatalf("%q: %v", r, err)
+		}
+		contours, err := f.contours(index, 0, 0, 0)
+		if err != nil {
+			log.Fatalf("%q: %v", r, err)
+		}
+		fmt.Fprintf(&buffer, "\t%q: {advance: %d, contours: [][]int16{", r, f.advance(index))
+		for _, contour := range contours {
+			buffer.WriteString("{")
+			for _, p := range contour {
+				on := 0
+				if p.on {
+					on = 1
+				}
+				fmt.Fprintf(&buffer, "%d,%d,", p.x<<1|on, p.y)
+			}
+			buffer.WriteString("},")
+		}
+		buffer.WriteString("}},\n")
+	}
+	buffer.WriteString("}\n")
+
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseFont(data []byte) (*font, error) {
+	f := &font{data: data, tables: make(map[string][]byte)}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		record := data[12+16*i:]
+		offset := binary.BigEndian.Uint32(record[8:])
+		length := binary.BigEndian.Uint32(record[12:])
+		f.tables[string(record[:4])] = data[offset : offset+length]
+	}
+	for _, tag := range []string{"head", "hhea", "hmtx", "loca", "glyf", "cmap"} {
+		if f.tables[tag] == nil {
+			return nil, fmt.Errorf("缺少%s表", tag)
+		}
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(f.tables["head"][18:]))
+	f.ascent = int(int16(binary.BigEndian.Uint16(f.tables["hhea"][4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(f.tables["hhea"][6:])))
+	return f, nil
+}
+
+// glyphIndex 从格式4的Unicode cmap子表中查找字形
+func (f *font) glyphIndex(r rune) (int, error) {
+	cmap := f.tables["cmap"]
+	numTables := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < numTables; i++ {
+		record := cmap[4+8*i:]
+		platform, encoding := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:])
+		if !(platform == 3 && encoding == 1) && platform != 0 {
+			continue
+		}
+		sub := cmap[binary.BigEndian.Uint32(record[4:]):]
+		if binary.BigEndian.Uint16(sub) != 4 {
+			continue
+		}
+		segCount := int(binary.BigEndian.Uint16(sub[6:])) / 2
+		ends := sub[14:]
+		starts := ends[2*segCount+2:]
+		deltas := starts[2*segCount:]
+		rangeOffsets := deltas[2*segCount:]
+		for s := 0; s < segCount; s++ {
+			end := rune(binary.BigEndian.Uint16(ends[2*s:]))
+			start := rune(binary.BigEndian.Uint16(starts[2*s:]))
+			if r < start || r > end {
+				continue
+			}
+			delta := int(binary.BigEndian.Uint16(deltas[2*s:]))
+			rangeOffset := int(binary.BigEndian.Uint16(rangeOffsets[2*s:]))
+			if rangeOffset == 0 {
+				return (int(r) + delta) & 0xFFFF, nil
+			}
+			index := int(binary.BigEndian.Uint16(rangeOffsets[2*s+rangeOffset+2*int(r-start):]))
+			if index == 0 {
+				return 0, errors.New("字体中没有该字符")
+			}
+			return (index + delta) & 0xFFFF, nil
+		}
+	}
+	return 0, errors.New("字体中没有该字符")
+}
+
+func (f *font) advance(index int) int {
+	numMetrics := int(binary.BigEndian.Uint16(f.tables["hhea"][34:]))
+	if index >= numMetrics {
+		index = numMetrics - 1
+	}
+	return int(binary.BigEndian.Uint16(f.tables["hmtx"][4*index:]))
+}
+
+func (f *font) glyph(index int) []byte {
+	loca := f.tables["loca"]
+	var start, end int
+	if binary.BigEndian.Uint16(f.tables["head"][50:]) == 0 {
+		start = 2 * int(binary.BigEndian.Uint16(loca[2*index:]))
+		end = 2 * int(binary.BigEndian.Uint16(loca[2*index+2:]))
+	} else {
+		start = int(binary.BigEndian.Uint32(loca[4*index:]))
+		end = int(binary.BigEndian.Uint32(loca[4*index+4:]))
+	}
+	return f.tables["glyf"][start:end]
+}
+
+// contours 读取字形轮廓，组合字形按偏移展开，不支持缩放
+func (f *font) contours(index, dx, dy, depth int) ([][]point, error) {
+	g := f.glyph(index)
+	if len(g) == 0 {
+		return nil, nil
+	}
+	numContours := int(int16(binary.BigEndian.Uint16(g)))
+	if numContours < 0 {
+		return f.composite(g[10:], dx, dy, depth)
+	}
+
+	endPts := make([]int, numContours)
+	for i := range endPts {
+		endPts[i] = int(binary.BigEndian.Uint16(g[10+2*i:]))
+	}
+	pos := 10 + 2*numContours
+	pos += 2 + int(binary.BigEndian.Uint16(g[pos:]))
+	numPoints := 0
+	if numContours > 0 {
+		numPoints = endPts[numContours-1] + 1
+	}
+
+	flags := make([]byte, 0, numPoints)
+	for len(flags) < numPoints {
+		flag := g[pos]
+		pos++
+		flags = append(flags, flag)
+		if flag&8 != 0 {
+			for n := g[pos]; n > 0; n-- {
+				flags = append(flags, flag)
+			}
+			pos++
+		}
+	}
+
+	coords := func(short, same byte) []int {
+		values := make([]int, numPoints)
+		value := 0
+		for i, flag := range flags {
+			switch {
+			case flag&short != 0:
+				d := int(g[pos])
+				pos++
+				if flag&same == 0 {
+					d = -d
+				}
+				value += d
+			case flag&same == 0:
+				value += int(int16(binary.BigEndian.Uint16(g[pos:])))
+				pos += 2
+			}
+			values[i] = value
+		}
+		return values
+	}
+	xs := coords(2, 16)
+	ys := coords(4, 32)
+
+	var contours [][]point
+	start := 0
+	for _, end := range endPts {
+		var contour []point
+		for i := start; i <= end; i++ {
+			contour = append(contour, point{x: xs[i] + dx, y: ys[i] + dy, on: flags[i]&1 != 0})
+		}
+		contours = append(contours, contour)
+		start = end + 1
+	}
+	return contours, nil
+}
+
+func (f *font) composite(g []byte, dx, dy, depth int) ([][]point, error) {
+	if depth > 4 {
+		return nil, errors.New("组合字形嵌套过深")
+	}
+	var contours [][]point
+	for pos := 0; ; {
+		flags := binary.BigEndian.Uint16(g[pos:])
+		index := int(binary.BigEndian.Uint16(g[pos+2:]))
+		pos += 4
+		var ox, oy int
+		if flags&1 != 0 {
+			ox, oy = int(int16(binary.BigEndian.Uint16(g[pos:]))), int(int16(binary.BigEndian.Uint16(g[pos+2:])))
+			pos += 4
+		} else {
+			ox, oy = int(int8(g[pos])), int(int8(g[pos+1]))
+			pos += 2
+		}
+		if flags&2 == 0 {
+			return nil, errors.New("不支持按点对齐的组合字形")
+		}
+		if flags&(8|0x40|0x80) != 0 {
+			return nil, errors.New("不支持缩放的组合字形")
+		}
+		component, err := f.contours(index, dx+ox, dy+oy, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		contours = append(contours, component...)
+		if flags&0x20 == 0 {
+			return contours, nil
+		}
+	}
+}
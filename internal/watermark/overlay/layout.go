@@ -0,0 +1,117 @@
+package overlay
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Layout 文字水印的排列方式
+type Layout string
+
+// 支持的排列方式
+const (
+	// LayoutTile 以中心为原点按旋转后的网格平铺，为默认的排列方式
+	LayoutTile Layout = "tile"
+	// LayoutDiagonal 在中心绘制一个水印，旋转角度为0时沿对角线从左下到右上
+	LayoutDiagonal Layout = "diagonal"
+	// LayoutHeader 在顶部居中绘制一个水平的水印，忽略旋转角度
+	LayoutHeader Layout = "header"
+	// LayoutFooter 在底部居中绘制一个水平的水印，忽略旋转角度
+	LayoutFooter Layout = "footer"
+)
+
+// Layouts 返回所有支持的排列方式
+func Layouts() []Layout {
+	return []Layout{LayoutTile, LayoutDiagonal, LayoutHeader, LayoutFooter}
+}
+
+// ParseLayout 解析排列方式，为空时返回平铺
+func ParseLayout(s string) (Layout, error) {
+	if s == "" {
+		return LayoutTile, nil
+	}
+	for _, layout := range Layouts() {
+		if strings.EqualFold(s, string(layout)) {
+			return layout, nil
+		}
+	}
+	return "", fmt.Errorf("%w: 未知的排列方式 %s", ErrInvalidOptions, s)
+}
+
+// Placement 一个文字水印的位置
+// X、Y为水印中心的坐标，原点在左上角，y轴向下；Angle为旋转角度，单位为度，正数为顺时针
+type Placement struct {
+	X, Y  float64
+	Angle float64
+}
+
+// TextSize 返回在width×height的区域中使用的字号，advance为字号为1时文字的宽度
+// 未指定字号时按排列方式自动确定：平铺为短边的1/16，页眉页脚为短边的1/40，对角线为对角线长度的60%
+func (o Options) TextSize(width, height, advance float64) float64 {
+	if o.FontSize > 0 {
+		return o.FontSize
+	}
+	short := math.Min(width, height)
+	switch o.Layout {
+	case LayoutHeader, LayoutFooter:
+		return math.Max(8, short/40)
+	case LayoutDiagonal:
+		if advance <= 0 {
+			return math.Max(12, short/8)
+		}
+		return math.Max(12, math.Min(math.Hypot(width, height)*0.6/advance, short/4))
+	}
+	return math.Max(12, short/16)
+}
+
+// Placements 返回在width×height的区域中绘制宽textWidth、高textHeight的文字水印的位置
+// fontSize用于计算平铺的默认间距和页眉页脚的边距
+func (o Options) Placements(width, height, fontSize, textWidth, textHeight float64) []Placement {
+	switch o.Layout {
+	case LayoutHeader:
+		return []Placement{{X: width / 2, Y: fontSize + textHeight/2}}
+	case LayoutFooter:
+		return []Placement{{X: width / 2, Y: height - fontSize - textHeight/2}}
+	case LayoutDiagonal:
+		angle := o.Angle
+		if angle == 0 {
+			angle = -math.Atan2(height, width) * 180 / math.Pi
+		}
+		return []Placement{{X: width / 2, Y: height / 2, Angle: angle}}
+	}
+
+	spacing := o.Spacing
+	if spacing == 0 {
+		spacing = fontSize * 2
+	}
+	cellWidth, cellHeight := textWidth+spacing, textHeight+spacing
+	sin, cos := math.Sincos(o.Angle * math.Pi / 180)
+
+	// 旋转后的网格需要覆盖以中心为圆心、半对角线为半径的圆
+	radius := math.Hypot(width, height) / 2
+	cellRadius := math.Hypot(cellWidth, cellHeight) / 2
+	rows := int(math.Ceil(radius/cellHeight)) + 1
+	cols := int(math.Ceil(radius/cellWidth)) + 1
+
+	var placements []Placement
+	for row := -rows; row <= rows; row++ {
+		for col := -cols; col <= cols; col++ {
+			// 水印中心在旋转后网格中的坐标，奇数行错开半个水印
+			cx := float64(col) * cellWidth
+			if row%2 != 0 {
+				cx += cellWidth / 2
+			}
+			cy := float64(row) * cellHeight
+			if math.Hypot(cx, cy) > radius+cellRadius {
+				continue
+			}
+			placements = append(placements, Placement{
+				X:     cx*cos - cy*sin + width/2,
+				Y:     cx*sin + cy*cos + height/2,
+				Angle: o.Angle,
+			})
+		}
+	}
+	return placements
+}
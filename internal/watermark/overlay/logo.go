@@ -0,0 +1,259 @@
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+// MaxLogoSize 标志图片的最大宽度和高度，单位为像素
+const MaxLogoSize = 4096
+
+// Anchor 标志图片在目标图片上的位置
+type Anchor string
+
+// 支持的标志位置
+const (
+	AnchorTopLeft     Anchor = "top-left"
+	AnchorTopRight    Anchor = "top-right"
+	AnchorBottomLeft  Anchor = "bottom-left"
+	AnchorBottomRight Anchor = "bottom-right"
+	AnchorCenter      Anchor = "center"
+	// AnchorTile 以图片中心为原点平铺整幅图片
+	AnchorTile Anchor = "tile"
+)
+
+// Anchors 返回所有支持的标志位置
+func Anchors() []Anchor {
+	return []Anchor{AnchorTopLeft, AnchorTopRight, AnchorBottomLeft, AnchorBottomRight, AnchorCenter, AnchorTile}
+}
+
+// ParseAnchor 解析标志位置，为空时返回右下角
+func ParseAnchor(s string) (Anchor, error) {
+	if s == "" {
+		return AnchorBottomRight, nil
+	}
+	for _, anchor := range Anchors() {
+		if strings.EqualFold(s, string(anchor)) {
+			return anchor, nil
+		}
+	}
+	return "", fmt.Errorf("%w: 未知的标志位置 %s", ErrInvalidOptions, s)
+}
+
+// Logo 叠加到图片上的标志图片，透明部分按PNG的alpha通道合成
+type Logo struct {
+	Image image.Image
+	// Anchor 标志的位置
+	Anchor Anchor
+	// Scale 标志相对于目标图片的大小，标志按原始宽高比缩放到目标图片宽和高的Scale倍以内，范围为(0, 1]
+	Scale float64
+	// Opacity 不透明度，范围为(0, 1]，与标志本身的透明度相乘
+	Opacity float64
+}
+
+// DecodeLogo 读取PNG格式的标志图片，位置、大小和不透明度使用默认值：右下角、0.2和0.5
+func DecodeLogo(r io.Reader) (*Logo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取标志图片失败: %w", err)
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 标志图片应为PNG格式: %v", ErrInvalidOptions, err)
+	}
+	if config.Width > MaxLogoSize || config.Height > MaxLogoSize {
+		return nil, fmt.Errorf("%w: 标志图片不能超过%d×%d像素", ErrInvalidOptions, MaxLogoSize, MaxLogoSize)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 解码标志图片失败: %v", ErrInvalidOptions, err)
+	}
+	return &Logo{Image: img, Anchor: AnchorBottomRight, Scale: 0.2, Opacity: 0.5}, nil
+}
+
+// Validate 检查标志参数是否有效
+func (l *Logo) Validate() error {
+	if l.Image == nil || l.Image.Bounds().Empty() {
+		return fmt.Errorf("%w: 标志图片为空", ErrInvalidOptions)
+	}
+	if _, err := ParseAnchor(string(l.Anchor)); err != nil {
+		return err
+	}
+	if !(l.Scale > 0 && l.Scale <= 1) {
+		return fmt.Errorf("%w: 标志大小应在0到1之间", ErrInvalidOptions)
+	}
+	if !(l.Opacity > 0 && l.Opacity <= 1) {
+		return fmt.Errorf("%w: 标志不透明度应在0到1之间", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// draw 将标志缩放后合成到图片上
+func (l *Logo) draw(img *image.NRGBA) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	logoBounds := l.Image.Bounds()
+
+	// 保持宽高比缩放到Scale倍的目标图片以内
+	ratio := math.Min(float64(width)*l.Scale/float64(logoBounds.Dx()), float64(height)*l.Scale/float64(logoBounds.Dy()))
+	logoWidth := max(1, int(math.Round(float64(logoBounds.Dx())*ratio)))
+	logoHeight := max(1, int(math.Round(float64(logoBounds.Dy())*ratio)))
+	scaled := resize(l.Image, logoWidth, logoHeight)
+
+	// 四角的标志与边缘保留短边1/50的距离，平铺时相邻两个标志之间间隔标志大小的一半
+	margin := min(width, height) / 50
+	var positions []image.Point
+	switch l.Anchor {
+	case AnchorTopLeft:
+		positions = []image.Point{{margin, margin}}
+	case AnchorTopRight:
+		positions = []image.Point{{width - margin - logoWidth, margin}}
+	case AnchorBottomLeft:
+		positions = []image.Point{{margin, height - margin - logoHeight}}
+	case AnchorCenter:
+		positions = []image.Point{{(width - logoWidth) / 2, (height - logoHeight) / 2}}
+	case AnchorTile:
+		stepX, stepY := logoWidth+max(1, logoWidth/2), logoHeight+max(1, logoHeight/2)
+		originX := ((width-logoWidth)/2)%stepX - stepX
+		originY := ((height-logoHeight)/2)%stepY - stepY
+		for y := originY; y < height; y += stepY {
+			for x := originX; x < width; x += stepX {
+				positions = append(positions, image.Point{x, y})
+			}
+		}
+	default:
+		positions = []image.Point{{width - margin - logoWidth, height - margin - logoHeight}}
+	}
+
+	for _, position := range positions {
+		target := image.Rectangle{Min: position, Max: position.Add(image.Pt(logoWidth, logoHeight))}.
+			Intersect(image.Rect(0, 0, width, height))
+		for y := target.Min.Y; y < target.Max.Y; y++ {
+			for x := target.Min.X; x < target.Max.X; x++ {
+				c := scaled.NRGBAAt(x-position.X, y-position.Y)
+				if c.A == 0 {
+					continue
+				}
+				i := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+				blend(img.Pix[i:i+4:i+4], [3]float64{float64(c.R), float64(c.G), float64(c.B)}, float64(c.A)/0xFF*l.Opacity)
+			}
+		}
+	}
+}
+
+// contribution 缩放时目标像素中一个源像素所占的权重
+type contribution struct {
+	index  int
+	weight float64
+}
+
+// resizeWeights 计算一个方向上每个目标像素由哪些源像素组成
+// 缩小时按覆盖面积求平均，放大时使用线性插值
+func resizeWeights(src, dst int) [][]contribution {
+	scale := float64(src) / float64(dst)
+	weights := make([][]contribution, dst)
+	for i := range weights {
+		if scale > 1 {
+			start, end := float64(i)*scale, float64(i+1)*scale
+			for j := int(start); j < src && float64(j) < end; j++ {
+				if w := math.Min(end, float64(j+1)) - math.Max(start, float64(j)); w > 0 {
+					weights[i] = append(weights[i], contribution{j, w / scale})
+				}
+			}
+			continue
+		}
+		center := (float64(i)+0.5)*scale - 0.5
+		j := int(math.Floor(center))
+		f := center - float64(j)
+		weights[i] = []contribution{{min(max(j, 0), src-1), 1 - f}, {min(max(j+1, 0), src-1), f}}
+	}
+	return weights
+}
+
+// resize 将图片缩放到指定大小，先水平后垂直，在预乘alpha的颜色上插值，避免透明边缘发黑
+func resize(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		output := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(output, output.Bounds(), src, bounds.Min, draw.Src)
+		return output
+	}
+
+	premultiplied := image.NewRGBA64(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(premultiplied, premultiplied.Bounds(), src, bounds.Min, draw.Src)
+
+	columns := resizeWeights(bounds.Dx(), width)
+	horizontal := make([][4]float64, width*bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		for x, weights := range columns {
+			var sum [4]float64
+			for _, c := range weights {
+				p := premultiplied.RGBA64At(c.index, y)
+				sum[0] += float64(p.R) * c.weight
+				sum[1] += float64(p.G) * c.weight
+				sum[2] += float64(p.B) * c.weight
+				sum[3] += float64(p.A) * c.weight
+			}
+			horizontal[y*width+x] = sum
+		}
+	}
+
+	output := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range resizeWeights(bounds.Dy(), height) {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for _, c := range weights {
+				for k, v := range horizontal[c.index*width+x] {
+					sum[k] += v * c.weight
+				}
+			}
+			if sum[3] <= 0 {
+				continue
+			}
+			i := output.PixOffset(x, y)
+			for k := 0; k < 3; k++ {
+				output.Pix[i+k] = uint8(math.Round(math.Min(sum[k]/sum[3], 1) * 0xFF))
+			}
+			output.Pix[i+3] = uint8(math.Round(math.Min(sum[3]/0xFFFF, 1) * 0xFF))
+		}
+	}
+	return output
+}
+
+// Rotate 返回顺时针旋转turns个90度后的图片副本
+func Rotate(img image.Image, turns int) *image.NRGBA {
+	bounds := img.Bounds()
+	source := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(source, source.Bounds(), img, bounds.Min, draw.Src)
+	width, height := bounds.Dx(), bounds.Dy()
+
+	turns = (turns%4 + 4) % 4
+	if turns == 0 {
+		return source
+	}
+	output := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if turns != 2 {
+		output = image.NewNRGBA(image.Rect(0, 0, height, width))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var target image.Point
+			switch turns {
+			case 1:
+				target = image.Pt(height-1-y, x)
+			case 2:
+				target = image.Pt(width-1-x, height-1-y)
+			case 3:
+				target = image.Pt(y, width-1-x)
+			}
+			output.SetNRGBA(target.X, target.Y, source.NRGBAAt(x, y))
+		}
+	}
+	return output
+}
@@ -0,0 +1,209 @@
+// Package overlay 在图片上绘制可见的平铺文字水印和标志图片
+// 文字使用内置的矢量字体绘制，不依赖系统字体，旋转后仍然平滑。
+// 内置字体只包含ASCII可打印字符和少量符号，见 Supported。
+package overlay
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTextLength 可见水印文本的最大字符数
+const MaxTextLength = 100
+
+// 定义可见水印相关的错误
+var (
+	ErrEmptyText       = errors.New("可见水印文本不能为空")
+	ErrUnsupportedText = errors.New("可见水印文本包含内置字体不支持的字符")
+	ErrInvalidOptions  = errors.New("可见水印参数无效")
+)
+
+// Options 可见水印的参数，与网页上的水印预览对应
+type Options struct {
+	// Text 水印文本，为空时由调用方使用水印载荷的文本
+	Text string `json:"text,omitempty"`
+	// Opacity 不透明度，范围为(0, 1]
+	Opacity float64 `json:"opacity"`
+	// Angle 旋转角度，单位为度，正数为顺时针，与CSS的rotate相同
+	Angle float64 `json:"angle"`
+	// FontSize 字号，单位为像素（PDF中为点），为0时按排列方式自动确定，见 TextSize
+	FontSize float64 `json:"font_size"`
+	// Color 文字颜色，透明度由 Opacity 决定
+	Color color.NRGBA `json:"-"`
+	// Spacing 相邻两个水印之间的间距，单位为像素，为0时使用字号的2倍
+	Spacing float64 `json:"spacing"`
+	// Layout 文字水印的排列方式，为空时平铺
+	Layout Layout `json:"layout,omitempty"`
+	// Logo 叠加的标志图片，为nil时不绘制；设置后 Text 为空表示只绘制标志
+	Logo *Logo `json:"-"`
+}
+
+// DefaultOptions 返回默认的可见水印参数：灰色、不透明度0.3、不旋转、自动字号和间距
+func DefaultOptions() Options {
+	return Options{Opacity: 0.3, Color: color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xFF}}
+}
+
+// Validate 检查参数是否有效
+func (o Options) Validate() error {
+	if err := o.ValidateVector(); err != nil {
+		return err
+	}
+	if !Supported(o.Text) {
+		return ErrUnsupportedText
+	}
+	return nil
+}
+
+// ValidateVector 检查参数是否有效，但不检查内置字体能否绘制文本
+// 用于SVG等由查看器使用自己的字体渲染文字的矢量格式
+func (o Options) ValidateVector() error {
+	if o.Logo != nil {
+		if err := o.Logo.Validate(); err != nil {
+			return err
+		}
+		if o.Text == "" {
+			return nil
+		}
+	}
+	if strings.TrimSpace(o.Text) == "" {
+		return ErrEmptyText
+	}
+	if utf8.RuneCountInString(o.Text) > MaxTextLength {
+		return fmt.Errorf("%w: 文本不能超过%d个字符", ErrInvalidOptions, MaxTextLength)
+	}
+	if !(o.Opacity > 0 && o.Opacity <= 1) {
+		return fmt.Errorf("%w: 不透明度应在0到1之间", ErrInvalidOptions)
+	}
+	if math.IsNaN(o.Angle) || math.IsInf(o.Angle, 0) {
+		return fmt.Errorf("%w: 旋转角度无效", ErrInvalidOptions)
+	}
+	if !(o.FontSize >= 0 && o.FontSize <= 1000) {
+		return fmt.Errorf("%w: 字号应在0到1000像素之间", ErrInvalidOptions)
+	}
+	if !(o.Spacing >= 0 && o.Spacing <= 10000) {
+		return fmt.Errorf("%w: 间距应在0到10000像素之间", ErrInvalidOptions)
+	}
+	if o.Layout != "" && !slices.Contains(Layouts(), o.Layout) {
+		return fmt.Errorf("%w: 未知的排列方式 %s", ErrInvalidOptions, o.Layout)
+	}
+	return nil
+}
+
+// Supported 判断内置字体能否绘制文本中的所有字符
+func Supported(text string) bool {
+	for _, r := range text {
+		if !supported(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseColor 解析"#RRGGBB"或"RRGGBB"形式的颜色
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.NRGBA{}, fmt.Errorf("%w: 颜色应为#RRGGBB格式: %s", ErrInvalidOptions, s)
+	}
+	return color.NRGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xFF}, nil
+}
+
+// Apply 返回绘制了可见水印的图片副本，原图不会被修改
+func Apply(img image.Image, opts Options) (*image.NRGBA, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	output := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(output, output.Bounds(), img, bounds.Min, draw.Src)
+	if err := Draw(output, opts); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// Draw 在图片上直接绘制可见水印，先绘制文字再叠加标志
+func Draw(img *image.NRGBA, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if img.Bounds().Empty() {
+		return nil
+	}
+	if opts.Text != "" {
+		drawText(img, opts)
+	}
+	if opts.Logo != nil {
+		opts.Logo.draw(img)
+	}
+	return nil
+}
+
+// drawText 绘制文字水印
+// 平铺时水印以图片中心为原点按旋转后的网格平铺，相邻两行错开半个水印，覆盖整幅图片
+func drawText(img *image.NRGBA, opts Options) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// 文字在字体单位下的宽度，字号对应字体的em大小，与CSS相同
+	advance := 0
+	for _, r := range opts.Text {
+		advance += glyphs[r].advance
+	}
+	fontSize := opts.TextSize(float64(width), float64(height), float64(advance)/unitsPerEm)
+	scale := fontSize / unitsPerEm
+	textWidth := float64(advance) * scale
+	textHeight := float64(fontAscent-fontDescent) * scale
+
+	r := newRasterizer(width, height)
+	for _, p := range opts.Placements(float64(width), float64(height), fontSize, textWidth, textHeight) {
+		sin, cos := math.Sincos(p.Angle * math.Pi / 180)
+
+		// 字体坐标转换为以水印中心为原点的坐标，再旋转到图片中
+		pen := 0.0
+		for _, ch := range opts.Text {
+			g := glyphs[ch]
+			transform := func(x, y float64) vec {
+				lx, ly := (pen+x)*scale-textWidth/2, (fontAscent-y)*scale-textHeight/2
+				return vec{lx*cos - ly*sin + p.X, lx*sin + ly*cos + p.Y}
+			}
+			for _, contour := range g.contours {
+				var previous *vec
+				walkContour(contour, transform, func(p vec) {
+					if previous != nil {
+						r.line(*previous, p)
+					}
+					previous = &p
+				})
+			}
+			pen += float64(g.advance)
+		}
+	}
+
+	// 按覆盖率和不透明度将文字颜色叠加到图片上
+	alpha := opts.Opacity * float64(opts.Color.A) / 0xFF
+	c := [3]float64{float64(opts.Color.R), float64(opts.Color.G), float64(opts.Color.B)}
+	r.coverage(func(x, y int, coverage float32) {
+		i := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+		blend(img.Pix[i:i+4:i+4], c, float64(coverage)*alpha)
+	})
+}
+
+// blend 将颜色c以不透明度a叠加到非预乘alpha的像素上
+func blend(pix []uint8, c [3]float64, a float64) {
+	srcAlpha := float64(pix[3]) / 0xFF
+	outAlpha := a + srcAlpha*(1-a)
+	for k := 0; k < 3; k++ {
+		pix[k] = uint8(math.Round((c[k]*a + float64(pix[k])*srcAlpha*(1-a)) / outAlpha))
+	}
+	pix[3] = uint8(math.Round(outAlpha * 0xFF))
+}
@@ -0,0 +1,207 @@
+package overlay
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	base := DefaultOptions()
+	base.Text = "CONFIDENTIAL"
+	if err := base.Validate(); err != nil {
+		t.Fatalf("默认参数无效: %v", err)
+	}
+
+	cases := map[string]struct {
+		modify func(o *Options)
+		want   error
+	}{
+		"空文本":    {func(o *Options) { o.Text = "  " }, ErrEmptyText},
+		"中文文本":   {func(o *Options) { o.Text = "内部资料" }, ErrUnsupportedText},
+		"不透明度为0": {func(o *Options) { o.Opacity = 0 }, ErrInvalidOptions},
+		"负数字号":   {func(o *Options) { o.FontSize = -1 }, ErrInvalidOptions},
+	}
+	for name, c := range cases {
+		opts := base
+		c.modify(&opts)
+		if err := opts.Validate(); !errors.Is(err, c.want) {
+			t.Errorf("%s: 期望返回 %v，实际为: %v", name, c.want, err)
+		}
+	}
+
+	if c, err := ParseColor("#FF8000"); err != nil || c != (color.NRGBA{R: 0xFF, G: 0x80, A: 0xFF}) {
+		t.Errorf("解析颜色结果为 %v, %v", c, err)
+	}
+	if _, err := ParseColor("red"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("期望返回 ErrInvalidOptions，实际为: %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 320, 240))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	opts := DefaultOptions()
+	opts.Text = "DRAFT"
+	opts.Color = color.NRGBA{A: 0xFF}
+	opts.Opacity = 0.5
+	opts.Angle = -30
+	output, err := Apply(img, opts)
+	if err != nil {
+		t.Fatalf("绘制可见水印失败: %v", err)
+	}
+	if img.Pix[0] != 0xFF || img.Pix[len(img.Pix)-1] != 0xFF {
+		t.Error("原图被修改")
+	}
+
+	// 平铺的水印覆盖整幅图片，每个象限都有被绘制的像素，且颜色不会比不透明度允许的更深
+	var quadrants [4]int
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			pixel := output.NRGBAAt(x, y)
+			if pixel.A != 0xFF {
+				t.Fatalf("像素(%d,%d)的透明度变为%d", x, y, pixel.A)
+			}
+			if pixel.R < 0x7F {
+				t.Fatalf("像素(%d,%d)的颜色%d超过不透明度", x, y, pixel.R)
+			}
+			if pixel.R < 0xFF {
+				quadrants[(y/120)*2+x/160]++
+			}
+		}
+	}
+	for i, count := range quadrants {
+		if count == 0 {
+			t.Errorf("第%d个象限没有水印", i+1)
+		}
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	// 每种排列方式绘制的范围，按上中下三个水平条带统计被绘制的像素
+	for _, c := range []struct {
+		layout Layout
+		bands  [3]bool
+	}{
+		{LayoutHeader, [3]bool{true, false, false}},
+		{LayoutFooter, [3]bool{false, false, true}},
+		{LayoutDiagonal, [3]bool{true, true, true}},
+	} {
+		layout, err := ParseLayout(string(c.layout))
+		if err != nil {
+			t.Fatalf("解析排列方式失败: %v", err)
+		}
+		opts := DefaultOptions()
+		opts.Text, opts.Layout, opts.Opacity = "TOP SECRET", layout, 1
+		output, err := Apply(img, opts)
+		if err != nil {
+			t.Fatalf("%s: 绘制可见水印失败: %v", layout, err)
+		}
+		var bands [3]bool
+		for y := 0; y < 300; y++ {
+			for x := 0; x < 400; x++ {
+				if output.NRGBAAt(x, y).R != 0xFF {
+					bands[y/100] = true
+				}
+			}
+		}
+		if bands != c.bands {
+			t.Errorf("%s: 绘制的范围为 %v，期望 %v", layout, bands, c.bands)
+		}
+	}
+
+	// 对角线上只有一个水印，沿对角线旋转
+	opts := Options{Text: "X", Layout: LayoutDiagonal}
+	placements := opts.Placements(400, 300, 20, 10, 10)
+	if len(placements) != 1 || placements[0].X != 200 || placements[0].Y != 150 || math.Abs(placements[0].Angle+36.87) > 0.01 {
+		t.Errorf("对角线水印的位置为 %v", placements)
+	}
+	if _, err := ParseLayout("spiral"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("期望返回 ErrInvalidOptions，实际为: %v", err)
+	}
+	if err := (Options{Text: "X", Opacity: 1, Layout: "Spiral"}).Validate(); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("期望返回 ErrInvalidOptions，实际为: %v", err)
+	}
+}
+
+func TestLogo(t *testing.T) {
+	// 64×32的半透明红色标志，右半部分完全透明
+	source := image.NewNRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			source.SetNRGBA(x, y, color.NRGBA{R: 0xFF, A: 0x80})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, source); err != nil {
+		t.Fatalf("编码标志失败: %v", err)
+	}
+	logo, err := DecodeLogo(&encoded)
+	if err != nil {
+		t.Fatalf("读取标志失败: %v", err)
+	}
+	if _, err := DecodeLogo(strings.NewReader("GIF89a")); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("期望返回 ErrInvalidOptions，实际为: %v", err)
+	}
+
+	// 缩小后颜色不变，透明部分与不透明部分交界处不会发黑
+	scaled := resize(logo.Image, 16, 8)
+	for x := 0; x < 16; x++ {
+		c := scaled.NRGBAAt(x, 4)
+		if c.A != 0 && (c.R != 0xFF || c.G != 0) {
+			t.Fatalf("缩小后像素(%d,4)为 %v", x, c)
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for _, c := range []struct {
+		anchor  Anchor
+		covered []image.Point
+		clear   []image.Point
+	}{
+		{AnchorBottomRight, []image.Point{{165, 90}}, []image.Point{{190, 90}, {5, 5}, {100, 50}}},
+		{AnchorTopLeft, []image.Point{{5, 5}}, []image.Point{{30, 5}, {165, 90}}},
+		{AnchorCenter, []image.Point{{95, 50}}, []image.Point{{5, 5}, {165, 90}}},
+		// 40×20的标志以60×30为间隔平铺，中心的标志位于(80,40)
+		{AnchorTile, []image.Point{{95, 50}, {25, 15}, {145, 75}}, []image.Point{{50, 50}}},
+	} {
+		anchor, err := ParseAnchor(string(c.anchor))
+		if err != nil {
+			t.Fatalf("解析标志位置失败: %v", err)
+		}
+		logo.Anchor, logo.Opacity = anchor, 1
+		output, err := Apply(img, Options{Logo: logo})
+		if err != nil {
+			t.Fatalf("绘制标志失败: %v", err)
+		}
+		for _, p := range c.covered {
+			if output.NRGBAAt(p.X, p.Y).G == 0xFF {
+				t.Errorf("%s: 像素%v没有标志", anchor, p)
+			}
+		}
+		for _, p := range c.clear {
+			if output.NRGBAAt(p.X, p.Y).G != 0xFF {
+				t.Errorf("%s: 像素%v不应有标志", anchor, p)
+			}
+		}
+	}
+	if _, err := ParseAnchor("middle"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("期望返回 ErrInvalidOptions，实际为: %v", err)
+	}
+}
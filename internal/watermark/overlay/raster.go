@@ -0,0 +1,124 @@
+package overlay
+
+import "math"
+
+// rasterizer 计算多边形对每个像素的覆盖率，用于绘制抗锯齿的文字
+// 每条边按其经过的面积把有符号的覆盖率累加到所在行，逐行求前缀和后得到每个像素的覆盖率，
+// 字形轮廓的外圈和内圈方向相反，重叠部分取绝对值后不会超过1
+type rasterizer struct {
+	width  int
+	height int
+	// stride 每行的单元数，比图像宽2列，容纳落在右边界上的累加值
+	stride int
+	acc    []float32
+}
+
+func newRasterizer(width, height int) *rasterizer {
+	return &rasterizer{width: width, height: height, stride: width + 2, acc: make([]float32, (width+2)*height)}
+}
+
+// line 累加一条边，超出图像左右边界的部分压到边界上，超出上下边界的部分忽略
+func (r *rasterizer) line(p0, p1 vec) {
+	w := float64(r.width)
+	// 在左右边界处拆分线段，图像外的部分变为边界上的竖线，不改变图像内像素的覆盖率
+	for _, bound := range []float64{0, w} {
+		if (p0.x < bound && p1.x > bound) || (p0.x > bound && p1.x < bound) {
+			t := (bound - p0.x) / (p1.x - p0.x)
+			m := vec{bound, p0.y + t*(p1.y-p0.y)}
+			r.line(p0, m)
+			r.line(m, p1)
+			return
+		}
+	}
+	p0.x = math.Max(0, math.Min(w, p0.x))
+	p1.x = math.Max(0, math.Min(w, p1.x))
+	r.clippedLine(p0, p1)
+}
+
+// clippedLine 累加左右方向已在图像范围内的边
+func (r *rasterizer) clippedLine(p0, p1 vec) {
+	if p0.y == p1.y {
+		return
+	}
+	dir := float32(1)
+	if p0.y > p1.y {
+		dir = -1
+		p0, p1 = p1, p0
+	}
+	if p1.y <= 0 || p0.y >= float64(r.height) {
+		return
+	}
+
+	dxdy := (p1.x - p0.x) / (p1.y - p0.y)
+	x := p0.x
+	if p0.y < 0 {
+		x = math.Max(0, math.Min(float64(r.width), x-p0.y*dxdy))
+	}
+	y0 := int(math.Max(0, p0.y))
+	y1 := int(math.Min(float64(r.height), math.Ceil(p1.y)))
+
+	for y := y0; y < y1; y++ {
+		row := r.acc[y*r.stride : (y+1)*r.stride]
+		dy := math.Min(float64(y+1), p1.y) - math.Max(float64(y), p0.y)
+		// 限制在边界内，避免舍入误差使下标越界
+		xnext := math.Max(0, math.Min(float64(r.width), x+dxdy*dy))
+		d := float32(dy) * dir
+
+		x0, x1 := x, xnext
+		if x0 > x1 {
+			x0, x1 = x1, x0
+		}
+		x0floor := math.Floor(x0)
+		x0i := int(x0floor)
+		x1ceil := math.Ceil(x1)
+		x1i := int(x1ceil)
+
+		if x1i <= x0i+1 {
+			// 边在这一行只经过一个像素
+			xmf := float32(0.5*(x+xnext) - x0floor)
+			row[x0i] += d - d*xmf
+			row[x0i+1] += d * xmf
+		} else {
+			s := float32(1 / (x1 - x0))
+			x0f := float32(x0 - x0floor)
+			a0 := 0.5 * s * (1 - x0f) * (1 - x0f)
+			x1f := float32(x1 - x1ceil + 1)
+			am := 0.5 * s * x1f * x1f
+			row[x0i] += d * a0
+			if x1i == x0i+2 {
+				row[x0i+1] += d * (1 - a0 - am)
+			} else {
+				a1 := s * (1.5 - x0f)
+				row[x0i+1] += d * (a1 - a0)
+				for xi := x0i + 2; xi < x1i-1; xi++ {
+					row[xi] += d * s
+				}
+				a2 := a1 + float32(x1i-x0i-3)*s
+				row[x1i-1] += d * (1 - a2 - am)
+			}
+			row[x1i] += d * am
+		}
+		x = xnext
+	}
+}
+
+// coverage 逐行求前缀和，对每个覆盖率大于0的像素调用fn，覆盖率范围为(0, 1]
+func (r *rasterizer) coverage(fn func(x, y int, c float32)) {
+	for y := 0; y < r.height; y++ {
+		row := r.acc[y*r.stride : (y+1)*r.stride]
+		sum := float32(0)
+		for x := 0; x < r.width; x++ {
+			sum += row[x]
+			c := sum
+			if c < 0 {
+				c = -c
+			}
+			if c > 1 {
+				c = 1
+			}
+			if c > 1.0/512 {
+				fn(x, y, c)
+			}
+		}
+	}
+}
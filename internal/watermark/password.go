@@ -0,0 +1,29 @@
+package watermark
+
+import (
+	"errors"
+)
+
+// 打开受密码保护的文档时的错误
+var (
+	ErrPasswordRequired = errors.New("文档已加密，需要提供密码")
+	ErrInvalidPassword  = errors.New("文档密码不正确")
+)
+
+// PasswordWatermarker 由能够打开加密文档的处理器实现
+type PasswordWatermarker interface {
+	StreamWatermarker
+
+	// WithPassword 返回使用password打开加密文档的处理器，原处理器不受影响
+	// password可以是用户密码或所有者密码；为空时只能打开用户密码为空的文档，其他加密文档返回 ErrPasswordRequired
+	WithPassword(password string) StreamWatermarker
+}
+
+// WithPassword 返回使用password打开加密文档的处理器
+// 处理器没有实现 PasswordWatermarker 时原样返回，不支持加密的文件类型忽略密码
+func WithPassword(w StreamWatermarker, password string) StreamWatermarker {
+	if pw, ok := w.(PasswordWatermarker); ok {
+		return pw.WithPassword(password)
+	}
+	return w
+}
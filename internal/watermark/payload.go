@@ -0,0 +1,181 @@
+package watermark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// 水印载荷的大小限制
+const (
+	MaxTextLength  = 100  // 水印文本的最大字节数
+	MaxFieldLength = 256  // 单个标识字段或自定义字段值的最大字节数
+	MaxFieldCount  = 32   // 自定义字段的最大数量
+	MaxPayloadSize = 4096 // 序列化后载荷的最大字节数
+)
+
+// 定义载荷相关的错误
+var (
+	ErrEmptyPayload    = errors.New("水印文本不能为空")
+	ErrPayloadTooLarge = errors.New("水印载荷过大")
+)
+
+// Payload 描述嵌入到文档中的结构化水印信息
+type Payload struct {
+	// Text 水印文本
+	Text string `json:"text"`
+	// RecipientID 文档接收者或用户ID，用于追踪泄露来源
+	RecipientID string `json:"recipient_id,omitempty"`
+	// DocumentID 文档ID
+	DocumentID string `json:"document_id,omitempty"`
+	// Issuer 水印签发方
+	Issuer string `json:"issuer,omitempty"`
+	// Rights 版权声明，除嵌入信封外还以明文写入XMP的 dc:rights，为空时不写入
+	Rights string `json:"rights,omitempty"`
+	// IssuedAt 水印签发时间
+	IssuedAt time.Time `json:"issued_at"`
+	// Fields 自定义键值对
+	Fields map[string]string `json:"fields,omitempty"`
+	// History 文档中之前的水印，按添加顺序排列，由当前水印的签发方一起签名
+	History []*Payload `json:"history,omitempty"`
+
+	// Verification 提取时的来源校验结果，不会嵌入到文档中
+	Verification *Verification `json:"-"`
+	// Overlay 添加水印时同时绘制的可见水印参数，为nil时不绘制，不会嵌入到文档中
+	// 只有能力中 Visible 为true的嵌入方式会绘制，其他处理器忽略该参数，调用方应先检查能力
+	Overlay *overlay.Options `json:"-"`
+}
+
+// NewPayload 使用水印文本创建载荷，签发时间为当前时间
+func NewPayload(text string) *Payload {
+	return &Payload{
+		Text:     text,
+		IssuedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// Validate 检查载荷是否有效
+func (p *Payload) Validate() error {
+	if strings.TrimSpace(p.Text) == "" {
+		return ErrEmptyPayload
+	}
+	if len(p.Text) > MaxTextLength {
+		return fmt.Errorf("%w: 水印文本过长，请控制在%d个字符以内", ErrPayloadTooLarge, MaxTextLength)
+	}
+
+	for name, value := range map[string]string{
+		"recipient_id": p.RecipientID,
+		"document_id":  p.DocumentID,
+		"issuer":       p.Issuer,
+		"rights":       p.Rights,
+	} {
+		if len(value) > MaxFieldLength {
+			return fmt.Errorf("%w: 字段 %s 过长", ErrPayloadTooLarge, name)
+		}
+	}
+
+	if len(p.Fields) > MaxFieldCount {
+		return fmt.Errorf("%w: 自定义字段不能超过%d个", ErrPayloadTooLarge, MaxFieldCount)
+	}
+	for key, value := range p.Fields {
+		if strings.TrimSpace(key) == "" {
+			return errors.New("自定义字段名不能为空")
+		}
+		if len(key) > MaxFieldLength || len(value) > MaxFieldLength {
+			return fmt.Errorf("%w: 自定义字段 %s 过长", ErrPayloadTooLarge, key)
+		}
+	}
+
+	data, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxPayloadSize {
+		return fmt.Errorf("%w: 序列化后为%d字节，上限为%d字节", ErrPayloadTooLarge, len(data), MaxPayloadSize)
+	}
+
+	return nil
+}
+
+// AppendHistory 将previous及其历史记录加入载荷的历史记录
+func (p *Payload) AppendHistory(previous *Payload) {
+	entry := *previous
+	entry.History = nil
+	entry.Verification = nil
+
+	history := make([]*Payload, 0, len(previous.History)+1)
+	history = append(history, previous.History...)
+	p.History = append(history, &entry)
+}
+
+// Chain 返回文档中的全部水印，按添加顺序排列，最后一个为当前载荷
+func (p *Payload) Chain() []*Payload {
+	chain := make([]*Payload, 0, len(p.History)+1)
+	chain = append(chain, p.History...)
+	return append(chain, p)
+}
+
+// Marshal 将载荷序列化为JSON
+func (p *Payload) Marshal() ([]byte, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("序列化水印载荷失败: %w", err)
+	}
+	return data, nil
+}
+
+// Timestamp 返回RFC3339格式的签发时间，未设置时返回空字符串
+func (p *Payload) Timestamp() string {
+	if p.IssuedAt.IsZero() {
+		return ""
+	}
+	return p.IssuedAt.Format(time.RFC3339)
+}
+
+// UnmarshalPayload 从JSON中解析载荷
+func UnmarshalPayload(data []byte) (*Payload, error) {
+	var p Payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("解析水印载荷失败: %w", err)
+	}
+	return &p, nil
+}
+
+// DecodePayload 解析处理器中嵌入的水印数据
+// 新版本嵌入的是JSON格式的载荷；旧版本只嵌入了纯文本，
+// 此时使用legacyTimestamp（Unix秒或RFC3339）作为签发时间
+// 旧版本的水印没有签名，校验结果为未签名
+func DecodePayload(data []byte, legacyTimestamp string) *Payload {
+	if len(data) > 0 && data[0] == '{' {
+		if p, err := UnmarshalPayload(data); err == nil {
+			p.Verification = &Verification{Status: StatusUnsigned}
+			return p
+		}
+	}
+
+	p := &Payload{Text: string(data), Verification: &Verification{Status: StatusUnsigned}}
+	if t, err := ParseTimestamp(legacyTimestamp); err == nil {
+		p.IssuedAt = t
+	}
+	return p
+}
+
+// ParseTimestamp 解析旧版水印中的时间戳，支持Unix秒和RFC3339格式
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	// 尝试解析为 Unix 时间戳（秒）
+	if unixTime, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		return time.Unix(unixTime, 0).UTC(), nil
+	}
+
+	// 尝试解析为 RFC3339 格式
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("无法解析时间戳: %s", timestamp)
+}
@@ -0,0 +1,131 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxStreamLength 解码后的流数据的最大长度，防止压缩炸弹
+const maxStreamLength = 256 << 20
+
+// decodeStream 解码流对象的数据，只支持不压缩和FlateDecode（可带PNG预测器）的流
+func decodeStream(object *pdfObject) ([]byte, error) {
+	dict, ok := parseDict(object.dict)
+	if !ok || object.stream == nil {
+		return nil, errors.New("不是有效的流对象")
+	}
+
+	filters := arrayItems(dict["/Filter"])
+	switch {
+	case len(filters) == 0:
+		return object.stream, nil
+	case len(filters) > 1 || !bytes.Equal(filters[0], []byte("/FlateDecode")) && !bytes.Equal(filters[0], []byte("/Fl")):
+		return nil, fmt.Errorf("不支持的流过滤器: %s", dict["/Filter"])
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(object.stream))
+	if err != nil {
+		return nil, fmt.Errorf("解压流数据失败: %w", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxStreamLength+1))
+	// 不少文件的压缩数据缺少校验和，已解压出数据时忽略截断错误
+	if err != nil && !(errors.Is(err, io.ErrUnexpectedEOF) && len(data) > 0) {
+		return nil, fmt.Errorf("解压流数据失败: %w", err)
+	}
+	if len(data) > maxStreamLength {
+		return nil, errors.New("流数据过大")
+	}
+
+	params := arrayItems(dict["/DecodeParms"])
+	if len(params) == 0 {
+		return data, nil
+	}
+	decodeParms, _ := parseDict(params[0])
+	predictor, _ := parseInt(decodeParms["/Predictor"])
+	if predictor <= 1 {
+		return data, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("不支持的预测器: %d", predictor)
+	}
+	columns, ok := parseInt(decodeParms["/Columns"])
+	if !ok {
+		columns = 1
+	}
+	colors, ok := parseInt(decodeParms["/Colors"])
+	if !ok {
+		colors = 1
+	}
+	bits, ok := parseInt(decodeParms["/BitsPerComponent"])
+	if !ok {
+		bits = 8
+	}
+	return unpredictPNG(data, columns, colors, bits)
+}
+
+// unpredictPNG 还原PNG预测器处理过的数据，每行数据前有一个字节的过滤类型
+func unpredictPNG(data []byte, columns, colors, bits int) ([]byte, error) {
+	if columns <= 0 || colors <= 0 || bits <= 0 || columns*colors*bits > 1<<24 {
+		return nil, errors.New("预测器参数无效")
+	}
+	rowLength := (columns*colors*bits + 7) / 8
+	bpp := max(1, colors*bits/8)
+
+	output := make([]byte, 0, len(data)/(rowLength+1)*rowLength)
+	previous := make([]byte, rowLength)
+	for len(data) > 0 {
+		if len(data) < rowLength+1 {
+			return nil, errors.New("预测器数据不完整")
+		}
+		filter, row := data[0], append([]byte(nil), data[1:rowLength+1]...)
+		data = data[rowLength+1:]
+
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], previous[i-bpp]
+			}
+			up := previous[i]
+			switch filter {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("未知的PNG过滤类型: %d", filter)
+			}
+		}
+		output = append(output, row...)
+		previous = row
+	}
+	return output, nil
+}
+
+// paeth PNG的Paeth预测函数
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,55 @@
+package pdf
+
+import "fmt"
+
+// 可见水印使用PDF标准14种字体中的Helvetica，阅读器自带该字体，文件中不需要嵌入字体数据。
+// 文字按WinAnsiEncoding编码，宽度取自Helvetica的AFM文件，单位为字号的1/1000
+const (
+	fontName       = "Helvetica"
+	fontAscent     = 718  // 大写字母高度
+	fontDescent    = -207 // 下伸部分深度
+	fontUnitsPerEm = 1000
+)
+
+// helveticaASCII ASCII可打印字符（0x20到0x7E）的宽度
+var helveticaASCII = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // 空格到/
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0到?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @到O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P到_
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // `到o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p到~
+}
+
+// winAnsiGlyph ASCII之外支持的字符在WinAnsiEncoding中的编码和宽度
+type winAnsiGlyph struct {
+	code  byte
+	width int
+}
+
+// winAnsiExtra ASCII之外常用于水印文本的标点和符号
+var winAnsiExtra = map[rune]winAnsiGlyph{
+	'€': {0x80, 556}, '…': {0x85, 1000}, '‘': {0x91, 222}, '’': {0x92, 222},
+	'“': {0x93, 333}, '”': {0x94, 333}, '•': {0x95, 350}, '–': {0x96, 556},
+	'—': {0x97, 1000}, '™': {0x99, 1000}, ' ': {0xA0, 278}, '§': {0xA7, 556},
+	'©': {0xA9, 737}, '®': {0xAE, 737}, '°': {0xB0, 400}, '·': {0xB7, 278},
+}
+
+// encodeText 将文本编码为WinAnsiEncoding，返回编码后的字节和以字体单位计的宽度
+func encodeText(text string) ([]byte, int, error) {
+	encoded := make([]byte, 0, len(text))
+	width := 0
+	for _, r := range text {
+		switch glyph, ok := winAnsiExtra[r]; {
+		case r >= 0x20 && r <= 0x7E:
+			encoded = append(encoded, byte(r))
+			width += helveticaASCII[r-0x20]
+		case ok:
+			encoded = append(encoded, glyph.code)
+			width += glyph.width
+		default:
+			return nil, 0, fmt.Errorf("字符 %q 不在PDF标准字体的WinAnsi编码中", r)
+		}
+	}
+	return encoded, width, nil
+}
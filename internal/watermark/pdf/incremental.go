@@ -0,0 +1,113 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// updateMarker 本工具追加的增量更新前的注释，移除水印时用于定位增量更新
+const updateMarker = "%WATERMARK_UPDATE"
+
+// updateObject 增量更新中写入的对象
+type updateObject struct {
+	ref  objectRef
+	body []byte
+}
+
+// appendUpdate 在文件末尾追加增量更新，原文件的字节保持不变
+// 新的trailer通过/Prev指向原来的交叉引用节，/Info指向info，info为零值时保留原trailer中的/Info；/Encrypt和/ID保持不变。
+// 已加密的文件中对象使用原来的安全处理器加密，交叉引用流不加密。
+// 原文件最后一个交叉引用节是交叉引用流时，增量更新也写入交叉引用流
+func appendUpdate(d *document, objects []updateObject, info objectRef) []byte {
+	var buffer bytes.Buffer
+	buffer.Write(d.data)
+	buffer.WriteString("\n" + updateMarker + "\n")
+
+	size := d.size
+	offsets := make(map[int]int, len(objects))
+	for _, object := range objects {
+		offsets[object.ref.num] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d %d obj\n", object.ref.num, object.ref.gen)
+		if d.security != nil {
+			object.body = d.security.encryptBody(object.ref, object.body)
+		}
+		buffer.Write(object.body)
+		buffer.WriteString("\nendobj\n")
+		size = max(size, object.ref.num+1)
+	}
+
+	// trailer字典中/Size和/Prev之外的条目
+	var entries bytes.Buffer
+	fmt.Fprintf(&entries, " /Root %s", d.root)
+	if info != (objectRef{}) {
+		entries.WriteString(" /Info " + info.String())
+	} else if original, ok := d.trailerDict["/Info"]; ok {
+		entries.WriteString(" /Info ")
+		entries.Write(original)
+	}
+	// 已加密的文件沿用原来的/Encrypt和/ID，/ID参与文件密钥的计算
+	for _, key := range []string{"/Encrypt", "/ID"} {
+		if value, ok := d.trailerDict[key]; ok {
+			entries.WriteString(" " + key + " ")
+			entries.Write(value)
+		}
+	}
+
+	// 每个对象单独作为一个子节，对象号不需要连续
+	sort.Slice(objects, func(i, j int) bool { return objects[i].ref.num < objects[j].ref.num })
+	xrefOffset := buffer.Len()
+	if !d.xrefStream {
+		buffer.WriteString("xref\n")
+		for _, object := range objects {
+			fmt.Fprintf(&buffer, "%d 1\n%010d %05d n \n", object.ref.num, offsets[object.ref.num], object.ref.gen)
+		}
+		fmt.Fprintf(&buffer, "trailer\n<< /Size %d%s /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", size, entries.Bytes(), d.startxref, xrefOffset)
+		return buffer.Bytes()
+	}
+
+	// 交叉引用流本身也是一个对象，每项为1字节类型、偏移和2字节代号，不压缩
+	stream := objectRef{num: size}
+	objects = append(objects, updateObject{ref: stream})
+	offsets[stream.num] = xrefOffset
+	width := 1
+	for xrefOffset >= 1<<(8*width) {
+		width++
+	}
+	var index, rows bytes.Buffer
+	for _, object := range objects {
+		fmt.Fprintf(&index, " %d 1", object.ref.num)
+		rows.WriteByte(entryInUse)
+		for i := width - 1; i >= 0; i-- {
+			rows.WriteByte(byte(offsets[object.ref.num] >> (8 * i)))
+		}
+		rows.Write([]byte{byte(object.ref.gen >> 8), byte(object.ref.gen)})
+	}
+	fmt.Fprintf(&buffer, "%d 0 obj\n<< /Type /XRef /Size %d%s /Prev %d /W [1 %d 2] /Index [%s] /Length %d >>\nstream\n",
+		stream.num, size+1, entries.Bytes(), d.startxref, width, bytes.TrimSpace(index.Bytes()), rows.Len())
+	buffer.Write(rows.Bytes())
+	fmt.Fprintf(&buffer, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buffer.Bytes()
+}
+
+// removeLastUpdate 删除本工具追加的最后一个增量更新，之后又有其他增量更新时不删除
+func removeLastUpdate(data []byte) ([]byte, bool) {
+	pos := bytes.LastIndex(data, []byte("\n"+updateMarker+"\n"))
+	if pos < 0 || bytes.Count(data[pos:], []byte("%%EOF")) != 1 {
+		return data, false
+	}
+	return data[:pos], true
+}
+
+// removeUpdates 依次删除文件末尾本工具追加的所有增量更新，返回删除后的数据和删除的数量
+func removeUpdates(data []byte) ([]byte, int) {
+	count := 0
+	for {
+		stripped, ok := removeLastUpdate(data)
+		if !ok {
+			return data, count
+		}
+		data = stripped
+		count++
+	}
+}
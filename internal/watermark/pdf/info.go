@@ -0,0 +1,46 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// infoKey 文档信息字典中保存水印信封的键
+const infoKey = "/WatermarkEnvelope"
+
+// infoEnvelopePattern 匹配文档信息字典中的水印信封，信封是Base64文本，不含需要转义的字符
+var infoEnvelopePattern = regexp.MustCompile(infoKey + `\s*\(([A-Za-z0-9+/=]*)\)`)
+
+// infoKeyPattern 匹配文档信息字典中的水印条目，已加密的文件中信封是加密后的二进制字符串
+var infoKeyPattern = regexp.MustCompile(infoKey + `\s*[(<]`)
+
+// infoObject 返回写入水印信封的文档信息字典
+// 复制原有的文档信息字典，保留标题、作者等条目，原字典可以位于对象流中
+func infoObject(d *document, armored string, ref objectRef) updateObject {
+	dict := []byte("<< >>")
+	if original, ok := d.info(); ok {
+		if object, ok := d.object(original); ok && bytes.HasPrefix(object.dict, []byte("<<")) {
+			dict = object.dict
+		}
+	}
+	return updateObject{ref: ref, body: setKey(dict, infoKey, "("+armored+")")}
+}
+
+// findInfoEnvelopes 返回文件中所有文档信息字典水印信封的位置
+func findInfoEnvelopes(data []byte) [][]int {
+	return infoEnvelopePattern.FindAllSubmatchIndex(data, -1)
+}
+
+// removeInfo 用空格覆盖文档信息字典中的水印信封，保持之后的对象偏移不变
+func removeInfo(data []byte) ([]byte, int) {
+	matches := findInfoEnvelopes(data)
+	if len(matches) == 0 {
+		return data, 0
+	}
+
+	output := append([]byte(nil), data...)
+	for _, m := range matches {
+		copy(output[m[0]:m[1]], bytes.Repeat([]byte(" "), m[1]-m[0]))
+	}
+	return output, len(matches)
+}
@@ -0,0 +1,248 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// maxNesting 数组和字典的最大嵌套层数，超过时视为无效对象
+const maxNesting = 64
+
+var (
+	// refTailPattern 匹配整数之后的"G R"，两者组成间接引用
+	refTailPattern = regexp.MustCompile(`^\s+\d+\s+R\b`)
+	refPattern     = regexp.MustCompile(`^(\d+)\s+(\d+)\s+R$`)
+	// objHeaderPattern 匹配间接对象的开头"N G obj"
+	objHeaderPattern = regexp.MustCompile(`^(\d+)\s+(\d+)\s+obj\b`)
+)
+
+// objectRef 间接对象引用
+type objectRef struct {
+	num int
+	gen int
+}
+
+// String 返回引用的PDF写法，如"1 0 R"
+func (r objectRef) String() string {
+	return fmt.Sprintf("%d %d R", r.num, r.gen)
+}
+
+// isSpace 判断是否为PDF空白字符
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+// isDelimiter 判断是否为PDF分隔符
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// skipSpace 跳过PDF空白字符和注释
+func skipSpace(data []byte, pos int) int {
+	for pos < len(data) {
+		switch {
+		case isSpace(data[pos]):
+			pos++
+		case data[pos] == '%':
+			for pos < len(data) && data[pos] != '\n' && data[pos] != '\r' {
+				pos++
+			}
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+// objectEnd 返回从pos开始的直接对象结束后的位置，pos处不是完整的对象时返回-1
+// 间接引用"N G R"作为一个对象；字符串中的括号和尖括号不计入嵌套
+func objectEnd(data []byte, pos int) int {
+	return nestedObjectEnd(data, pos, 0)
+}
+
+func nestedObjectEnd(data []byte, pos, depth int) int {
+	if pos >= len(data) || depth > maxNesting {
+		return -1
+	}
+
+	switch c := data[pos]; c {
+	case '(':
+		// 字面字符串可以嵌套括号，反斜杠转义下一个字符
+		nesting := 0
+		for i := pos; i < len(data); i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case '(':
+				nesting++
+			case ')':
+				if nesting--; nesting == 0 {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	case '<':
+		if pos+1 < len(data) && data[pos+1] == '<' {
+			return containerEnd(data, pos+2, ">>", depth)
+		}
+		end := bytes.IndexByte(data[pos:], '>')
+		if end < 0 {
+			return -1
+		}
+		return pos + end + 1
+	case '[':
+		return containerEnd(data, pos+1, "]", depth)
+	case '/':
+		end := pos + 1
+		for end < len(data) && !isSpace(data[end]) && !isDelimiter(data[end]) {
+			end++
+		}
+		return end
+	case ')', '>', ']', '{', '}':
+		return -1
+	}
+
+	// 数字、true、false、null，整数之后可能是间接引用
+	end := pos
+	for end < len(data) && !isSpace(data[end]) && !isDelimiter(data[end]) {
+		end++
+	}
+	if _, err := strconv.Atoi(string(data[pos:end])); err == nil {
+		if m := refTailPattern.FindIndex(data[end:min(end+32, len(data))]); m != nil {
+			return end + m[1]
+		}
+	}
+	return end
+}
+
+// containerEnd 返回从pos开始的数组或字典内容以closing结束后的位置
+func containerEnd(data []byte, pos int, closing string, depth int) int {
+	for {
+		pos = skipSpace(data, pos)
+		if bytes.HasPrefix(data[pos:], []byte(closing)) {
+			return pos + len(closing)
+		}
+		end := nestedObjectEnd(data, pos, depth+1)
+		if end < 0 {
+			return -1
+		}
+		pos = end
+	}
+}
+
+// dictionaryEnd 返回从start开始的字典结束后的位置，start处不是字典或字典不完整时返回-1
+func dictionaryEnd(data []byte, start int) int {
+	if !bytes.HasPrefix(data[start:], []byte("<<")) {
+		return -1
+	}
+	return objectEnd(data, start)
+}
+
+// parseDict 解析字典的第一层条目，返回键（包括斜杠）到值原文的映射
+func parseDict(dict []byte) (map[string][]byte, bool) {
+	if !bytes.HasPrefix(dict, []byte("<<")) {
+		return nil, false
+	}
+
+	entries := make(map[string][]byte)
+	pos := 2
+	for {
+		pos = skipSpace(dict, pos)
+		if bytes.HasPrefix(dict[pos:], []byte(">>")) {
+			return entries, true
+		}
+		if pos >= len(dict) || dict[pos] != '/' {
+			return nil, false
+		}
+		keyEnd := objectEnd(dict, pos)
+		valueStart := skipSpace(dict, keyEnd)
+		valueEnd := objectEnd(dict, valueStart)
+		if valueEnd < 0 {
+			return nil, false
+		}
+		entries[string(dict[pos:keyEnd])] = dict[valueStart:valueEnd]
+		pos = valueEnd
+	}
+}
+
+// removeKey 返回删除了第一层中指定键的字典，其余条目的原文保持不变
+func removeKey(dict []byte, key string) []byte {
+	if !bytes.HasPrefix(dict, []byte("<<")) {
+		return dict
+	}
+
+	output := append([]byte(nil), dict[:2]...)
+	pos := 2
+	for {
+		start := skipSpace(dict, pos)
+		if bytes.HasPrefix(dict[start:], []byte(">>")) || start >= len(dict) || dict[start] != '/' {
+			return append(output, dict[pos:]...)
+		}
+		keyEnd := objectEnd(dict, start)
+		valueEnd := objectEnd(dict, skipSpace(dict, keyEnd))
+		if valueEnd < 0 {
+			return append(output, dict[pos:]...)
+		}
+		if string(dict[start:keyEnd]) != key {
+			output = append(output, dict[pos:valueEnd]...)
+		}
+		pos = valueEnd
+	}
+}
+
+// setKey 返回第一层中键key的值替换为value的字典，原来没有该键时加在末尾
+func setKey(dict []byte, key, value string) []byte {
+	dict = removeKey(dict, key)
+	output := append([]byte(nil), bytes.TrimSpace(dict[:len(dict)-2])...)
+	return append(output, " "+key+" "+value+" >>"...)
+}
+
+// arrayItems 返回数组中的各个元素，value不是数组时作为只有一个元素的数组
+func arrayItems(value []byte) [][]byte {
+	if !bytes.HasPrefix(value, []byte("[")) {
+		if len(value) == 0 {
+			return nil
+		}
+		return [][]byte{value}
+	}
+
+	var items [][]byte
+	pos := 1
+	for {
+		pos = skipSpace(value, pos)
+		if pos >= len(value) || value[pos] == ']' {
+			return items
+		}
+		end := objectEnd(value, pos)
+		if end < 0 {
+			return items
+		}
+		items = append(items, value[pos:end])
+		pos = end
+	}
+}
+
+// parseRef 解析间接引用
+func parseRef(value []byte) (objectRef, bool) {
+	m := refPattern.FindSubmatch(value)
+	if m == nil {
+		return objectRef{}, false
+	}
+	var ref objectRef
+	ref.num, _ = strconv.Atoi(string(m[1]))
+	ref.gen, _ = strconv.Atoi(string(m[2]))
+	return ref, true
+}
+
+// parseInt 解析整数
+func parseInt(value []byte) (int, bool) {
+	n, err := strconv.Atoi(string(value))
+	return n, err == nil
+}
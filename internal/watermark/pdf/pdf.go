@@ -2,19 +2,24 @@ package pdf
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 	"strings"
-	"time"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
+	"watermark-tool/internal/watermark/xmp"
 )
 
 // PDFWatermarker 实现了PDF文件的水印处理
-type PDFWatermarker struct{}
+type PDFWatermarker struct {
+	// password 打开加密文档的用户密码或所有者密码，见 WithPassword
+	password string
+}
 
 // 注册PDF水印处理器
 func init() {
@@ -26,60 +31,49 @@ func (p *PDFWatermarker) GetSupportedType() string {
 	return "pdf"
 }
 
-// 定义PDF水印标记
+// Capabilities 返回嵌入方式的能力
+func (p *PDFWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "以增量更新写入文档信息字典和XMP元数据流，原文件字节不变，可选在每一页上叠加文字可见水印", Locate: true, Lossless: true, Visible: true}
+}
+
+// 旧版本在trailer前或追加的注释中写入的水印标记，只用于提取和移除已有的水印
 const (
 	watermarkPrefix = "%WATERMARK_BEGIN:"
 	watermarkSuffix = ":WATERMARK_END%"
 )
 
-// createWatermarkMetadata 创建包含水印信息的元数据
-func createWatermarkMetadata(text string) string {
-	// 生成时间戳
-	timestamp := time.Now().Format(time.RFC3339)
-
-	// 简单编码水印文本
-	encodedText := base64.StdEncoding.EncodeToString([]byte(text))
-
-	// 格式化元数据
-	metadata := fmt.Sprintf("%s%s|%s%s",
-		watermarkPrefix,
-		encodedText,
-		timestamp,
-		watermarkSuffix)
-
-	return metadata
+// AddWatermark 为PDF文件添加水印
+func (p *PDFWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
+	return watermark.AddWatermarkFile(context.Background(), p, inputFile, outputFile, watermark.NewPayload(watermarkText))
 }
 
-// insertMetadata 在PDF文件的不同位置插入元数据
-func insertMetadata(pdfData []byte, metadata string) []byte {
-	var buffer bytes.Buffer
-
-	// 在文件的多个位置插入水印，增加隐蔽性和冗余性
-
-	// 1. 在PDF trailer附近插入
-	trailerPos := bytes.LastIndex(pdfData, []byte("trailer"))
-	if trailerPos > 0 {
-		buffer.Write(pdfData[:trailerPos])
-		buffer.WriteString("\n")
-		buffer.WriteString(metadata)
-		buffer.WriteString("\n")
-		buffer.Write(pdfData[trailerPos:])
-		return buffer.Bytes()
+// ExtractWatermark 从PDF文件中提取水印
+func (p *PDFWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), p, inputFile)
+	if err != nil {
+		return "", "", err
 	}
+	return payload.Text, payload.Timestamp(), nil
+}
 
-	// 2. 在文件末尾插入（作为备用方案）
-	buffer.Write(pdfData)
-	buffer.WriteString("\n")
-	buffer.WriteString(metadata)
-	buffer.WriteString("\n")
+// AddWatermarkStream 为PDF数据流添加水印
+// 水印以增量更新的方式追加在文件末尾：新的文档信息字典和XMP元数据流保存水印信封，
+// 新的交叉引用表和trailer通过/Prev指向原交叉引用表。原文件的字节保持不变，已有的数字签名仍然有效。
+// 载荷中带有可见水印参数时，同一个增量更新还会在每一页的内容后绘制文字水印。
+// 已加密的文件需要通过 WithPassword 提供用户密码或所有者密码，追加的对象使用原文件的安全处理器加密
+func (p *PDFWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	return addWatermark(ctx, src, size, dst, payload, p.password, false)
+}
 
-	return buffer.Bytes()
+// WithPassword 返回使用password打开加密文档的处理器
+func (p *PDFWatermarker) WithPassword(password string) watermark.StreamWatermarker {
+	return &PDFWatermarker{password: password}
 }
 
-// AddWatermark 为PDF文件添加水印
-func (p *PDFWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 读取源PDF文件
-	data, err := os.ReadFile(inputFile)
+// addWatermark 以增量更新添加水印，已加密的文件使用password打开，hidden为true时同时在每一页上写入不可见的文字层
+func addWatermark(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload, password string, hidden bool) error {
+	// 读取源PDF数据
+	data, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
 		return fmt.Errorf("读取PDF文件失败: %w", err)
 	}
@@ -89,57 +83,217 @@ func (p *PDFWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 		return errors.New("不是有效的PDF文件")
 	}
 
-	// 创建包含水印信息的元数据
-	metadata := createWatermarkMetadata(watermarkText)
-
-	// 在PDF文件中插入元数据
-	watermarkedData := insertMetadata(data, metadata)
+	// 将水印载荷加密并封装为信封
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
 
-	// 写入输出文件
-	err = os.WriteFile(outputFile, watermarkedData, 0644)
+	// 先删除之前添加水印时追加的增量更新，重复添加不会累积
+	data, _ = removeUpdates(data)
+	var mark pageMark
+	if opts, ok := payload.OverlayOptions(); ok {
+		mark.stamp = &opts
+	}
+	if hidden {
+		mark.hidden = armored
+	}
+	watermarkedData, err := appendWatermark(data, password, armored, watermark.XMPProperties(payload, armored), mark)
 	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 写入输出
+	if _, err := dst.Write(watermarkedData); err != nil {
 		return fmt.Errorf("写入PDF文件失败: %w", err)
 	}
 
 	return nil
 }
 
-// ExtractWatermark 从PDF文件中提取水印
-func (p *PDFWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	// 读取PDF文件
-	data, err := os.ReadFile(inputFile)
+// appendWatermark 追加包含水印的增量更新，同时在每一页上绘制mark中的可见水印和不可见文字层
+// 已加密的文件使用password打开，追加的对象按原文件的加密算法和文件密钥加密
+func appendWatermark(data []byte, password, armored string, props xmp.Properties, mark pageMark) ([]byte, error) {
+	d, err := openDocument(data, password)
 	if err != nil {
-		return "", "", fmt.Errorf("读取PDF文件失败: %w", err)
+		return nil, err
+	}
+
+	metadata := objectRef{num: d.size}
+	info := objectRef{num: d.size + 1}
+	objects, err := xmpObjects(d, props, metadata)
+	if err != nil {
+		return nil, err
+	}
+	objects = append(objects, infoObject(d, armored, info))
+	if !mark.empty() {
+		stamps, err := stampObjects(d, mark, d.size+2)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, stamps...)
+	}
+	return appendUpdate(d, objects, info), nil
+}
+
+// ExtractWatermarkStream 从PDF数据流中提取水印
+func (p *PDFWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	// 读取PDF数据
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF文件失败: %w", err)
 	}
 
 	// 验证是否为PDF文件
 	if !bytes.HasPrefix(data, []byte("%PDF-")) {
-		return "", "", errors.New("不是有效的PDF文件")
+		return nil, errors.New("不是有效的PDF文件")
+	}
+
+	// 依次读取最后写入的文档信息字典、XMP元数据流和水印注释，都没有时再通过交叉引用读取对象
+	if matches := findInfoEnvelopes(data); matches != nil {
+		last := matches[len(matches)-1]
+		return watermark.OpenPayload(string(data[last[2]:last[3]]))
+	}
+	if payload, err := watermark.OpenXMP(data); !errors.Is(err, watermark.ErrNoWatermark) {
+		return payload, err
 	}
 
-	// 使用正则表达式提取水印元数据
 	pattern := regexp.MustCompile(watermarkPrefix + `(.*?)` + watermarkSuffix)
 	matches := pattern.FindSubmatch(data)
-
 	if len(matches) < 2 {
-		return "", "", errors.New("未找到水印信息")
+		return extractFromObjects(ctx, data, p.password)
 	}
 
-	// 解析水印元数据
+	// 解析水印信封
 	watermarkData := string(matches[1])
+	if envelope.IsArmored(watermarkData) {
+		return watermark.OpenPayload(watermarkData)
+	}
+
+	// 旧版本格式：Base64编码的水印文本|时间戳
 	parts := strings.Split(watermarkData, "|")
 	if len(parts) < 2 {
-		return "", "", errors.New("水印格式无效")
+		return nil, errors.New("水印格式无效")
 	}
 
 	encodedText := parts[0]
 	timestamp := parts[1]
 
-	// 解码水印文本
+	// 解码水印载荷
 	decodedBytes, err := base64.StdEncoding.DecodeString(encodedText)
 	if err != nil {
-		return "", "", fmt.Errorf("解码水印失败: %w", err)
+		return nil, fmt.Errorf("解码水印失败: %w", err)
 	}
 
-	return string(decodedBytes), timestamp, nil
+	return watermark.DecodePayload(decodedBytes, timestamp), nil
+}
+
+// extractFromObjects 通过交叉引用读取文档信息字典和文档目录引用的元数据流中的水印，都没有时读取页面上的文字层
+// 文件被其他工具改写后，这些对象可能位于对象流中，元数据流也可能被压缩，直接搜索文件内容找不到；
+// 已加密的文件中这些对象也是加密的，需要使用password解密
+func extractFromObjects(ctx context.Context, data []byte, password string) (*watermark.Payload, error) {
+	d, err := openEncrypted(data, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref, ok := d.info(); ok {
+		if object, ok := d.object(ref); ok {
+			if m := infoEnvelopePattern.FindSubmatch(object.dict); m != nil {
+				return watermark.OpenPayload(string(m[1]))
+			}
+		}
+	}
+	if catalog, ok := d.object(d.root); ok {
+		entries, _ := parseDict(catalog.dict)
+		if ref, ok := parseRef(entries["/Metadata"]); ok {
+			if object, ok := d.object(ref); ok && object.stream != nil {
+				if packet, err := decodeStream(object); err == nil {
+					if payload, err := watermark.OpenXMP(packet); !errors.Is(err, watermark.ErrNoWatermark) {
+						return payload, err
+					}
+				}
+			}
+		}
+	}
+	return extractFromPages(ctx, d)
+}
+
+// openEncrypted 使用password打开文档
+// 密码缺失或错误时返回对应的错误，其他无法解析的文件返回 watermark.ErrNoWatermark
+func openEncrypted(data []byte, password string) (*document, error) {
+	d, err := openDocument(data, password)
+	if errors.Is(err, watermark.ErrPasswordRequired) || errors.Is(err, watermark.ErrInvalidPassword) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, watermark.ErrNoWatermark
+	}
+	return d, nil
+}
+
+// RemoveWatermark 移除PDF文件中的水印
+func (p *PDFWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), p, inputFile, outputFile)
+}
+
+// RemoveWatermarkStream 移除PDF数据流中的水印
+func (p *PDFWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取PDF文件失败: %w", err)
+	}
+
+	// 验证是否为PDF文件
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return errors.New("不是有效的PDF文件")
+	}
+
+	// 水印所在的增量更新是文件最后的更新时整个删除，文件恢复原样；
+	// 之后又有其他增量更新时用空格覆盖水印信封和可见水印的内容，已加密的文件解密后覆盖，再删除旧版本的水印注释
+	data, count := removeUpdates(data)
+	data, encrypted, err := removeEncrypted(data, p.password)
+	if err != nil {
+		return err
+	}
+	data, infos := removeInfo(data)
+	data, descriptions := removeXMP(data)
+	data, stamps := removeStamps(data)
+	data, comments := watermark.CutMarkers(data, watermarkPrefix, watermarkSuffix)
+	if count+encrypted+infos+descriptions+stamps+comments == 0 {
+		return watermark.ErrNoWatermark
+	}
+
+	if _, err := dst.Write(data); err != nil {
+		return fmt.Errorf("写入PDF文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// LocateWatermarks 返回PDF数据流中文档信息字典水印信封、XMP水印属性、可见水印和水印注释的偏移
+// 已加密的文件中XMP元数据流是加密的，只能定位文档信息字典和可见水印
+func (p *PDFWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF文件失败: %w", err)
+	}
+
+	var locations []string
+	for _, m := range infoKeyPattern.FindAllIndex(data, -1) {
+		locations = append(locations, fmt.Sprintf("Info@%d", m[0]))
+	}
+	for _, r := range xmp.Descriptions(data) {
+		locations = append(locations, fmt.Sprintf("XMP@%d", r[0]))
+	}
+	for _, r := range findStamps(data) {
+		locations = append(locations, fmt.Sprintf("stamp@%d", r[0]))
+	}
+	for _, offset := range watermark.FindMarkers(data, watermarkPrefix, watermarkSuffix) {
+		locations = append(locations, fmt.Sprintf("comment@%d", offset))
+	}
+	return locations, nil
 }
@@ -0,0 +1,189 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+// testPDF 生成只有一页的PDF文件，文档目录引用未压缩的元数据流，trailer引用文档信息字典
+func testPDF() []byte {
+	packet := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?><x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/"><pdf:Producer>Writer</pdf:Producer></rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 5 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << >> >>",
+		"<< /Length 0 >>\nstream\n\nendstream",
+		fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(packet), packet),
+		"<< /Title (Report) /Producer (Writer) >>",
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xrefOffset := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R /ID [<01><02>] >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+	return buffer.Bytes()
+}
+
+func TestPDFIncrementalUpdate(t *testing.T) {
+	ctx := context.Background()
+	w := &PDFWatermarker{}
+	data := testPDF()
+
+	payload := watermark.NewPayload("内部资料")
+	payload.Issuer = "法务部"
+	payload.Rights = "© 2026 示例公司"
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, payload); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+	output := marked.Bytes()
+	if !bytes.HasPrefix(output, data) {
+		t.Fatal("原文件的字节被修改")
+	}
+
+	// 新的trailer指向原交叉引用表和新的文档信息字典，新交叉引用表中的偏移指向对应的对象
+	d, err := openDocument(output, "")
+	if err != nil {
+		t.Fatalf("读取新的trailer失败: %v", err)
+	}
+	if d.size != 9 || d.xrefStream || !bytes.Contains(d.trailer, []byte("/ID [<01><02>]")) || !bytes.Contains(d.trailer, []byte("/Info 8 0 R")) {
+		t.Errorf("新的trailer为 %s", d.trailer)
+	}
+	original, _ := openDocument(data, "")
+	if !bytes.Contains(d.trailer, []byte(fmt.Sprintf("/Prev %d", original.startxref))) {
+		t.Errorf("新的trailer没有指向原交叉引用表: %s", d.trailer)
+	}
+	entries := regexp.MustCompile(`(\d+) 1\n(\d{10}) (\d{5}) n \n`).FindAllSubmatch(output[d.startxref:], -1)
+	if len(entries) != 3 {
+		t.Fatalf("新的交叉引用表有%d项，期望3项", len(entries))
+	}
+	for _, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[2]))
+		if want := fmt.Sprintf("%s 0 obj", entry[1]); !bytes.HasPrefix(output[offset:], []byte(want)) {
+			t.Errorf("偏移%d处不是对象 %s", offset, want)
+		}
+	}
+
+	// 文档目录引用新的元数据流，原有的XMP属性保留，同时写入版权信息，水印文本不以明文写入
+	catalog, ok := d.object(d.root)
+	if !ok || !bytes.Contains(catalog.dict, []byte("/Metadata 7 0 R")) || !bytes.Contains(catalog.dict, []byte("/Pages 2 0 R")) {
+		t.Fatalf("文档目录为 %s", catalog.dict)
+	}
+	metadata, ok := d.object(objectRef{num: 7})
+	if !ok || metadata.stream == nil {
+		t.Fatal("未找到新的元数据流")
+	}
+	for _, want := range []string{"<pdf:Producer>Writer</pdf:Producer>", "© 2026 示例公司", "法务部"} {
+		if !bytes.Contains(metadata.stream, []byte(want)) {
+			t.Errorf("元数据流中缺少 %s", want)
+		}
+	}
+	if bytes.Contains(metadata.stream, []byte("内部资料")) {
+		t.Error("水印文本以明文写入了元数据流")
+	}
+
+	// 新的文档信息字典保留原有条目
+	info, ok := d.object(objectRef{num: 8})
+	if !ok || !bytes.HasPrefix(info.dict, []byte("<< /Title (Report) /Producer (Writer) "+infoKey+" (")) {
+		t.Fatalf("文档信息字典为 %s", info.dict)
+	}
+	if locations, err := w.LocateWatermarks(ctx, bytes.NewReader(output), int64(len(output))); err != nil ||
+		len(locations) != 2 || !strings.HasPrefix(locations[0], "Info@") || !strings.HasPrefix(locations[1], "XMP@") {
+		t.Errorf("水印位置为 %v, %v", locations, err)
+	}
+
+	// 清除文档信息字典后仍可以从XMP中提取水印
+	xmpOnly, _ := removeInfo(output)
+	extracted, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(xmpOnly), int64(len(xmpOnly)))
+	if err != nil || extracted.Text != "内部资料" {
+		t.Errorf("从XMP提取水印结果为 %v, %v", extracted, err)
+	}
+
+	// 重复添加时替换之前的增量更新
+	var remarked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)), &remarked, watermark.NewPayload("第二次")); err != nil {
+		t.Fatalf("重复添加水印失败: %v", err)
+	}
+	if bytes.Count(remarked.Bytes(), []byte(updateMarker)) != 1 {
+		t.Error("重复添加后增量更新被累积")
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(remarked.Bytes()), int64(remarked.Len()), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if !bytes.Equal(stripped.Bytes(), data) {
+		t.Error("移除水印后的文件与原文件不一致")
+	}
+
+	// 之后又有其他增量更新时用空格覆盖水印信封，文件长度不变
+	signed := append(append([]byte(nil), output...), "\n% signature\nstartxref\n0\n%%EOF\n"...)
+	stripped.Reset()
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(signed), int64(len(signed)), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if stripped.Len() != len(signed) {
+		t.Error("覆盖水印信封后文件长度改变")
+	}
+	if _, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+}
+
+func TestPDFLegacyComment(t *testing.T) {
+	ctx := context.Background()
+	w := &PDFWatermarker{}
+	data := testPDF()
+
+	// 旧版本在trailer前插入的水印注释仍可以提取和移除
+	armored, err := watermark.SealPayload(watermark.NewPayload("旧水印"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := bytes.LastIndex(data, []byte("trailer"))
+	legacy := append(append(append([]byte(nil), data[:pos]...), "\n"+watermarkPrefix+armored+watermarkSuffix+"\n"...), data[pos:]...)
+
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(legacy), int64(len(legacy)))
+	if err != nil || payload.Text != "旧水印" {
+		t.Fatalf("提取旧版本水印结果为 %v, %v", payload, err)
+	}
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(legacy), int64(len(legacy)), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if !bytes.Equal(stripped.Bytes(), data) {
+		t.Error("移除旧版本水印后的文件与原文件不一致")
+	}
+
+	// 旧版本为已加密的文件追加的水印注释重复原来的startxref，不需要密码即可提取和移除
+	encrypted := bytes.Replace(data, []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt 9 0 R"), 1)
+	all := startxrefPattern.FindAllSubmatch(encrypted, -1)
+	appended := fmt.Appendf(append([]byte(nil), encrypted...), "\n%s\n%s%s%s\nstartxref\n%s\n%%%%EOF\n",
+		updateMarker, watermarkPrefix, armored, watermarkSuffix, all[len(all)-1][1])
+	payload, err = w.ExtractWatermarkStream(ctx, bytes.NewReader(appended), int64(len(appended)))
+	if err != nil || payload.Text != "旧水印" {
+		t.Errorf("提取水印结果为 %v, %v", payload, err)
+	}
+	stripped.Reset()
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(appended), int64(len(appended)), &stripped); err != nil || !bytes.Equal(stripped.Bytes(), encrypted) {
+		t.Errorf("移除水印结果不正确: %v", err)
+	}
+}
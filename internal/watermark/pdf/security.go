@@ -0,0 +1,529 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"regexp"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/xmp"
+)
+
+// passwordPadding 标准安全处理器用于填充口令的32字节，见PDF规范算法2
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// cryptMethod 字符串或流使用的加密算法
+type cryptMethod int
+
+const (
+	cryptIdentity cryptMethod = iota // 不加密
+	cryptRC4                         // RC4，密钥由文件密钥和对象号派生
+	cryptAESV2                       // AES-128-CBC，密钥由文件密钥和对象号派生
+	cryptAESV3                       // AES-256-CBC，直接使用文件密钥
+)
+
+// securityHandler 标准安全处理器，保存验证口令后得到的文件密钥
+// 读取对象时解密其中的字符串和流，追加对象时使用相同的算法和文件密钥加密，原有的/Encrypt字典保持不变
+type securityHandler struct {
+	// ref /Encrypt字典所在的对象，该对象中的字符串不加密；字典直接写在trailer中时为零值
+	ref      objectRef
+	revision int
+	key      []byte
+	strings  cryptMethod
+	streams  cryptMethod
+	// encryptMetadata 为false时XMP元数据流不加密
+	encryptMetadata bool
+}
+
+// newSecurityHandler 读取trailer中的/Encrypt字典并验证口令，口令可以是用户口令或所有者口令
+// 没有提供口令时先尝试空的用户口令，失败时返回 watermark.ErrPasswordRequired
+func newSecurityHandler(d *document, password string) (*securityHandler, error) {
+	h := &securityHandler{encryptMetadata: true}
+	value := d.trailerDict["/Encrypt"]
+	if ref, ok := parseRef(value); ok {
+		object, ok := d.object(ref)
+		if !ok {
+			return nil, errors.New("未找到PDF加密字典")
+		}
+		h.ref, value = ref, object.dict
+	}
+	entries, ok := parseDict(value)
+	if !ok {
+		return nil, errors.New("PDF加密字典无效")
+	}
+	if filter := string(entries["/Filter"]); filter != "/Standard" {
+		return nil, fmt.Errorf("不支持的PDF安全处理器 %s", filter)
+	}
+
+	version, _ := parseInt(entries["/V"])
+	h.revision, _ = parseInt(entries["/R"])
+	if bytes.Equal(entries["/EncryptMetadata"], []byte("false")) {
+		h.encryptMetadata = false
+	}
+	length := 40
+	if v, ok := parseInt(entries["/Length"]); ok {
+		length = v
+	}
+	switch version {
+	case 1, 2:
+		h.strings, h.streams = cryptRC4, cryptRC4
+	case 4, 5:
+		filters, _ := parseDict(d.resolve(entries["/CF"]))
+		h.strings = cryptFilterMethod(d, filters, entries["/StrF"])
+		h.streams = cryptFilterMethod(d, filters, entries["/StmF"])
+		if version == 4 {
+			length = 128
+		}
+	default:
+		return nil, fmt.Errorf("不支持的PDF加密版本 %d", version)
+	}
+
+	o, u := decodeString(entries["/O"]), decodeString(entries["/U"])
+	switch h.revision {
+	case 2, 3, 4:
+		if len(o) < 32 || len(u) < 32 || length < 40 || length > 128 || length%8 != 0 {
+			return nil, errors.New("PDF加密字典的/O、/U或/Length无效")
+		}
+		permissions, _ := parseInt(entries["/P"])
+		var id []byte
+		if items := arrayItems(d.trailerDict["/ID"]); len(items) > 0 {
+			id = decodeString(items[0])
+		}
+		n := length / 8
+		if h.revision == 2 {
+			n = 5
+		}
+		h.key = h.authenticate([]byte(password), o[:32], u[:32], uint32(permissions), id, n)
+	case 5, 6:
+		oe, ue := decodeString(entries["/OE"]), decodeString(entries["/UE"])
+		if len(o) < 48 || len(u) < 48 || len(oe) != 32 || len(ue) != 32 {
+			return nil, errors.New("PDF加密字典的/O、/U、/OE或/UE无效")
+		}
+		h.key = h.authenticateAES256([]byte(password), o[:48], u[:48], oe, ue)
+	default:
+		return nil, fmt.Errorf("不支持的PDF安全处理器版本 %d", h.revision)
+	}
+
+	if h.key == nil {
+		if password == "" {
+			return nil, watermark.ErrPasswordRequired
+		}
+		return nil, watermark.ErrInvalidPassword
+	}
+	return h, nil
+}
+
+// cryptFilterMethod 返回加密过滤器名称对应的算法，/Identity表示不加密
+func cryptFilterMethod(d *document, filters map[string][]byte, name []byte) cryptMethod {
+	if len(name) == 0 || bytes.Equal(name, []byte("/Identity")) {
+		return cryptIdentity
+	}
+	filter, _ := parseDict(d.resolve(filters[string(name)]))
+	switch string(filter["/CFM"]) {
+	case "/V2":
+		return cryptRC4
+	case "/AESV2":
+		return cryptAESV2
+	case "/AESV3":
+		return cryptAESV3
+	}
+	return cryptIdentity
+}
+
+// authenticate 使用修订版本2到4的算法验证口令，返回文件密钥，口令错误时返回nil
+// 先作为用户口令验证，再作为所有者口令解出用户口令后验证
+func (h *securityHandler) authenticate(password, o, u []byte, permissions uint32, id []byte, n int) []byte {
+	if key := h.userKey(password, o, u, permissions, id, n); key != nil {
+		return key
+	}
+
+	// 算法7：所有者口令的摘要作为RC4密钥解密/O，得到填充后的用户口令
+	sum := md5.Sum(padPassword(password))
+	if h.revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum = md5.Sum(sum[:])
+		}
+	}
+	user := append([]byte(nil), o...)
+	if h.revision == 2 {
+		user = rc4Crypt(sum[:n], user)
+	} else {
+		for i := 19; i >= 0; i-- {
+			user = rc4Crypt(xorKey(sum[:n], byte(i)), user)
+		}
+	}
+	return h.userKey(user, o, u, permissions, id, n)
+}
+
+// userKey 使用算法2计算文件密钥，并按算法4或5与/U比较，口令错误时返回nil
+func (h *securityHandler) userKey(password, o, u []byte, permissions uint32, id []byte, n int) []byte {
+	digest := md5.New()
+	digest.Write(padPassword(password))
+	digest.Write(o)
+	binary.Write(digest, binary.LittleEndian, permissions)
+	digest.Write(id)
+	if h.revision >= 4 && !h.encryptMetadata {
+		digest.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	key := digest.Sum(nil)
+	if h.revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:n])
+			key = sum[:]
+		}
+	}
+	key = key[:n]
+
+	if h.revision == 2 {
+		if !bytes.Equal(rc4Crypt(key, passwordPadding), u) {
+			return nil
+		}
+		return key
+	}
+	check := md5.Sum(append(append([]byte(nil), passwordPadding...), id...))
+	value := check[:]
+	for i := 0; i < 20; i++ {
+		value = rc4Crypt(xorKey(key, byte(i)), value)
+	}
+	if !bytes.Equal(value, u[:16]) {
+		return nil
+	}
+	return key
+}
+
+// authenticateAES256 使用修订版本5和6的算法验证口令，返回文件密钥，口令错误时返回nil
+// /U和/O的前32字节为摘要，之后8字节为验证盐、8字节为密钥盐；文件密钥用口令派生的密钥从/UE或/OE解出
+func (h *securityHandler) authenticateAES256(password, o, u, oe, ue []byte) []byte {
+	if len(password) > 127 {
+		password = password[:127]
+	}
+	var intermediate, encrypted []byte
+	switch {
+	case bytes.Equal(h.hashAES256(password, u[32:40], nil), u[:32]):
+		intermediate, encrypted = h.hashAES256(password, u[40:48], nil), ue
+	case bytes.Equal(h.hashAES256(password, o[32:40], u), o[:32]):
+		intermediate, encrypted = h.hashAES256(password, o[40:48], u), oe
+	default:
+		return nil
+	}
+
+	block, err := aes.NewCipher(intermediate)
+	if err != nil {
+		return nil
+	}
+	key := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, encrypted)
+	return key
+}
+
+// hashAES256 计算修订版本5的SHA-256摘要或修订版本6的算法2.B摘要
+func (h *securityHandler) hashAES256(password, salt, userKey []byte) []byte {
+	digest := sha256.New()
+	digest.Write(password)
+	digest.Write(salt)
+	digest.Write(userKey)
+	k := digest.Sum(nil)
+	if h.revision == 5 {
+		return k
+	}
+
+	for round := 0; ; round++ {
+		var block []byte
+		for i := 0; i < 64; i++ {
+			block = append(block, password...)
+			block = append(block, k...)
+			block = append(block, userKey...)
+		}
+		c, err := aes.NewCipher(k[:16])
+		if err != nil {
+			return nil
+		}
+		e := make([]byte, len(block))
+		cipher.NewCBCEncrypter(c, k[16:32]).CryptBlocks(e, block)
+
+		// 前16字节作为大整数除以3的余数等于各字节之和除以3的余数
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			return k[:32]
+		}
+	}
+}
+
+// objectKey 返回加密对象中字符串和流使用的密钥，见PDF规范算法1
+func (h *securityHandler) objectKey(ref objectRef, method cryptMethod) []byte {
+	if method == cryptAESV3 {
+		return h.key
+	}
+	digest := md5.New()
+	digest.Write(h.key)
+	digest.Write([]byte{byte(ref.num), byte(ref.num >> 8), byte(ref.num >> 16), byte(ref.gen), byte(ref.gen >> 8)})
+	if method == cryptAESV2 {
+		digest.Write([]byte("sAlT"))
+	}
+	return digest.Sum(nil)[:min(len(h.key)+5, 16)]
+}
+
+// decrypt 解密对象ref中的字符串或流数据
+func (h *securityHandler) decrypt(ref objectRef, method cryptMethod, data []byte) ([]byte, error) {
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(h.objectKey(ref, method), data), nil
+	case cryptAESV2, cryptAESV3:
+		if len(data) == 0 {
+			return data, nil
+		}
+		if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+			return nil, errors.New("AES加密的数据长度无效")
+		}
+		block, err := aes.NewCipher(h.objectKey(ref, method))
+		if err != nil {
+			return nil, err
+		}
+		plain := make([]byte, len(data)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+		padding := int(plain[len(plain)-1])
+		if padding < 1 || padding > aes.BlockSize {
+			return nil, errors.New("AES加密的数据填充无效")
+		}
+		return plain[:len(plain)-padding], nil
+	}
+	return data, nil
+}
+
+// encrypt 加密对象ref中的字符串或流数据，AES使用随机的初始向量和PKCS#5填充
+func (h *securityHandler) encrypt(ref objectRef, method cryptMethod, data []byte) []byte {
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(h.objectKey(ref, method), data)
+	case cryptAESV2, cryptAESV3:
+		block, err := aes.NewCipher(h.objectKey(ref, method))
+		if err != nil {
+			return data
+		}
+		padding := aes.BlockSize - len(data)%aes.BlockSize
+		plain := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		output := make([]byte, aes.BlockSize+len(plain))
+		rand.Read(output[:aes.BlockSize])
+		cipher.NewCBCEncrypter(block, output[:aes.BlockSize]).CryptBlocks(output[aes.BlockSize:], plain)
+		return output
+	}
+	return data
+}
+
+// streamMethod 返回流使用的算法，/EncryptMetadata为false时元数据流不加密，交叉引用流始终不加密
+func (h *securityHandler) streamMethod(dict []byte) cryptMethod {
+	entries, _ := parseDict(dict)
+	switch string(entries["/Type"]) {
+	case "/XRef":
+		return cryptIdentity
+	case "/Metadata":
+		if !h.encryptMetadata {
+			return cryptIdentity
+		}
+	}
+	return h.streams
+}
+
+// decryptObject 返回对象的明文：字典中的字符串和流数据都已解密，字符串写为字面字符串
+func (h *securityHandler) decryptObject(ref objectRef, object *pdfObject) (*pdfObject, error) {
+	if ref == h.ref {
+		return object, nil
+	}
+	dict, err := transformStrings(object.dict, func(s []byte) ([]byte, error) {
+		return h.decrypt(ref, h.strings, s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	plain := &pdfObject{dict: dict}
+	if object.stream != nil {
+		if plain.stream, err = h.decrypt(ref, h.streamMethod(object.dict), object.stream); err != nil {
+			return nil, err
+		}
+	}
+	return plain, nil
+}
+
+// encryptBody 加密增量更新中写入的对象：字典中的字符串和流数据，并更新流的/Length
+func (h *securityHandler) encryptBody(ref objectRef, body []byte) []byte {
+	end := objectEnd(body, 0)
+	if end < 0 {
+		return body
+	}
+	dict, _ := transformStrings(body[:end], func(s []byte) ([]byte, error) {
+		return h.encrypt(ref, h.strings, s), nil
+	})
+
+	start := bytes.Index(body[end:], []byte("stream\n"))
+	if start < 0 || !bytes.HasSuffix(body, []byte("\nendstream")) {
+		return dict
+	}
+	stream := body[end+start+len("stream\n") : len(body)-len("\nendstream")]
+	encrypted := h.encrypt(ref, h.streamMethod(dict), stream)
+	dict = setKey(dict, "/Length", fmt.Sprint(len(encrypted)))
+
+	var buffer bytes.Buffer
+	buffer.Write(dict)
+	buffer.WriteString("\nstream\n")
+	buffer.Write(encrypted)
+	buffer.WriteString("\nendstream")
+	return buffer.Bytes()
+}
+
+// transformStrings 对对象中的每个字面字符串和十六进制字符串的内容调用fn，结果写为字面字符串
+func transformStrings(data []byte, fn func([]byte) ([]byte, error)) ([]byte, error) {
+	var output bytes.Buffer
+	for pos := 0; pos < len(data); {
+		switch c := data[pos]; {
+		case c == '<' && pos+1 < len(data) && data[pos+1] == '<':
+			// 字典的开始，两个字符一起复制，避免第二个'<'被当作十六进制字符串
+			output.WriteString("<<")
+			pos += 2
+		case c == '(' || c == '<':
+			end := objectEnd(data, pos)
+			if end < 0 {
+				return nil, errors.New("PDF字符串不完整")
+			}
+			value, err := fn(decodeString(data[pos:end]))
+			if err != nil {
+				return nil, err
+			}
+			output.WriteString(literalString(value))
+			pos = end
+		default:
+			output.WriteByte(c)
+			pos++
+		}
+	}
+	return output.Bytes(), nil
+}
+
+// padPassword 将口令截断或填充为32字节
+func padPassword(password []byte) []byte {
+	padded := make([]byte, 32)
+	n := copy(padded, password)
+	copy(padded[n:], passwordPadding)
+	return padded
+}
+
+// xorKey 返回密钥每个字节与b异或的结果
+func xorKey(key []byte, b byte) []byte {
+	output := make([]byte, len(key))
+	for i, k := range key {
+		output[i] = k ^ b
+	}
+	return output
+}
+
+// rc4Crypt 使用RC4加密或解密数据
+func rc4Crypt(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	output := make([]byte, len(data))
+	c.XORKeyStream(output, data)
+	return output
+}
+
+// metadataPattern 匹配元数据流字典中的类型
+var metadataPattern = regexp.MustCompile(`/Type\s*/Metadata\b`)
+
+// removeEncrypted 覆盖已加密文件中其他增量更新之前的水印，保持所有对象的偏移不变
+// 文档信息字典中的水印条目直接用空格覆盖；可见水印表单和XMP元数据流解密后覆盖，再按原来的长度加密写回，
+// 表单字典中的标记同时被覆盖。没有这些水印或文件未加密时原样返回，需要解密时使用password
+func removeEncrypted(data []byte, password string) ([]byte, int, error) {
+	infos := infoKeyPattern.FindAllIndex(data, -1)
+	stamps := stampPattern.FindAllIndex(data, -1)
+	if len(infos) == 0 && len(stamps) == 0 {
+		return data, 0, nil
+	}
+	d, err := openDocument(data, password)
+	if errors.Is(err, watermark.ErrPasswordRequired) || errors.Is(err, watermark.ErrInvalidPassword) {
+		return nil, 0, err
+	}
+	if err != nil || d.security == nil {
+		return data, 0, nil
+	}
+
+	output := append([]byte(nil), data...)
+	count := 0
+	for _, m := range infos {
+		if end := objectEnd(data, m[1]-1); end > 0 {
+			copy(output[m[0]:end], bytes.Repeat([]byte(" "), end-m[0]))
+			count++
+		}
+	}
+	for _, m := range stamps {
+		count += d.rewriteStream(output, m[0], func(plain []byte) int {
+			copy(plain, bytes.Repeat([]byte(" "), len(plain)))
+			return 1
+		})
+		copy(output[m[0]:], bytes.Repeat([]byte(" "), len(stampMarker)))
+	}
+	for _, m := range metadataPattern.FindAllIndex(data, -1) {
+		count += d.rewriteStream(output, m[0], func(plain []byte) int {
+			ranges := xmp.Descriptions(plain)
+			for _, r := range ranges {
+				copy(plain[r[0]:r[1]], bytes.Repeat([]byte(" "), r[1]-r[0]))
+			}
+			return len(ranges)
+		})
+	}
+	return output, count, nil
+}
+
+// rewriteStream 解密字典中pos所在的流对象，fn修改明文后按相同的长度加密写回output，返回fn的结果
+// 压缩或不加密的流不修改，返回0
+func (d *document) rewriteStream(output []byte, pos int, fn func(plain []byte) int) int {
+	header := bytes.LastIndex(d.data[:pos], []byte("obj"))
+	if header < 0 {
+		return 0
+	}
+	ref, object, ok := d.objectAt(bytes.LastIndexAny(d.data[:header], "\r\n") + 1)
+	if !ok || object.stream == nil || object.offset < pos {
+		return 0
+	}
+	entries, _ := parseDict(object.dict)
+	method := d.security.streamMethod(object.dict)
+	if _, ok := entries["/Filter"]; ok || method == cryptIdentity {
+		return 0
+	}
+	plain, err := d.security.decrypt(ref, method, object.stream)
+	if err != nil {
+		return 0
+	}
+	n := fn(plain)
+	if encrypted := d.security.encrypt(ref, method, plain); n > 0 && len(encrypted) == len(object.stream) {
+		copy(output[object.offset:], encrypted)
+		return n
+	}
+	return 0
+}
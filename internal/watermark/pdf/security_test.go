@@ -0,0 +1,213 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// 修订版本3和4的加密字典，用户口令为user，所有者口令为owner，/P为-3904，由独立的实现计算
+const (
+	testDocumentID = "0123456789abcdef"
+	testOwnerHash  = "0ba3835f88f90388e74e54584125ce142be0de24c6b0d37746e075b891756671"
+	testUserHash   = "7443054f26f45bb262048d46fc50eef200000000000000000000000000000000"
+	testFileKey    = "d71270856c78b14074d3598548d46fdb"
+)
+
+// encryptedPDF 生成使用标准安全处理器加密的单页PDF文件，对象5为文档信息字典，对象6为加密字典
+// 修订版本3使用RC4，4使用AES-128，6使用AES-256
+func encryptedPDF(t *testing.T, revision int) []byte {
+	t.Helper()
+	h := &securityHandler{ref: objectRef{num: 6}, revision: revision, encryptMetadata: true}
+	var encrypt string
+	switch revision {
+	case 3:
+		h.key, _ = hex.DecodeString(testFileKey)
+		h.strings, h.streams = cryptRC4, cryptRC4
+		encrypt = fmt.Sprintf("<< /Filter /Standard /V 2 /R 3 /Length 128 /P -3904 /O <%s> /U <%s> >>", testOwnerHash, testUserHash)
+	case 4:
+		h.key, _ = hex.DecodeString(testFileKey)
+		h.strings, h.streams = cryptAESV2, cryptAESV2
+		encrypt = fmt.Sprintf("<< /Filter /Standard /V 4 /R 4 /Length 128 /P -3904 /CF << /StdCF << /CFM /AESV2 /AuthEvent /DocOpen /Length 16 >> >> /StmF /StdCF /StrF /StdCF /O <%s> /U <%s> >>", testOwnerHash, testUserHash)
+	case 6:
+		key := sha256.Sum256([]byte("file key"))
+		h.key = key[:]
+		h.strings, h.streams = cryptAESV3, cryptAESV3
+		u := append(h.hashAES256([]byte("user"), []byte("usersalt"), nil), "usersaltukeysalt"...)
+		o := append(h.hashAES256([]byte("owner"), []byte("ownrsalt"), u), "ownrsaltokeysalt"...)
+		ue := wrapKey(t, h.hashAES256([]byte("user"), []byte("ukeysalt"), nil), h.key)
+		oe := wrapKey(t, h.hashAES256([]byte("owner"), []byte("okeysalt"), u), h.key)
+		encrypt = fmt.Sprintf("<< /Filter /Standard /V 5 /R 6 /Length 256 /P -3904 /CF << /StdCF << /CFM /AESV3 /AuthEvent /DocOpen /Length 32 >> >> /StmF /StdCF /StrF /StdCF /O <%x> /U <%x> /OE <%x> /UE <%x> >>", o, u, oe, ue)
+	default:
+		t.Fatalf("不支持的修订版本 %d", revision)
+	}
+
+	content := "BT /F1 12 Tf (secret) Tj ET"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 600 800] /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		`<< /Title (Quarterly \(draft\)) >>`,
+	}
+	for i, object := range objects {
+		objects[i] = string(h.encryptBody(objectRef{num: i + 1}, []byte(object)))
+	}
+	data := buildPDF(append(objects, encrypt))
+	id := hex.EncodeToString([]byte(testDocumentID))
+	return bytes.Replace(data, []byte("/Root 1 0 R"), []byte(fmt.Sprintf("/Root 1 0 R /Info 5 0 R /Encrypt 6 0 R /ID [<%s> <%s>]", id, id)), 1)
+}
+
+// wrapKey 使用AES-256-CBC、全零初始向量且不填充加密文件密钥，生成/UE或/OE
+func wrapKey(t *testing.T, key, fileKey []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make([]byte, len(fileKey))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(output, fileKey)
+	return output
+}
+
+func TestHashAES256(t *testing.T) {
+	// 期望值由独立的实现按算法2.B计算
+	h := &securityHandler{revision: 6}
+	if got := hex.EncodeToString(h.hashAES256([]byte("user"), []byte("saltsalt"), nil)); got != "1beccb72cb28d43491db899cba6e2be838828ec0e51e0ae3f912aff2d75ad148" {
+		t.Errorf("用户口令的摘要为 %s", got)
+	}
+	u := make([]byte, 48)
+	for i := range u {
+		u[i] = byte(i)
+	}
+	if got := hex.EncodeToString(h.hashAES256([]byte("owner"), []byte("saltsalt"), u)); got != "94719cf805d1ad642d5e4b10a4f8dec244248f53b0d6d63470e246329b18f0b8" {
+		t.Errorf("所有者口令的摘要为 %s", got)
+	}
+}
+
+func TestOpenEncrypted(t *testing.T) {
+	for _, revision := range []int{3, 4, 6} {
+		t.Run(fmt.Sprintf("R%d", revision), func(t *testing.T) {
+			data := encryptedPDF(t, revision)
+			if bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("Quarterly")) {
+				t.Fatal("测试文件中的字符串和流应当被加密")
+			}
+			if _, err := openDocument(data, ""); !errors.Is(err, watermark.ErrPasswordRequired) {
+				t.Errorf("期望返回 ErrPasswordRequired，实际为: %v", err)
+			}
+			if _, err := openDocument(data, "wrong"); !errors.Is(err, watermark.ErrInvalidPassword) {
+				t.Errorf("期望返回 ErrInvalidPassword，实际为: %v", err)
+			}
+
+			var key []byte
+			for _, password := range []string{"user", "owner"} {
+				d, err := openDocument(data, password)
+				if err != nil {
+					t.Fatalf("使用口令 %s 打开失败: %v", password, err)
+				}
+				if key == nil {
+					key = d.security.key
+				} else if !bytes.Equal(key, d.security.key) {
+					t.Errorf("用户口令和所有者口令得到的文件密钥不同")
+				}
+				if info, ok := d.object(objectRef{num: 5}); !ok || !bytes.Contains(info.dict, []byte(`(Quarterly \(draft\))`)) {
+					t.Errorf("文档信息字典为 %v", info)
+				}
+				pages, err := d.pages()
+				if err != nil || len(pages) != 1 || string(d.pageText(pages[0])) != "secret" {
+					t.Errorf("页面为 %v, %v", pages, err)
+				}
+			}
+			if revision != 6 && hex.EncodeToString(key) != testFileKey {
+				t.Errorf("文件密钥为 %x", key)
+			}
+		})
+	}
+}
+
+func TestPDFEncrypted(t *testing.T) {
+	w := &PDFWatermarker{}
+	opts := overlay.DefaultOptions()
+	opts.Text = "Draft"
+	for _, revision := range []int{3, 4, 6} {
+		t.Run(fmt.Sprintf("R%d", revision), func(t *testing.T) {
+			data := encryptedPDF(t, revision)
+			ctx := context.Background()
+			payload := watermark.NewPayload("加密文档")
+			payload.Overlay = &opts
+			err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &bytes.Buffer{}, payload)
+			if !errors.Is(err, watermark.ErrPasswordRequired) {
+				t.Fatalf("期望返回 ErrPasswordRequired，实际为: %v", err)
+			}
+
+			var marked bytes.Buffer
+			if err := w.WithPassword("user").AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, payload); err != nil {
+				t.Fatalf("添加水印失败: %v", err)
+			}
+			output := marked.Bytes()
+			tail := string(output[len(data):])
+			if !bytes.HasPrefix(output, data) || !strings.Contains(tail, "/Encrypt 6 0 R /ID [") {
+				t.Fatalf("增量更新没有沿用原来的安全处理器:\n%s", tail)
+			}
+			if findInfoEnvelopes(output) != nil || strings.Contains(tail, "Quarterly") || strings.Contains(tail, "Draft") {
+				t.Error("追加的对象没有加密")
+			}
+
+			if _, err := w.ExtractWatermarkStream(context.Background(), bytes.NewReader(output), int64(len(output))); !errors.Is(err, watermark.ErrPasswordRequired) {
+				t.Errorf("期望返回 ErrPasswordRequired，实际为: %v", err)
+			}
+			owner := w.WithPassword("owner")
+			payload, err = owner.ExtractWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)))
+			if err != nil || payload.Text != "加密文档" {
+				t.Fatalf("提取水印结果为 %v, %v", payload, err)
+			}
+
+			// 追加的文档信息字典保留原来的条目，可见水印表单解密后可以读取
+			d, err := openDocument(output, "owner")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info, ok := d.object(objectRef{num: 8}); !ok || !bytes.Contains(info.dict, []byte("Quarterly")) {
+				t.Errorf("文档信息字典为 %v", info)
+			}
+			pages, _ := d.pages()
+			if text := string(d.pageText(pages[0])); !strings.HasPrefix(text, "secretDraft") {
+				t.Errorf("页面文字为 %q", text)
+			}
+
+			var stripped bytes.Buffer
+			if err := w.RemoveWatermarkStream(context.Background(), bytes.NewReader(output), int64(len(output)), &stripped); err != nil || !bytes.Equal(stripped.Bytes(), data) {
+				t.Errorf("移除水印后的文件与原文件不一致: %v", err)
+			}
+
+			// 之后有其他增量更新时需要密码，解密后覆盖水印，文件长度不变
+			later := append(append([]byte(nil), output...), "\n% signature\nstartxref\n0\n%%EOF\n"...)
+			if err := w.RemoveWatermarkStream(context.Background(), bytes.NewReader(later), int64(len(later)), &bytes.Buffer{}); !errors.Is(err, watermark.ErrPasswordRequired) {
+				t.Errorf("期望返回 ErrPasswordRequired，实际为: %v", err)
+			}
+			stripped.Reset()
+			if err := owner.RemoveWatermarkStream(ctx, bytes.NewReader(later), int64(len(later)), &stripped); err != nil || stripped.Len() != len(later) {
+				t.Fatalf("移除水印失败: %v", err)
+			}
+			if _, err := owner.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+				t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+			}
+			if d, err = openDocument(stripped.Bytes(), "user"); err != nil {
+				t.Fatal(err)
+			}
+			pages, _ = d.pages()
+			if text := string(d.pageText(pages[0])); text != "secret" {
+				t.Errorf("移除后的页面文字为 %q", text)
+			}
+		})
+	}
+}
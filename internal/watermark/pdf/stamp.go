@@ -0,0 +1,394 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// 可见水印写入的对象中使用的名称
+const (
+	stampName   = "/WatermarkStamp"       // 页面资源中表单XObject的名称
+	stampFont   = "/WmtF0"                // 表单资源中字体的名称
+	stampGState = "/WmtGS0"               // 表单资源中图形状态的名称
+	stampMarker = "/WatermarkTool /Stamp" // 表单XObject字典中的标记，移除和定位时使用
+)
+
+// maxPageDepth 页面树的最大深度
+const maxPageDepth = 32
+
+// stampPattern 匹配可见水印表单XObject的流数据的开头，表单的字典中没有嵌套的字典
+var stampPattern = regexp.MustCompile(stampMarker + `[^>]*>>\s*stream\r?\n`)
+
+// defaultMediaBox 页面没有MediaBox时使用的Letter尺寸
+var defaultMediaBox = [4]float64{0, 0, 612, 792}
+
+// page 页面树中的一个页面，继承的属性已经合并
+type page struct {
+	ref  objectRef
+	dict []byte
+	// box 可见区域，有CropBox时为CropBox与MediaBox的交集
+	box [4]float64
+	// rotate 显示时顺时针旋转的角度，为0、90、180或270
+	rotate int
+	// resources 页面使用的资源字典
+	resources []byte
+}
+
+// resolve 返回值本身，值为间接引用时返回引用的对象
+func (d *document) resolve(value []byte) []byte {
+	if ref, ok := parseRef(value); ok {
+		if object, ok := d.object(ref); ok {
+			return object.dict
+		}
+		return nil
+	}
+	return value
+}
+
+// pages 按顺序返回文档中的所有页面
+func (d *document) pages() ([]page, error) {
+	catalog, ok := d.object(d.root)
+	if !ok {
+		return nil, errors.New("未找到PDF文档目录")
+	}
+	entries, _ := parseDict(catalog.dict)
+	root, ok := parseRef(entries["/Pages"])
+	if !ok {
+		return nil, errors.New("PDF文档目录缺少页面树")
+	}
+
+	var pages []page
+	visited := make(map[int]bool)
+	inherited := map[string][]byte{}
+	if err := d.walkPages(root, inherited, visited, 0, &pages); err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("PDF文件没有页面")
+	}
+	return pages, nil
+}
+
+// walkPages 遍历页面树节点，MediaBox、CropBox、Rotate和Resources可以从上级节点继承
+func (d *document) walkPages(ref objectRef, inherited map[string][]byte, visited map[int]bool, depth int, pages *[]page) error {
+	if visited[ref.num] || depth > maxPageDepth {
+		return errors.New("PDF页面树存在循环引用")
+	}
+	visited[ref.num] = true
+
+	object, ok := d.object(ref)
+	if !ok {
+		return fmt.Errorf("未找到页面树节点 %s", ref)
+	}
+	entries, ok := parseDict(object.dict)
+	if !ok {
+		return fmt.Errorf("页面树节点 %s 无效", ref)
+	}
+	attributes := make(map[string][]byte, len(inherited))
+	for key, value := range inherited {
+		attributes[key] = value
+	}
+	for _, key := range []string{"/MediaBox", "/CropBox", "/Rotate", "/Resources"} {
+		if value, ok := entries[key]; ok {
+			attributes[key] = d.resolve(value)
+		}
+	}
+
+	if kids, ok := entries["/Kids"]; ok && !bytes.Equal(entries["/Type"], []byte("/Page")) {
+		for _, kid := range arrayItems(d.resolve(kids)) {
+			kidRef, ok := parseRef(kid)
+			if !ok {
+				return fmt.Errorf("页面树节点 %s 的/Kids无效", ref)
+			}
+			if err := d.walkPages(kidRef, attributes, visited, depth+1, pages); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	p := page{ref: ref, dict: object.dict, box: defaultMediaBox, resources: attributes["/Resources"]}
+	if box, ok := parseBox(attributes["/MediaBox"]); ok {
+		p.box = box
+	}
+	if crop, ok := parseBox(attributes["/CropBox"]); ok {
+		p.box = [4]float64{
+			math.Max(p.box[0], crop[0]), math.Max(p.box[1], crop[1]),
+			math.Min(p.box[2], crop[2]), math.Min(p.box[3], crop[3]),
+		}
+		if p.box[0] >= p.box[2] || p.box[1] >= p.box[3] {
+			p.box, _ = parseBox(attributes["/MediaBox"])
+		}
+	}
+	if rotate, ok := parseInt(attributes["/Rotate"]); ok && rotate%90 == 0 {
+		p.rotate = (rotate%360 + 360) % 360
+	}
+	*pages = append(*pages, p)
+	return nil
+}
+
+// parseBox 解析[llx lly urx ury]形式的矩形，返回左下角和右上角
+func parseBox(value []byte) ([4]float64, bool) {
+	items := arrayItems(value)
+	if len(items) != 4 || !bytes.HasPrefix(value, []byte("[")) {
+		return [4]float64{}, false
+	}
+	var box [4]float64
+	for i, item := range items {
+		v, err := strconv.ParseFloat(string(item), 64)
+		if err != nil {
+			return [4]float64{}, false
+		}
+		box[i] = v
+	}
+	box = [4]float64{math.Min(box[0], box[2]), math.Min(box[1], box[3]), math.Max(box[0], box[2]), math.Max(box[1], box[3])}
+	if box[2]-box[0] <= 0 || box[3]-box[1] <= 0 {
+		return [4]float64{}, false
+	}
+	return box, true
+}
+
+// pageMark 绘制在每一页上的水印
+type pageMark struct {
+	// stamp 可见水印参数，为nil时不绘制可见水印
+	stamp *overlay.Options
+	// hidden 以不可见文字写入的内容，为空时不写入文字层
+	hidden string
+}
+
+// empty 判断是否不需要在页面上绘制任何内容
+func (m pageMark) empty() bool {
+	return m.stamp == nil && m.hidden == ""
+}
+
+// stampObjects 返回在每一页上绘制水印的增量更新对象，对象号从next开始分配
+// 水印绘制在带有独立资源的表单XObject中，页面内容流前后各加一个流：前面保存图形状态，
+// 后面恢复图形状态后绘制表单，原有内容对图形状态的修改不会影响水印。
+// 可见区域和旋转角度相同的页面共用一个表单
+func stampObjects(d *document, mark pageMark, next int) ([]updateObject, error) {
+	var text []byte
+	var advance int
+	if opts := mark.stamp; opts != nil {
+		if opts.Logo != nil {
+			return nil, fmt.Errorf("%w: PDF不支持标志图片", overlay.ErrInvalidOptions)
+		}
+		if err := opts.ValidateVector(); err != nil {
+			return nil, err
+		}
+		var err error
+		if text, advance, err = encodeText(opts.Text); err != nil {
+			return nil, fmt.Errorf("%w: %v", overlay.ErrUnsupportedText, err)
+		}
+	}
+
+	pages, err := d.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	allocate := func() objectRef {
+		next++
+		return objectRef{num: next - 1}
+	}
+	opacity := 1.0
+	if mark.stamp != nil {
+		opacity = mark.stamp.Opacity
+	}
+	font, gstate, resources, open, closing := allocate(), allocate(), allocate(), allocate(), allocate()
+	objects := []updateObject{
+		{ref: font, body: []byte(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", fontName))},
+		{ref: gstate, body: []byte(fmt.Sprintf("<< /Type /ExtGState /ca %s /CA %s >>", number(opacity), number(opacity)))},
+		{ref: resources, body: []byte(fmt.Sprintf("<< /Font << %s %s >> /ExtGState << %s %s >> >>", stampFont, font, stampGState, gstate))},
+		{ref: open, body: streamBody("q\n")},
+		{ref: closing, body: streamBody("Q\nq " + stampName + " Do Q\n")},
+	}
+
+	forms := make(map[string]objectRef)
+	for _, p := range pages {
+		key := fmt.Sprint(p.box, p.rotate)
+		form, ok := forms[key]
+		if !ok {
+			form = allocate()
+			forms[key] = form
+			content := formContent(p, mark, text, advance)
+			objects = append(objects, updateObject{ref: form, body: []byte(fmt.Sprintf(
+				"<< /Type /XObject /Subtype /Form %s /BBox [%s %s %s %s] /Resources %s /Length %d >>\nstream\n%s\nendstream",
+				stampMarker, number(p.box[0]), number(p.box[1]), number(p.box[2]), number(p.box[3]), resources, len(content), content))})
+		}
+
+		objects = append(objects, updateObject{ref: p.ref, body: d.stampPage(p, form, open, closing)})
+	}
+	return objects, nil
+}
+
+// stampPage 返回页面字典的副本：内容流前后加上保存和绘制水印的流，资源中加入水印表单
+func (d *document) stampPage(p page, form, open, closing objectRef) []byte {
+	entries, _ := parseDict(p.dict)
+	contents := []string{open.String()}
+	if value, ok := entries["/Contents"]; ok {
+		if resolved := d.resolve(value); bytes.HasPrefix(resolved, []byte("[")) {
+			for _, item := range arrayItems(resolved) {
+				contents = append(contents, string(item))
+			}
+		} else if _, isRef := parseRef(value); isRef {
+			contents = append(contents, string(value))
+		}
+	}
+	contents = append(contents, closing.String())
+
+	resources := p.resources
+	if !bytes.HasPrefix(resources, []byte("<<")) {
+		resources = []byte("<< >>")
+	}
+	resourceEntries, _ := parseDict(resources)
+	xobjects := d.resolve(resourceEntries["/XObject"])
+	if !bytes.HasPrefix(xobjects, []byte("<<")) {
+		xobjects = []byte("<< >>")
+	}
+	xobjects = setKey(xobjects, stampName, form.String())
+	resources = setKey(resources, "/XObject", string(xobjects))
+
+	dict := setKey(p.dict, "/Contents", "["+strings.Join(contents, " ")+"]")
+	return setKey(dict, "/Resources", string(resources))
+}
+
+// formContent 生成表单的内容流
+// 先把坐标系变换为页面显示时的方向，原点在可见区域左下角，再绘制可见水印和不可见的文字层
+func formContent(p page, mark pageMark, text []byte, advance int) string {
+	matrix, width, height := displayMatrix(p)
+	var content strings.Builder
+	fmt.Fprintf(&content, "q %s cm\n", numbers(matrix[:]))
+	if mark.stamp != nil {
+		content.WriteString(stampContent(*mark.stamp, width, height, text, advance))
+		content.WriteByte('\n')
+	}
+	if mark.hidden != "" {
+		content.WriteString(hiddenContent(mark.hidden))
+		content.WriteByte('\n')
+	}
+	content.WriteString("Q")
+	return content.String()
+}
+
+// displayMatrix 返回页面显示时的坐标系到用户空间的变换，以及显示时可见区域的宽和高
+func displayMatrix(p page) ([6]float64, float64, float64) {
+	width, height := p.box[2]-p.box[0], p.box[3]-p.box[1]
+	var matrix [6]float64
+	switch p.rotate {
+	case 90:
+		width, height = height, width
+		matrix = [6]float64{0, 1, -1, 0, p.box[2], p.box[1]}
+	case 180:
+		matrix = [6]float64{-1, 0, 0, -1, p.box[2], p.box[3]}
+	case 270:
+		width, height = height, width
+		matrix = [6]float64{0, -1, 1, 0, p.box[0], p.box[3]}
+	default:
+		matrix = [6]float64{1, 0, 0, 1, p.box[0], p.box[1]}
+	}
+	return matrix, width, height
+}
+
+// stampContent 在width×height的区域中按排列方式绘制可见水印
+func stampContent(opts overlay.Options, width, height float64, text []byte, advance int) string {
+	fontSize := opts.TextSize(width, height, float64(advance)/fontUnitsPerEm)
+	textWidth := float64(advance) * fontSize / fontUnitsPerEm
+	textHeight := float64(fontAscent-fontDescent) * fontSize / fontUnitsPerEm
+	// 基线相对于文字中心的位置
+	baseline := textHeight/2 - float64(fontAscent)*fontSize/fontUnitsPerEm
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "q %s gs\n", stampGState)
+	fmt.Fprintf(&content, "%s %s %s rg\n", number(float64(opts.Color.R)/0xFF), number(float64(opts.Color.G)/0xFF), number(float64(opts.Color.B)/0xFF))
+	fmt.Fprintf(&content, "BT %s %s Tf\n", stampFont, number(fontSize))
+	for _, placement := range opts.Placements(width, height, fontSize, textWidth, textHeight) {
+		// 放置位置的y轴向下、角度顺时针为正，PDF的y轴向上、角度逆时针为正
+		sin, cos := math.Sincos(-placement.Angle * math.Pi / 180)
+		x, y := -textWidth/2, baseline
+		tm := []float64{cos, sin, -sin, cos, x*cos - y*sin + placement.X, x*sin + y*cos + height - placement.Y}
+		fmt.Fprintf(&content, "%s Tm %s Tj\n", numbers(tm), literalString(text))
+	}
+	content.WriteString("ET Q")
+	return content.String()
+}
+
+// streamBody 返回不压缩的流对象
+func streamBody(data string) []byte {
+	return []byte(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(data), data))
+}
+
+// literalString 返回PDF字面字符串，转义括号和反斜杠
+// 回车也需要转义，否则读取时会被当作换行，加密后的二进制字符串因此损坏
+func literalString(data []byte) string {
+	var buffer bytes.Buffer
+	buffer.WriteByte('(')
+	for _, b := range data {
+		if b == '\r' {
+			buffer.WriteString(`\r`)
+			continue
+		}
+		if b == '(' || b == ')' || b == '\\' {
+			buffer.WriteByte('\\')
+		}
+		buffer.WriteByte(b)
+	}
+	buffer.WriteByte(')')
+	return buffer.String()
+}
+
+// number 返回最多保留4位小数的数字
+func number(v float64) string {
+	v = math.Round(v*1e4) / 1e4
+	if v == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// numbers 返回以空格分隔的数字
+func numbers(values []float64) string {
+	var buffer bytes.Buffer
+	for i, v := range values {
+		if i > 0 {
+			buffer.WriteByte(' ')
+		}
+		buffer.WriteString(number(v))
+	}
+	return buffer.String()
+}
+
+// findStamps 返回文件中内容不为空的可见水印表单的流数据范围
+func findStamps(data []byte) [][2]int {
+	var ranges [][2]int
+	for _, m := range stampPattern.FindAllIndex(data, -1) {
+		end := bytes.Index(data[m[1]:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		if content := data[m[1] : m[1]+end]; len(bytes.TrimSpace(content)) > 0 {
+			ranges = append(ranges, [2]int{m[1], m[1] + end})
+		}
+	}
+	return ranges
+}
+
+// removeStamps 用空格覆盖可见水印表单的内容，保持之后的对象偏移不变，页面中的表单变为空白
+func removeStamps(data []byte) ([]byte, int) {
+	ranges := findStamps(data)
+	if len(ranges) == 0 {
+		return data, 0
+	}
+
+	output := append([]byte(nil), data...)
+	for _, r := range ranges {
+		copy(output[r[0]:r[1]], bytes.Repeat([]byte(" "), r[1]-r[0]))
+	}
+	return output, len(ranges)
+}
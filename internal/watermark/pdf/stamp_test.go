@@ -0,0 +1,151 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// pagesPDF 生成有两页的PDF文件：MediaBox和Resources从页面树继承，
+// 第二页旋转90度、带有CropBox，内容流为数组
+func pagesPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 600 800] /Resources << /XObject 7 0 R >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Rotate 90 /CropBox [50 100 550 700] /Contents [5 0 R 6 0 R] >>",
+		"<< /Length 0 >>\nstream\n\nendstream",
+		"<< /Length 0 >>\nstream\n\nendstream",
+		"<< /Im0 5 0 R >>",
+	}
+	return buildPDF(objects)
+}
+
+// buildPDF 依次写入对象1到len(objects)，生成使用经典交叉引用表的PDF文件，对象1为文档目录
+func buildPDF(objects []string) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xrefOffset := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+	return buffer.Bytes()
+}
+
+func TestPDFStamp(t *testing.T) {
+	w := &PDFWatermarker{}
+	data := pagesPDF()
+
+	opts := overlay.DefaultOptions()
+	opts.Text = "CONFIDENTIAL (draft)"
+	opts.Layout = overlay.LayoutDiagonal
+	ctx := context.Background()
+	payload := watermark.NewPayload("内部资料")
+	payload.Overlay = &opts
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, payload); err != nil {
+		t.Fatalf("添加可见水印失败: %v", err)
+	}
+	output := marked.Bytes()
+	if !bytes.HasPrefix(output, data) {
+		t.Fatal("原文件的字节被修改")
+	}
+
+	d, err := openDocument(output, "")
+	if err != nil {
+		t.Fatalf("解析添加水印后的文件失败: %v", err)
+	}
+	pages, err := d.pages()
+	if err != nil || len(pages) != 2 {
+		t.Fatalf("页面为 %v, %v", pages, err)
+	}
+	for i, want := range []string{"/Contents [13 0 R 5 0 R 14 0 R]", "/Contents [13 0 R 5 0 R 6 0 R 14 0 R]"} {
+		p := pages[i]
+		if !bytes.Contains(p.dict, []byte(want)) {
+			t.Errorf("第%d页的内容流为 %s", i+1, p.dict)
+		}
+		// 继承的资源复制到页面中，原有的XObject保留
+		if !bytes.Contains(p.dict, []byte("/Im0 5 0 R "+stampName)) {
+			t.Errorf("第%d页的资源为 %s", i+1, p.resources)
+		}
+	}
+	if pages[1].box != [4]float64{50, 100, 550, 700} || pages[1].rotate != 90 {
+		t.Errorf("第二页的可见区域为 %v，旋转 %d", pages[1].box, pages[1].rotate)
+	}
+
+	// 可见区域不同的两页各使用一个表单，旋转的页面先变换到显示方向
+	forms := findStamps(output)
+	if len(forms) != 2 {
+		t.Fatalf("可见水印表单有 %d 个", len(forms))
+	}
+	second := string(output[forms[1][0]:forms[1][1]])
+	if !strings.Contains(second, "0 1 -1 0 550 100 cm") || !strings.Contains(second, `(CONFIDENTIAL \(draft\)) Tj`) {
+		t.Errorf("第二页的表单内容为 %s", second)
+	}
+	if !bytes.Contains(output, []byte("/BaseFont /Helvetica")) || !bytes.Contains(output, []byte("/ca 0.3 /CA 0.3")) {
+		t.Error("未写入字体或透明度")
+	}
+
+	locations, err := w.LocateWatermarks(ctx, bytes.NewReader(output), int64(len(output)))
+	if err != nil || len(locations) != 4 || !strings.HasPrefix(locations[2], "stamp@") {
+		t.Errorf("水印位置为 %v, %v", locations, err)
+	}
+	payload, err = w.ExtractWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)))
+	if err != nil || payload.Text != "内部资料" {
+		t.Fatalf("提取水印结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)), &stripped); err != nil || !bytes.Equal(stripped.Bytes(), data) {
+		t.Errorf("移除水印后的文件与原文件不一致: %v", err)
+	}
+
+	// 之后有其他增量更新时用空格覆盖表单内容
+	later := append(append([]byte(nil), output...), "\n% signature\nstartxref\n0\n%%EOF\n"...)
+	stripped.Reset()
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(later), int64(len(later)), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if stripped.Len() != len(later) || findStamps(stripped.Bytes()) != nil {
+		t.Error("可见水印表单的内容没有被覆盖")
+	}
+}
+
+func TestPDFStampOptions(t *testing.T) {
+	w := &PDFWatermarker{}
+	data := pagesPDF()
+
+	opts := overlay.DefaultOptions()
+	opts.Text = "机密"
+	payload := watermark.NewPayload("x")
+	payload.Overlay = &opts
+	err := w.AddWatermarkStream(context.Background(), bytes.NewReader(data), int64(len(data)), &bytes.Buffer{}, payload)
+	if !errors.Is(err, overlay.ErrUnsupportedText) {
+		t.Errorf("期望返回 ErrUnsupportedText，实际为: %v", err)
+	}
+
+	// 页眉页脚水平绘制，旋转角度不影响文字方向
+	for _, layout := range []overlay.Layout{overlay.LayoutHeader, overlay.LayoutFooter} {
+		opts.Text = "Draft"
+		opts.Layout = layout
+		opts.Angle = 30
+		content := stampContent(opts, 600, 800, []byte("Draft"), 2168)
+		if strings.Count(content, " Tm ") != 1 || !strings.Contains(content, "1 0 0 1 ") {
+			t.Errorf("%s 的内容为 %s", layout, content)
+		}
+	}
+}
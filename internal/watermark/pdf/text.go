@@ -0,0 +1,406 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"watermark-tool/internal/watermark"
+)
+
+// textPriority 文字层水印的优先级，低于元数据水印，需要时通过嵌入方式"text"指定
+const textPriority = -10
+
+func init() {
+	watermark.RegisterStrategy(watermark.Strategy{Method: "text", Priority: textPriority, Watermarker: &TextWatermarker{}})
+}
+
+// 不可见文字层的参数
+// 信封以字号为1的文字按行写在可见区域左下角，文字渲染模式为3（不填充也不描边），阅读器不显示，
+// 但复制文字、提取页面、合并文件和重新打印为PDF时作为页面上的文字保留
+const (
+	hiddenPrefix   = "WATERMARK:"
+	hiddenSuffix   = ":WATERMARK"
+	hiddenLine     = 64  // 每行的字符数
+	hiddenLeading  = 1.2 // 行距
+	maxFormDepth   = 16  // 读取文字时表单XObject的最大嵌套深度
+	hiddenFontSize = 1
+)
+
+// hiddenPattern 匹配页面文字中的信封，文字已去掉空白
+var hiddenPattern = regexp.MustCompile(hiddenPrefix + `([A-Za-z0-9+/=]+)` + hiddenSuffix)
+
+// TextWatermarker 在每一页上写入不可见的文字层，同时写入文档信息字典和XMP元数据流
+// 元数据被清理工具删除、页面被提取或合并到其他文件、文件被重新打印为PDF后，仍可以从页面文字中提取水印
+type TextWatermarker struct {
+	// password 打开加密文档的用户密码或所有者密码，见 WithPassword
+	password string
+}
+
+// GetSupportedType 返回支持的文件类型
+func (t *TextWatermarker) GetSupportedType() string {
+	return "pdf"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (t *TextWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "在每一页上写入不可见的文字，页面被提取、合并或重新打印后仍可提取", Locate: true, Lossless: true, Robust: true, Visible: true}
+}
+
+// AddWatermarkStream 以增量更新写入文档信息字典、XMP元数据流和每一页上的不可见文字层
+func (t *TextWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	return addWatermark(ctx, src, size, dst, payload, t.password, true)
+}
+
+// WithPassword 返回使用password打开加密文档的处理器
+func (t *TextWatermarker) WithPassword(password string) watermark.StreamWatermarker {
+	return &TextWatermarker{password: password}
+}
+
+// ExtractWatermarkStream 从页面内容流的文字中提取水印
+func (t *TextWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF文件失败: %w", err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, errors.New("不是有效的PDF文件")
+	}
+
+	d, err := openEncrypted(data, t.password)
+	if err != nil {
+		return nil, err
+	}
+	return extractFromPages(ctx, d)
+}
+
+// RemoveWatermarkStream 移除水印，文字层与可见水印在同一个表单中，随增量更新一起删除或被空格覆盖
+// 重新打印后成为页面内容一部分的文字层无法移除
+func (t *TextWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	return (&PDFWatermarker{password: t.password}).RemoveWatermarkStream(ctx, src, size, dst)
+}
+
+// LocateWatermarks 返回页面文字中包含水印信封的页码
+func (t *TextWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF文件失败: %w", err)
+	}
+	d, err := openEncrypted(data, t.password)
+	if errors.Is(err, watermark.ErrNoWatermark) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pages, err := d.pages()
+	if err != nil {
+		return nil, nil
+	}
+
+	var locations []string
+	for i, p := range pages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if hiddenPattern.Match(d.pageText(p)) {
+			locations = append(locations, fmt.Sprintf("page@%d", i+1))
+		}
+	}
+	return locations, nil
+}
+
+// hiddenContent 返回写入不可见文字层的内容流片段
+func hiddenContent(armored string) string {
+	text := hiddenPrefix + armored + hiddenSuffix
+	var lines []string
+	for len(text) > hiddenLine {
+		lines = append(lines, text[:hiddenLine])
+		text = text[hiddenLine:]
+	}
+	lines = append(lines, text)
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "BT 3 Tr %s %d Tf %s TL 1 %s Td\n", stampFont, hiddenFontSize, number(hiddenLeading), number(float64(len(lines))*hiddenLeading))
+	for i, line := range lines {
+		// 第一行之后使用'操作符，先换行再绘制
+		operator := "'"
+		if i == 0 {
+			operator = "Tj"
+		}
+		fmt.Fprintf(&content, "%s %s\n", literalString([]byte(line)), operator)
+	}
+	content.WriteString("ET")
+	return content.String()
+}
+
+// extractFromPages 依次读取每一页的文字，返回第一个能够打开的水印信封
+func extractFromPages(ctx context.Context, d *document) (*watermark.Payload, error) {
+	pages, err := d.pages()
+	if err != nil {
+		return nil, watermark.ErrNoWatermark
+	}
+
+	lastErr := watermark.ErrNoWatermark
+	for _, p := range pages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, m := range hiddenPattern.FindAllSubmatch(d.pageText(p), -1) {
+			payload, err := watermark.OpenPayload(string(m[1]))
+			if err == nil {
+				return payload, nil
+			}
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// pageText 返回页面内容流和其中绘制的表单XObject中显示的所有文字，去掉空白后按绘制顺序连接
+// 只处理单字节编码的字符串，使用复合字体或自定义编码的文字不能还原为原来的字符
+func (d *document) pageText(p page) []byte {
+	var content []byte
+	for _, stream := range d.contentStreams(p.dict) {
+		content = append(content, stream...)
+		content = append(content, '\n')
+	}
+
+	collector := &textCollector{d: d, visited: make(map[int]bool)}
+	collector.collect(content, p.resources, 0)
+	return collector.text.Bytes()
+}
+
+// contentStreams 返回页面的所有内容流解码后的数据，无法解码的流被忽略
+func (d *document) contentStreams(dict []byte) [][]byte {
+	entries, _ := parseDict(dict)
+	value := entries["/Contents"]
+	var refs [][]byte
+	if ref, ok := parseRef(value); ok {
+		object, ok := d.object(ref)
+		if !ok {
+			return nil
+		}
+		if object.stream != nil {
+			refs = [][]byte{value}
+		} else {
+			refs = arrayItems(object.dict)
+		}
+	} else {
+		refs = arrayItems(value)
+	}
+
+	var streams [][]byte
+	for _, item := range refs {
+		ref, ok := parseRef(item)
+		if !ok {
+			continue
+		}
+		object, ok := d.object(ref)
+		if !ok || object.stream == nil {
+			continue
+		}
+		if data, err := decodeStream(object); err == nil {
+			streams = append(streams, data)
+		}
+	}
+	return streams
+}
+
+// textCollector 收集内容流中显示的文字
+type textCollector struct {
+	d *document
+	// visited 已经读取过的表单XObject，多次绘制的表单只读取一次
+	visited map[int]bool
+	text    bytes.Buffer
+}
+
+// collect 读取内容流中Tj、TJ、'和"操作符显示的字符串，遇到Do操作符时读取绘制的表单
+func (c *textCollector) collect(content, resources []byte, depth int) {
+	var operands [][]byte
+	for pos := skipSpace(content, 0); pos < len(content); pos = skipSpace(content, pos) {
+		end := objectEnd(content, pos)
+		if end <= pos {
+			// 内容流中不应出现的字符，跳过后继续
+			pos++
+			operands = operands[:0]
+			continue
+		}
+		token := content[pos:end]
+		pos = end
+		if isOperand(token) {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch string(token) {
+		case "Tj", "'", `"`:
+			if len(operands) > 0 {
+				c.appendString(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				for _, item := range arrayItems(operands[len(operands)-1]) {
+					c.appendString(item)
+				}
+			}
+		case "Do":
+			if len(operands) > 0 && depth < maxFormDepth {
+				c.collectForm(operands[len(operands)-1], resources, depth)
+			}
+		case "ID":
+			// 内嵌图像的数据是二进制的，跳到EI操作符之后
+			pos = inlineImageEnd(content, pos)
+		}
+		operands = operands[:0]
+	}
+}
+
+// collectForm 读取资源中名为name的表单XObject中的文字
+func (c *textCollector) collectForm(name, resources []byte, depth int) {
+	entries, _ := parseDict(c.d.resolve(resources))
+	xobjects, _ := parseDict(c.d.resolve(entries["/XObject"]))
+	ref, ok := parseRef(xobjects[string(name)])
+	if !ok || c.visited[ref.num] {
+		return
+	}
+	c.visited[ref.num] = true
+
+	object, ok := c.d.object(ref)
+	if !ok || object.stream == nil {
+		return
+	}
+	dict, _ := parseDict(object.dict)
+	if !bytes.Equal(dict["/Subtype"], []byte("/Form")) {
+		return
+	}
+	content, err := decodeStream(object)
+	if err != nil {
+		return
+	}
+	// 表单没有资源字典时使用绘制它的内容流的资源
+	if formResources, ok := dict["/Resources"]; ok {
+		resources = formResources
+	}
+	c.collect(content, resources, depth+1)
+}
+
+// appendString 将字符串操作数的内容去掉空白后加入文字
+func (c *textCollector) appendString(token []byte) {
+	for _, b := range decodeString(token) {
+		if !isSpace(b) {
+			c.text.WriteByte(b)
+		}
+	}
+}
+
+// isOperand 判断内容流中的词是否为操作数：数字、字符串、名称、数组、字典、true、false或null
+func isOperand(token []byte) bool {
+	switch c := token[0]; {
+	case c == '(' || c == '<' || c == '[' || c == '/':
+		return true
+	case c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.':
+		return true
+	}
+	switch string(token) {
+	case "true", "false", "null":
+		return true
+	}
+	return false
+}
+
+// inlineImageEnd 返回pos之后前后都是空白的EI操作符的结束位置
+func inlineImageEnd(content []byte, pos int) int {
+	for {
+		i := bytes.Index(content[pos:], []byte("EI"))
+		if i < 0 {
+			return len(content)
+		}
+		end := pos + i + 2
+		if pos+i > 0 && isSpace(content[pos+i-1]) && (end == len(content) || isSpace(content[end])) {
+			return end
+		}
+		pos = end
+	}
+}
+
+// decodeString 返回字面字符串或十六进制字符串的内容，其他值返回nil
+func decodeString(token []byte) []byte {
+	if len(token) < 2 {
+		return nil
+	}
+	switch {
+	case token[0] == '(':
+		return decodeLiteral(token[1 : len(token)-1])
+	case token[0] == '<' && token[1] != '<':
+		return decodeHex(token[1 : len(token)-1])
+	}
+	return nil
+}
+
+// decodeLiteral 解码字面字符串中的转义序列
+func decodeLiteral(data []byte) []byte {
+	output := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\\' || i+1 == len(data) {
+			output = append(output, data[i])
+			continue
+		}
+		i++
+		switch c := data[i]; c {
+		case 'n':
+			output = append(output, '\n')
+		case 'r':
+			output = append(output, '\r')
+		case 't':
+			output = append(output, '\t')
+		case 'b':
+			output = append(output, '\b')
+		case 'f':
+			output = append(output, '\f')
+		case '\r':
+			// 反斜杠后的换行表示字符串在下一行继续
+			if i+1 < len(data) && data[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			if c < '0' || c > '7' {
+				output = append(output, c)
+				continue
+			}
+			// 最多3位的八进制转义
+			value := 0
+			for n := 0; n < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; n++ {
+				value = value*8 + int(data[i]-'0')
+				i++
+			}
+			i--
+			output = append(output, byte(value))
+		}
+	}
+	return output
+}
+
+// decodeHex 解码十六进制字符串，忽略空白，奇数个数字时最后补0
+func decodeHex(data []byte) []byte {
+	digits := bytes.Map(func(r rune) rune {
+		if r < 0x80 && isSpace(byte(r)) {
+			return -1
+		}
+		return r
+	}, data)
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	output := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(output, digits); err != nil {
+		return nil
+	}
+	return output
+}
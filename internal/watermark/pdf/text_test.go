@@ -0,0 +1,106 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+func TestPDFTextLayer(t *testing.T) {
+	ctx := context.Background()
+	w := &TextWatermarker{}
+	data := pagesPDF()
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("文字层")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+	output := marked.Bytes()
+	if !bytes.HasPrefix(output, data) {
+		t.Fatal("原文件的字节被修改")
+	}
+	forms := findStamps(output)
+	if len(forms) != 2 || !bytes.Contains(output[forms[0][0]:forms[0][1]], []byte("BT 3 Tr "+stampFont+" 1 Tf")) {
+		t.Fatalf("文字层表单为 %v", forms)
+	}
+
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)))
+	if err != nil || payload.Text != "文字层" {
+		t.Fatalf("从文字层提取水印结果为 %v, %v", payload, err)
+	}
+	locations, err := w.LocateWatermarks(ctx, bytes.NewReader(output), int64(len(output)))
+	if err != nil || strings.Join(locations, ",") != "page@1,page@2" {
+		t.Errorf("水印位置为 %v, %v", locations, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)), &stripped); err != nil || !bytes.Equal(stripped.Bytes(), data) {
+		t.Errorf("移除水印后的文件与原文件不一致: %v", err)
+	}
+}
+
+func TestPDFTextLayerRewritten(t *testing.T) {
+	ctx := context.Background()
+	armored, err := watermark.SealPayload(watermark.NewPayload("重新打印"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打印为PDF后没有文档信息字典和元数据，文字层被拆成TJ数组中的字面字符串和十六进制字符串，
+	// 写在压缩的表单XObject中，前面还有包含二进制数据的内嵌图像。
+	// 表单开头重复的操作使压缩后的数据总是比原数据短，不会写为不压缩的块
+	text := hiddenPrefix + armored + hiddenSuffix
+	half := len(text) / 2
+	form := deflate([]byte(fmt.Sprintf("%sBT /F1 1 Tf 3 Tr [(%s) -20 <%s>] TJ ET", strings.Repeat("q Q ", 64),
+		text[:half], strings.ToUpper(hex.EncodeToString([]byte(text[half:]))))))
+	content := deflate([]byte("q BI /W 1 /H 1 /BPC 8 /CS /G ID \x00(junk) Tj EI Q\nq /Fm0 Do Q\n(visible text) Tj"))
+	data := buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /XObject << /Fm0 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 612 792] /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", len(form), form),
+	})
+	if bytes.Contains(data, []byte(text[:half])) {
+		t.Fatal("测试文件中的文字层应当被压缩")
+	}
+
+	d, err := openDocument(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, _ := d.pages()
+	if got := string(d.pageText(pages[0])); got != text+"visibletext" {
+		t.Errorf("页面文字为 %q", got)
+	}
+
+	// 默认方式在元数据中找不到水印时读取页面上的文字层
+	payload, err := (&PDFWatermarker{}).ExtractWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)))
+	if err != nil || payload.Text != "重新打印" {
+		t.Fatalf("提取水印结果为 %v, %v", payload, err)
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{`(a\(b\)\\c)`, `a(b)\c`},
+		{`(\101\60x\n)`, "A0x\n"},
+		{"(line\\\ncontinued)", "linecontinued"},
+		{"<41 42 4>", "AB@"},
+		{"<< /A 1 >>", ""},
+		{"/Name", ""},
+	}
+	for _, tt := range tests {
+		if got := string(decodeString([]byte(tt.token))); got != tt.want {
+			t.Errorf("decodeString(%q) = %q，期望 %q", tt.token, got, tt.want)
+		}
+	}
+}
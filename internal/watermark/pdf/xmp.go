@@ -0,0 +1,59 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"watermark-tool/internal/watermark/xmp"
+)
+
+// xmpObjects 返回写入XMP水印属性的增量更新对象：ref处的元数据流和引用它的文档目录副本
+// 合并文档原有的元数据流中的属性
+func xmpObjects(d *document, props xmp.Properties, ref objectRef) ([]updateObject, error) {
+	catalog, ok := d.object(d.root)
+	if !ok {
+		return nil, errors.New("未找到PDF文档目录")
+	}
+
+	// 读取原有的元数据流，无法解码的元数据流不合并
+	var packet []byte
+	if entries, ok := parseDict(catalog.dict); ok {
+		if original, ok := parseRef(entries["/Metadata"]); ok {
+			if object, ok := d.object(original); ok && object.stream != nil {
+				packet, _ = decodeStream(object)
+			}
+		}
+	}
+	merged, err := xmp.Merge(packet, props)
+	if err != nil {
+		return nil, err
+	}
+
+	var stream bytes.Buffer
+	fmt.Fprintf(&stream, "<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n", len(merged))
+	stream.Write(merged)
+	stream.WriteString("\nendstream")
+
+	// 复制文档目录，替换其中的/Metadata引用
+	dict := setKey(catalog.dict, "/Metadata", ref.String())
+
+	return []updateObject{
+		{ref: ref, body: stream.Bytes()},
+		{ref: d.root, body: dict},
+	}, nil
+}
+
+// removeXMP 用空格覆盖PDF中的XMP水印属性，保持之后的对象偏移不变
+func removeXMP(data []byte) ([]byte, int) {
+	ranges := xmp.Descriptions(data)
+	if len(ranges) == 0 {
+		return data, 0
+	}
+
+	output := append([]byte(nil), data...)
+	for _, r := range ranges {
+		copy(output[r[0]:r[1]], bytes.Repeat([]byte(" "), r[1]-r[0]))
+	}
+	return output, len(ranges)
+}
@@ -0,0 +1,511 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`)
+	// xrefEntryPattern 匹配经典交叉引用表中的一项
+	xrefEntryPattern = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+([nf])`)
+	// xrefSubsectionPattern 匹配经典交叉引用表中子节的起始对象号和对象数
+	xrefSubsectionPattern = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s*[\r\n]`)
+	// objectPattern 扫描文件中的间接对象定义，用于修复损坏的交叉引用
+	objectPattern = regexp.MustCompile(`(?:^|[^0-9])(\d+)\s+(\d+)\s+obj\b`)
+)
+
+// 交叉引用项的类型
+const (
+	entryFree       = 0 // 空闲对象
+	entryInUse      = 1 // 位于文件中的对象
+	entryCompressed = 2 // 位于对象流中的对象
+)
+
+// xrefEntry 交叉引用项
+type xrefEntry struct {
+	kind int
+	// offset 对象在文件中的偏移，对象流中的对象为对象流的对象号
+	offset int
+	// gen 对象的代号，对象流中的对象为在对象流中的序号
+	gen int
+}
+
+// pdfObject 文件中的间接对象
+type pdfObject struct {
+	// dict 对象的字典
+	dict []byte
+	// stream 流对象未解码的数据，不是流对象时为nil
+	stream []byte
+	// offset 流数据在文件中的偏移，对象流中的对象和解密后的对象为0
+	offset int
+}
+
+// objectStream 解码后的对象流
+type objectStream struct {
+	data []byte
+	// offsets 各对象在data中的偏移，按对象流中的序号排列
+	offsets []int
+	nums    []int
+}
+
+// document 解析后的PDF文件
+// 只读取交叉引用和用到的对象，原文件的字节不会被修改；支持经典交叉引用表、交叉引用流、
+// 对象流，以及同时使用两者的混合文件。交叉引用损坏时扫描文件中的对象定义进行修复
+type document struct {
+	data    []byte
+	entries map[int]xrefEntry
+	// trailer 最后一个trailer字典的原文，使用交叉引用流时为交叉引用流的字典
+	trailer []byte
+	// trailerDict 解析后的trailer字典
+	trailerDict map[string][]byte
+	// startxref 最后一个交叉引用节的偏移
+	startxref int
+	// xrefStream 最后一个交叉引用节是交叉引用流，增量更新也使用交叉引用流
+	xrefStream bool
+	// size 交叉引用中的对象数
+	size int
+	// root 文档目录对象
+	root objectRef
+	// security 已加密的文件的安全处理器，未加密时为nil
+	security *securityHandler
+
+	objectStreams map[int]*objectStream
+}
+
+// openDocument 解析PDF文件的交叉引用和trailer
+// 已加密的文件使用password验证口令，之后读取的对象都是解密后的明文；
+// 口令为空且不是空的用户口令时返回 watermark.ErrPasswordRequired，口令错误时返回 watermark.ErrInvalidPassword
+func openDocument(data []byte, password string) (*document, error) {
+	d := &document{data: data, objectStreams: make(map[int]*objectStream)}
+	if err := d.loadXref(); err != nil {
+		if repairErr := d.repair(); repairErr != nil {
+			return nil, fmt.Errorf("解析PDF交叉引用失败: %w", err)
+		}
+	}
+
+	dict, ok := parseDict(d.trailer)
+	if !ok {
+		return nil, errors.New("PDF文件的trailer字典无效")
+	}
+	d.trailerDict = dict
+
+	size, ok := parseInt(dict["/Size"])
+	root, rootOK := parseRef(dict["/Root"])
+	if !ok || !rootOK {
+		return nil, errors.New("PDF文件的trailer字典缺少/Size或/Root")
+	}
+	d.size, d.root = size, root
+
+	if _, ok := dict["/Encrypt"]; ok {
+		security, err := newSecurityHandler(d, password)
+		if err != nil {
+			return nil, err
+		}
+		d.security = security
+	}
+	return d, nil
+}
+
+// info 返回trailer中/Info引用的文档信息字典，没有时返回false
+func (d *document) info() (objectRef, bool) {
+	return parseRef(d.trailerDict["/Info"])
+}
+
+// loadXref 从最后一个startxref开始，沿/Prev读取所有交叉引用节，较新的交叉引用项覆盖较旧的
+func (d *document) loadXref() error {
+	matches := startxrefPattern.FindAllSubmatch(d.data, -1)
+	if matches == nil {
+		return errors.New("PDF文件缺少startxref")
+	}
+	startxref, err := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if err != nil {
+		return fmt.Errorf("PDF文件的startxref无效: %w", err)
+	}
+	d.startxref = startxref
+	d.entries = make(map[int]xrefEntry)
+
+	visited := make(map[int]bool)
+	for offset := startxref; ; {
+		if offset < 0 || offset >= len(d.data) || visited[offset] {
+			return fmt.Errorf("交叉引用的偏移%d无效", offset)
+		}
+		visited[offset] = true
+
+		var trailer []byte
+		pos := skipSpace(d.data, offset)
+		classic := bytes.HasPrefix(d.data[pos:], []byte("xref"))
+		if classic {
+			trailer, err = d.readXrefTable(pos + len("xref"))
+		} else {
+			trailer, err = d.readXrefStream(offset)
+		}
+		if err != nil {
+			return err
+		}
+		if d.trailer == nil {
+			d.trailer, d.xrefStream = trailer, !classic
+		}
+
+		dict, _ := parseDict(trailer)
+		prev, ok := parseInt(dict["/Prev"])
+		if !ok {
+			return nil
+		}
+		offset = prev
+	}
+}
+
+// addEntry 添加交叉引用项，已有较新的项时忽略
+func (d *document) addEntry(num int, entry xrefEntry) {
+	if _, ok := d.entries[num]; !ok {
+		d.entries[num] = entry
+	}
+}
+
+// readXrefTable 读取经典交叉引用表，pos为xref关键字之后的位置，返回其后的trailer字典
+// 混合文件的trailer带有/XRefStm，其中的交叉引用流补充表中没有的对象，通常是对象流中的对象
+func (d *document) readXrefTable(pos int) ([]byte, error) {
+	var free []int
+	for {
+		m := xrefSubsectionPattern.FindSubmatchIndex(d.data[pos:min(pos+64, len(d.data))])
+		if m == nil {
+			break
+		}
+		start, _ := strconv.Atoi(string(d.data[pos+m[2] : pos+m[3]]))
+		count, _ := strconv.Atoi(string(d.data[pos+m[4] : pos+m[5]]))
+		pos += m[3]
+		for i := 0; i < count; i++ {
+			e := xrefEntryPattern.FindSubmatchIndex(d.data[pos:min(pos+64, len(d.data))])
+			if e == nil {
+				return nil, errors.New("经典交叉引用表无效")
+			}
+			offset, _ := strconv.Atoi(string(d.data[pos+e[2] : pos+e[3]]))
+			gen, _ := strconv.Atoi(string(d.data[pos+e[4] : pos+e[5]]))
+			if d.data[pos+e[6]] == 'n' {
+				d.addEntry(start+i, xrefEntry{kind: entryInUse, offset: offset, gen: gen})
+			} else {
+				free = append(free, start+i)
+			}
+			pos += e[1]
+		}
+	}
+
+	pos = skipSpace(d.data, pos)
+	if !bytes.HasPrefix(d.data[pos:], []byte("trailer")) {
+		return nil, errors.New("经典交叉引用表之后缺少trailer")
+	}
+	start := skipSpace(d.data, pos+len("trailer"))
+	end := dictionaryEnd(d.data, start)
+	if end < 0 {
+		return nil, errors.New("PDF文件的trailer字典无效")
+	}
+	trailer := d.data[start:end]
+
+	dict, _ := parseDict(trailer)
+	if stm, ok := parseInt(dict["/XRefStm"]); ok {
+		if _, err := d.readXrefStream(stm); err != nil {
+			return nil, err
+		}
+	}
+	for _, num := range free {
+		d.addEntry(num, xrefEntry{kind: entryFree})
+	}
+	return trailer, nil
+}
+
+// readXrefStream 读取offset处的交叉引用流，返回交叉引用流的字典
+func (d *document) readXrefStream(offset int) ([]byte, error) {
+	_, object, ok := d.objectAt(offset)
+	if !ok || object.stream == nil {
+		return nil, fmt.Errorf("偏移%d处不是交叉引用流", offset)
+	}
+	dict, _ := parseDict(object.dict)
+	if !bytes.Equal(dict["/Type"], []byte("/XRef")) {
+		return nil, fmt.Errorf("偏移%d处不是交叉引用流", offset)
+	}
+	data, err := decodeStream(object)
+	if err != nil {
+		return nil, fmt.Errorf("解码交叉引用流失败: %w", err)
+	}
+
+	var widths [3]int
+	items := arrayItems(dict["/W"])
+	if len(items) != 3 {
+		return nil, errors.New("交叉引用流的/W无效")
+	}
+	rowLength := 0
+	for i, item := range items {
+		w, ok := parseInt(item)
+		if !ok || w < 0 || w > 8 {
+			return nil, errors.New("交叉引用流的/W无效")
+		}
+		widths[i] = w
+		rowLength += w
+	}
+	if rowLength == 0 {
+		return nil, errors.New("交叉引用流的/W无效")
+	}
+
+	size, _ := parseInt(dict["/Size"])
+	index := []int{0, size}
+	if items := arrayItems(dict["/Index"]); items != nil {
+		index = index[:0]
+		for _, item := range items {
+			n, ok := parseInt(item)
+			if !ok {
+				return nil, errors.New("交叉引用流的/Index无效")
+			}
+			index = append(index, n)
+		}
+	}
+
+	for i := 0; i+1 < len(index); i += 2 {
+		for num := index[i]; num < index[i]+index[i+1]; num++ {
+			if len(data) < rowLength {
+				return nil, errors.New("交叉引用流数据不完整")
+			}
+			var fields [3]int
+			for f, w := range widths {
+				for _, b := range data[:w] {
+					fields[f] = fields[f]<<8 | int(b)
+				}
+				data = data[w:]
+			}
+			// 类型字段宽度为0时默认为1
+			if widths[0] == 0 {
+				fields[0] = entryInUse
+			}
+			switch fields[0] {
+			case entryFree, entryInUse, entryCompressed:
+				d.addEntry(num, xrefEntry{kind: fields[0], offset: fields[1], gen: fields[2]})
+			}
+		}
+	}
+	return object.dict, nil
+}
+
+// repair 交叉引用损坏时扫描文件中所有的对象定义，后出现的定义覆盖之前的，再读取对象流中的对象
+// trailer使用最后一个trailer字典，没有时使用最后一个交叉引用流的字典
+func (d *document) repair() error {
+	d.entries = make(map[int]xrefEntry)
+	d.trailer, d.xrefStream = nil, false
+
+	var nums, xrefStreams []int
+	for _, m := range objectPattern.FindAllSubmatchIndex(d.data, -1) {
+		num, _ := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(d.data[m[4]:m[5]]))
+		d.entries[num] = xrefEntry{kind: entryInUse, offset: m[2], gen: gen}
+		nums = append(nums, num)
+	}
+
+	for _, num := range nums {
+		entry := d.entries[num]
+		_, object, ok := d.objectAt(entry.offset)
+		if !ok {
+			continue
+		}
+		dict, _ := parseDict(object.dict)
+		switch string(dict["/Type"]) {
+		case "/XRef":
+			xrefStreams = append(xrefStreams, entry.offset)
+		case "/ObjStm":
+			stream, err := d.objectStream(num)
+			if err != nil {
+				continue
+			}
+			for i, n := range stream.nums {
+				d.addEntry(n, xrefEntry{kind: entryCompressed, offset: num, gen: i})
+			}
+		}
+	}
+
+	if pos := bytes.LastIndex(d.data, []byte("trailer")); pos >= 0 {
+		start := skipSpace(d.data, pos+len("trailer"))
+		if end := dictionaryEnd(d.data, start); end >= 0 {
+			d.trailer = d.data[start:end]
+		}
+	}
+	if d.trailer == nil && len(xrefStreams) > 0 {
+		last := xrefStreams[0]
+		for _, offset := range xrefStreams {
+			last = max(last, offset)
+		}
+		_, object, _ := d.objectAt(last)
+		d.trailer, d.xrefStream = object.dict, true
+	}
+	if d.trailer == nil {
+		return errors.New("未找到PDF文件的trailer")
+	}
+	return nil
+}
+
+// objectAt 读取offset处的间接对象
+func (d *document) objectAt(offset int) (objectRef, *pdfObject, bool) {
+	if offset < 0 || offset >= len(d.data) {
+		return objectRef{}, nil, false
+	}
+	pos := skipSpace(d.data, offset)
+	m := objHeaderPattern.FindSubmatchIndex(d.data[pos:min(pos+64, len(d.data))])
+	if m == nil {
+		return objectRef{}, nil, false
+	}
+	var ref objectRef
+	ref.num, _ = strconv.Atoi(string(d.data[pos+m[2] : pos+m[3]]))
+	ref.gen, _ = strconv.Atoi(string(d.data[pos+m[4] : pos+m[5]]))
+
+	valueStart := skipSpace(d.data, pos+m[1])
+	valueEnd := objectEnd(d.data, valueStart)
+	if valueEnd < 0 {
+		return objectRef{}, nil, false
+	}
+	object := &pdfObject{dict: d.data[valueStart:valueEnd]}
+
+	pos = skipSpace(d.data, valueEnd)
+	if !bytes.HasPrefix(d.data[pos:], []byte("stream")) {
+		return ref, object, true
+	}
+	pos += len("stream")
+	if bytes.HasPrefix(d.data[pos:], []byte("\r\n")) {
+		pos += 2
+	} else if pos < len(d.data) && (d.data[pos] == '\n' || d.data[pos] == '\r') {
+		pos++
+	}
+	object.stream, object.offset = d.data[pos:d.streamEnd(object.dict, pos)], pos
+	return ref, object, true
+}
+
+// streamEnd 返回从pos开始的流数据结束的位置
+// 优先使用/Length，/Length无效时查找endstream关键字
+func (d *document) streamEnd(dict []byte, pos int) int {
+	entries, _ := parseDict(dict)
+	length, ok := parseInt(entries["/Length"])
+	if ref, isRef := parseRef(entries["/Length"]); isRef {
+		length, ok = d.integer(ref)
+	}
+	if ok && length >= 0 && pos+length <= len(d.data) &&
+		bytes.HasPrefix(d.data[skipSpace(d.data, pos+length):], []byte("endstream")) {
+		return pos + length
+	}
+
+	end := bytes.Index(d.data[pos:], []byte("endstream"))
+	if end < 0 {
+		return len(d.data)
+	}
+	end += pos
+	if end > pos && d.data[end-1] == '\n' {
+		end--
+	}
+	if end > pos && d.data[end-1] == '\r' {
+		end--
+	}
+	return end
+}
+
+// integer 读取整数对象，用于间接给出的流长度
+func (d *document) integer(ref objectRef) (int, bool) {
+	entry, ok := d.entries[ref.num]
+	if !ok || entry.kind != entryInUse {
+		return 0, false
+	}
+	pos := skipSpace(d.data, entry.offset)
+	m := objHeaderPattern.FindIndex(d.data[pos:min(pos+64, len(d.data))])
+	if m == nil {
+		return 0, false
+	}
+	start := skipSpace(d.data, pos+m[1])
+	end := start
+	for end < len(d.data) && !isSpace(d.data[end]) && !isDelimiter(d.data[end]) {
+		end++
+	}
+	return parseInt(d.data[start:end])
+}
+
+// object 通过交叉引用读取对象，对象可以位于对象流中
+func (d *document) object(ref objectRef) (*pdfObject, bool) {
+	entry, ok := d.entries[ref.num]
+	if !ok {
+		return nil, false
+	}
+
+	switch entry.kind {
+	case entryInUse:
+		found, object, ok := d.objectAt(entry.offset)
+		if !ok || found.num != ref.num {
+			return nil, false
+		}
+		if d.security != nil {
+			plain, err := d.security.decryptObject(found, object)
+			return plain, err == nil
+		}
+		return object, true
+	case entryCompressed:
+		stream, err := d.objectStream(entry.offset)
+		if err != nil || entry.gen >= len(stream.offsets) || stream.nums[entry.gen] != ref.num {
+			return nil, false
+		}
+		start := stream.offsets[entry.gen]
+		end := objectEnd(stream.data, start)
+		if end < 0 {
+			return nil, false
+		}
+		return &pdfObject{dict: stream.data[start:end]}, true
+	}
+	return nil, false
+}
+
+// objectStream 读取并缓存解码后的对象流
+func (d *document) objectStream(num int) (*objectStream, error) {
+	if stream, ok := d.objectStreams[num]; ok {
+		return stream, nil
+	}
+
+	entry, ok := d.entries[num]
+	if !ok || entry.kind != entryInUse {
+		return nil, fmt.Errorf("未找到对象流%d", num)
+	}
+	ref, object, ok := d.objectAt(entry.offset)
+	if !ok || object.stream == nil {
+		return nil, fmt.Errorf("对象%d不是对象流", num)
+	}
+	if d.security != nil {
+		var err error
+		if object, err = d.security.decryptObject(ref, object); err != nil {
+			return nil, fmt.Errorf("解密对象流失败: %w", err)
+		}
+	}
+	dict, _ := parseDict(object.dict)
+	n, ok1 := parseInt(dict["/N"])
+	first, ok2 := parseInt(dict["/First"])
+	if !bytes.Equal(dict["/Type"], []byte("/ObjStm")) || !ok1 || !ok2 {
+		return nil, fmt.Errorf("对象%d不是对象流", num)
+	}
+	data, err := decodeStream(object)
+	if err != nil {
+		return nil, fmt.Errorf("解码对象流失败: %w", err)
+	}
+	if first < 0 || first > len(data) {
+		return nil, fmt.Errorf("对象流%d的/First无效", num)
+	}
+
+	// 对象流开头是n对"对象号 偏移"，偏移相对于/First
+	fields := bytes.Fields(data[:first])
+	if n < 0 || len(fields) < 2*n {
+		return nil, fmt.Errorf("对象流%d的对象表不完整", num)
+	}
+	stream := &objectStream{data: data}
+	for i := 0; i < n; i++ {
+		objectNum, ok1 := parseInt(fields[2*i])
+		offset, ok2 := parseInt(fields[2*i+1])
+		if !ok1 || !ok2 || offset < 0 || first+offset < first || first+offset > len(data) {
+			return nil, fmt.Errorf("对象流%d的对象表无效", num)
+		}
+		stream.nums = append(stream.nums, objectNum)
+		stream.offsets = append(stream.offsets, skipSpace(data, first+offset))
+	}
+	d.objectStreams[num] = stream
+	return stream, nil
+}
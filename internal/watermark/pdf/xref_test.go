@@ -0,0 +1,246 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+// deflate 使用zlib压缩数据
+func deflate(data []byte) []byte {
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+// predictUp 使用PNG Up预测器处理数据，每行前加上过滤类型2
+func predictUp(data []byte, columns int) []byte {
+	var output []byte
+	previous := make([]byte, columns)
+	for i := 0; i < len(data); i += columns {
+		row := data[i : i+columns]
+		output = append(output, 2)
+		for j, b := range row {
+			output = append(output, b-previous[j])
+		}
+		previous = row
+	}
+	return output
+}
+
+// objectStreamPDF 生成使用对象流的PDF文件，文档目录、页面树、页面和文档信息字典位于压缩的对象流5中
+// hybrid为false时只使用交叉引用流；为true时生成混合文件，经典交叉引用表中对象流里的对象为空闲项，
+// /XRefStm指向的交叉引用流给出这些对象的位置
+func objectStreamPDF(info string, hybrid bool) []byte {
+	compressed := []struct {
+		num  int
+		body string
+	}{
+		{1, "<< /Type /Catalog /Pages 2 0 R >>"},
+		{2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"},
+		{3, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>"},
+		{6, info},
+	}
+	var header, body bytes.Buffer
+	for _, object := range compressed {
+		fmt.Fprintf(&header, "%d %d ", object.num, body.Len())
+		body.WriteString(object.body + "\n")
+	}
+	objstm := deflate(append(header.Bytes(), body.Bytes()...))
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.5\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make(map[int]int)
+	offsets[4] = buffer.Len()
+	buffer.WriteString("4 0 obj\n<< /Length 18 >>\nstream\nBT /F1 12 Tf ET\n\nendstream\nendobj\n")
+	offsets[5] = buffer.Len()
+	fmt.Fprintf(&buffer, "5 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n",
+		len(compressed), header.Len(), len(objstm))
+	buffer.Write(objstm)
+	buffer.WriteString("\nendstream\nendobj\n")
+
+	// 交叉引用流：每项为1字节类型、4字节偏移或对象流号、1字节代号或序号
+	offsets[7] = buffer.Len()
+	row := func(kind, field, gen int) []byte {
+		return []byte{byte(kind), byte(field >> 24), byte(field >> 16), byte(field >> 8), byte(field), byte(gen)}
+	}
+	index := "0 8"
+	rows := bytes.Join([][]byte{
+		row(0, 0, 255), row(2, 5, 0), row(2, 5, 1), row(2, 5, 2),
+		row(1, offsets[4], 0), row(1, offsets[5], 0), row(2, 5, 3), row(1, offsets[7], 0),
+	}, nil)
+	if hybrid {
+		// 混合文件的交叉引用流只列出对象流中的对象1、2、3和6
+		index = "1 3 6 1"
+		rows = bytes.Join([][]byte{row(2, 5, 0), row(2, 5, 1), row(2, 5, 2), row(2, 5, 3)}, nil)
+	}
+	stream := deflate(predictUp(rows, 6))
+	trailer := "/Size 8 /Root 1 0 R /Info 6 0 R /ID [<01><02>]"
+	fmt.Fprintf(&buffer, "7 0 obj\n<< /Type /XRef %s /W [1 4 1] /Index [%s] /Filter /FlateDecode /DecodeParms << /Columns 6 /Predictor 12 >> /Length %d >>\nstream\n",
+		trailer, index, len(stream))
+	buffer.Write(stream)
+	buffer.WriteString("\nendstream\nendobj\n")
+
+	startxref := offsets[7]
+	if hybrid {
+		startxref = buffer.Len()
+		buffer.WriteString("xref\n0 8\n0000000000 65535 f \n0000000000 65535 f \n0000000000 65535 f \n0000000000 65535 f \n")
+		fmt.Fprintf(&buffer, "%010d 00000 n \n%010d 00000 n \n0000000000 65535 f \n%010d 00000 n \n", offsets[4], offsets[5], offsets[7])
+		fmt.Fprintf(&buffer, "trailer\n<< %s /XRefStm %d >>\n", trailer, offsets[7])
+	}
+	fmt.Fprintf(&buffer, "startxref\n%d\n%%%%EOF\n", startxref)
+	return buffer.Bytes()
+}
+
+func TestObjectEnd(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"<< /A (a) >> rest", "<< /A (a) >>"},
+		{"<< /A (>> \\) (x)) /B <3E3E> /C [1 0 R << /D 2 >>] >> 1 0 obj", "<< /A (>> \\) (x)) /B <3E3E> /C [1 0 R << /D 2 >>] >>"},
+		{"12 0 R /Next", "12 0 R"},
+		{"12 0 obj", "12"},
+		{"/Name#20x/B", "/Name#20x"},
+		{"[1 2.5 -3 true null]]", "[1 2.5 -3 true null]"},
+		{"<< /Open", ""},
+	}
+	for _, tt := range tests {
+		end := objectEnd([]byte(tt.data), 0)
+		got := ""
+		if end >= 0 {
+			got = tt.data[:end]
+		}
+		if got != tt.want {
+			t.Errorf("objectEnd(%q) = %q，期望 %q", tt.data, got, tt.want)
+		}
+	}
+
+	dict, ok := parseDict([]byte("<< /Type /Catalog /Pages 2 0 R % 注释\n/Names << /Dests 3 0 R >> >>"))
+	if !ok || string(dict["/Pages"]) != "2 0 R" || string(dict["/Names"]) != "<< /Dests 3 0 R >>" || dict["/Dests"] != nil {
+		t.Errorf("解析字典结果为 %q", dict)
+	}
+	if got := removeKey([]byte("<< /A 1 /Metadata 5 0 R /B << /Metadata 6 0 R >> >>"), "/Metadata"); string(got) != "<< /A 1 /B << /Metadata 6 0 R >> >>" {
+		t.Errorf("删除键后的字典为 %s", got)
+	}
+}
+
+func TestPDFObjectStreams(t *testing.T) {
+	ctx := context.Background()
+	w := &PDFWatermarker{}
+
+	for _, hybrid := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hybrid=%v", hybrid), func(t *testing.T) {
+			data := objectStreamPDF("<< /Title (Report) >>", hybrid)
+			d, err := openDocument(data, "")
+			if err != nil {
+				t.Fatalf("解析文件失败: %v", err)
+			}
+			if d.xrefStream == hybrid || d.size != 8 || d.root != (objectRef{num: 1}) {
+				t.Errorf("交叉引用为 xrefStream=%v size=%d root=%v", d.xrefStream, d.size, d.root)
+			}
+			if page, ok := d.object(objectRef{num: 3}); !ok || !bytes.Contains(page.dict, []byte("/Contents 4 0 R")) {
+				t.Errorf("未读取到对象流中的页面: %v", page)
+			}
+			if content, ok := d.object(objectRef{num: 4}); !ok || string(content.stream) != "BT /F1 12 Tf ET\n" {
+				t.Errorf("未读取到内容流: %v", content)
+			}
+
+			var marked bytes.Buffer
+			if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("对象流")); err != nil {
+				t.Fatalf("添加水印失败: %v", err)
+			}
+			output := marked.Bytes()
+			if !bytes.HasPrefix(output, data) {
+				t.Fatal("原文件的字节被修改")
+			}
+
+			// 增量更新使用与原文件最后一个交叉引用节相同的形式
+			updated, err := openDocument(output, "")
+			if err != nil {
+				t.Fatalf("解析添加水印后的文件失败: %v", err)
+			}
+			if updated.xrefStream == hybrid || updated.startxref <= len(data) {
+				t.Errorf("增量更新的交叉引用为 xrefStream=%v startxref=%d", updated.xrefStream, updated.startxref)
+			}
+			if !bytes.Contains(updated.trailer, []byte(fmt.Sprintf("/Prev %d", d.startxref))) {
+				t.Errorf("新的trailer没有指向原交叉引用: %s", updated.trailer)
+			}
+			catalog, ok := updated.object(updated.root)
+			if !ok || !bytes.Contains(catalog.dict, []byte("/Pages 2 0 R /Metadata 8 0 R")) {
+				t.Errorf("文档目录为 %v", catalog)
+			}
+			info, ok := updated.object(objectRef{num: 9})
+			if !ok || !bytes.HasPrefix(info.dict, []byte("<< /Title (Report) "+infoKey)) {
+				t.Errorf("文档信息字典为 %v", info)
+			}
+			if page, ok := updated.object(objectRef{num: 3}); !ok || !bytes.Contains(page.dict, []byte("/Type /Page")) {
+				t.Error("增量更新后未读取到原对象流中的页面")
+			}
+
+			payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)))
+			if err != nil || payload.Text != "对象流" {
+				t.Fatalf("提取水印结果为 %v, %v", payload, err)
+			}
+			var stripped bytes.Buffer
+			if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(output), int64(len(output)), &stripped); err != nil {
+				t.Fatalf("移除水印失败: %v", err)
+			}
+			if !bytes.Equal(stripped.Bytes(), data) {
+				t.Error("移除水印后的文件与原文件不一致")
+			}
+		})
+	}
+}
+
+func TestPDFCompressedInfo(t *testing.T) {
+	ctx := context.Background()
+	w := &PDFWatermarker{}
+
+	// 其他工具改写文件后，文档信息字典位于压缩的对象流中，直接搜索文件内容找不到
+	armored, err := watermark.SealPayload(watermark.NewPayload("改写后"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := objectStreamPDF(fmt.Sprintf("<< /Producer (qpdf) %s (%s) >>", infoKey, armored), false)
+	if bytes.Contains(data, []byte(infoKey)) {
+		t.Fatal("测试文件中的文档信息字典应当被压缩")
+	}
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)))
+	if err != nil || payload.Text != "改写后" {
+		t.Fatalf("提取水印结果为 %v, %v", payload, err)
+	}
+
+	// startxref损坏时扫描文件中的对象定义，仍可以读取对象流中的对象
+	broken := bytes.Replace(data, []byte("startxref\n"), []byte("startxref\n9"), 1)
+	d, err := openDocument(broken, "")
+	if err != nil {
+		t.Fatalf("修复交叉引用失败: %v", err)
+	}
+	if info, ok := d.object(objectRef{num: 6}); !ok || !bytes.Contains(info.dict, []byte("(qpdf)")) {
+		t.Errorf("修复后未读取到文档信息字典: %v", info)
+	}
+}
+
+func TestObjectStreamInvalidOffset(t *testing.T) {
+	// 对象表中的偏移为负数时返回错误，不会越界读取
+	content := "7 -5<< /A 1 >>"
+	data := buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		fmt.Sprintf("<< /Type /ObjStm /N 1 /First 4 /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	})
+	d, err := openDocument(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.objectStream(3); err == nil || err.Error() != "对象流3的对象表无效" {
+		t.Errorf("期望返回对象表无效，实际为: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// pngSignature PNG文件头
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// chunkKeyword 保存水印信封的文本块关键字
+const chunkKeyword = "WatermarkEnvelope"
+
+// xmpKeyword 保存XMP数据包的iTXt块关键字
+const xmpKeyword = "XML:com.adobe.xmp"
+
+// maxTextLength 解压文本块时允许的最大长度，防止压缩炸弹
+const maxTextLength = 1 << 20
+
+// chunk PNG数据块
+type chunk struct {
+	// Type 块类型，如"IHDR"、"iTXt"
+	Type string
+	// Data 块数据，不包括长度、类型和CRC
+	Data []byte
+	// Offset 块在文件中的偏移
+	Offset int
+	// Raw 块的原始字节，包括长度、类型和CRC
+	Raw []byte
+}
+
+// parseChunks 按顺序解析PNG数据块直到IEND，同时返回IEND之后的数据
+// 只检查块结构，不校验CRC，因此不会修改或拒绝其他工具写入的块
+func parseChunks(data []byte) ([]chunk, []byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, nil, errors.New("不是有效的PNG文件")
+	}
+
+	var chunks []chunk
+	pos := len(pngSignature)
+	for {
+		if len(data)-pos < 12 {
+			return nil, nil, errors.New("PNG数据块不完整")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || length > len(data)-pos-12 {
+			return nil, nil, errors.New("PNG数据块长度无效")
+		}
+
+		end := pos + 12 + length
+		c := chunk{
+			Type:   string(data[pos+4 : pos+8]),
+			Data:   data[pos+8 : pos+8+length],
+			Offset: pos,
+			Raw:    data[pos:end],
+		}
+		if len(chunks) == 0 && c.Type != "IHDR" {
+			return nil, nil, errors.New("PNG文件缺少IHDR块")
+		}
+		chunks = append(chunks, c)
+		pos = end
+
+		if c.Type == "IEND" {
+			return chunks, data[pos:], nil
+		}
+	}
+}
+
+// appendChunk 将数据块编码后追加到dst，CRC覆盖块类型和数据
+func appendChunk(dst []byte, chunkType string, data []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(data)))
+	dst = append(dst, chunkType...)
+	dst = append(dst, data...)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	return binary.BigEndian.AppendUint32(dst, crc.Sum32())
+}
+
+// encodeITXt 编码未压缩的iTXt块数据，不设置语言和翻译后的关键字
+func encodeITXt(keyword, text string) []byte {
+	var data []byte
+	data = append(data, keyword...)
+	// 关键字结束符、压缩标志、压缩方法、语言标签结束符、翻译关键字结束符
+	data = append(data, 0, 0, 0, 0, 0)
+	return append(data, text...)
+}
+
+// decodeTextChunk 解析tEXt、zTXt或iTXt块，返回关键字和文本
+func decodeTextChunk(c chunk) (string, string, error) {
+	keyword, rest, ok := bytes.Cut(c.Data, []byte{0})
+	if !ok {
+		return "", "", errors.New("文本块缺少关键字")
+	}
+
+	switch c.Type {
+	case "tEXt":
+		return string(keyword), string(rest), nil
+
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", errors.New("zTXt块数据不完整")
+		}
+		text, err := inflate(rest[1:])
+		return string(keyword), string(text), err
+
+	case "iTXt":
+		if len(rest) < 2 {
+			return "", "", errors.New("iTXt块数据不完整")
+		}
+		compressed := rest[0] == 1
+		// 跳过压缩标志、压缩方法、语言标签和翻译后的关键字
+		rest = rest[2:]
+		for i := 0; i < 2; i++ {
+			var found bool
+			if _, rest, found = bytes.Cut(rest, []byte{0}); !found {
+				return "", "", errors.New("iTXt块数据不完整")
+			}
+		}
+		if !compressed {
+			return string(keyword), string(rest), nil
+		}
+		text, err := inflate(rest)
+		return string(keyword), string(text), err
+	}
+
+	return "", "", fmt.Errorf("%s 不是文本块", c.Type)
+}
+
+// isTextChunk 判断是否为文本块
+func isTextChunk(c chunk) bool {
+	return c.Type == "tEXt" || c.Type == "zTXt" || c.Type == "iTXt"
+}
+
+// isWatermarkChunk 判断是否为保存水印信封的文本块
+func isWatermarkChunk(c chunk) bool {
+	if !isTextChunk(c) {
+		return false
+	}
+	keyword, _, _ := bytes.Cut(c.Data, []byte{0})
+	return string(keyword) == chunkKeyword
+}
+
+// isXMPChunk 判断是否为保存XMP数据包的iTXt块
+func isXMPChunk(c chunk) bool {
+	if c.Type != "iTXt" {
+		return false
+	}
+	keyword, _, _ := bytes.Cut(c.Data, []byte{0})
+	return string(keyword) == xmpKeyword
+}
+
+// inflate 解压zlib数据
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解压文本块失败: %w", err)
+	}
+	defer reader.Close()
+
+	text, err := io.ReadAll(io.LimitReader(reader, maxTextLength+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压文本块失败: %w", err)
+	}
+	if len(text) > maxTextLength {
+		return nil, errors.New("文本块过大")
+	}
+	return text, nil
+}
+
+// portableChunks 与图像编码方式无关的辅助块，重新编码像素后从原文件复制
+// sBIT、bKGD、tRNS等块依赖颜色类型和位深度，不能直接复制
+var portableChunks = map[string]bool{
+	"gAMA": true,
+	"cHRM": true,
+	"sRGB": true,
+	"iCCP": true,
+	"pHYs": true,
+	"tIME": true,
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+}
+
+// copyPortableChunks 将原文件中与编码方式无关的辅助块复制到重新编码的PNG中，放在IHDR之后
+func copyPortableChunks(encoded []byte, original []chunk) ([]byte, error) {
+	chunks, trailer, err := parseChunks(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]byte, 0, len(encoded))
+	output = append(output, pngSignature...)
+	for _, c := range chunks {
+		output = append(output, c.Raw...)
+		if c.Type != "IHDR" {
+			continue
+		}
+		for _, o := range original {
+			if portableChunks[o.Type] {
+				output = append(output, o.Raw...)
+			}
+		}
+	}
+	return append(output, trailer...), nil
+}
@@ -0,0 +1,194 @@
+package png
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
+	"watermark-tool/internal/watermark/lsb"
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// pixelFormat PNG像素水印的帧头标记和位置序列标签
+var pixelFormat = lsb.Format{Magic: 0xA5C3, SeedLabel: []byte("watermark-png-lsb")}
+
+// PixelWatermarker 将水印嵌入PNG图片像素的最低位
+// 水印不依赖文件元数据，经过编辑器另存为、元数据清理或截图（无缩放）后仍然可以提取
+type PixelWatermarker struct{}
+
+// NewPixelWatermarker 创建一个新的PNG像素水印处理器
+func NewPixelWatermarker() *PixelWatermarker {
+	return &PixelWatermarker{}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (w *PixelWatermarker) GetSupportedType() string {
+	return "png"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (w *PixelWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "在像素最低位中重复嵌入，裁剪或重新保存后仍可提取", Locate: true, Robust: true, Visible: true}
+}
+
+// AddWatermarkStream 将水印信封嵌入PNG图片的像素
+// 调色板和灰度图片会转换为8位RGBA，色彩配置和文本块等辅助块保留
+func (w *PixelWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	img, chunks, err := decodePixels(ctx, src, size)
+	if err != nil {
+		return err
+	}
+	// 先绘制可见水印，再把隐水印嵌入绘制后的像素
+	if opts, ok := payload.OverlayOptions(); ok {
+		if err := overlay.Draw(img, opts); err != nil {
+			return err
+		}
+	}
+
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
+	env, err := envelope.Dearmor(armored)
+	if err != nil {
+		return err
+	}
+	data, err := env.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := pixelFormat.Embed(lsb.NRGBA{NRGBA: img}, watermark.GetKeyProvider().ActiveKeyID(), data); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return encodePixels(img, chunks, dst)
+}
+
+// ExtractWatermarkStream 从PNG图片的像素中提取水印
+func (w *PixelWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	img, _, err := decodePixels(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+
+	mark, err := pixelFormat.Find(ctx, lsb.NRGBA{NRGBA: img})
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := envelope.Unmarshal(mark.Data)
+	if err != nil {
+		return nil, fmt.Errorf("解析像素水印失败: %w", err)
+	}
+	armored, err := env.Armor()
+	if err != nil {
+		return nil, err
+	}
+	return watermark.OpenPayload(armored)
+}
+
+// RemoveWatermarkStream 用随机数据覆盖像素水印所在的位
+// 原始像素的最低位无法恢复，移除后的图片与添加水印前不完全相同，但差异不可见
+func (w *PixelWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	img, chunks, err := decodePixels(ctx, src, size)
+	if err != nil {
+		return err
+	}
+
+	pixels := lsb.NRGBA{NRGBA: img}
+	mark, err := pixelFormat.Find(ctx, pixels)
+	if err != nil {
+		return err
+	}
+	lsb.Erase(pixels, mark)
+
+	return encodePixels(img, chunks, dst)
+}
+
+// LocateWatermarks 返回包含像素水印的区块的左上角坐标
+func (w *PixelWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	img, _, err := decodePixels(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+
+	pixels := lsb.NRGBA{NRGBA: img}
+	mark, err := pixelFormat.Find(ctx, pixels)
+	if errors.Is(err, watermark.ErrNoWatermark) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for _, origin := range lsb.Tiles(pixels, mark.OriginX, mark.OriginY) {
+		locations = append(locations, fmt.Sprintf("tile@%d,%d", origin.X, origin.Y))
+	}
+	return locations, nil
+}
+
+// decodePixels 解码PNG图片为8位RGBA，同时返回原文件的数据块
+func decodePixels(ctx context.Context, src io.ReaderAt, size int64) (*image.NRGBA, []chunk, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	return decodeData(ctx, data)
+}
+
+// decodeData 解码内存中的PNG图片为8位RGBA，同时返回数据块
+func decodeData(ctx context.Context, data []byte) (*image.NRGBA, []chunk, error) {
+	chunks, _, err := parseChunks(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba, chunks, nil
+	}
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			nrgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return nrgba, chunks, nil
+}
+
+// encodePixels 编码图片并复制原文件中的辅助块
+func encodePixels(img *image.NRGBA, original []chunk, dst io.Writer) error {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return fmt.Errorf("编码图片失败: %w", err)
+	}
+
+	output, err := copyPortableChunks(buffer.Bytes(), original)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
@@ -2,19 +2,25 @@ package png
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"image/png"
-	"os"
+	"io"
 	"strings"
-	"time"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
+	"watermark-tool/internal/watermark/overlay"
+	"watermark-tool/internal/watermark/xmp"
 )
 
+// pixelPriority 像素水印的优先级，低于元数据水印，需要时通过嵌入方式"pixel"指定
+const pixelPriority = -10
+
 func init() {
 	watermark.RegisterWatermarker(NewPNGWatermarker())
+	watermark.RegisterStrategy(watermark.Strategy{Method: "pixel", Priority: pixelPriority, Watermarker: NewPixelWatermarker()})
 }
 
 // PNGWatermarker 提供对PNG图片的水印操作
@@ -30,7 +36,12 @@ func (w *PNGWatermarker) GetSupportedType() string {
 	return "png"
 }
 
-// 定义水印标记
+// Capabilities 返回嵌入方式的能力
+func (w *PNGWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入iTXt文本块和XMP元数据", Locate: true, Lossless: true, Visible: true}
+}
+
+// 旧版本在IEND之后追加的水印标记，只用于读取和移除旧文件中的水印
 const (
 	watermarkPrefix = "<!--WATERMARK_BEGIN:"
 	watermarkSuffix = ":WATERMARK_END-->"
@@ -38,108 +49,172 @@ const (
 
 // AddWatermark 添加水印到PNG图片
 func (w *PNGWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("输入文件不存在: %s", inputFile)
-	}
+	return watermark.AddWatermarkFile(context.Background(), w, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
 
-	// 打开PNG文件
-	file, err := os.Open(inputFile)
+// ExtractWatermark 从PNG图片中提取水印
+func (w *PNGWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), w, inputFile)
 	if err != nil {
-		return fmt.Errorf("打开图片文件失败: %w", err)
+		return "", "", err
 	}
-	defer file.Close()
+	return payload.Text, payload.Timestamp(), nil
+}
 
-	// 解码PNG图片
-	img, err := png.Decode(file)
+// AddWatermarkStream 添加水印到PNG数据流
+// 水印信封保存在IEND之前的iTXt块中，并合并到XMP数据包，
+// 其他数据块原样复制，图像数据和色彩配置等辅助块不会改变；只有绘制可见水印时才重新编码图像
+func (w *PNGWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	data, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
-		return fmt.Errorf("解码图片失败: %w", err)
+		return fmt.Errorf("读取图片文件失败: %w", err)
 	}
 
-	// 创建输出文件
-	output, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %w", err)
+	// 需要可见水印时绘制后重新编码，辅助块保留
+	if opts, ok := payload.OverlayOptions(); ok {
+		if data, err = renderOverlay(ctx, data, opts); err != nil {
+			return err
+		}
 	}
-	defer output.Close()
 
-	// 编码水印文本
-	encodedText := base64.StdEncoding.EncodeToString([]byte(watermarkText))
-
-	// 添加时间戳
-	timestamp := time.Now().Format(time.RFC3339)
-
-	// 创建水印元数据
-	metadata := fmt.Sprintf("%s%s|%s%s",
-		watermarkPrefix,
-		encodedText,
-		timestamp,
-		watermarkSuffix)
+	chunks, trailer, err := parseChunks(data)
+	if err != nil {
+		return err
+	}
 
-	// 在不影响图像质量的情况下将水印编码到PNG文件中
-	// 首先将图像编码到内存缓冲区
-	var pngBuffer bytes.Buffer
-	if err := png.Encode(&pngBuffer, img); err != nil {
-		return fmt.Errorf("编码图片失败: %w", err)
+	// 将水印载荷加密并封装为信封
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
 	}
 
-	// 获取PNG数据
-	pngData := pngBuffer.Bytes()
+	// 同时写入XMP数据包，已有XMP块时就地合并，否则按XMP规范放在IDAT之前
+	var packet []byte
+	existing := -1
+	for i, c := range chunks {
+		if isXMPChunk(c) {
+			_, text, err := decodeTextChunk(c)
+			if err != nil {
+				return err
+			}
+			packet, existing = []byte(text), i
+			break
+		}
+	}
+	merged, err := xmp.Merge(packet, watermark.XMPProperties(payload, armored))
+	if err != nil {
+		return err
+	}
+	xmpData := encodeITXt(xmpKeyword, string(merged))
 
-	// 创建输出缓冲区
-	var outputBuffer bytes.Buffer
+	output := make([]byte, 0, len(data)+len(armored)+len(xmpData)+64)
+	output = append(output, pngSignature...)
+	for i, c := range chunks {
+		switch {
+		case i == existing:
+			output = appendChunk(output, "iTXt", xmpData)
+			continue
+		case c.Type == "IDAT" && existing < 0:
+			output = appendChunk(output, "iTXt", xmpData)
+			existing = i
+		case c.Type == "IEND":
+			output = appendChunk(output, "iTXt", encodeITXt(chunkKeyword, armored))
+		}
+		output = append(output, c.Raw...)
+	}
+	output = append(output, trailer...)
 
-	// 写入PNG数据
-	outputBuffer.Write(pngData)
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
 
-	// 在文件末尾添加水印信息作为注释
-	outputBuffer.WriteString("\n")
-	outputBuffer.WriteString(metadata)
-	outputBuffer.WriteString("\n")
+	return nil
+}
 
-	// 写入最终数据到输出文件
-	_, err = output.Write(outputBuffer.Bytes())
+// renderOverlay 在PNG图片上绘制可见水印并重新编码，保留原文件中与编码方式无关的辅助块
+func renderOverlay(ctx context.Context, data []byte, opts overlay.Options) ([]byte, error) {
+	img, chunks, err := decodeData(ctx, data)
 	if err != nil {
-		return fmt.Errorf("写入输出文件失败: %w", err)
+		return nil, err
+	}
+	if err := overlay.Draw(img, opts); err != nil {
+		return nil, err
 	}
 
-	return nil
+	var buffer bytes.Buffer
+	if err := encodePixels(img, chunks, &buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
 }
 
-// ExtractWatermark 从PNG图片中提取水印
-func (w *PNGWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("输入文件不存在: %s", inputFile)
+// ExtractWatermarkStream 从PNG数据流中提取水印
+// 优先读取iTXt等文本块，其次读取XMP数据包，都没有时读取旧版本追加在IEND之后的水印
+func (w *PNGWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	// 读取图片数据
+	pngData, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
 	}
 
-	// 读取图片文件
-	pngData, err := os.ReadFile(inputFile)
+	chunks, trailer, err := parseChunks(pngData)
 	if err != nil {
-		return "", "", fmt.Errorf("读取图片文件失败: %w", err)
+		return nil, err
 	}
 
-	// 将二进制数据转换为字符串以便搜索水印标记
-	dataStr := string(pngData)
+	for _, c := range chunks {
+		if !isWatermarkChunk(c) {
+			continue
+		}
+		_, text, err := decodeTextChunk(c)
+		if err != nil {
+			return nil, err
+		}
+		return watermark.OpenPayload(text)
+	}
+
+	// 读取XMP数据包中的水印属性
+	for _, c := range chunks {
+		if !isXMPChunk(c) {
+			continue
+		}
+		_, text, err := decodeTextChunk(c)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := xmp.Envelope([]byte(text)); ok {
+			return watermark.OpenXMP([]byte(text))
+		}
+	}
 
+	return extractLegacy(string(trailer))
+}
+
+// extractLegacy 解析旧版本追加在IEND之后的水印
+func extractLegacy(dataStr string) (*watermark.Payload, error) {
 	// 查找水印信息
 	startIdx := strings.Index(dataStr, watermarkPrefix)
 	if startIdx == -1 {
-		return "", "", errors.New("未找到水印信息")
+		return nil, watermark.ErrNoWatermark
 	}
 
 	endIdx := strings.Index(dataStr[startIdx:], watermarkSuffix)
 	if endIdx == -1 {
-		return "", "", errors.New("水印信息格式无效")
+		return nil, errors.New("水印信息格式无效")
 	}
 
 	// 提取水印数据
 	watermarkData := dataStr[startIdx+len(watermarkPrefix) : startIdx+endIdx]
 
-	// 解析水印数据
+	// 解析水印信封
+	if envelope.IsArmored(watermarkData) {
+		return watermark.OpenPayload(watermarkData)
+	}
+
+	// 更早版本的格式：Base64编码的水印文本|时间戳
 	parts := strings.Split(watermarkData, "|")
 	if len(parts) < 2 {
-		return "", "", errors.New("水印数据格式无效")
+		return nil, errors.New("水印数据格式无效")
 	}
 
 	encodedText := parts[0]
@@ -148,8 +223,99 @@ func (w *PNGWatermarker) ExtractWatermark(inputFile string) (string, string, err
 	// 解码Base64编码的水印文本
 	decodedBytes, err := base64.StdEncoding.DecodeString(encodedText)
 	if err != nil {
-		return "", "", fmt.Errorf("解码水印信息失败: %w", err)
+		return nil, fmt.Errorf("解码水印信息失败: %w", err)
+	}
+
+	return watermark.DecodePayload(decodedBytes, timestamp), nil
+}
+
+// RemoveWatermark 移除PNG图片中的水印
+func (w *PNGWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), w, inputFile, outputFile)
+}
+
+// RemoveWatermarkStream 移除PNG数据流中的水印
+// 删除水印文本块、XMP水印属性和旧版本追加在IEND之后的水印，其他数据原样保留
+func (w *PNGWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取图片文件失败: %w", err)
+	}
+
+	chunks, trailer, err := parseChunks(data)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	output := make([]byte, 0, len(data))
+	output = append(output, pngSignature...)
+	for _, c := range chunks {
+		if isWatermarkChunk(c) {
+			count++
+			continue
+		}
+		if isXMPChunk(c) {
+			// 只删除XMP中的水印属性，数据包中没有其他属性时删除整个块
+			_, text, err := decodeTextChunk(c)
+			if err != nil {
+				return err
+			}
+			if rest, removed := xmp.Remove([]byte(text)); removed {
+				count++
+				if rest != nil {
+					output = appendChunk(output, "iTXt", encodeITXt(xmpKeyword, string(rest)))
+				}
+				continue
+			}
+		}
+		output = append(output, c.Raw...)
+	}
+
+	// 删除旧版本的水印标记
+	trailer, removed := watermark.CutMarkers(trailer, watermarkPrefix, watermarkSuffix)
+	count += removed
+	if count == 0 {
+		return watermark.ErrNoWatermark
+	}
+	output = append(output, trailer...)
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// LocateWatermarks 返回PNG数据流中水印文本块、XMP块和旧版本水印数据的偏移
+func (w *PNGWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+
+	chunks, trailer, err := parseChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for _, c := range chunks {
+		if isWatermarkChunk(c) {
+			locations = append(locations, fmt.Sprintf("%s@%d", c.Type, c.Offset))
+		}
+		if isXMPChunk(c) {
+			if _, text, err := decodeTextChunk(c); err == nil {
+				if _, ok := xmp.Envelope([]byte(text)); ok {
+					locations = append(locations, fmt.Sprintf("XMP@%d", c.Offset))
+				}
+			}
+		}
 	}
 
-	return string(decodedBytes), timestamp, nil
+	trailerOffset := int64(len(data) - len(trailer))
+	for _, offset := range watermark.FindMarkers(trailer, watermarkPrefix, watermarkSuffix) {
+		locations = append(locations, fmt.Sprintf("trailer@%d", trailerOffset+offset))
+	}
+	return locations, nil
 }
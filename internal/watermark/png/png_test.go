@@ -0,0 +1,268 @@
+package png
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// testPNG 生成带有gAMA和tEXt辅助块的PNG图片
+func testPNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	img.Set(1, 1, color.RGBA{R: 200, A: 255})
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatalf("编码测试图片失败: %v", err)
+	}
+
+	chunks, _, err := parseChunks(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("解析测试图片失败: %v", err)
+	}
+	output := append([]byte(nil), pngSignature...)
+	for _, c := range chunks {
+		output = append(output, c.Raw...)
+		if c.Type == "IHDR" {
+			output = appendChunk(output, "gAMA", []byte{0, 0, 0xB1, 0x8F})
+			output = appendChunk(output, "tEXt", []byte("Author\x00designer"))
+		}
+	}
+	return output
+}
+
+func TestPNGTextChunk(t *testing.T) {
+	ctx := context.Background()
+	w := NewPNGWatermarker()
+	data := testPNG(t)
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("设计稿")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	// 输出应是合法的PNG，辅助块保留，XMP块位于IDAT之前，水印块位于IEND之前
+	if _, err := png.Decode(bytes.NewReader(marked.Bytes())); err != nil {
+		t.Fatalf("解码带水印的图片失败: %v", err)
+	}
+	chunks, trailer, err := parseChunks(marked.Bytes())
+	if err != nil {
+		t.Fatalf("解析带水印的图片失败: %v", err)
+	}
+	var types []string
+	for _, c := range chunks {
+		types = append(types, c.Type)
+	}
+	want := []string{"IHDR", "gAMA", "tEXt", "iTXt", "IDAT", "iTXt", "IEND"}
+	if len(types) != len(want) || len(trailer) != 0 {
+		t.Fatalf("数据块为 %v，IEND之后有%d字节", types, len(trailer))
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("数据块为 %v，期望 %v", types, want)
+		}
+	}
+
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()))
+	if err != nil || payload.Text != "设计稿" {
+		t.Errorf("提取水印结果为 %v, %v", payload, err)
+	}
+}
+
+func TestPNGLegacyTrailer(t *testing.T) {
+	ctx := context.Background()
+	w := NewPNGWatermarker()
+	data := testPNG(t)
+
+	armored, err := watermark.SealPayload(watermark.NewPayload("旧水印"))
+	if err != nil {
+		t.Fatalf("封装水印失败: %v", err)
+	}
+	legacy := append(append([]byte(nil), data...), "\n"+watermarkPrefix+armored+watermarkSuffix+"\n"...)
+
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(legacy), int64(len(legacy)))
+	if err != nil || payload.Text != "旧水印" {
+		t.Errorf("提取旧版本水印结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(legacy), int64(len(legacy)), &stripped); err != nil {
+		t.Fatalf("移除旧版本水印失败: %v", err)
+	}
+	if !bytes.Equal(stripped.Bytes(), data) {
+		t.Error("移除旧版本水印后的文件与原文件不一致")
+	}
+}
+
+// photoPNG 生成有颜色渐变的图片，模拟设计稿
+func photoPNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 255})
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatalf("编码测试图片失败: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestPixelWatermark(t *testing.T) {
+	ctx := context.Background()
+	w := NewPixelWatermarker()
+	data := photoPNG(t, 300, 280)
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("设计稿")); err != nil {
+		t.Fatalf("添加像素水印失败: %v", err)
+	}
+
+	original, _ := png.Decode(bytes.NewReader(data))
+	watermarked, err := png.Decode(bytes.NewReader(marked.Bytes()))
+	if err != nil {
+		t.Fatalf("解码带水印的图片失败: %v", err)
+	}
+	for y := 0; y < 280; y++ {
+		for x := 0; x < 300; x++ {
+			r1, g1, b1, _ := original.At(x, y).RGBA()
+			r2, g2, b2, _ := watermarked.At(x, y).RGBA()
+			if diff(r1, r2) > 0x101 || diff(g1, g2) > 0x101 || diff(b1, b2) > 0x101 {
+				t.Fatalf("像素(%d,%d)的变化超过最低位", x, y)
+			}
+		}
+	}
+
+	// 模拟在编辑器中裁剪后另存为，元数据全部丢失，裁剪后只保留一个完整区块
+	cropped := image.NewNRGBA(image.Rect(0, 0, 240, 220))
+	for y := 0; y < 220; y++ {
+		for x := 0; x < 240; x++ {
+			cropped.Set(x, y, watermarked.At(x+37, y+53))
+		}
+	}
+	var resaved bytes.Buffer
+	if err := png.Encode(&resaved, cropped); err != nil {
+		t.Fatalf("编码裁剪后的图片失败: %v", err)
+	}
+
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(resaved.Bytes()), int64(resaved.Len()))
+	if err != nil || payload.Text != "设计稿" {
+		t.Fatalf("从裁剪后的图片提取水印结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()), &stripped); err != nil {
+		t.Fatalf("移除像素水印失败: %v", err)
+	}
+	if _, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+}
+
+func diff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestPNGXMPMerge(t *testing.T) {
+	ctx := context.Background()
+	w := NewPNGWatermarker()
+
+	// 在IHDR之后加入图片编辑软件写入的XMP数据包
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/"><xmp:CreatorTool>Editor</xmp:CreatorTool></rdf:Description></rdf:RDF></x:xmpmeta>`
+	chunks, _, _ := parseChunks(testPNG(t))
+	data := append([]byte(nil), pngSignature...)
+	for _, c := range chunks {
+		data = append(data, c.Raw...)
+		if c.Type == "IHDR" {
+			data = appendChunk(data, "iTXt", encodeITXt(xmpKeyword, packet))
+		}
+	}
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("设计稿")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	// 水印属性合并到原有的XMP块中，并且只删除水印文本块时仍可以从XMP中提取水印
+	chunks, _, _ = parseChunks(marked.Bytes())
+	xmpOnly := append([]byte(nil), pngSignature...)
+	xmpChunks := 0
+	for _, c := range chunks {
+		if isXMPChunk(c) {
+			xmpChunks++
+			if _, text, _ := decodeTextChunk(c); !bytes.Contains([]byte(text), []byte("Editor")) {
+				t.Error("XMP块中原有的属性丢失")
+			}
+		}
+		if !isWatermarkChunk(c) {
+			xmpOnly = append(xmpOnly, c.Raw...)
+		}
+	}
+	if xmpChunks != 1 {
+		t.Errorf("XMP块有%d个，期望1个", xmpChunks)
+	}
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(xmpOnly), int64(len(xmpOnly)))
+	if err != nil || payload.Text != "设计稿" {
+		t.Errorf("从XMP提取水印结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if !bytes.Equal(stripped.Bytes(), data) {
+		t.Error("移除水印后的文件与原文件不一致")
+	}
+}
+
+func TestPNGVisibleOverlay(t *testing.T) {
+	opts := overlay.DefaultOptions()
+	opts.Text = "DRAFT"
+	ctx := context.Background()
+	source := photoPNG(t, 300, 280)
+
+	// 两种嵌入方式都先绘制可见水印，再嵌入隐水印
+	for _, w := range []watermark.StreamWatermarker{NewPNGWatermarker(), NewPixelWatermarker()} {
+		var marked bytes.Buffer
+		payload := watermark.NewPayload("设计稿")
+		payload.Overlay = &opts
+		if err := w.AddWatermarkStream(ctx, bytes.NewReader(source), int64(len(source)), &marked, payload); err != nil {
+			t.Fatalf("添加可见水印失败: %v", err)
+		}
+
+		original, _ := png.Decode(bytes.NewReader(source))
+		rendered, err := png.Decode(bytes.NewReader(marked.Bytes()))
+		if err != nil {
+			t.Fatalf("解码带水印的图片失败: %v", err)
+		}
+		changed := false
+		for y := original.Bounds().Min.Y; y < original.Bounds().Max.Y && !changed; y++ {
+			for x := original.Bounds().Min.X; x < original.Bounds().Max.X; x++ {
+				r1, _, _, _ := original.At(x, y).RGBA()
+				r2, _, _, _ := rendered.At(x, y).RGBA()
+				if diff(r1, r2) > 0x101 {
+					changed = true
+					break
+				}
+			}
+		}
+		if !changed {
+			t.Errorf("%T 没有绘制可见水印", w)
+		}
+
+		payload, err = w.ExtractWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()))
+		if err != nil || payload.Text != "设计稿" {
+			t.Errorf("%T 提取水印结果为 %v, %v", w, payload, err)
+		}
+	}
+}
@@ -3,14 +3,15 @@ package pptx
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"regexp"
 	"strings"
-	"time"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
 )
 
 // PPTXWatermarker 实现PowerPoint文档的水印处理
@@ -23,217 +24,135 @@ func init() {
 
 // AddWatermark 为PowerPoint添加水印
 func (p *PPTXWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 创建临时目录
-	tempDir, err := os.MkdirTemp("", "pptx-watermark-*")
+	return watermark.AddWatermarkFile(context.Background(), p, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
+
+// ExtractWatermark 从PPTX文档中提取水印
+func (p *PPTXWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), p, inputFile)
 	if err != nil {
-		return fmt.Errorf("创建临时目录失败: %w", err)
+		return "", "", err
 	}
-	defer os.RemoveAll(tempDir)
+	return payload.Text, payload.Timestamp(), nil
+}
 
-	// 解压PPTX文件
-	err = unzipFile(inputFile, tempDir)
+// AddWatermarkStream 为PowerPoint数据流添加水印
+func (p *PPTXWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	// 水印载荷编码为Base64，避免破坏XML结构
+	encoded, err := encodeMarker(payload)
 	if err != nil {
-		return fmt.Errorf("解压PPTX文件失败: %w", err)
+		return err
 	}
 
-	// 添加水印到元数据
-	// 修改core.xml添加水印信息
-	corePropsPath := filepath.Join(tempDir, "docProps", "core.xml")
-	if _, err := os.Stat(corePropsPath); err == nil {
-		coreContent, err := os.ReadFile(corePropsPath)
-		if err == nil {
+	err = rewriteZip(ctx, src, size, dst, func(name string, content []byte) ([]byte, error) {
+		// 添加水印到元数据
+		if name == "docProps/core.xml" {
 			// 添加水印到关键词
-			modified := false
-			if bytes.Contains(coreContent, []byte("<cp:keywords>")) {
-				newContent := bytes.Replace(
-					coreContent,
+			if bytes.Contains(content, []byte("<cp:keywords>")) {
+				return bytes.Replace(
+					content,
 					[]byte("<cp:keywords>"),
-					[]byte(fmt.Sprintf("<cp:keywords>Watermark:%s ", watermarkText)),
-					1,
-				)
-				if !bytes.Equal(newContent, coreContent) {
-					coreContent = newContent
-					modified = true
-				}
-			} else if bytes.Contains(coreContent, []byte("</cp:coreProperties>")) {
-				// 如果没有关键词标签，添加一个
-				newContent := bytes.Replace(
-					coreContent,
-					[]byte("</cp:coreProperties>"),
-					[]byte(fmt.Sprintf("<cp:keywords>Watermark:%s</cp:keywords></cp:coreProperties>", watermarkText)),
+					[]byte(fmt.Sprintf("<cp:keywords>%s%s ", markerPrefix, encoded)),
 					1,
-				)
-				if !bytes.Equal(newContent, coreContent) {
-					coreContent = newContent
-					modified = true
-				}
-			}
-
-			if modified {
-				err = os.WriteFile(corePropsPath, coreContent, 0644)
-				if err != nil {
-					return fmt.Errorf("写入core.xml失败: %w", err)
-				}
+				), nil
 			}
+			// 如果没有关键词标签，添加一个
+			return bytes.Replace(
+				content,
+				[]byte("</cp:coreProperties>"),
+				[]byte(fmt.Sprintf("<cp:keywords>%s%s</cp:keywords></cp:coreProperties>", markerPrefix, encoded)),
+				1,
+			), nil
 		}
-	}
 
-	// 在每个幻灯片中添加水印
-	// 查找所有幻灯片文件
-	slidesDir := filepath.Join(tempDir, "ppt", "slides")
-	if _, err := os.Stat(slidesDir); err == nil {
-		files, err := os.ReadDir(slidesDir)
-		if err == nil {
-			for _, file := range files {
-				if !file.IsDir() && strings.HasPrefix(file.Name(), "slide") && strings.HasSuffix(file.Name(), ".xml") {
-					slidePath := filepath.Join(slidesDir, file.Name())
-
-					// 读取幻灯片内容
-					slideContent, err := os.ReadFile(slidePath)
-					if err != nil {
-						continue
-					}
-
-					// 在幻灯片末尾添加水印注释
-					watermarkComment := fmt.Sprintf("<!-- Watermark: %s -->", watermarkText)
-					if !bytes.Contains(slideContent, []byte(watermarkComment)) {
-						endTagPos := bytes.LastIndex(slideContent, []byte("</p:sld>"))
-						if endTagPos > 0 {
-							newContent := append(
-								slideContent[:endTagPos],
-								append(
-									[]byte(watermarkComment),
-									slideContent[endTagPos:]...,
-								)...,
-							)
-							err = os.WriteFile(slidePath, newContent, 0644)
-							if err != nil {
-								return fmt.Errorf("写入幻灯片水印失败: %w", err)
-							}
-						}
-					}
-				}
+		// 在每个幻灯片末尾添加水印注释
+		if isSlide(name) {
+			watermarkComment := fmt.Sprintf("<!-- %s %s -->", markerPrefix, encoded)
+			endTagPos := bytes.LastIndex(content, []byte("</p:sld>"))
+			if endTagPos > 0 {
+				newContent := make([]byte, 0, len(content)+len(watermarkComment))
+				newContent = append(newContent, content[:endTagPos]...)
+				newContent = append(newContent, watermarkComment...)
+				newContent = append(newContent, content[endTagPos:]...)
+				return newContent, nil
 			}
 		}
-	}
 
-	// 重新打包PPTX文件
-	err = zipDir(tempDir, outputFile)
+		return content, nil
+	})
 	if err != nil {
-		return fmt.Errorf("重新打包PPTX文件失败: %w", err)
+		return fmt.Errorf("处理PPTX文件失败: %w", err)
 	}
 
 	return nil
 }
 
-// ExtractWatermark 从PPTX文档中提取水印
-func (p *PPTXWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	// 创建临时目录
-	tempDir, err := os.MkdirTemp("", "pptx-extract-*")
+// ExtractWatermarkStream 从PPTX文档数据流中提取水印
+func (p *PPTXWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
-		return "", "", fmt.Errorf("创建临时目录失败: %w", err)
+		return nil, fmt.Errorf("解压PPTX文件失败: %w", err)
 	}
-	defer os.RemoveAll(tempDir)
 
-	// 解压PPTX文件
-	err = unzipFile(inputFile, tempDir)
-	if err != nil {
-		return "", "", fmt.Errorf("解压PPTX文件失败: %w", err)
+	// 首先检查文档属性
+	coreContent, err := readZipEntry(reader, "docProps/core.xml")
+	if err == nil {
+		if value, ok := findMarker(coreContent, []byte(markerPrefix), []byte("<"), []byte(" ")); ok {
+			return decodeMarker(value)
+		}
 	}
 
-	// 默认时间戳
-	timestamp := time.Now().Format(time.RFC3339)
+	// 如果在文档属性中没找到，查找演示文稿注释
+	// 遍历所有幻灯片
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !isSlide(file.Name) {
+			continue
+		}
 
-	// 首先检查文档属性
-	corePropsPath := filepath.Join(tempDir, "docProps", "core.xml")
-	if _, err := os.Stat(corePropsPath); err == nil {
-		coreContent, err := os.ReadFile(corePropsPath)
-		if err == nil {
-			// 查找时间戳信息
-			timeStampPrefix := "TimeStamp:"
-			if tsIdx := bytes.Index(coreContent, []byte(timeStampPrefix)); tsIdx > 0 {
-				tsStart := tsIdx + len(timeStampPrefix)
-				tsEnd := tsStart
-				for i := tsStart; i < len(coreContent) && i < tsStart+50; i++ {
-					if coreContent[i] == '<' || coreContent[i] == ' ' {
-						tsEnd = i
-						break
-					}
-				}
-				if tsEnd > tsStart {
-					timestamp = string(coreContent[tsStart:tsEnd])
-				}
-			}
+		slideContent, err := readZipEntry(reader, file.Name)
+		if err != nil {
+			continue
+		}
 
-			// 查找水印信息
-			watermarkPrefix := "Watermark:"
-			if idx := bytes.Index(coreContent, []byte(watermarkPrefix)); idx > 0 {
-				start := idx + len(watermarkPrefix)
-				end := start
-				for i := start; i < len(coreContent) && i < start+100; i++ {
-					if coreContent[i] == '<' || coreContent[i] == ' ' {
-						end = i
-						break
-					}
-				}
-				if end > start {
-					return string(coreContent[start:end]), timestamp, nil
-				}
-			}
+		// 查找水印标记
+		if value, ok := findMarker(slideContent, []byte("<!-- "+markerPrefix+" "), []byte(" -->")); ok {
+			return decodeMarker(value)
 		}
 	}
 
-	// 如果在文档属性中没找到，查找演示文稿注释
-	// 遍历所有幻灯片
-	slidesDir := filepath.Join(tempDir, "ppt", "slides")
-	if _, err := os.Stat(slidesDir); err == nil {
-		files, err := os.ReadDir(slidesDir)
-		if err == nil {
-			for _, file := range files {
-				if !file.IsDir() && strings.HasSuffix(file.Name(), ".xml") {
-					slidePath := filepath.Join(slidesDir, file.Name())
-					slideContent, err := os.ReadFile(slidePath)
-					if err != nil {
-						continue
-					}
-
-					// 查找时间戳标记
-					timeStampTagPrefix := "<!-- TimeStamp: "
-					if tsIdx := bytes.Index(slideContent, []byte(timeStampTagPrefix)); tsIdx > 0 {
-						tsStart := tsIdx + len(timeStampTagPrefix)
-						tsEnd := tsStart
-						for i := tsStart; i < len(slideContent) && i < tsStart+50; i++ {
-							if slideContent[i] == '-' && i+2 < len(slideContent) && slideContent[i+1] == '-' && slideContent[i+2] == '>' {
-								tsEnd = i
-								break
-							}
-						}
-						if tsEnd > tsStart {
-							timestamp = string(slideContent[tsStart:tsEnd])
-						}
-					}
-
-					// 查找水印标记
-					watermarkTagPrefix := "<!-- Watermark: "
-					if idx := bytes.Index(slideContent, []byte(watermarkTagPrefix)); idx > 0 {
-						start := idx + len(watermarkTagPrefix)
-						end := start
-						for i := start; i < len(slideContent) && i < start+100; i++ {
-							if slideContent[i] == '-' && i+2 < len(slideContent) && slideContent[i+1] == '-' && slideContent[i+2] == '>' {
-								end = i
-								break
-							}
-						}
-						if end > start {
-							return string(slideContent[start:end]), timestamp, nil
-						}
-					}
-				}
-			}
+	return nil, watermark.ErrNoWatermark
+}
+
+// RemoveWatermark 移除PowerPoint中的水印
+func (p *PPTXWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), p, inputFile, outputFile)
+}
+
+// RemoveWatermarkStream 删除PowerPoint数据流中文档属性和各幻灯片里的水印标记
+func (p *PPTXWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	found := false
+	err := rewriteZip(ctx, src, size, dst, func(name string, content []byte) ([]byte, error) {
+		var removed bool
+		switch {
+		case name == "docProps/core.xml":
+			content, removed = removeMarkers(content, keywordMarkerPattern)
+		case isSlide(name):
+			content, removed = removeMarkers(content, commentMarkerPattern)
 		}
+		found = found || removed
+		return content, nil
+	})
+	if err != nil {
+		return fmt.Errorf("处理PPTX文件失败: %w", err)
+	}
+	if !found {
+		return watermark.ErrNoWatermark
 	}
 
-	return "", "", fmt.Errorf("未找到水印信息")
+	return nil
 }
 
 // GetSupportedType 返回支持的文件类型
@@ -241,104 +160,167 @@ func (p *PPTXWatermarker) GetSupportedType() string {
 	return "pptx"
 }
 
-// unzipFile 解压文件到指定目录
-func unzipFile(zipFile, destDir string) error {
-	reader, err := zip.OpenReader(zipFile)
-	if err != nil {
-		return err
+// Capabilities 返回嵌入方式的能力
+func (p *PPTXWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入文档关键词和XML注释", Locate: true, Lossless: true}
+}
+
+// isSlide 判断ZIP中的文件是否为幻灯片
+func isSlide(name string) bool {
+	if !strings.HasPrefix(name, "ppt/slides/") {
+		return false
 	}
-	defer reader.Close()
+	base := strings.TrimPrefix(name, "ppt/slides/")
+	return !strings.Contains(base, "/") && strings.HasPrefix(base, "slide") && strings.HasSuffix(base, ".xml")
+}
 
-	for _, file := range reader.File {
-		path := filepath.Join(destDir, file.Name)
+// 水印标记前缀
+const markerPrefix = "Watermark:"
 
-		// 创建目录
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, 0755)
-			continue
-		}
+// encodeMarker 将水印载荷封装为可以直接写入XML的信封
+func encodeMarker(payload *watermark.Payload) (string, error) {
+	return watermark.SealPayload(payload)
+}
 
-		// 确保父目录存在
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return err
+// decodeMarker 解析水印标记
+// 旧版本的标记是Base64编码的JSON载荷，或者是未编码的水印文本，都没有签名
+func decodeMarker(value string) (*watermark.Payload, error) {
+	if envelope.IsArmored(value) {
+		return watermark.OpenPayload(value)
+	}
+	if data, err := base64.StdEncoding.DecodeString(value); err == nil && len(data) > 0 && data[0] == '{' {
+		if payload, err := watermark.UnmarshalPayload(data); err == nil {
+			payload.Verification = &watermark.Verification{Status: watermark.StatusUnsigned}
+			return payload, nil
 		}
+	}
+	return &watermark.Payload{Text: value, Verification: &watermark.Verification{Status: watermark.StatusUnsigned}}, nil
+}
 
-		// 解压文件
-		fileReader, err := file.Open()
-		if err != nil {
-			return err
+// 水印标记的正则表达式，与 findMarker 查找的范围一致
+var (
+	// keywordMarkerPattern 匹配文档属性关键词中的水印标记及其后的分隔空格
+	keywordMarkerPattern = regexp.MustCompile(regexp.QuoteMeta(markerPrefix) + `[^<\s]+ ?`)
+	// commentMarkerPattern 匹配文档内容中的水印注释
+	commentMarkerPattern = regexp.MustCompile(`(?s)<!-- ` + regexp.QuoteMeta(markerPrefix) + ` .*? -->`)
+)
+
+// removeMarkers 删除content中匹配pattern的水印标记，返回删除后的内容和是否删除了标记
+func removeMarkers(content []byte, pattern *regexp.Regexp) ([]byte, bool) {
+	if !pattern.Match(content) {
+		return content, false
+	}
+	return pattern.ReplaceAllLiteral(content, nil), true
+}
+
+// findMarker 查找prefix之后、最近的一个terminator之前的内容
+func findMarker(content, prefix []byte, terminators ...[]byte) (string, bool) {
+	idx := bytes.Index(content, prefix)
+	if idx < 0 {
+		return "", false
+	}
+
+	start := idx + len(prefix)
+	end := -1
+	for _, terminator := range terminators {
+		if i := bytes.Index(content[start:], terminator); i >= 0 && (end < 0 || i < end) {
+			end = i
 		}
+	}
+	if end <= 0 {
+		return "", false
+	}
 
-		targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			fileReader.Close()
-			return err
+	return string(content[start : start+end]), true
+}
+
+// readZipEntry 读取ZIP中指定文件的全部内容
+func readZipEntry(reader *zip.Reader, name string) ([]byte, error) {
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
 		}
 
-		_, err = io.Copy(targetFile, fileReader)
-		targetFile.Close()
-		fileReader.Close()
+		rc, err := file.Open()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		defer rc.Close()
+
+		return io.ReadAll(rc)
 	}
 
-	return nil
+	return nil, fmt.Errorf("未找到文件: %s", name)
 }
 
-// zipDir 压缩目录为ZIP文件
-func zipDir(sourceDir, zipFile string) error {
-	// 创建ZIP文件
-	file, err := os.Create(zipFile)
+// rewriteZip 逐个复制ZIP中的文件到dst，modify可以替换文件内容
+// 每处理一个文件检查一次ctx
+func rewriteZip(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, modify func(name string, content []byte) ([]byte, error)) error {
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	writer := zip.NewWriter(file)
-	defer writer.Close()
 
-	// 遍历源目录
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	writer := zip.NewWriter(dst)
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		// 获取相对路径
-		relPath, err := filepath.Rel(sourceDir, path)
+		rc, err := file.Open()
 		if err != nil {
 			return err
 		}
-
-		// 跳过根目录本身
-		if relPath == "." {
-			return nil
-		}
-
-		// 使用标准的路径分隔符
-		relPath = strings.ReplaceAll(relPath, "\\", "/")
-
-		// 处理目录
-		if info.IsDir() {
-			_, err = writer.Create(relPath + "/")
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
 			return err
 		}
 
-		// 处理文件
-		fileToZip, err := os.Open(path)
+		content, err = modify(file.Name, content)
 		if err != nil {
 			return err
 		}
-		defer fileToZip.Close()
 
-		// 创建ZIP内的文件
-		zipEntry, err := writer.Create(relPath)
+		header := file.FileHeader
+		entry, err := writer.CreateHeader(&header)
 		if err != nil {
 			return err
 		}
+		if _, err := entry.Write(content); err != nil {
+			return err
+		}
+	}
 
-		// 复制文件内容
-		_, err = io.Copy(zipEntry, fileToZip)
-		return err
-	})
+	return writer.Close()
+}
+
+// LocateWatermarks 返回PowerPoint数据流中包含水印标记的文件
+func (p *PPTXWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	reader, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, fmt.Errorf("解压PPTX文件失败: %w", err)
+	}
+
+	var locations []string
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var pattern *regexp.Regexp
+		switch {
+		case file.Name == "docProps/core.xml":
+			pattern = keywordMarkerPattern
+		case isSlide(file.Name):
+			pattern = commentMarkerPattern
+		default:
+			continue
+		}
+
+		if content, err := readZipEntry(reader, file.Name); err == nil && pattern.Match(content) {
+			locations = append(locations, file.Name)
+		}
+	}
+	return locations, nil
 }
@@ -0,0 +1,331 @@
+package watermark
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultMethod 只注册了一种嵌入方式的处理器使用的方式名称
+const DefaultMethod = "default"
+
+// ErrUnknownMethod 文件类型没有注册指定的嵌入方式
+var ErrUnknownMethod = errors.New("不支持的水印嵌入方式")
+
+// Capabilities 描述一种嵌入方式的能力
+type Capabilities struct {
+	// Description 嵌入方式的说明
+	Description string `json:"description,omitempty"`
+	// Locate 能否报告水印的嵌入位置，见 WatermarkLocator
+	Locate bool `json:"locate"`
+	// Lossless 添加和移除水印时是否保持文档内容不变，如图像不会被重新编码
+	Lossless bool `json:"lossless"`
+	// Robust 水印能否在格式转换、重新压缩或另存为之后保留
+	Robust bool `json:"robust"`
+	// Visible 添加水印时能否同时绘制可见水印，见 Payload.Overlay
+	Visible bool `json:"visible"`
+}
+
+// CapabilityDescriber 由能够描述自身能力的处理器实现
+type CapabilityDescriber interface {
+	Capabilities() Capabilities
+}
+
+// Strategy 描述为某种文件类型注册的一种水印嵌入方式
+type Strategy struct {
+	// FileType 文件类型
+	FileType string `json:"file_type"`
+	// Method 嵌入方式名称，如"metadata"、"pixel"，同一文件类型中唯一
+	Method string `json:"method"`
+	// Priority 优先级，未指定嵌入方式时使用优先级最高的方式添加水印
+	Priority int `json:"priority"`
+	// Capabilities 嵌入方式的能力
+	Capabilities Capabilities `json:"capabilities"`
+	// Watermarker 水印处理器
+	Watermarker StreamWatermarker `json:"-"`
+}
+
+// Registry 保存各文件类型的水印处理器和文件类型别名，可以并发使用
+// 每种文件类型可以注册多种嵌入方式，添加水印时使用优先级最高的方式或指定的方式，
+// 提取、检测和移除水印时会依次尝试所有方式
+type Registry struct {
+	mu         sync.RWMutex
+	aliases    map[string]string
+	strategies map[string][]*Strategy
+}
+
+// NewRegistry 创建一个空的注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		aliases:    make(map[string]string),
+		strategies: make(map[string][]*Strategy),
+	}
+}
+
+// DefaultRegistry 处理器在 init 中注册到的默认注册表
+var DefaultRegistry = newDefaultRegistry()
+
+// newDefaultRegistry 创建包含常用文件类型别名的注册表
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.RegisterAlias("jpeg", "jpg")
+	r.RegisterAlias("jpe", "jpg")
+	r.RegisterAlias("tif", "tiff")
+	return r
+}
+
+// RegisterAlias 注册文件类型的别名，如"jpeg"是"jpg"的别名
+func (r *Registry) RegisterAlias(alias, fileType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aliases[normalizeName(alias)] = normalizeName(fileType)
+}
+
+// Normalize 将扩展名或类型名转换为注册处理器时使用的类型名，如".JPEG"转换为"jpg"
+func (r *Registry) Normalize(fileType string) string {
+	fileType = normalizeName(fileType)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if alias, ok := r.aliases[fileType]; ok {
+		return alias
+	}
+	return fileType
+}
+
+// Register 注册一种嵌入方式，FileType为空时使用处理器支持的类型，Method为空时为 DefaultMethod
+// 未设置能力时从处理器获取，处理器没有实现 CapabilityDescriber 时根据实现的接口推断
+func (r *Registry) Register(strategy Strategy) error {
+	if strategy.Watermarker == nil {
+		return errors.New("水印处理器不能为空")
+	}
+	if strategy.FileType == "" {
+		strategy.FileType = strategy.Watermarker.GetSupportedType()
+	}
+	strategy.FileType = r.Normalize(strategy.FileType)
+	if strategy.Method == "" {
+		strategy.Method = DefaultMethod
+	}
+	if strategy.Capabilities == (Capabilities{}) {
+		strategy.Capabilities = capabilitiesOf(strategy.Watermarker)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	strategies := r.strategies[strategy.FileType]
+	for _, existing := range strategies {
+		if existing.Method == strategy.Method {
+			return fmt.Errorf("文件类型 %s 已注册嵌入方式 %s", strategy.FileType, strategy.Method)
+		}
+	}
+
+	// 按优先级从高到低排列，优先级相同时先注册的在前
+	strategies = append(strategies, &strategy)
+	sort.SliceStable(strategies, func(i, j int) bool {
+		return strategies[i].Priority > strategies[j].Priority
+	})
+	r.strategies[strategy.FileType] = strategies
+	return nil
+}
+
+// Lookup 返回文件类型的处理器
+// 添加水印时使用优先级最高的嵌入方式，提取、检测和移除水印时依次尝试所有嵌入方式
+func (r *Registry) Lookup(fileType string) (StreamWatermarker, bool) {
+	strategies := r.Strategies(fileType)
+	if len(strategies) == 0 {
+		return nil, false
+	}
+	return combine(strategies), true
+}
+
+// LookupMethod 返回使用指定嵌入方式添加水印的处理器，method为空时与 Lookup 相同
+// 提取、检测和移除水印时先尝试指定的方式，再依次尝试其他方式，
+// 因此替换水印时也会移除用其他方式嵌入的旧水印
+func (r *Registry) LookupMethod(fileType, method string) (StreamWatermarker, error) {
+	strategies := r.Strategies(fileType)
+	if len(strategies) == 0 {
+		return nil, fmt.Errorf("不支持的文件类型: %s", fileType)
+	}
+	if method == "" {
+		return combine(strategies), nil
+	}
+
+	for i, strategy := range strategies {
+		if strategy.Method == method {
+			// 将指定的方式移到最前面，其余方式保持优先级顺序
+			copy(strategies[1:i+1], strategies[:i])
+			strategies[0] = strategy
+			return combine(strategies), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s 不支持 %s", ErrUnknownMethod, strategies[0].FileType, method)
+}
+
+// Preferred 返回添加水印时使用的嵌入方式，method为空时为优先级最高的方式
+func (r *Registry) Preferred(fileType, method string) (Strategy, error) {
+	strategies := r.Strategies(fileType)
+	if len(strategies) == 0 {
+		return Strategy{}, fmt.Errorf("不支持的文件类型: %s", fileType)
+	}
+	if method == "" {
+		return strategies[0], nil
+	}
+	for _, strategy := range strategies {
+		if strategy.Method == method {
+			return strategy, nil
+		}
+	}
+	return Strategy{}, fmt.Errorf("%w: %s 不支持 %s", ErrUnknownMethod, strategies[0].FileType, method)
+}
+
+// Strategies 返回文件类型的所有嵌入方式，按优先级从高到低排列
+func (r *Registry) Strategies(fileType string) []Strategy {
+	fileType = r.Normalize(fileType)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	strategies := make([]Strategy, len(r.strategies[fileType]))
+	for i, strategy := range r.strategies[fileType] {
+		strategies[i] = *strategy
+	}
+	return strategies
+}
+
+// Types 返回所有已注册的文件类型，按名称排序
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.strategies))
+	for fileType := range r.strategies {
+		types = append(types, fileType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// normalizeName 统一类型名的大小写，并去掉扩展名前的点号
+func normalizeName(fileType string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(fileType), "."))
+}
+
+// capabilitiesOf 返回处理器的能力
+func capabilitiesOf(w StreamWatermarker) Capabilities {
+	if describer, ok := w.(CapabilityDescriber); ok {
+		return describer.Capabilities()
+	}
+	_, locate := w.(WatermarkLocator)
+	return Capabilities{Locate: locate}
+}
+
+// combine 组合多种嵌入方式，只有一种方式时直接返回其处理器
+func combine(strategies []Strategy) StreamWatermarker {
+	if len(strategies) == 1 {
+		return strategies[0].Watermarker
+	}
+
+	watermarkers := make([]StreamWatermarker, len(strategies))
+	for i, strategy := range strategies {
+		watermarkers[i] = strategy.Watermarker
+	}
+	return &multiWatermarker{fileType: strategies[0].FileType, watermarkers: watermarkers}
+}
+
+// multiWatermarker 组合同一文件类型的多种嵌入方式，第一个处理器用于添加水印
+type multiWatermarker struct {
+	fileType     string
+	watermarkers []StreamWatermarker
+}
+
+// GetSupportedType 获取支持的文件类型
+func (m *multiWatermarker) GetSupportedType() string {
+	return m.fileType
+}
+
+// AddWatermarkStream 使用第一种嵌入方式添加水印
+func (m *multiWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *Payload) error {
+	return m.watermarkers[0].AddWatermarkStream(ctx, src, size, dst, payload)
+}
+
+// ExtractWatermarkStream 依次尝试各嵌入方式，返回第一个找到的水印
+func (m *multiWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*Payload, error) {
+	var firstErr error
+	for _, w := range m.watermarkers {
+		payload, err := w.ExtractWatermarkStream(ctx, src, size)
+		if err == nil {
+			return payload, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		// 找到了但无法读取的水印比没有水印更有参考价值
+		if firstErr == nil || errors.Is(firstErr, ErrNoWatermark) {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// RemoveWatermarkStream 依次使用各嵌入方式移除水印，任意一种方式找到水印即为成功
+func (m *multiWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	data, err := ReadAll(ctx, src, size)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, w := range m.watermarkers {
+		var output bytes.Buffer
+		err := w.RemoveWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &output)
+		if errors.Is(err, ErrNoWatermark) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		data = output.Bytes()
+		found = true
+	}
+	if !found {
+		return ErrNoWatermark
+	}
+
+	if _, err := dst.Write(data); err != nil {
+		return fmt.Errorf("写入输出数据失败: %w", err)
+	}
+	return nil
+}
+
+// WithPassword 返回各嵌入方式都使用password打开加密文档的处理器
+func (m *multiWatermarker) WithPassword(password string) StreamWatermarker {
+	watermarkers := make([]StreamWatermarker, len(m.watermarkers))
+	for i, w := range m.watermarkers {
+		watermarkers[i] = WithPassword(w, password)
+	}
+	return &multiWatermarker{fileType: m.fileType, watermarkers: watermarkers}
+}
+
+// LocateWatermarks 返回各嵌入方式找到的水印位置
+func (m *multiWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	var locations []string
+	var firstErr error
+	for _, w := range m.watermarkers {
+		locator, ok := w.(WatermarkLocator)
+		if !ok {
+			continue
+		}
+		found, err := locator.LocateWatermarks(ctx, src, size)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		locations = append(locations, found...)
+	}
+	return locations, firstErr
+}
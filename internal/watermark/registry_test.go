@@ -0,0 +1,150 @@
+package watermark
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeWatermarker 在数据末尾追加带标签的标记，用于测试注册表
+type fakeWatermarker struct {
+	tag string
+}
+
+func (f *fakeWatermarker) GetSupportedType() string {
+	return "fake"
+}
+
+func (f *fakeWatermarker) marker() []byte {
+	return []byte("[" + f.tag + "]")
+}
+
+func (f *fakeWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *Payload) error {
+	data, err := ReadAll(ctx, src, size)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(append(data, f.marker()...))
+	return err
+}
+
+func (f *fakeWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*Payload, error) {
+	data, err := ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, f.marker()) {
+		return nil, ErrNoWatermark
+	}
+	return NewPayload(f.tag), nil
+}
+
+func (f *fakeWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	data, err := ReadAll(ctx, src, size)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(data, f.marker()) {
+		return ErrNoWatermark
+	}
+	_, err = dst.Write(bytes.ReplaceAll(data, f.marker(), nil))
+	return err
+}
+
+func TestRegistryStrategies(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterAlias("fk", "fake")
+	for _, strategy := range []Strategy{
+		{Method: "metadata", Priority: 10, Watermarker: &fakeWatermarker{tag: "metadata"}},
+		{Method: "pixel", Priority: 20, Watermarker: &fakeWatermarker{tag: "pixel"}},
+	} {
+		if err := r.Register(strategy); err != nil {
+			t.Fatalf("注册 %s 失败: %v", strategy.Method, err)
+		}
+	}
+	if err := r.Register(Strategy{Method: "pixel", Watermarker: &fakeWatermarker{tag: "pixel"}}); err == nil {
+		t.Error("重复注册同一嵌入方式时应返回错误")
+	}
+
+	strategies := r.Strategies(".FK")
+	if len(strategies) != 2 || strategies[0].Method != "pixel" || strategies[1].Method != "metadata" {
+		t.Fatalf("嵌入方式未按优先级排列: %+v", strategies)
+	}
+
+	ctx := context.Background()
+	src := []byte("document")
+
+	// 未指定方式时使用优先级最高的方式添加，指定方式时使用指定的方式
+	for method, want := range map[string]string{"": "pixel", "metadata": "metadata"} {
+		w, err := r.LookupMethod("fk", method)
+		if err != nil {
+			t.Fatalf("获取嵌入方式 %q 失败: %v", method, err)
+		}
+		var output bytes.Buffer
+		if err := w.AddWatermarkStream(ctx, bytes.NewReader(src), int64(len(src)), &output, NewPayload("x")); err != nil {
+			t.Fatalf("添加水印失败: %v", err)
+		}
+		if got := output.String(); got != "document["+want+"]" {
+			t.Errorf("嵌入方式 %q 的输出为 %q", method, got)
+		}
+	}
+	if _, err := r.LookupMethod("fake", "dct"); !errors.Is(err, ErrUnknownMethod) {
+		t.Errorf("期望返回 ErrUnknownMethod，实际为: %v", err)
+	}
+
+	// 提取和移除水印时尝试所有方式
+	w, _ := r.Lookup("fake")
+	marked := []byte("document[metadata][pixel]")
+	payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(marked), int64(len(marked)))
+	if err != nil || payload.Text != "pixel" {
+		t.Errorf("提取水印结果为 %v, %v", payload, err)
+	}
+	var output bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(marked), int64(len(marked)), &output); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if output.String() != "document" {
+		t.Errorf("移除水印后为 %q", output.String())
+	}
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(src), int64(len(src)), io.Discard); !errors.Is(err, ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+}
+
+func TestRegistryConcurrentAccess(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			method := fmt.Sprintf("m%d", i)
+			if err := r.Register(Strategy{Method: method, Priority: i, Watermarker: &fakeWatermarker{tag: method}}); err != nil {
+				t.Errorf("注册 %s 失败: %v", method, err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			r.Lookup("fake")
+			r.Types()
+		}()
+	}
+	wg.Wait()
+
+	strategies := r.Strategies("fake")
+	if len(strategies) != 8 || strategies[0].Method != "m7" {
+		t.Errorf("并发注册后的嵌入方式不正确: %+v", strategies)
+	}
+}
+
+func TestDefaultRegistryAliases(t *testing.T) {
+	for alias, want := range map[string]string{".JPEG": "jpg", "jpe": "jpg", "tif": "tiff", "pdf": "pdf"} {
+		if got := NormalizeType(alias); got != want {
+			t.Errorf("NormalizeType(%q) = %q，期望 %q", alias, got, want)
+		}
+	}
+}
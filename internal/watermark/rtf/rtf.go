@@ -2,19 +2,14 @@ package rtf
 
 import (
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
+	"context"
 	"crypto/md5"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
 	"regexp"
-	"time"
 
 	"watermark-tool/internal/watermark"
 )
@@ -36,15 +31,37 @@ func (w *RTFWatermarker) GetSupportedType() string {
 	return "rtf"
 }
 
+// Capabilities 返回嵌入方式的能力
+func (w *RTFWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入隐藏的RTF组", Locate: true, Lossless: true}
+}
+
+// 水印组的正则表达式
+var (
+	// envelopePattern 匹配 {\*\watermark-envelope 信封} 形式的水印组
+	envelopePattern = regexp.MustCompile(`\{\\\*\\watermark-envelope ([A-Za-z0-9+/=]+)\}`)
+	// legacyPattern 匹配旧版本的水印组
+	legacyPattern = regexp.MustCompile(`\{\\\*\\watermark-data timestamp="(\d+)" checksum="([a-f0-9]+)"\\watermark-content ([A-Za-z0-9+/=]+)\\watermark-end\}`)
+)
+
 // AddWatermark 添加水印到RTF文档
 func (w *RTFWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("输入文件不存在: %s", inputFile)
+	return watermark.AddWatermarkFile(context.Background(), w, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
+
+// ExtractWatermark 从RTF文档中提取水印
+func (w *RTFWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), w, inputFile)
+	if err != nil {
+		return "", "", err
 	}
+	return payload.Text, payload.Timestamp(), nil
+}
 
-	// 读取RTF文件内容
-	fileContent, err := ioutil.ReadFile(inputFile)
+// AddWatermarkStream 添加水印到RTF数据流
+func (w *RTFWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	// 读取RTF内容
+	fileContent, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
 		return fmt.Errorf("读取RTF文件失败: %w", err)
 	}
@@ -55,7 +72,7 @@ func (w *RTFWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 	}
 
 	// 准备水印数据
-	watermarkData, err := prepareWatermarkData(watermarkText)
+	watermarkData, err := prepareWatermarkData(payload)
 	if err != nil {
 		return fmt.Errorf("准备水印数据失败: %w", err)
 	}
@@ -68,7 +85,7 @@ func (w *RTFWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 	if match != nil {
 		// 在info块之后插入我们的水印注释
 		insertPos := match[1]
-		modifiedContent = make([]byte, len(fileContent)+len(watermarkData)+2)
+		modifiedContent = make([]byte, len(fileContent)+len(watermarkData))
 		copy(modifiedContent, fileContent[:insertPos])
 		copy(modifiedContent[insertPos:], []byte(watermarkData))
 		copy(modifiedContent[insertPos+len(watermarkData):], fileContent[insertPos:])
@@ -83,45 +100,43 @@ func (w *RTFWatermarker) AddWatermark(inputFile, outputFile, watermarkText strin
 			headerEnd = len("{\\rtf1")
 		}
 
-		modifiedContent = make([]byte, len(fileContent)+len(watermarkData)+2)
+		modifiedContent = make([]byte, len(fileContent)+len(watermarkData))
 		copy(modifiedContent, fileContent[:headerEnd])
 		copy(modifiedContent[headerEnd:], []byte(watermarkData))
 		copy(modifiedContent[headerEnd+len(watermarkData):], fileContent[headerEnd:])
 	}
 
-	// 写入修改后的内容到输出文件
-	err = ioutil.WriteFile(outputFile, modifiedContent, 0644)
-	if err != nil {
+	// 写入修改后的内容
+	if _, err := dst.Write(modifiedContent); err != nil {
 		return fmt.Errorf("写入输出文件失败: %w", err)
 	}
 
 	return nil
 }
 
-// ExtractWatermark 从RTF文档中提取水印
-func (w *RTFWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return "", "", fmt.Errorf("输入文件不存在: %s", inputFile)
-	}
-
-	// 读取RTF文件内容
-	fileContent, err := ioutil.ReadFile(inputFile)
+// ExtractWatermarkStream 从RTF数据流中提取水印
+func (w *RTFWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	// 读取RTF内容
+	fileContent, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
-		return "", "", fmt.Errorf("读取RTF文件失败: %w", err)
+		return nil, fmt.Errorf("读取RTF文件失败: %w", err)
 	}
 
 	// 验证RTF格式
 	if !bytes.HasPrefix(fileContent, []byte("{\\rtf1")) {
-		return "", "", errors.New("无效的RTF文件格式")
+		return nil, errors.New("无效的RTF文件格式")
 	}
 
-	// 查找水印数据
-	re := regexp.MustCompile(`\{\\*\\watermark-data timestamp="(\d+)" checksum="([a-f0-9]+)"\\watermark-content ([A-Za-z0-9+/=]+)\\watermark-end\}`)
-	matches := re.FindSubmatch(fileContent)
+	// 查找水印信封
+	if matches := envelopePattern.FindSubmatch(fileContent); matches != nil {
+		return watermark.OpenPayload(string(matches[1]))
+	}
+
+	// 查找旧版本的水印数据
+	matches := legacyPattern.FindSubmatch(fileContent)
 
 	if matches == nil || len(matches) < 4 {
-		return "", "", errors.New("未找到水印数据")
+		return nil, watermark.ErrNoWatermark
 	}
 
 	// 获取时间戳、校验和和加密的水印内容
@@ -130,111 +145,78 @@ func (w *RTFWatermarker) ExtractWatermark(inputFile string) (string, string, err
 	encryptedContent := string(matches[3])
 
 	// 解密水印内容
-	watermarkText, err := decryptWatermark(encryptedContent)
+	decrypted, err := decryptWatermark(encryptedContent)
 	if err != nil {
-		return "", "", fmt.Errorf("解密水印失败: %w", err)
+		return nil, fmt.Errorf("解密水印失败: %w", err)
 	}
 
 	// 验证校验和
-	if generateChecksum(watermarkText) != checksum {
-		return "", "", errors.New("水印校验和不匹配，文件可能被篡改")
+	if generateChecksum(decrypted) != checksum {
+		return nil, errors.New("水印校验和不匹配，文件可能被篡改")
 	}
 
 	// 验证时间戳（可选，此处仅确保它是有效的Unix时间戳）
 	_, err = fmt.Sscanf(timestamp, "%d", new(int64))
 	if err != nil {
-		return "", "", errors.New("水印时间戳无效")
+		return nil, errors.New("水印时间戳无效")
 	}
 
-	return watermarkText, timestamp, nil
+	return watermark.DecodePayload([]byte(decrypted), timestamp), nil
 }
 
-// prepareWatermarkData 准备用于插入RTF文档的水印数据
-func prepareWatermarkData(watermarkText string) (string, error) {
-	// 加密水印文本
-	encryptedText, err := encryptWatermark(watermarkText)
-	if err != nil {
-		return "", err
-	}
-
-	// 生成校验和
-	checksum := generateChecksum(watermarkText)
-
-	// 格式化为RTF注释格式
-	// 在RTF中，{\\*\\注释内容}表示特殊字段或隐藏内容
-	return fmt.Sprintf("{\\*\\watermark-data timestamp=\"%d\" checksum=\"%s\"\\watermark-content %s\\watermark-end}",
-		time.Now().Unix(),
-		checksum,
-		encryptedText), nil
+// RemoveWatermark 移除RTF文档中的水印
+func (w *RTFWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), w, inputFile, outputFile)
 }
 
-// 加密水印文本
-func encryptWatermark(text string) (string, error) {
-	// 定义密钥（实际应用中应从安全来源获取）
-	key := []byte("watermark-security-key-for-encryption")
-	plaintext := []byte(text)
-
-	// 创建一个新的AES加密块
-	block, err := aes.NewCipher(key)
+// RemoveWatermarkStream 移除RTF数据流中的水印组，包括旧版本的水印组
+func (w *RTFWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	// 读取RTF内容
+	fileContent, err := watermark.ReadAll(ctx, src, size)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("读取RTF文件失败: %w", err)
 	}
 
-	// 创建一个新的GCM模式
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+	// 验证RTF格式
+	if !bytes.HasPrefix(fileContent, []byte("{\\rtf1")) {
+		return errors.New("无效的RTF文件格式")
 	}
 
-	// 创建随机数作为nonce
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+	if !envelopePattern.Match(fileContent) && !legacyPattern.Match(fileContent) {
+		return watermark.ErrNoWatermark
 	}
+	fileContent = envelopePattern.ReplaceAllLiteral(fileContent, nil)
+	fileContent = legacyPattern.ReplaceAllLiteral(fileContent, nil)
 
-	// 加密数据
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
+	// 写入修改后的内容
+	if _, err := dst.Write(fileContent); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
 
-	// 将结果编码为base64字符串
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return nil
 }
 
-// 解密水印文本
-func decryptWatermark(encryptedText string) (string, error) {
-	// 定义密钥（必须与加密时使用的相同）
-	key := []byte("watermark-security-key-for-encryption")
-
-	// 解码base64字符串
-	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
+// prepareWatermarkData 准备用于插入RTF文档的水印数据
+func prepareWatermarkData(payload *watermark.Payload) (string, error) {
+	// 将水印载荷加密并封装为信封
+	armored, err := watermark.SealPayload(payload)
 	if err != nil {
 		return "", err
 	}
 
-	// 创建一个新的AES加密块
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
+	// 格式化为RTF注释格式
+	// 在RTF中，{\\*\\注释内容}表示特殊字段或隐藏内容
+	return fmt.Sprintf("{\\*\\watermark-envelope %s}", armored), nil
+}
 
-	// 创建一个新的GCM模式
-	aesGCM, err := cipher.NewGCM(block)
+// decryptWatermark 使用旧版本的内置密钥解密Base64编码的水印文本
+func decryptWatermark(encryptedText string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("base64解码失败: %w", err)
 	}
 
-	// 获取nonce大小
-	nonceSize := aesGCM.NonceSize()
-
-	// 检查密文长度
-	if len(ciphertext) < nonceSize {
-		return "", errors.New("密文长度不足")
-	}
-
-	// 提取nonce和实际密文
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-
-	// 解密数据
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := watermark.DecryptLegacy(ciphertext)
 	if err != nil {
 		return "", err
 	}
@@ -248,3 +230,20 @@ func generateChecksum(text string) string {
 	hasher.Write([]byte(text))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
+
+// LocateWatermarks 返回RTF数据流中水印组的偏移
+func (w *RTFWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	fileContent, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取RTF文件失败: %w", err)
+	}
+
+	var locations []string
+	for _, match := range envelopePattern.FindAllIndex(fileContent, -1) {
+		locations = append(locations, fmt.Sprintf("group@%d", match[0]))
+	}
+	for _, match := range legacyPattern.FindAllIndex(fileContent, -1) {
+		locations = append(locations, fmt.Sprintf("legacy-group@%d", match[0]))
+	}
+	return locations, nil
+}
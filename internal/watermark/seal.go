@@ -0,0 +1,158 @@
+package watermark
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"watermark-tool/internal/watermark/envelope"
+	"watermark-tool/internal/watermark/keys"
+)
+
+// SealPayload 序列化载荷，使用当前密钥加密、签名并封装为Armor形式的信封
+// 当前密钥没有独立的签名密钥时只计算MAC
+func SealPayload(payload *Payload) (string, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	provider := GetKeyProvider()
+	keyID := provider.ActiveKeyID()
+
+	ciphertext, err := provider.Encrypt(keyID, data)
+	if err != nil {
+		return "", fmt.Errorf("加密水印失败: %w", err)
+	}
+
+	env := envelope.New(ciphertext)
+	env.KeyID = keyID
+	env.Flags |= envelope.FlagEncrypted
+	err = env.Sign(signFunc(provider, keyID))
+	if errors.Is(err, keys.ErrNoSigningKey) {
+		err = env.Seal(macFunc(provider, keyID))
+	}
+	if err != nil {
+		return "", fmt.Errorf("签名水印失败: %w", err)
+	}
+
+	return env.Armor()
+}
+
+// ErrUnreadableWatermark 找到了水印信封但无法解析、校验或解密，如信封损坏或使用了未知的密钥
+// OpenPayload 返回的其他错误都可以用 errors.Is 判断为该错误，错误信息仍为具体原因
+var ErrUnreadableWatermark = errors.New("水印无法读取")
+
+// unreadableError 保留具体原因的错误信息，同时匹配 ErrUnreadableWatermark
+type unreadableError struct {
+	err error
+}
+
+func (e *unreadableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unreadableError) Unwrap() []error {
+	return []error{e.err, ErrUnreadableWatermark}
+}
+
+// OpenPayload 解析Armor形式的信封，使用信封中记录的密钥校验并解密载荷
+// 签名或MAC无效但载荷仍可解密时，返回校验结果为伪造的载荷，由调用方决定如何处理；
+// 签名无效且无法解密时返回 ErrForgedWatermark；只有签名公钥时返回 *SealedError，
+// 其中包含签名的校验结果；其他无法读取的情况返回 ErrUnreadableWatermark
+func OpenPayload(armored string) (*Payload, error) {
+	payload, err := openPayload(armored)
+	if err != nil && !errors.Is(err, ErrForgedWatermark) {
+		return nil, &unreadableError{err: err}
+	}
+	return payload, err
+}
+
+// openPayload 实现 OpenPayload，返回未包装的错误
+func openPayload(armored string) (*Payload, error) {
+	env, err := envelope.Dearmor(armored)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := GetKeyProvider()
+	verification, err := verifyEnvelope(provider, env)
+	if err != nil {
+		return nil, err
+	}
+
+	data := env.Payload
+	if env.Flags.Has(envelope.FlagEncrypted) {
+		if data, err = provider.Decrypt(env.KeyID, data); err != nil {
+			if verification.Forged() {
+				return nil, ErrForgedWatermark
+			}
+			if verification.Authentic() && errors.Is(err, keys.ErrUnknownKey) {
+				return nil, &SealedError{Verification: verification}
+			}
+			return nil, fmt.Errorf("解密水印失败: %w", err)
+		}
+	}
+
+	payload, err := UnmarshalPayload(data)
+	if err != nil {
+		return nil, err
+	}
+	payload.Verification = verification
+	return payload, nil
+}
+
+// verifyEnvelope 校验信封的签名或MAC
+// 使用公开的内置密钥签名的水印任何人都可以生成，校验通过也只视为未签名
+func verifyEnvelope(provider keys.KeyProvider, env *envelope.Envelope) (*Verification, error) {
+	verification := &Verification{KeyID: env.KeyID}
+
+	var err error
+	switch {
+	case env.Flags.Has(envelope.FlagSigned):
+		verification.Algorithm = AlgorithmEd25519
+		var publicKey ed25519.PublicKey
+		if publicKey, err = provider.PublicKey(env.KeyID); err != nil {
+			return nil, err
+		}
+		err = env.VerifySignature(func(data, signature []byte) error {
+			if !ed25519.Verify(publicKey, data, signature) {
+				return envelope.ErrMACMismatch
+			}
+			return nil
+		})
+	case env.Flags.Has(envelope.FlagKeyedMAC):
+		verification.Algorithm = AlgorithmHMACSHA256
+		err = env.Verify(macFunc(provider, env.KeyID))
+	default:
+		verification.Algorithm = AlgorithmSHA256
+		err = env.Verify(nil)
+	}
+
+	switch {
+	case errors.Is(err, envelope.ErrMACMismatch):
+		verification.Status = StatusForged
+	case err != nil:
+		return nil, err
+	case verification.Algorithm == AlgorithmSHA256 || env.KeyID == keys.LegacyKeyID:
+		verification.Status = StatusUnsigned
+	default:
+		verification.Status = StatusAuthentic
+	}
+
+	return verification, nil
+}
+
+// signFunc 返回使用指定密钥签名的函数
+func signFunc(provider keys.KeyProvider, keyID string) envelope.MACFunc {
+	return func(data []byte) ([]byte, error) {
+		return provider.Sign(keyID, data)
+	}
+}
+
+// macFunc 返回使用指定密钥计算MAC的函数
+func macFunc(provider keys.KeyProvider, keyID string) envelope.MACFunc {
+	return func(data []byte) ([]byte, error) {
+		return provider.MAC(keyID, data)
+	}
+}
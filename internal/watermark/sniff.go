@@ -0,0 +1,172 @@
+package watermark
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrUnknownType 无法根据文件内容识别文件类型
+var ErrUnknownType = errors.New("无法识别文件类型")
+
+// 识别文件类型时读取的文件头长度，PDF允许文件头之前有少量其他数据
+const sniffLength = 1024
+
+// 文件头标记
+var (
+	pdfMagic  = []byte("%PDF-")
+	pngMagic  = []byte("\x89PNG\r\n\x1a\n")
+	jpegMagic = []byte{0xFF, 0xD8, 0xFF}
+	gifMagic  = [][]byte{[]byte("GIF87a"), []byte("GIF89a")}
+	tiffMagic = [][]byte{[]byte("II\x2a\x00"), []byte("MM\x00\x2a"), []byte("II\x2b\x00"), []byte("MM\x00\x2b")} // 包括BigTIFF
+	bmpMagic  = []byte("BM")
+	svgMagic  = []byte("<svg")
+	rtfMagic  = []byte("{\\rtf")
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// OOXML主文档的内容类型，用于区分docx、xlsx和pptx
+var ooxmlContentTypes = []struct {
+	contentType string
+	fileType    string
+	mainPart    string
+}{
+	{"wordprocessingml.document.main+xml", "docx", "word/document.xml"},
+	{"spreadsheetml.sheet.main+xml", "xlsx", "xl/workbook.xml"},
+	{"presentationml.presentation.main+xml", "pptx", "ppt/presentation.xml"},
+}
+
+// ODF的mimetype与文件类型的对应关系
+var odfMimeTypes = map[string]string{
+	"application/vnd.oasis.opendocument.text": "odt",
+}
+
+// NormalizeType 将扩展名或类型名转换为注册处理器时使用的类型名，如".JPEG"转换为"jpg"
+// 别名在 DefaultRegistry 中注册
+func NormalizeType(fileType string) string {
+	return DefaultRegistry.Normalize(fileType)
+}
+
+// DetectType 根据文件头和容器内容识别文件类型
+// ZIP容器会进一步检查ODF的mimetype和OOXML的[Content_Types].xml
+func DetectType(src io.ReaderAt, size int64) (string, error) {
+	header := make([]byte, sniffLength)
+	n, err := src.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, pngMagic):
+		return "png", nil
+	case bytes.HasPrefix(header, jpegMagic):
+		return "jpg", nil
+	case hasAnyPrefix(header, gifMagic):
+		return "gif", nil
+	case hasAnyPrefix(header, tiffMagic):
+		return "tiff", nil
+	case isBMP(header, size):
+		return "bmp", nil
+	case bytes.HasPrefix(header, rtfMagic):
+		return "rtf", nil
+	case bytes.HasPrefix(header, zipMagic):
+		return detectZipType(src, size)
+	case bytes.Contains(header, pdfMagic):
+		return "pdf", nil
+	case isSVG(header):
+		return "svg", nil
+	}
+
+	return "", ErrUnknownType
+}
+
+// detectZipType 识别ZIP容器中的文档类型
+func detectZipType(src io.ReaderAt, size int64) (string, error) {
+	reader, err := zip.NewReader(src, size)
+	if err != nil {
+		return "", ErrUnknownType
+	}
+
+	names := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		names[file.Name] = file
+	}
+
+	// ODF文档的第一个文件为未压缩的mimetype
+	if file, ok := names["mimetype"]; ok {
+		content, err := readZipFile(file)
+		if err == nil {
+			if fileType, ok := odfMimeTypes[strings.TrimSpace(string(content))]; ok {
+				return fileType, nil
+			}
+		}
+		return "", ErrUnknownType
+	}
+
+	// OOXML文档根据主文档的内容类型识别，缺少内容类型声明时根据主文档路径识别
+	if file, ok := names["[Content_Types].xml"]; ok {
+		content, err := readZipFile(file)
+		if err == nil {
+			for _, t := range ooxmlContentTypes {
+				if bytes.Contains(content, []byte(t.contentType)) {
+					return t.fileType, nil
+				}
+			}
+		}
+		for _, t := range ooxmlContentTypes {
+			if _, ok := names[t.mainPart]; ok {
+				return t.fileType, nil
+			}
+		}
+	}
+
+	return "", ErrUnknownType
+}
+
+// readZipFile 读取ZIP中的文件内容，最多读取sniffLength*64字节
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(io.LimitReader(rc, sniffLength*64))
+}
+
+// hasAnyPrefix 判断data是否以prefixes中的任意一个开头
+func hasAnyPrefix(data []byte, prefixes [][]byte) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// BMP信息头的长度，依次为 BITMAPCOREHEADER、BITMAPINFOHEADER、V2、V3、V4和V5信息头
+var bmpHeaderSizes = map[uint32]bool{12: true, 40: true, 52: true, 56: true, 108: true, 124: true}
+
+// isBMP 判断文件头是否为BMP文件：以"BM"开头，信息头长度有效，文件头中记录的文件长度不超过实际长度
+// 只检查"BM"会把以这两个字母开头的文本文件误认为BMP
+func isBMP(header []byte, size int64) bool {
+	if len(header) < 18 || !bytes.HasPrefix(header, bmpMagic) {
+		return false
+	}
+	headerSize := binary.LittleEndian.Uint32(header[14:])
+	fileSize := int64(binary.LittleEndian.Uint32(header[2:]))
+	return bmpHeaderSizes[headerSize] && fileSize >= 14+int64(headerSize) && fileSize <= size
+}
+
+// isSVG 判断文件头是否为SVG文档：以XML声明、注释或元素开头，并在前面的内容中出现svg元素（可以带命名空间前缀）
+func isSVG(header []byte) bool {
+	header = bytes.TrimLeft(bytes.TrimPrefix(header, []byte("\uFEFF")), " \t\r\n")
+	if !bytes.HasPrefix(header, []byte("<")) {
+		return false
+	}
+	return bytes.Contains(header, svgMagic) || bytes.Contains(header, []byte(":svg "))
+}
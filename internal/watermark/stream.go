@@ -0,0 +1,304 @@
+package watermark
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 流式读写时每次处理的块大小（1MB），每处理完一块检查一次ctx
+const chunkSize = 1 << 20
+
+// ReadAll 从src中读取全部内容，每读取一块检查一次ctx
+func ReadAll(ctx context.Context, src io.ReaderAt, size int64) ([]byte, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("无效的文件大小: %d", size)
+	}
+
+	data := make([]byte, size)
+	for offset := int64(0); offset < size; offset += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		end := offset + chunkSize
+		if end > size {
+			end = size
+		}
+
+		n, err := src.ReadAt(data[offset:end], offset)
+		if err != nil && !(err == io.EOF && int64(n) == end-offset) {
+			return nil, fmt.Errorf("读取数据失败: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+// Copy 将src中的数据复制到dst，每复制一块检查一次ctx
+func Copy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buffer := make([]byte, 32*1024)
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, err := src.Read(buffer)
+		if n > 0 {
+			m, writeErr := dst.Write(buffer[:n])
+			written += int64(m)
+			if writeErr != nil {
+				return written, writeErr
+			}
+			if m != n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// AddWatermarkFile 使用流式处理器为文件添加水印
+// 结果先写入输出目录下的临时文件，成功后再重命名为outputFile，
+// 因此处理失败或被取消时不会留下不完整的输出文件
+func AddWatermarkFile(ctx context.Context, w StreamWatermarker, inputFile, outputFile string, payload *Payload) error {
+	return transformFile(inputFile, outputFile, func(src io.ReaderAt, size int64, dst io.Writer) error {
+		return w.AddWatermarkStream(ctx, src, size, dst, payload)
+	})
+}
+
+// RemoveWatermarkFile 使用流式处理器移除文件中的水印，输出方式与 AddWatermarkFile 相同
+func RemoveWatermarkFile(ctx context.Context, w StreamWatermarker, inputFile, outputFile string) error {
+	return transformFile(inputFile, outputFile, func(src io.ReaderAt, size int64, dst io.Writer) error {
+		return w.RemoveWatermarkStream(ctx, src, size, dst)
+	})
+}
+
+// transformFile 读取inputFile，经transform处理后写入outputFile
+func transformFile(inputFile, outputFile string, transform func(src io.ReaderAt, size int64, dst io.Writer) error) error {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("打开输入文件失败: %w", err)
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return fmt.Errorf("读取文件信息失败: %w", err)
+	}
+
+	output, err := os.CreateTemp(filepath.Dir(outputFile), ".watermark-*")
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %w", err)
+	}
+	tempPath := output.Name()
+	defer os.Remove(tempPath)
+
+	if err := transform(input, info.Size(), output); err != nil {
+		output.Close()
+		return err
+	}
+
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+
+	if err := os.Chmod(tempPath, 0644); err != nil {
+		return fmt.Errorf("设置输出文件权限失败: %w", err)
+	}
+
+	if err := os.Rename(tempPath, outputFile); err != nil {
+		return fmt.Errorf("保存输出文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// ExtractWatermarkFile 使用流式处理器从文件中提取水印
+func ExtractWatermarkFile(ctx context.Context, w StreamWatermarker, inputFile string) (*Payload, error) {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("打开输入文件失败: %w", err)
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件信息失败: %w", err)
+	}
+
+	return w.ExtractWatermarkStream(ctx, input, info.Size())
+}
+
+// legacyAdapter 将基于文件路径的 Watermarker 包装为 StreamWatermarker
+type legacyAdapter struct {
+	w Watermarker
+}
+
+// NewLegacyAdapter 将只实现了旧接口的处理器包装为流式处理器
+// 输入会先写入临时文件再交给旧处理器，旧处理器本身无法被中途取消，
+// 适配器只能在调用前后检查ctx，因此处理器应尽快迁移到 StreamWatermarker。
+// 旧接口只能嵌入水印文本，载荷中的其他字段会被忽略
+func NewLegacyAdapter(w Watermarker) StreamWatermarker {
+	return &legacyAdapter{w: w}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (a *legacyAdapter) GetSupportedType() string {
+	return a.w.GetSupportedType()
+}
+
+// AddWatermarkStream 通过临时文件调用旧处理器添加水印
+func (a *legacyAdapter) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *Payload) error {
+	tempDir, err := os.MkdirTemp("", "watermark-legacy-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputFile := filepath.Join(tempDir, "input."+a.w.GetSupportedType())
+	outputFile := filepath.Join(tempDir, "output."+a.w.GetSupportedType())
+
+	if err := writeTempFile(ctx, inputFile, src, size); err != nil {
+		return err
+	}
+
+	if err := a.w.AddWatermark(inputFile, outputFile, payload.Text); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	output, err := os.Open(outputFile)
+	if err != nil {
+		return fmt.Errorf("打开输出文件失败: %w", err)
+	}
+	defer output.Close()
+
+	if _, err := Copy(ctx, dst, output); err != nil {
+		return fmt.Errorf("写入输出数据失败: %w", err)
+	}
+
+	return nil
+}
+
+// ExtractWatermarkStream 通过临时文件调用旧处理器提取水印
+func (a *legacyAdapter) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*Payload, error) {
+	tempDir, err := os.MkdirTemp("", "watermark-legacy-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputFile := filepath.Join(tempDir, "input."+a.w.GetSupportedType())
+	if err := writeTempFile(ctx, inputFile, src, size); err != nil {
+		return nil, err
+	}
+
+	text, timestamp, err := a.w.ExtractWatermark(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return DecodePayload([]byte(text), timestamp), nil
+}
+
+// RemoveWatermarkStream 通过临时文件调用旧处理器移除水印
+func (a *legacyAdapter) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	tempDir, err := os.MkdirTemp("", "watermark-legacy-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputFile := filepath.Join(tempDir, "input."+a.w.GetSupportedType())
+	outputFile := filepath.Join(tempDir, "output."+a.w.GetSupportedType())
+
+	if err := writeTempFile(ctx, inputFile, src, size); err != nil {
+		return err
+	}
+
+	if err := a.w.RemoveWatermark(inputFile, outputFile); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	output, err := os.Open(outputFile)
+	if err != nil {
+		return fmt.Errorf("打开输出文件失败: %w", err)
+	}
+	defer output.Close()
+
+	if _, err := Copy(ctx, dst, output); err != nil {
+		return fmt.Errorf("写入输出数据失败: %w", err)
+	}
+
+	return nil
+}
+
+// writeTempFile 将src中的数据写入临时文件
+func writeTempFile(ctx context.Context, path string, src io.ReaderAt, size int64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+
+	_, err = Copy(ctx, file, io.NewSectionReader(src, 0, size))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// CutMarkers 删除data中所有以prefix开始、以suffix结束的文本标记，
+// 标记前后由添加水印时插入的换行符也会一起删除。返回删除后的数据和删除的标记数量
+func CutMarkers(data []byte, prefix, suffix string) ([]byte, int) {
+	var output []byte
+	count := 0
+	for {
+		start := bytes.Index(data, []byte(prefix))
+		if start < 0 {
+			break
+		}
+		end := bytes.Index(data[start:], []byte(suffix))
+		if end < 0 {
+			break
+		}
+		end += start + len(suffix)
+
+		if start > 0 && data[start-1] == '\n' {
+			start--
+		}
+		if end < len(data) && data[end] == '\n' {
+			end++
+		}
+
+		output = append(output, data[:start]...)
+		data = data[end:]
+		count++
+	}
+
+	if count == 0 {
+		return data, 0
+	}
+	return append(output, data...), count
+}
@@ -0,0 +1,221 @@
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"watermark-tool/internal/watermark/xmp"
+)
+
+// svgNamespace SVG的命名空间
+const svgNamespace = "http://www.w3.org/2000/svg"
+
+// 本工具写入的元素的名称和标识
+const (
+	envelopeElement = "Envelope" // metadata中保存信封的元素，位于 xmp.Namespace 命名空间
+	envelopeAttr    = "envelope" // 可见水印分组上保存信封的属性，位于 xmp.Namespace 命名空间
+	metadataID      = "watermark-tool-metadata"
+	overlayID       = "watermark-tool-overlay"
+	patternID       = "watermark-tool-pattern"
+)
+
+// 水印所在的位置
+const (
+	locationMetadata = "metadata"
+	locationOverlay  = "overlay"
+)
+
+// mark 文档中本工具写入的元素，[start, end)为删除水印时要删除的字节范围
+type mark struct {
+	location string
+	start    int
+	end      int
+	envelope string
+}
+
+// element 文档中一个元素的位置
+type element struct {
+	start        int // 开始标签的起始位置
+	contentStart int // 开始标签之后的位置
+	contentEnd   int // 结束标签的起始位置
+	end          int // 结束标签之后的位置
+	id           string
+}
+
+// document 解析后的SVG文档，只记录位置，原文的字节不会被重写
+type document struct {
+	data []byte
+	// prefix 根元素的命名空间前缀，如"svg:"，新加入的SVG元素使用相同的前缀
+	prefix string
+	root   element
+	// viewBox 根元素的viewBox，没有时由宽高得到，都没有时为nil
+	viewBox []float64
+	// metadata 根元素下的第一个非空metadata元素
+	metadata *element
+	marks    []mark
+}
+
+// parseDocument 使用XML解析器解析SVG文档，记录根元素、metadata和本工具写入的元素的位置
+func parseDocument(data []byte) (*document, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Entity = xml.HTMLEntity
+
+	doc := &document{data: data}
+	var stack []*element
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析SVG文件失败: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			offset := int(decoder.InputOffset())
+			if len(stack) == 0 {
+				if doc.root.contentStart != 0 || t.Name.Local != "svg" || t.Name.Space != svgNamespace {
+					return nil, errors.New("不是有效的SVG文件")
+				}
+				if bytes.HasSuffix(data[start:offset], []byte("/>")) {
+					return nil, errors.New("SVG文件没有内容")
+				}
+				doc.root = element{start: start, contentStart: offset}
+				doc.prefix = elementPrefix(data[start:offset])
+				doc.viewBox = parseViewBox(t.Attr)
+			}
+
+			// 本工具写入的元素整体跳过，其中的内容不再解析
+			if t.Name.Space == xmp.Namespace && t.Name.Local == envelopeElement {
+				var envelope string
+				if err := decoder.DecodeElement(&envelope, &t); err != nil {
+					return nil, fmt.Errorf("解析SVG水印失败: %w", err)
+				}
+				doc.marks = append(doc.marks, mark{location: locationMetadata, start: start, end: int(decoder.InputOffset()), envelope: strings.TrimSpace(envelope)})
+				continue
+			}
+			if envelope, ok := attr(t.Attr, xmp.Namespace, envelopeAttr); ok && len(stack) > 0 {
+				if err := decoder.Skip(); err != nil {
+					return nil, fmt.Errorf("解析SVG水印失败: %w", err)
+				}
+				doc.marks = append(doc.marks, mark{location: locationOverlay, start: start, end: int(decoder.InputOffset()), envelope: envelope})
+				continue
+			}
+
+			e := &element{start: start, contentStart: offset}
+			e.id, _ = attr(t.Attr, "", "id")
+			if len(stack) == 1 && doc.metadata == nil && t.Name.Local == "metadata" && t.Name.Space == svgNamespace &&
+				!bytes.HasSuffix(data[start:offset], []byte("/>")) {
+				doc.metadata = e
+			}
+			stack = append(stack, e)
+
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			e.contentEnd, e.end = start, int(decoder.InputOffset())
+			if len(stack) == 0 {
+				doc.root = *e
+			}
+		}
+	}
+
+	if doc.root.contentStart == 0 {
+		return nil, errors.New("不是有效的SVG文件")
+	}
+	return doc, nil
+}
+
+// elementPrefix 返回开始标签中元素名的命名空间前缀，包括冒号
+func elementPrefix(tag []byte) string {
+	name := tag[1:]
+	if end := bytes.IndexAny(name, " \t\r\n/>"); end >= 0 {
+		name = name[:end]
+	}
+	if colon := bytes.IndexByte(name, ':'); colon >= 0 {
+		return string(name[:colon+1])
+	}
+	return ""
+}
+
+// attr 返回指定命名空间和名称的属性值
+func attr(attrs []xml.Attr, space, local string) (string, bool) {
+	for _, a := range attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// parseViewBox 返回根元素的viewBox，没有viewBox时使用以像素为单位的宽高
+func parseViewBox(attrs []xml.Attr) []float64 {
+	if value, ok := attr(attrs, "", "viewBox"); ok {
+		fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n' })
+		if len(fields) == 4 {
+			box := make([]float64, 4)
+			for i, field := range fields {
+				v, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return nil
+				}
+				box[i] = v
+			}
+			if box[2] > 0 && box[3] > 0 {
+				return box
+			}
+		}
+		return nil
+	}
+
+	width, _ := attr(attrs, "", "width")
+	height, _ := attr(attrs, "", "height")
+	w, err1 := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(width), "px"), 64)
+	h, err2 := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(height), "px"), 64)
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return nil
+	}
+	return []float64{0, 0, w, h}
+}
+
+// removeMarks 删除本工具写入的所有元素，只剩下本工具创建的空metadata元素时一并删除
+func (d *document) removeMarks() []byte {
+	ranges := make([][2]int, 0, len(d.marks)+1)
+	for _, m := range d.marks {
+		ranges = append(ranges, [2]int{m.start, m.end})
+	}
+
+	if m := d.metadata; m != nil && m.id == metadataID {
+		rest := 0
+		for _, r := range ranges {
+			if r[0] >= m.contentStart && r[1] <= m.contentEnd {
+				rest += r[1] - r[0]
+			}
+		}
+		if len(bytes.TrimSpace(d.data[m.contentStart:m.contentEnd])) == rest {
+			ranges = append(ranges, [2]int{m.start, m.end})
+		}
+	}
+
+	output := make([]byte, 0, len(d.data))
+	position := 0
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0] || ranges[i][0] == ranges[j][0] && ranges[i][1] > ranges[j][1]
+	})
+	for _, r := range ranges {
+		if r[0] < position {
+			continue // 包含在已删除的metadata中
+		}
+		output = append(output, d.data[position:r[0]]...)
+		position = r[1]
+	}
+	return append(output, d.data[position:]...)
+}
@@ -0,0 +1,305 @@
+// Package svg 提供SVG矢量图的水印处理
+// 水印写入 metadata 元素，可选叠加由 text 图案平铺的可见水印。
+// 文档使用XML解析器定位插入和删除的位置，新元素由XML编码器生成，原文的其他字节保持不变，
+// 不会像重新序列化整个文档那样改写命名空间前缀、属性顺序或viewBox。
+package svg
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/overlay"
+	"watermark-tool/internal/watermark/xmp"
+)
+
+func init() {
+	watermark.RegisterStreamWatermarker(NewSVGWatermarker())
+}
+
+// SVGWatermarker 提供对SVG矢量图的水印操作
+type SVGWatermarker struct{}
+
+// NewSVGWatermarker 创建一个新的SVG水印处理器
+func NewSVGWatermarker() *SVGWatermarker {
+	return &SVGWatermarker{}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (w *SVGWatermarker) GetSupportedType() string {
+	return "svg"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (w *SVGWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入metadata元素，可选叠加平铺的text可见水印", Locate: true, Lossless: true, Visible: true}
+}
+
+// AddWatermarkStream 添加水印到SVG数据流
+// 信封写入根元素下的metadata元素，没有时在根元素开头创建；要求绘制可见水印时在根元素末尾加入可见水印分组，
+// 分组上同样保存信封，清理工具删除metadata后仍可提取。已有的水印先被删除
+func (w *SVGWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取SVG文件失败: %w", err)
+	}
+	doc, err := parseDocument(data)
+	if err != nil {
+		return err
+	}
+	if len(doc.marks) > 0 {
+		if doc, err = parseDocument(doc.removeMarks()); err != nil {
+			return err
+		}
+	}
+
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	var overlayGroup []byte
+	if opts, ok := payload.OverlayOptions(); ok {
+		if overlayGroup, err = doc.overlay(opts, armored); err != nil {
+			return err
+		}
+	}
+
+	var metadata []byte
+	position := doc.root.contentStart
+	if doc.metadata != nil {
+		position = doc.metadata.contentStart
+		metadata, err = encodeElements(func(e *xml.Encoder) error { return writeEnvelope(e, armored) })
+	} else {
+		metadata, err = encodeElements(func(e *xml.Encoder) error {
+			name := xml.Name{Local: doc.prefix + "metadata"}
+			if err := e.EncodeToken(xml.StartElement{Name: name, Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: metadataID}}}); err != nil {
+				return err
+			}
+			if err := writeEnvelope(e, armored); err != nil {
+				return err
+			}
+			return e.EncodeToken(xml.EndElement{Name: name})
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	output := make([]byte, 0, len(doc.data)+len(metadata)+len(overlayGroup))
+	output = append(output, doc.data[:position]...)
+	output = append(output, metadata...)
+	output = append(output, doc.data[position:doc.root.contentEnd]...)
+	output = append(output, overlayGroup...)
+	output = append(output, doc.data[doc.root.contentEnd:]...)
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// ExtractWatermarkStream 从SVG数据流中提取水印，优先读取metadata，其次读取可见水印分组
+func (w *SVGWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取SVG文件失败: %w", err)
+	}
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, location := range []string{locationMetadata, locationOverlay} {
+		for _, m := range doc.marks {
+			if m.location == location {
+				return watermark.OpenPayload(m.envelope)
+			}
+		}
+	}
+	return nil, watermark.ErrNoWatermark
+}
+
+// RemoveWatermarkStream 删除SVG数据流中的水印元素和可见水印，其他内容原样保留
+func (w *SVGWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取SVG文件失败: %w", err)
+	}
+	doc, err := parseDocument(data)
+	if err != nil {
+		return err
+	}
+	if len(doc.marks) == 0 {
+		return watermark.ErrNoWatermark
+	}
+
+	if _, err := dst.Write(doc.removeMarks()); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// LocateWatermarks 返回水印元素的位置和偏移
+func (w *SVGWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取SVG文件失败: %w", err)
+	}
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for _, m := range doc.marks {
+		locations = append(locations, fmt.Sprintf("%s@%d", m.location, m.start))
+	}
+	return locations, nil
+}
+
+// encodeElements 使用XML编码器生成要插入的元素，文本和属性值都会被正确转义
+func encodeElements(write func(e *xml.Encoder) error) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := xml.NewEncoder(&buffer)
+	if err := write(encoder); err != nil {
+		return nil, fmt.Errorf("生成SVG元素失败: %w", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, fmt.Errorf("生成SVG元素失败: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeEnvelope 写入保存信封的元素，元素自己声明命名空间，不依赖文档中已有的声明
+func writeEnvelope(e *xml.Encoder, armored string) error {
+	name := xml.Name{Local: "wmt:" + envelopeElement}
+	start := xml.StartElement{Name: name, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:wmt"}, Value: xmp.Namespace}}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := e.EncodeToken(xml.CharData(armored)); err != nil {
+		return err
+	}
+	return e.EncodeToken(xml.EndElement{Name: name})
+}
+
+// overlay 生成可见水印分组：用text图案平铺覆盖整个viewBox的矩形，图案按水印角度绕画面中心旋转，
+// 相邻两行错开半个水印，与图片的可见水印效果相同
+func (d *document) overlay(opts overlay.Options, armored string) ([]byte, error) {
+	if opts.Logo != nil {
+		return nil, fmt.Errorf("%w: SVG不支持标志图片", overlay.ErrInvalidOptions)
+	}
+	if opts.Layout != "" && opts.Layout != overlay.LayoutTile {
+		return nil, fmt.Errorf("%w: SVG只支持平铺的可见水印", overlay.ErrInvalidOptions)
+	}
+	if err := opts.ValidateVector(); err != nil {
+		return nil, err
+	}
+
+	// 没有viewBox和宽高时矩形覆盖整个视口，字号使用默认值
+	x, y, width, height := "0", "0", "100%", "100%"
+	fontSize, centerX, centerY := opts.FontSize, 0.0, 0.0
+	if box := d.viewBox; box != nil {
+		x, y, width, height = number(box[0]), number(box[1]), number(box[2]), number(box[3])
+		if fontSize == 0 {
+			fontSize = math.Max(math.Min(box[2], box[3])/16, 1)
+		}
+		centerX, centerY = box[0]+box[2]/2, box[1]+box[3]/2
+	}
+	if fontSize == 0 {
+		fontSize = 24
+	}
+	spacing := opts.Spacing
+	if spacing == 0 {
+		spacing = fontSize * 2
+	}
+	tileWidth := textWidth(opts.Text, fontSize) + spacing
+	tileHeight := (fontSize + spacing) * 2
+
+	color := fmt.Sprintf("#%02X%02X%02X", opts.Color.R, opts.Color.G, opts.Color.B)
+	textAttrs := func(tx, ty float64) []xml.Attr {
+		return []xml.Attr{
+			{Name: xml.Name{Local: "x"}, Value: number(tx)},
+			{Name: xml.Name{Local: "y"}, Value: number(ty)},
+			{Name: xml.Name{Local: "font-size"}, Value: number(fontSize)},
+			{Name: xml.Name{Local: "font-family"}, Value: "sans-serif"},
+			{Name: xml.Name{Local: "text-anchor"}, Value: "middle"},
+			{Name: xml.Name{Local: "dominant-baseline"}, Value: "central"},
+			{Name: xml.Name{Local: "fill"}, Value: color},
+			{Name: xml.Name{Local: "fill-opacity"}, Value: number(opts.Opacity)},
+		}
+	}
+	// 第一行居中，第二行在图案左右边缘各放一个，拼接后错开半个水印
+	texts := [][2]float64{{tileWidth / 2, tileHeight / 4}, {0, tileHeight * 3 / 4}, {tileWidth, tileHeight * 3 / 4}}
+
+	p := d.prefix
+	return encodeElements(func(e *xml.Encoder) error {
+		tokens := []xml.Token{
+			xml.StartElement{Name: xml.Name{Local: p + "g"}, Attr: []xml.Attr{
+				{Name: xml.Name{Local: "id"}, Value: overlayID},
+				{Name: xml.Name{Local: "xmlns:wmt"}, Value: xmp.Namespace},
+				{Name: xml.Name{Local: "wmt:" + envelopeAttr}, Value: armored},
+				{Name: xml.Name{Local: "pointer-events"}, Value: "none"},
+			}},
+			xml.StartElement{Name: xml.Name{Local: p + "defs"}},
+			xml.StartElement{Name: xml.Name{Local: p + "pattern"}, Attr: []xml.Attr{
+				{Name: xml.Name{Local: "id"}, Value: patternID},
+				{Name: xml.Name{Local: "patternUnits"}, Value: "userSpaceOnUse"},
+				{Name: xml.Name{Local: "x"}, Value: number(centerX)},
+				{Name: xml.Name{Local: "y"}, Value: number(centerY)},
+				{Name: xml.Name{Local: "width"}, Value: number(tileWidth)},
+				{Name: xml.Name{Local: "height"}, Value: number(tileHeight)},
+				{Name: xml.Name{Local: "patternTransform"}, Value: fmt.Sprintf("rotate(%s %s %s)", number(opts.Angle), number(centerX), number(centerY))},
+			}},
+		}
+		for _, t := range texts {
+			name := xml.Name{Local: p + "text"}
+			tokens = append(tokens, xml.StartElement{Name: name, Attr: textAttrs(t[0], t[1])}, xml.CharData(opts.Text), xml.EndElement{Name: name})
+		}
+		tokens = append(tokens,
+			xml.EndElement{Name: xml.Name{Local: p + "pattern"}},
+			xml.EndElement{Name: xml.Name{Local: p + "defs"}},
+			xml.StartElement{Name: xml.Name{Local: p + "rect"}, Attr: []xml.Attr{
+				{Name: xml.Name{Local: "x"}, Value: x},
+				{Name: xml.Name{Local: "y"}, Value: y},
+				{Name: xml.Name{Local: "width"}, Value: width},
+				{Name: xml.Name{Local: "height"}, Value: height},
+				{Name: xml.Name{Local: "fill"}, Value: "url(#" + patternID + ")"},
+			}},
+			xml.EndElement{Name: xml.Name{Local: p + "rect"}},
+			xml.EndElement{Name: xml.Name{Local: p + "g"}},
+		)
+		for _, token := range tokens {
+			if err := e.EncodeToken(token); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// textWidth 估算文本的宽度，全角字符按一个字号计算，其他字符按0.6个字号计算
+func textWidth(text string, fontSize float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hangul, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || r >= 0xFF00 && r <= 0xFFEF {
+			width += fontSize
+		} else {
+			width += fontSize * 0.6
+		}
+	}
+	return width
+}
+
+// number 格式化坐标，保留两位小数并去掉多余的0
+func number(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
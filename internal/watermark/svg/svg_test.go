@@ -0,0 +1,169 @@
+package svg
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// testSVG 带有XML声明、注释、已有metadata和非默认前缀命名空间的SVG
+const testSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- 产品架构图 -->
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="-10 -10 420 300" width="840" height="600">
+  <metadata><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"/></metadata>
+  <rect x="0" y="0" width="400" height="280" fill="#eef"/>
+  <text x="200" y="140" text-anchor="middle">A &amp; B</text>
+</svg>
+`
+
+// addWatermark 添加水印，opts不为nil时同时绘制可见水印
+func addWatermark(t *testing.T, ctx context.Context, data []byte, text string, opts *overlay.Options) []byte {
+	t.Helper()
+	var output bytes.Buffer
+	payload := watermark.NewPayload(text)
+	payload.Overlay = opts
+	if err := NewSVGWatermarker().AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &output, payload); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+	return output.Bytes()
+}
+
+// checkWellFormed 检查文档是格式正确的XML，并返回根元素的viewBox
+func checkWellFormed(t *testing.T, data []byte) string {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	viewBox := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return viewBox
+		}
+		if err != nil {
+			t.Fatalf("文档不是格式正确的XML: %v\n%s", err, data)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "svg" {
+			viewBox, _ = attr(start.Attr, "", "viewBox")
+		}
+	}
+}
+
+func TestSVGMetadata(t *testing.T) {
+	ctx := context.Background()
+	w := NewSVGWatermarker()
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"已有metadata", testSVG},
+		{"没有metadata", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><circle r="5"/></svg>`},
+		{"带前缀", `<svg:svg xmlns:svg="http://www.w3.org/2000/svg" width="20" height="10"><svg:circle r="5"/></svg:svg>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			marked := addWatermark(t, ctx, data, "内部 <资料> & 草稿", nil)
+			if checkWellFormed(t, marked) != checkWellFormed(t, data) {
+				t.Error("viewBox被修改")
+			}
+			// 新建的metadata使用根元素的前缀
+			if tt.name == "带前缀" && !bytes.Contains(marked, []byte(`<svg:metadata id="`+metadataID+`">`)) {
+				t.Errorf("新建的metadata没有使用根元素的前缀:\n%s", marked)
+			}
+
+			payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(marked), int64(len(marked)))
+			if err != nil || payload.Text != "内部 <资料> & 草稿" {
+				t.Fatalf("提取水印结果为 %v, %v", payload, err)
+			}
+			if locations, err := w.LocateWatermarks(ctx, bytes.NewReader(marked), int64(len(marked))); err != nil ||
+				len(locations) != 1 || !strings.HasPrefix(locations[0], "metadata@") {
+				t.Errorf("水印位置为 %v, %v", locations, err)
+			}
+
+			// 重复添加时替换原来的水印
+			remarked := addWatermark(t, ctx, marked, "第二次", nil)
+			if locations, _ := w.LocateWatermarks(ctx, bytes.NewReader(remarked), int64(len(remarked))); len(locations) != 1 {
+				t.Errorf("重复添加后水印位置为 %v", locations)
+			}
+
+			var stripped bytes.Buffer
+			if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(remarked), int64(len(remarked)), &stripped); err != nil {
+				t.Fatalf("移除水印失败: %v", err)
+			}
+			if stripped.String() != tt.data {
+				t.Errorf("移除水印后的文件与原文件不一致:\n%s", stripped.String())
+			}
+			if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len()), io.Discard); !errors.Is(err, watermark.ErrNoWatermark) {
+				t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+			}
+		})
+	}
+}
+
+func TestSVGVisibleOverlay(t *testing.T) {
+	w := NewSVGWatermarker()
+	opts := overlay.DefaultOptions()
+	opts.Text = "机密 CONFIDENTIAL"
+	opts.Angle = -30
+	ctx := context.Background()
+
+	data := []byte(testSVG)
+	marked := addWatermark(t, ctx, data, "内部资料", &opts)
+	if checkWellFormed(t, marked) != "-10 -10 420 300" {
+		t.Error("viewBox被修改")
+	}
+
+	// 可见水印在原有内容之后，矩形覆盖整个viewBox，文字不受内置字体限制
+	for _, want := range []string{
+		`<rect x="-10" y="-10" width="420" height="300" fill="url(#` + patternID + `)">`,
+		`patternTransform="rotate(-30 200 140)"`,
+		`>机密 CONFIDENTIAL</text>`,
+		`fill="#808080" fill-opacity="0.3"`,
+	} {
+		if !bytes.Contains(marked, []byte(want)) {
+			t.Errorf("可见水印中没有 %s", want)
+		}
+	}
+	if bytes.Index(marked, []byte(overlayID)) < bytes.Index(marked, []byte(`A &amp; B`)) {
+		t.Error("可见水印应当在原有内容之后")
+	}
+
+	// 清理工具删除metadata后仍可从可见水印分组中提取
+	doc, err := parseDocument(marked)
+	if err != nil {
+		t.Fatalf("解析文档失败: %v", err)
+	}
+	withoutMetadata := append(append([]byte(nil), marked[:doc.metadata.start]...), marked[doc.metadata.end:]...)
+	payload, err := w.ExtractWatermarkStream(context.Background(), bytes.NewReader(withoutMetadata), int64(len(withoutMetadata)))
+	if err != nil || payload.Text != "内部资料" {
+		t.Fatalf("从可见水印提取结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(context.Background(), bytes.NewReader(marked), int64(len(marked)), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if stripped.String() != testSVG {
+		t.Errorf("移除水印后的文件与原文件不一致:\n%s", stripped.String())
+	}
+}
+
+func TestSVGInvalid(t *testing.T) {
+	w := NewSVGWatermarker()
+	for _, data := range []string{
+		`<html xmlns="http://www.w3.org/1999/xhtml"></html>`,
+		`<svg xmlns="http://www.w3.org/2000/svg"><g></svg>`,
+		`<svg>no namespace</svg>`,
+	} {
+		if err := w.AddWatermarkStream(context.Background(), strings.NewReader(data), int64(len(data)), io.Discard, watermark.NewPayload("x")); err == nil {
+			t.Errorf("%s 应当返回错误", data)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package tiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// TIFF文件头
+var (
+	littleEndianHeader = []byte("II\x2a\x00")
+	bigEndianHeader    = []byte("MM\x00\x2a")
+)
+
+// maxPages 读取IFD链时允许的最大页数，防止构造的循环链表
+const maxPages = 10000
+
+// 字段类型
+const (
+	typeASCII = 2
+	typeLong  = 4
+)
+
+// typeSizes 各字段类型每个值占用的字节数
+var typeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4,
+}
+
+// entry IFD中的一个字段，value 为条目中的4字节值或偏移，按文件的字节序保存
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value [4]byte
+}
+
+// ifd 一页图像的IFD
+type ifd struct {
+	offset  uint32
+	entries []entry
+	next    uint32
+}
+
+// byteOrder 文件的字节序，既用于读取也用于追加写入
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// readHeader 读取文件头，返回字节序和第一个IFD的偏移
+func readHeader(data []byte) (byteOrder, uint32, error) {
+	if len(data) < 8 {
+		return nil, 0, errors.New("不是有效的TIFF文件")
+	}
+	var order byteOrder
+	switch {
+	case string(data[:4]) == string(littleEndianHeader):
+		order = binary.LittleEndian
+	case string(data[:4]) == string(bigEndianHeader):
+		order = binary.BigEndian
+	case string(data[:4]) == "II+\x00" || string(data[:4]) == "MM\x00+":
+		return nil, 0, errors.New("不支持BigTIFF文件")
+	default:
+		return nil, 0, errors.New("不是有效的TIFF文件")
+	}
+	return order, order.Uint32(data[4:]), nil
+}
+
+// readIFD 读取offset处的IFD
+func readIFD(data []byte, order byteOrder, offset uint32) (*ifd, error) {
+	pos := int(offset)
+	if offset < 8 || pos+2 > len(data) {
+		return nil, fmt.Errorf("TIFF的IFD偏移%d无效", offset)
+	}
+	count := int(order.Uint16(data[pos:]))
+	end := pos + 2 + 12*count
+	if end+4 > len(data) {
+		return nil, errors.New("TIFF的IFD不完整")
+	}
+
+	d := &ifd{offset: offset, entries: make([]entry, count), next: order.Uint32(data[end:])}
+	for i := range d.entries {
+		raw := data[pos+2+12*i:]
+		e := entry{tag: order.Uint16(raw), typ: order.Uint16(raw[2:]), count: order.Uint32(raw[4:])}
+		copy(e.value[:], raw[8:12])
+		d.entries[i] = e
+	}
+	return d, nil
+}
+
+// readPages 按顺序读取IFD链中的所有页
+func readPages(data []byte) (byteOrder, []*ifd, error) {
+	order, offset, err := readHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pages []*ifd
+	visited := make(map[uint32]bool)
+	for offset != 0 {
+		if visited[offset] || len(pages) >= maxPages {
+			return nil, nil, errors.New("TIFF的IFD链存在循环")
+		}
+		visited[offset] = true
+		d, err := readIFD(data, order, offset)
+		if err != nil {
+			return nil, nil, err
+		}
+		pages = append(pages, d)
+		offset = d.next
+	}
+	if len(pages) == 0 {
+		return nil, nil, errors.New("TIFF文件中没有图像")
+	}
+	return order, pages, nil
+}
+
+// find 返回IFD中指定标签的字段
+func (d *ifd) find(tag uint16) (entry, bool) {
+	for _, e := range d.entries {
+		if e.tag == tag {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// bytes 返回字段的值，不超过4字节的值保存在条目中，否则保存在条目指向的位置
+func (e entry) bytes(data []byte, order byteOrder) ([]byte, error) {
+	size, ok := typeSizes[e.typ]
+	if !ok {
+		return nil, fmt.Errorf("TIFF标签%d的类型%d未知", e.tag, e.typ)
+	}
+	length := uint64(size) * uint64(e.count)
+	if length <= 4 {
+		return e.value[:length], nil
+	}
+	offset := uint64(order.Uint32(e.value[:]))
+	if offset+length > uint64(len(data)) {
+		return nil, fmt.Errorf("TIFF标签%d的值超出文件范围", e.tag)
+	}
+	return data[offset : offset+length], nil
+}
+
+// appendIFD 将IFD编码后追加到dst，字段按标签排序
+func appendIFD(dst []byte, order byteOrder, entries []entry, next uint32) []byte {
+	dst = order.AppendUint16(dst, uint16(len(entries)))
+	for _, e := range entries {
+		dst = order.AppendUint16(dst, e.tag)
+		dst = order.AppendUint16(dst, e.typ)
+		dst = order.AppendUint32(dst, e.count)
+		dst = append(dst, e.value[:]...)
+	}
+	return order.AppendUint32(dst, next)
+}
+
+// ifdSize 返回包含n个字段的IFD占用的字节数
+func ifdSize(n int) int {
+	return 2 + 12*n + 4
+}
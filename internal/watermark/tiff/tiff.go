@@ -0,0 +1,253 @@
+// Package tiff 提供TIFF图片（包括多页TIFF）的水印处理
+package tiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"watermark-tool/internal/watermark"
+)
+
+func init() {
+	watermark.RegisterStreamWatermarker(NewTIFFWatermarker())
+}
+
+// 私有标签，位于TIFF规范留给私有用途的65000-65535范围
+const (
+	// tagWatermark 保存水印信封的ASCII字段，写入每一页
+	tagWatermark = 65433
+	// tagRestore 只写入第一页，两个LONG分别为添加水印前第一个IFD的偏移和文件长度，用于无损移除
+	tagRestore = 65434
+)
+
+// TIFFWatermarker 提供对TIFF图片的水印操作
+type TIFFWatermarker struct{}
+
+// NewTIFFWatermarker 创建一个新的TIFF水印处理器
+func NewTIFFWatermarker() *TIFFWatermarker {
+	return &TIFFWatermarker{}
+}
+
+// GetSupportedType 获取支持的文件类型
+func (w *TIFFWatermarker) GetSupportedType() string {
+	return "tiff"
+}
+
+// Capabilities 返回嵌入方式的能力
+func (w *TIFFWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "在每一页的IFD中写入私有标签", Locate: true, Lossless: true}
+}
+
+// AddWatermarkStream 添加水印到TIFF数据流
+// 原文件的数据原样保留，在文件末尾追加水印信封和每一页IFD的副本，副本中增加水印标签，
+// 其他字段仍然指向原来的图像数据，文件头指向第一页的副本
+func (w *TIFFWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	order, pages, err := readPages(data)
+	if err != nil {
+		return err
+	}
+	// 已经带有水印时在原文件上重新添加，避免副本层层累积
+	if original, ok := restoreOriginal(data, order, pages); ok {
+		data = original
+		if _, pages, err = readPages(data); err != nil {
+			return err
+		}
+	}
+
+	armored, err := watermark.SealPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	// 偏移需要对齐到字
+	output := append([]byte(nil), data...)
+	align := func() {
+		if len(output)%2 != 0 {
+			output = append(output, 0)
+		}
+	}
+	align()
+	envelopeOffset := len(output)
+	output = append(output, armored...)
+	output = append(output, 0)
+	align()
+	restoreOffset := len(output)
+	output = order.AppendUint32(output, order.Uint32(data[4:]))
+	output = order.AppendUint32(output, uint32(len(data)))
+
+	// 先计算各页副本的偏移，再依次写入
+	entries := make([][]entry, len(pages))
+	offsets := make([]int, len(pages)+1)
+	offsets[0] = len(output)
+	for i, page := range pages {
+		entries[i] = watermarkEntries(page, order, len(armored)+1, envelopeOffset, restoreOffset, i == 0)
+		offsets[i+1] = offsets[i] + ifdSize(len(entries[i]))
+	}
+	if uint64(offsets[len(pages)]) > 0xFFFFFFFF {
+		return fmt.Errorf("TIFF文件超过4GB")
+	}
+	for i := range pages {
+		next := uint32(0)
+		if i+1 < len(pages) {
+			next = uint32(offsets[i+1])
+		}
+		output = appendIFD(output, order, entries[i], next)
+	}
+	order.PutUint32(output[4:], uint32(offsets[0]))
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// watermarkEntries 返回加入水印标签后的字段，原有的水印标签会被替换
+func watermarkEntries(page *ifd, order byteOrder, length, envelopeOffset, restoreOffset int, first bool) []entry {
+	entries := make([]entry, 0, len(page.entries)+2)
+	for _, e := range page.entries {
+		if e.tag != tagWatermark && e.tag != tagRestore {
+			entries = append(entries, e)
+		}
+	}
+
+	mark := entry{tag: tagWatermark, typ: typeASCII, count: uint32(length)}
+	order.PutUint32(mark.value[:], uint32(envelopeOffset))
+	entries = append(entries, mark)
+	if first {
+		restore := entry{tag: tagRestore, typ: typeLong, count: 2}
+		order.PutUint32(restore.value[:], uint32(restoreOffset))
+		entries = append(entries, restore)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	return entries
+}
+
+// ExtractWatermarkStream 从TIFF数据流中提取水印，读取第一个带有水印标签的页
+func (w *TIFFWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	order, pages, err := readPages(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, page := range pages {
+		e, ok := page.find(tagWatermark)
+		if !ok {
+			continue
+		}
+		value, err := e.bytes(data, order)
+		if err != nil {
+			return nil, err
+		}
+		return watermark.OpenPayload(string(bytes.TrimRight(value, "\x00")))
+	}
+	return nil, watermark.ErrNoWatermark
+}
+
+// RemoveWatermarkStream 移除TIFF数据流中的水印标签
+// 文件在添加水印之后没有被其他工具改写时恢复为原文件，否则就地删除各页IFD中的水印标签
+func (w *TIFFWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	order, pages, err := readPages(data)
+	if err != nil {
+		return err
+	}
+
+	output, ok := restoreOriginal(data, order, pages)
+	if !ok {
+		if output, ok = removeInPlace(data, order, pages); !ok {
+			return watermark.ErrNoWatermark
+		}
+	}
+
+	if _, err := dst.Write(output); err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// restoreOriginal 按第一页的恢复标签截断文件，并让文件头重新指向原来的第一个IFD
+// 只有所有页都是追加的副本、恢复后的文件可以解析时才恢复
+func restoreOriginal(data []byte, order byteOrder, pages []*ifd) ([]byte, bool) {
+	e, ok := pages[0].find(tagRestore)
+	if !ok || e.typ != typeLong || e.count != 2 {
+		return nil, false
+	}
+	value, err := e.bytes(data, order)
+	if err != nil {
+		return nil, false
+	}
+	firstIFD, length := order.Uint32(value), int(order.Uint32(value[4:]))
+	if length < 8 || length > len(data) {
+		return nil, false
+	}
+	for _, page := range pages {
+		if int(page.offset) < length {
+			return nil, false
+		}
+	}
+
+	output := append([]byte(nil), data[:length]...)
+	order.PutUint32(output[4:], firstIFD)
+	if _, restored, err := readPages(output); err != nil || len(restored) != len(pages) {
+		return nil, false
+	}
+	return output, true
+}
+
+// removeInPlace 在各页IFD的原位置删除水印标签，后面的字段前移，空出的字节填0
+func removeInPlace(data []byte, order byteOrder, pages []*ifd) ([]byte, bool) {
+	output := append([]byte(nil), data...)
+	removed := false
+	for _, page := range pages {
+		var entries []entry
+		for _, e := range page.entries {
+			if e.tag != tagWatermark && e.tag != tagRestore {
+				entries = append(entries, e)
+			}
+		}
+		if len(entries) == len(page.entries) {
+			continue
+		}
+		removed = true
+
+		start := int(page.offset)
+		rewritten := appendIFD(nil, order, entries, page.next)
+		copy(output[start:], rewritten)
+		clear(output[start+len(rewritten) : start+ifdSize(len(page.entries))])
+	}
+	return output, removed
+}
+
+// LocateWatermarks 返回带有水印标签的各页IFD的偏移
+func (w *TIFFWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	data, err := watermark.ReadAll(ctx, src, size)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片文件失败: %w", err)
+	}
+	_, pages, err := readPages(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	for _, page := range pages {
+		if _, ok := page.find(tagWatermark); ok {
+			locations = append(locations, fmt.Sprintf("IFD@%d", page.offset))
+		}
+	}
+	return locations, nil
+}
@@ -0,0 +1,153 @@
+package tiff
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+// testTIFF 生成两页未压缩的8位灰度TIFF，每页一个条带，图像数据在IFD之前
+func testTIFF(order byteOrder) []byte {
+	output := []byte("II\x2a\x00\x00\x00\x00\x00")
+	if order == binary.BigEndian {
+		output = []byte("MM\x00\x2a\x00\x00\x00\x00")
+	}
+
+	sizes := [][2]int{{16, 8}, {24, 12}}
+	stripOffsets := make([]int, len(sizes))
+	for i, size := range sizes {
+		stripOffsets[i] = len(output)
+		for p := 0; p < size[0]*size[1]; p++ {
+			output = append(output, byte(p*7+i*40))
+		}
+	}
+	if len(output)%2 != 0 {
+		output = append(output, 0)
+	}
+
+	short := func(tag uint16, v int) entry {
+		e := entry{tag: tag, typ: 3, count: 1}
+		order.PutUint16(e.value[:], uint16(v))
+		return e
+	}
+	long := func(tag uint16, v int) entry {
+		e := entry{tag: tag, typ: typeLong, count: 1}
+		order.PutUint32(e.value[:], uint32(v))
+		return e
+	}
+	order.PutUint32(output[4:], uint32(len(output)))
+	for i, size := range sizes {
+		entries := []entry{
+			long(256, size[0]), long(257, size[1]), short(258, 8), short(259, 1), short(262, 1),
+			long(273, stripOffsets[i]), short(277, 1), long(278, size[1]), long(279, size[0]*size[1]),
+		}
+		next := 0
+		if i+1 < len(sizes) {
+			next = len(output) + ifdSize(len(entries))
+		}
+		output = appendIFD(output, order, entries, uint32(next))
+	}
+	return output
+}
+
+func TestTIFFPrivateTag(t *testing.T) {
+	ctx := context.Background()
+	w := NewTIFFWatermarker()
+
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			data := testTIFF(order)
+
+			var marked bytes.Buffer
+			if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("扫描件")); err != nil {
+				t.Fatalf("添加水印失败: %v", err)
+			}
+
+			// 原文件除第一个IFD的偏移外原样保留，每一页都带有水印标签，图像数据位置不变
+			if !bytes.Equal(marked.Bytes()[8:len(data)], data[8:]) {
+				t.Error("原文件的数据被修改")
+			}
+			_, original, _ := readPages(data)
+			_, pages, err := readPages(marked.Bytes())
+			if err != nil || len(pages) != 2 {
+				t.Fatalf("读取带水印的文件结果为 %d 页, %v", len(pages), err)
+			}
+			for i, page := range pages {
+				if _, ok := page.find(tagWatermark); !ok {
+					t.Errorf("第%d页没有水印标签", i+1)
+				}
+				for _, e := range original[i].entries {
+					if got, _ := page.find(e.tag); got != e {
+						t.Errorf("第%d页的标签%d被修改", i+1, e.tag)
+					}
+				}
+			}
+
+			payload, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()))
+			if err != nil || payload.Text != "扫描件" {
+				t.Errorf("提取水印结果为 %v, %v", payload, err)
+			}
+			if locations, err := w.LocateWatermarks(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len())); err != nil || len(locations) != 2 {
+				t.Errorf("水印位置为 %v, %v，期望两页", locations, err)
+			}
+
+			// 重复添加时替换原来的水印，移除后仍恢复为原文件
+			var remarked bytes.Buffer
+			if err := w.AddWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len()), &remarked, watermark.NewPayload("第二次")); err != nil {
+				t.Fatalf("重复添加水印失败: %v", err)
+			}
+			var stripped bytes.Buffer
+			if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(remarked.Bytes()), int64(remarked.Len()), &stripped); err != nil {
+				t.Fatalf("移除水印失败: %v", err)
+			}
+			if !bytes.Equal(stripped.Bytes(), data) {
+				t.Error("移除水印后的文件与原文件不一致")
+			}
+			if _, err := w.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+				t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+			}
+		})
+	}
+}
+
+func TestTIFFRemoveInPlace(t *testing.T) {
+	ctx := context.Background()
+	w := NewTIFFWatermarker()
+	data := testTIFF(binary.LittleEndian)
+
+	var marked bytes.Buffer
+	if err := w.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("扫描件")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	// 模拟其他工具改写文件后恢复信息失效，这时在原位置删除标签
+	rewritten := append(marked.Bytes(), make([]byte, 6)...)
+	_, pages, _ := readPages(rewritten)
+	e, _ := pages[0].find(tagRestore)
+	value, _ := e.bytes(rewritten, binary.LittleEndian)
+	binary.LittleEndian.PutUint32(value[4:], 4)
+
+	var stripped bytes.Buffer
+	if err := w.RemoveWatermarkStream(ctx, bytes.NewReader(rewritten), int64(len(rewritten)), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if stripped.Len() != len(rewritten) {
+		t.Errorf("就地移除后文件长度为%d，期望%d", stripped.Len(), len(rewritten))
+	}
+	_, pages, err := readPages(stripped.Bytes())
+	if err != nil || len(pages) != 2 {
+		t.Fatalf("读取移除水印后的文件结果为 %d 页, %v", len(pages), err)
+	}
+	for i, page := range pages {
+		if _, ok := page.find(tagWatermark); ok {
+			t.Errorf("第%d页的水印标签没有删除", i+1)
+		}
+		if _, ok := page.find(273); !ok {
+			t.Errorf("第%d页的图像字段丢失", i+1)
+		}
+	}
+}
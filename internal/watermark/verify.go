@@ -0,0 +1,80 @@
+package watermark
+
+import (
+	"errors"
+)
+
+// ErrForgedWatermark 水印签名校验失败
+var ErrForgedWatermark = errors.New("水印签名无效，可能被篡改或伪造")
+
+// ErrSealedPayload 水印签名有效，但只有签名公钥，无法解密水印内容
+var ErrSealedPayload = errors.New("水印签名有效，但没有解密水印内容的密钥")
+
+// SealedError 只用签名公钥校验的水印，可以确认来源但无法读取内容，可以用 errors.Is 判断为 ErrSealedPayload
+type SealedError struct {
+	// Verification 签名的校验结果
+	Verification *Verification
+}
+
+func (e *SealedError) Error() string {
+	return ErrSealedPayload.Error()
+}
+
+func (e *SealedError) Is(target error) bool {
+	return target == ErrSealedPayload
+}
+
+// VerificationStatus 水印来源的校验结果
+type VerificationStatus string
+
+const (
+	// StatusAuthentic 签名有效，水印由记录的密钥签发且未被修改
+	StatusAuthentic VerificationStatus = "authentic"
+	// StatusForged 签名或MAC无效，水印被篡改或伪造
+	StatusForged VerificationStatus = "forged"
+	// StatusUnsigned 水印没有可信的签名，例如旧版本的水印或使用公开内置密钥的水印
+	StatusUnsigned VerificationStatus = "unsigned"
+)
+
+// 校验使用的算法
+const (
+	AlgorithmEd25519    = "ed25519"
+	AlgorithmHMACSHA256 = "hmac-sha256"
+	AlgorithmSHA256     = "sha256"
+)
+
+// Verification 描述提取出的水印的来源校验结果
+type Verification struct {
+	// Status 校验结果
+	Status VerificationStatus `json:"status"`
+	// KeyID 签发水印的密钥ID
+	KeyID string `json:"key_id,omitempty"`
+	// Algorithm 校验使用的算法，旧版本水印为空
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// Authentic 返回水印是否由记录的密钥签发且未被修改
+func (v *Verification) Authentic() bool {
+	return v != nil && v.Status == StatusAuthentic
+}
+
+// Forged 返回水印是否被篡改或伪造
+func (v *Verification) Forged() bool {
+	return v != nil && v.Status == StatusForged
+}
+
+// String 返回校验结果的说明
+func (v *Verification) String() string {
+	switch {
+	case v == nil:
+		return "未签名"
+	case v.Status == StatusAuthentic:
+		return "真实，由密钥 " + v.KeyID + " 签发"
+	case v.Status == StatusForged:
+		return "签名无效，水印可能被篡改或伪造"
+	case v.KeyID == "":
+		return "未签名"
+	default:
+		return "未签名，密钥 " + v.KeyID + " 是公开的内置密钥或不支持签名"
+	}
+}
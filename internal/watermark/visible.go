@@ -0,0 +1,23 @@
+package watermark
+
+import (
+	"errors"
+
+	"watermark-tool/internal/watermark/overlay"
+)
+
+// ErrOverlayUnsupported 嵌入方式不支持绘制可见水印
+var ErrOverlayUnsupported = errors.New("该文件类型或嵌入方式不支持可见水印")
+
+// OverlayOptions 返回添加水印时要绘制的可见水印参数，载荷的 Overlay 为nil时返回false
+// 参数中既没有文本也没有标志时使用水印载荷的文本
+func (p *Payload) OverlayOptions() (overlay.Options, bool) {
+	if p == nil || p.Overlay == nil {
+		return overlay.Options{}, false
+	}
+	opts := *p.Overlay
+	if opts.Text == "" && opts.Logo == nil {
+		opts.Text = p.Text
+	}
+	return opts, true
+}
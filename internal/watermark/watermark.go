@@ -1,6 +1,16 @@
 package watermark
 
-// Watermarker 定义了水印接口
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNoWatermark 文档中没有水印
+var ErrNoWatermark = errors.New("未找到水印信息")
+
+// Watermarker 定义了基于文件路径的水印接口
+// 新的处理器应实现 StreamWatermarker，此接口保留用于兼容旧的调用方式
 type Watermarker interface {
 	// AddWatermark 添加水印到文档
 	AddWatermark(inputFile, outputFile, watermarkText string) error
@@ -9,21 +19,58 @@ type Watermarker interface {
 	// 返回值: 水印文本, 时间戳, 错误
 	ExtractWatermark(inputFile string) (string, string, error)
 
+	// RemoveWatermark 移除文档中的水印，文档中没有水印时返回 ErrNoWatermark
+	RemoveWatermark(inputFile, outputFile string) error
+
 	// GetSupportedType 获取支持的文件类型
 	GetSupportedType() string
 }
 
-// WatermarkRegistry 包含所有已注册的水印处理器
-var WatermarkRegistry = make(map[string]Watermarker)
+// StreamWatermarker 定义了基于流的水印接口
+// 文档通过 io.ReaderAt 和文件大小读取，结果写入 io.Writer，
+// 实现需要在各处理阶段检查 ctx，取消或超时后立即停止处理。
+// ctx只用于取消和超时，每次调用的参数都显式传递：可见水印参数在载荷的 Overlay 中，
+// 打开加密文档的密码通过 PasswordWatermarker 的 WithPassword 设置
+type StreamWatermarker interface {
+	// AddWatermarkStream 从src读取文档，嵌入水印载荷后写入dst
+	// 支持可见水印的嵌入方式在载荷的 Overlay 不为nil时同时绘制可见水印
+	AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *Payload) error
+
+	// ExtractWatermarkStream 从src读取文档并提取完整的水印载荷
+	ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*Payload, error)
 
-// RegisterWatermarker 注册水印处理器
+	// RemoveWatermarkStream 从src读取文档，移除所有水印后写入dst
+	// 文档中没有水印时返回 ErrNoWatermark
+	RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error
+
+	// GetSupportedType 获取支持的文件类型
+	GetSupportedType() string
+}
+
+// RegisterWatermarker 将水印处理器注册到 DefaultRegistry，嵌入方式为 DefaultMethod
+// 只实现了旧接口的处理器会通过 NewLegacyAdapter 包装后注册
 func RegisterWatermarker(w Watermarker) {
-	fileType := w.GetSupportedType()
-	WatermarkRegistry[fileType] = w
+	if sw, ok := w.(StreamWatermarker); ok {
+		RegisterStreamWatermarker(sw)
+		return
+	}
+	RegisterStreamWatermarker(NewLegacyAdapter(w))
+}
+
+// RegisterStreamWatermarker 将基于流的水印处理器注册到 DefaultRegistry，嵌入方式为 DefaultMethod
+// 同一文件类型重复注册时会panic，处理器在 init 中注册，重复注册是程序错误
+func RegisterStreamWatermarker(w StreamWatermarker) {
+	RegisterStrategy(Strategy{Watermarker: w})
+}
+
+// RegisterStrategy 将一种嵌入方式注册到 DefaultRegistry，重复注册时会panic
+func RegisterStrategy(strategy Strategy) {
+	if err := DefaultRegistry.Register(strategy); err != nil {
+		panic(err)
+	}
 }
 
-// GetWatermarker 根据文件类型获取水印处理器
-func GetWatermarker(fileType string) (Watermarker, bool) {
-	w, ok := WatermarkRegistry[fileType]
-	return w, ok
+// GetWatermarker 根据文件类型从 DefaultRegistry 获取水印处理器
+func GetWatermarker(fileType string) (StreamWatermarker, bool) {
+	return DefaultRegistry.Lookup(fileType)
 }
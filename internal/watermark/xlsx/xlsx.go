@@ -3,21 +3,21 @@ package xlsx
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"watermark-tool/internal/watermark"
+	"watermark-tool/internal/watermark/envelope"
 )
 
 // XLSXWatermarker 实现了XLSX文件的水印处理
@@ -33,6 +33,11 @@ func (x *XLSXWatermarker) GetSupportedType() string {
 	return "xlsx"
 }
 
+// Capabilities 返回嵌入方式的能力
+func (x *XLSXWatermarker) Capabilities() watermark.Capabilities {
+	return watermark.Capabilities{Description: "写入自定义文档属性", Locate: true, Lossless: true}
+}
+
 // 定义XLSX水印标记
 const (
 	watermarkPrefix = "WATERMARK_BEGIN:"
@@ -44,34 +49,14 @@ const (
 	corePropsFile     = "docProps/core.xml"
 	workbookFile      = "xl/workbook.xml"
 	sharedStringsFile = "xl/sharedStrings.xml"
+	customPropsFile   = "docProps/custom.xml"
 )
 
-// encrypt 使用AES加密文本
-func encrypt(plaintext, key string) (string, error) {
-	block, err := aes.NewCipher([]byte(key))
-	if err != nil {
-		return "", err
-	}
-
-	// 创建一个新的初始化向量
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return "", err
-	}
-
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], []byte(plaintext))
-
-	// 使用URL安全的base64编码，避免特殊字符问题
-	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
-}
+// propertyPattern 匹配自定义属性文件中的水印属性
+var propertyPattern = regexp.MustCompile(`<property[^>]*name="watermark"[^>]*>(.*?)</property>`)
 
 // decrypt 使用AES解密文本
 func decrypt(ciphertext, key string) (string, error) {
-	// 打印输入参数，便于调试
-	fmt.Printf("解密输入 - 密文: %s, 密钥长度: %d\n", ciphertext, len(key))
-
 	// 尝试多种解码方式
 	var data []byte
 	var err error
@@ -139,29 +124,14 @@ func calculateChecksum(text string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-// createWatermarkData 创建加密的水印数据
-func createWatermarkData(text string) (string, string, error) {
-	// 生成时间戳
-	timestamp := time.Now().Format(time.RFC3339)
-
-	// 计算校验和
-	checksum := calculateChecksum(text + timestamp)
-
-	// 加密水印文本
-	encryptedText, err := encrypt(text, checksum[:16])
+// createWatermarkData 创建包含加密水印信封的水印数据
+func createWatermarkData(payload *watermark.Payload) (string, error) {
+	armored, err := watermark.SealPayload(payload)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
-	// 格式化水印数据 - 不使用特殊字符
-	watermarkData := fmt.Sprintf("%s%s|%s|%s%s",
-		watermarkPrefix,
-		encryptedText,
-		timestamp,
-		checksum,
-		watermarkSuffix)
-
-	return watermarkData, checksum, nil
+	return watermarkPrefix + armored + watermarkSuffix, nil
 }
 
 // injectWatermarkIntoFile 将水印注入到指定的XML文件中
@@ -391,26 +361,32 @@ func extractWatermarkFromFile(r *zip.Reader, fileName string) (string, error) {
 
 // AddWatermark 为XLSX文件添加水印
 func (x *XLSXWatermarker) AddWatermark(inputFile, outputFile, watermarkText string) error {
-	data, err := os.ReadFile(inputFile)
+	return watermark.AddWatermarkFile(context.Background(), x, inputFile, outputFile, watermark.NewPayload(watermarkText))
+}
+
+// ExtractWatermark 从XLSX文件中提取水印
+func (x *XLSXWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
+	payload, err := watermark.ExtractWatermarkFile(context.Background(), x, inputFile)
 	if err != nil {
-		return fmt.Errorf("读取XLSX文件失败: %w", err)
+		return "", "", err
 	}
-	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	return payload.Text, payload.Timestamp(), nil
+}
+
+// AddWatermarkStream 为XLSX数据流添加水印
+func (x *XLSXWatermarker) AddWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer, payload *watermark.Payload) error {
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
 		return fmt.Errorf("解析XLSX文件失败: %w", err)
 	}
-	var outputBuffer bytes.Buffer
-	writer := zip.NewWriter(&outputBuffer)
+	writer := zip.NewWriter(dst)
 
-	watermarkData, checksum, err := createWatermarkData(watermarkText)
+	watermarkData, err := createWatermarkData(payload)
 	if err != nil {
 		return fmt.Errorf("创建水印数据失败: %w", err)
 	}
-	fmt.Printf("创建的水印数据: %s\n", watermarkData)
-	fmt.Printf("校验和: %s\n", checksum)
 
 	processedFiles := make(map[string]bool)
-	const customPropsFile = "docProps/custom.xml"
 	var customFile *zip.File
 	for _, f := range reader.File {
 		if f.Name == customPropsFile {
@@ -426,7 +402,6 @@ func (x *XLSXWatermarker) AddWatermark(inputFile, outputFile, watermarkText stri
 			if err == nil {
 				// 插入或更新自定义属性
 				endTag := "</Properties>"
-				propertyPattern := regexp.MustCompile(`<property[^>]*name="watermark"[^>]*>.*?</property>`) // 匹配已有水印属性
 				newProp := fmt.Sprintf(`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="2" name="watermark" type="string">%s</property>`, watermarkData)
 				var modifiedContent []byte
 				if propertyPattern.Match(content) {
@@ -437,7 +412,8 @@ func (x *XLSXWatermarker) AddWatermark(inputFile, outputFile, watermarkText stri
 				} else {
 					modifiedContent = content
 				}
-				w, err := writer.CreateHeader(&customFile.FileHeader)
+				header := customFile.FileHeader
+				w, err := writer.CreateHeader(&header)
 				if err == nil {
 					w.Write(modifiedContent)
 					processedFiles[customPropsFile] = true
@@ -461,6 +437,9 @@ func (x *XLSXWatermarker) AddWatermark(inputFile, outputFile, watermarkText stri
 	}
 	// 复制其余文件
 	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if processedFiles[file.Name] {
 			continue
 		}
@@ -468,7 +447,8 @@ func (x *XLSXWatermarker) AddWatermark(inputFile, outputFile, watermarkText stri
 		if err != nil {
 			return fmt.Errorf("打开XLSX内部文件失败: %w", err)
 		}
-		w, err := writer.CreateHeader(&file.FileHeader)
+		header := file.FileHeader
+		w, err := writer.CreateHeader(&header)
 		if err != nil {
 			rc.Close()
 			return fmt.Errorf("创建ZIP条目失败: %w", err)
@@ -483,24 +463,15 @@ func (x *XLSXWatermarker) AddWatermark(inputFile, outputFile, watermarkText stri
 	if err != nil {
 		return fmt.Errorf("关闭ZIP写入器失败: %w", err)
 	}
-	err = os.WriteFile(outputFile, outputBuffer.Bytes(), 0644)
-	if err != nil {
-		return fmt.Errorf("写入输出文件失败: %w", err)
-	}
 	return nil
 }
 
-// ExtractWatermark 从XLSX文件中提取水印
-func (x *XLSXWatermarker) ExtractWatermark(inputFile string) (string, string, error) {
-	data, err := os.ReadFile(inputFile)
-	if err != nil {
-		return "", "", fmt.Errorf("读取XLSX文件失败: %w", err)
-	}
-	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+// ExtractWatermarkStream 从XLSX数据流中提取水印
+func (x *XLSXWatermarker) ExtractWatermarkStream(ctx context.Context, src io.ReaderAt, size int64) (*watermark.Payload, error) {
+	reader, err := zip.NewReader(src, size)
 	if err != nil {
-		return "", "", fmt.Errorf("解析XLSX文件失败: %w", err)
+		return nil, fmt.Errorf("解析XLSX文件失败: %w", err)
 	}
-	const customPropsFile = "docProps/custom.xml"
 	for _, f := range reader.File {
 		if f.Name == customPropsFile {
 			rc, err := f.Open()
@@ -513,8 +484,7 @@ func (x *XLSXWatermarker) ExtractWatermark(inputFile string) (string, string, er
 				continue
 			}
 			// 提取自定义属性
-			pattern := regexp.MustCompile(`<property[^>]*name="watermark"[^>]*>(.*?)</property>`)
-			matches := pattern.FindSubmatch(content)
+			matches := propertyPattern.FindSubmatch(content)
 			if len(matches) >= 2 {
 				watermarkData := string(matches[1])
 				return parseWatermarkData(watermarkData)
@@ -522,72 +492,145 @@ func (x *XLSXWatermarker) ExtractWatermark(inputFile string) (string, string, er
 		}
 	}
 	// 兼容旧方法
-	return "", "", errors.New("未在XLSX文件中找到有效的水印信息")
+	return nil, watermark.ErrNoWatermark
 }
 
-// parseWatermarkData 解析水印数据
-func parseWatermarkData(watermarkData string) (string, string, error) {
-	// 添加日志，记录水印数据的格式
-	fmt.Printf("解析水印数据: %s\n", watermarkData)
+// RemoveWatermark 移除XLSX文件中的水印
+func (x *XLSXWatermarker) RemoveWatermark(inputFile, outputFile string) error {
+	return watermark.RemoveWatermarkFile(context.Background(), x, inputFile, outputFile)
+}
+
+// RemoveWatermarkStream 删除XLSX数据流中自定义属性文件里的水印属性，其余文件原样复制
+func (x *XLSXWatermarker) RemoveWatermarkStream(ctx context.Context, src io.ReaderAt, size int64, dst io.Writer) error {
+	reader, err := zip.NewReader(src, size)
+	if err != nil {
+		return fmt.Errorf("解析XLSX文件失败: %w", err)
+	}
+
+	var customContent []byte
+	for _, f := range reader.File {
+		if f.Name != customPropsFile {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("打开XLSX内部文件失败: %w", err)
+		}
+		customContent, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("读取XLSX内部文件失败: %w", err)
+		}
+		break
+	}
+	if !propertyPattern.Match(customContent) {
+		return watermark.ErrNoWatermark
+	}
+	customContent = propertyPattern.ReplaceAllLiteral(customContent, nil)
 
+	writer := zip.NewWriter(dst)
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// 复制文件头，CreateHeader会修改数据描述符标志，之后file.Open()会按修改后的标志读取
+		header := file.FileHeader
+		w, err := writer.CreateHeader(&header)
+		if err != nil {
+			return fmt.Errorf("创建ZIP条目失败: %w", err)
+		}
+		if file.Name == customPropsFile {
+			if _, err := w.Write(customContent); err != nil {
+				return fmt.Errorf("写入ZIP条目失败: %w", err)
+			}
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("打开XLSX内部文件失败: %w", err)
+		}
+		_, err = io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("复制ZIP条目失败: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("关闭ZIP写入器失败: %w", err)
+	}
+	return nil
+}
+
+// parseWatermarkData 解析水印数据
+func parseWatermarkData(watermarkData string) (*watermark.Payload, error) {
 	// 首先检查并移除水印前缀和后缀
 	if strings.Contains(watermarkData, watermarkPrefix) && strings.Contains(watermarkData, watermarkSuffix) {
 		start := strings.Index(watermarkData, watermarkPrefix) + len(watermarkPrefix)
 		end := strings.Index(watermarkData, watermarkSuffix)
 		if end > start {
 			watermarkData = watermarkData[start:end]
-			fmt.Printf("提取的水印数据（移除前缀后缀）: %s\n", watermarkData)
 		}
 	}
 
-	// 解析水印数据
+	// 解析水印信封
+	if envelope.IsArmored(watermarkData) {
+		return watermark.OpenPayload(watermarkData)
+	}
+
+	// 旧版本格式：加密文本|时间戳|校验和
 	parts := strings.Split(watermarkData, "|")
 	if len(parts) < 3 {
-		// 如果格式不正确，尝试更宽松的解析
-		if len(watermarkData) > 20 { // 假设至少有一些有效数据
-			// 尝试直接解密
-			tempKey := "0123456789abcdef"
-			decryptedText, err := decrypt(watermarkData, tempKey)
-			if err == nil {
-				return decryptedText, time.Now().Format(time.RFC3339), nil
-			}
-		}
-		return "", "", fmt.Errorf("无效的水印格式: %s", watermarkData)
+		return nil, fmt.Errorf("无效的水印格式: %s", watermarkData)
 	}
 
 	encryptedText := parts[0]
 	timestamp := parts[1]
 	checksum := parts[2]
 
-	// 打印解析后的部分，便于调试
-	fmt.Printf("解析的加密文本: %s\n", encryptedText)
-	fmt.Printf("解析的时间戳: %s\n", timestamp)
-	fmt.Printf("解析的校验和: %s\n", checksum)
-
 	// 确保校验和长度足够
 	if len(checksum) < 16 {
-		return "", "", fmt.Errorf("校验和长度不足: %d", len(checksum))
+		return nil, fmt.Errorf("校验和长度不足: %d", len(checksum))
 	}
 
-	// 解密水印文本
+	// 解密水印文本，旧版本使用校验和的前16个字符作为密钥
 	decryptedText, err := decrypt(encryptedText, checksum[:16])
 	if err != nil {
-		// 如果使用校验和解密失败，尝试使用固定密钥（不安全，但可能有助于恢复数据）
-		tempKey := "0123456789abcdef"
-		decryptedText, err = decrypt(encryptedText, tempKey)
-		if err != nil {
-			return "", "", fmt.Errorf("解密水印失败: %w (加密文本: %s)", err, encryptedText)
-		}
-		// 解密成功但使用了临时密钥，跳过校验和验证
-		return decryptedText, timestamp, nil
+		return nil, fmt.Errorf("解密水印失败: %w", err)
 	}
 
 	// 验证水印完整性
-	calculatedChecksum := calculateChecksum(decryptedText + timestamp)
-	if calculatedChecksum != checksum {
-		// 校验和不匹配，但我们已经成功解密了文本，所以仍然返回结果
-		fmt.Printf("警告：水印校验和不匹配 (计算值: %s, 存储值: %s)\n", calculatedChecksum, checksum)
+	if calculateChecksum(decryptedText+timestamp) != checksum {
+		return nil, errors.New("水印校验和不匹配，文件可能被篡改")
+	}
+
+	return watermark.DecodePayload([]byte(decryptedText), timestamp), nil
+}
+
+// LocateWatermarks 返回XLSX数据流中包含水印属性的文件
+func (x *XLSXWatermarker) LocateWatermarks(ctx context.Context, src io.ReaderAt, size int64) ([]string, error) {
+	reader, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, fmt.Errorf("解析XLSX文件失败: %w", err)
 	}
 
-	return decryptedText, timestamp, nil
+	for _, f := range reader.File {
+		if f.Name != customPropsFile {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("打开XLSX内部文件失败: %w", err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取XLSX内部文件失败: %w", err)
+		}
+		if propertyPattern.Match(content) {
+			return []string{customPropsFile}, nil
+		}
+	}
+	return nil, nil
 }
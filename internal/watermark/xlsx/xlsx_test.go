@@ -0,0 +1,132 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"watermark-tool/internal/watermark"
+)
+
+// storedZip 使用存储方式写入各文件，文件头中直接记录CRC和长度，不写数据描述符，与Excel生成的文件相同
+func storedZip(t *testing.T, names []string, contents map[string][]byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, name := range names {
+		content := contents[name]
+		w, err := writer.CreateRaw(&zip.FileHeader{
+			Name:               name,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(content)),
+			UncompressedSize64: uint64(len(content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// repack 读取ZIP中的全部文件并用 storedZip 重新打包，模拟Excel重新保存文件
+func repack(t *testing.T, data []byte) []byte {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	contents := make(map[string][]byte)
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[file.Name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, file.Name)
+	}
+	return storedZip(t, names, contents)
+}
+
+func TestXLSXWithoutDataDescriptors(t *testing.T) {
+	ctx := context.Background()
+	x := &XLSXWatermarker{}
+	data := storedZip(t, []string{"[Content_Types].xml", workbookFile, customPropsFile}, map[string][]byte{
+		"[Content_Types].xml": []byte(`<Types><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/></Types>`),
+		workbookFile:          []byte(`<workbook><sheets><sheet name="Sheet1" sheetId="1"/></sheets></workbook>`),
+		customPropsFile:       []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Properties></Properties>`),
+	})
+
+	var marked bytes.Buffer
+	if err := x.AddWatermarkStream(ctx, bytes.NewReader(data), int64(len(data)), &marked, watermark.NewPayload("报表")); err != nil {
+		t.Fatalf("添加水印失败: %v", err)
+	}
+
+	// 带水印的文件经过Excel重新保存后仍然可以提取和移除
+	resaved := repack(t, marked.Bytes())
+	payload, err := x.ExtractWatermarkStream(ctx, bytes.NewReader(resaved), int64(len(resaved)))
+	if err != nil || payload.Text != "报表" {
+		t.Fatalf("提取水印结果为 %v, %v", payload, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := x.RemoveWatermarkStream(ctx, bytes.NewReader(resaved), int64(len(resaved)), &stripped); err != nil {
+		t.Fatalf("移除水印失败: %v", err)
+	}
+	if _, err := x.ExtractWatermarkStream(ctx, bytes.NewReader(stripped.Bytes()), int64(stripped.Len())); !errors.Is(err, watermark.ErrNoWatermark) {
+		t.Errorf("期望返回 ErrNoWatermark，实际为: %v", err)
+	}
+
+	// 替换已有水印时也要复制未压缩的文件
+	marked.Reset()
+	if err := x.AddWatermarkStream(ctx, bytes.NewReader(resaved), int64(len(resaved)), &marked, watermark.NewPayload("新报表")); err != nil {
+		t.Fatalf("再次添加水印失败: %v", err)
+	}
+	if payload, err := x.ExtractWatermarkStream(ctx, bytes.NewReader(marked.Bytes()), int64(marked.Len())); err != nil || payload.Text != "新报表" {
+		t.Errorf("提取水印结果为 %v, %v", payload, err)
+	}
+}
+
+// legacyWatermarkData 生成旧版本格式的水印数据：加密文本|时间戳|校验和
+func legacyWatermarkData(t *testing.T, text, timestamp string) string {
+	t.Helper()
+	checksum := calculateChecksum(text + timestamp)
+	block, err := aes.NewCipher([]byte(checksum[:16]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, aes.BlockSize+len(text))
+	cipher.NewCFBEncrypter(block, data[:aes.BlockSize]).XORKeyStream(data[aes.BlockSize:], []byte(text))
+	return base64.RawURLEncoding.EncodeToString(data) + "|" + timestamp + "|" + checksum
+}
+
+func TestParseLegacyWatermarkData(t *testing.T) {
+	data := legacyWatermarkData(t, "旧水印", "1700000000")
+	payload, err := parseWatermarkData(data)
+	if err != nil || payload.Text != "旧水印" || payload.IssuedAt.Unix() != 1700000000 {
+		t.Fatalf("解析旧版本水印结果为 %v, %v", payload, err)
+	}
+
+	// 时间戳被修改后校验和不匹配
+	tampered := legacyWatermarkData(t, "旧水印", "1700000000")
+	tampered = tampered[:len(tampered)-len("1700000000|")-32] + "1800000000|" + tampered[len(tampered)-32:]
+	if _, err := parseWatermarkData(tampered); err == nil {
+		t.Error("校验和不匹配时应当返回错误")
+	}
+}
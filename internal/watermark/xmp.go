@@ -0,0 +1,20 @@
+package watermark
+
+import (
+	"watermark-tool/internal/watermark/xmp"
+)
+
+// XMPProperties 返回写入XMP数据包的水印属性，armored为 SealPayload 封装的信封
+// 水印文本只保存在信封中，版权声明和签发方以明文写入 dc:rights 和 xmpRights:Owner，供数字资产管理系统显示版权信息
+func XMPProperties(payload *Payload, armored string) xmp.Properties {
+	return xmp.Properties{Envelope: armored, Rights: payload.Rights, Owner: payload.Issuer}
+}
+
+// OpenXMP 从XMP数据包中读取并解析水印信封，数据包中没有水印属性时返回 ErrNoWatermark
+func OpenXMP(packet []byte) (*Payload, error) {
+	armored, ok := xmp.Envelope(packet)
+	if !ok {
+		return nil, ErrNoWatermark
+	}
+	return OpenPayload(armored)
+}
@@ -0,0 +1,146 @@
+// Package xmp 读写包含水印的XMP数据包
+// 水印信封保存在本工具的命名空间中，同时写入标准的 dc:rights 和 xmpRights 属性，
+// 使数字资产管理系统和图片编辑软件能够识别文档的版权信息。
+// 已有的XMP数据包不会被重写，水印属性作为单独的 rdf:Description 加入或删除。
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Namespace 本工具的XMP命名空间
+const Namespace = "http://ns.watermark-tool.dev/xmp/1.0/"
+
+// 标准XMP命名空间
+const (
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsXMPRights = "http://ns.adobe.com/xap/1.0/rights/"
+)
+
+// Properties 写入XMP的水印属性
+type Properties struct {
+	// Envelope Armor形式的水印信封，写入 wmt:Envelope
+	Envelope string
+	// Rights 版权声明，写入 dc:rights，为明文，任何读取XMP的软件都可以看到
+	Rights string
+	// Owner 权利人，写入 xmpRights:Owner，为空时不写入
+	Owner string
+}
+
+var (
+	// descriptionPattern 匹配本工具写入的 rdf:Description 元素及 Merge 在其前面加入的空白
+	descriptionPattern = regexp.MustCompile(`(?s)(?:\n  )?(<rdf:Description[^>]*xmlns:wmt="` + regexp.QuoteMeta(Namespace) + `"[^>]*>.*?</rdf:Description>)`)
+	// envelopePattern 匹配水印信封属性
+	envelopePattern = regexp.MustCompile(`<wmt:Envelope>([A-Za-z0-9+/=]+)</wmt:Envelope>`)
+)
+
+// Description 返回包含水印属性的 rdf:Description 元素
+// withRights为false时不写入 dc:rights 和 xmpRights，用于已有数据包中已经存在这些属性的情况
+func Description(p Properties, withRights bool) string {
+	var b strings.Builder
+	b.WriteString(`<rdf:Description rdf:about=""`)
+	if withRights {
+		b.WriteString("\n    xmlns:dc=\"" + nsDC + "\"")
+		b.WriteString("\n    xmlns:xmpRights=\"" + nsXMPRights + "\"")
+	}
+	b.WriteString("\n    xmlns:wmt=\"" + Namespace + "\">\n")
+	b.WriteString("   <wmt:Envelope>" + p.Envelope + "</wmt:Envelope>\n")
+
+	if withRights {
+		b.WriteString("   <xmpRights:Marked>True</xmpRights:Marked>\n")
+		if p.Owner != "" {
+			b.WriteString("   <xmpRights:Owner><rdf:Bag><rdf:li>" + escape(p.Owner) + "</rdf:li></rdf:Bag></xmpRights:Owner>\n")
+		}
+		if p.Rights != "" {
+			b.WriteString("   <dc:rights><rdf:Alt><rdf:li xml:lang=\"x-default\">" + escape(p.Rights) + "</rdf:li></rdf:Alt></dc:rights>\n")
+		}
+	}
+
+	b.WriteString("  </rdf:Description>")
+	return b.String()
+}
+
+// NewPacket 返回只包含水印属性的完整XMP数据包
+func NewPacket(p Properties) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"" + nsRDF + "\">\n  ")
+	b.WriteString(Description(p, true))
+	b.WriteString("\n </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+// Merge 将水印属性加入已有的XMP数据包，替换之前写入的水印属性，packet为空时创建新数据包
+// 数据包中已有 dc:rights 或 xmpRights 属性时不再重复写入
+func Merge(packet []byte, p Properties) ([]byte, error) {
+	if len(bytes.TrimSpace(packet)) == 0 {
+		return NewPacket(p), nil
+	}
+
+	packet = descriptionPattern.ReplaceAllLiteral(packet, nil)
+	end := bytes.LastIndex(packet, []byte("</rdf:RDF>"))
+	if end < 0 {
+		return nil, errors.New("XMP数据包缺少rdf:RDF元素")
+	}
+
+	withRights := !bytes.Contains(packet, []byte("<dc:rights")) && !bytes.Contains(packet, []byte("<xmpRights:"))
+	// 水印属性前只加空白，Remove删除时连同空白一起删除，数据包恢复原样
+	var merged bytes.Buffer
+	merged.Write(packet[:end])
+	merged.WriteString("\n  ")
+	merged.WriteString(Description(p, withRights))
+	merged.Write(packet[end:])
+	return merged.Bytes(), nil
+}
+
+// Envelope 从XMP数据包中读取水印信封
+func Envelope(packet []byte) (string, bool) {
+	description := descriptionPattern.Find(packet)
+	if description == nil {
+		return "", false
+	}
+	matches := envelopePattern.FindSubmatch(description)
+	if matches == nil {
+		return "", false
+	}
+	return string(matches[1]), true
+}
+
+// Remove 从XMP数据包中删除水印属性，返回删除后的数据包和是否找到了水印属性
+// 数据包中没有其他属性时返回nil，调用方应删除整个数据包
+func Remove(packet []byte) ([]byte, bool) {
+	if !descriptionPattern.Match(packet) {
+		return packet, false
+	}
+
+	rest := descriptionPattern.ReplaceAllLiteral(packet, nil)
+	if !bytes.Contains(rest, []byte("<rdf:Description")) {
+		return nil, true
+	}
+	return rest, true
+}
+
+// Descriptions 在任意数据中查找本工具写入的 rdf:Description 元素，返回每个元素的起止位置
+// 用于没有固定XMP位置的格式，如PDF中未压缩的元数据流
+func Descriptions(data []byte) [][2]int {
+	var ranges [][2]int
+	for _, loc := range descriptionPattern.FindAllSubmatchIndex(data, -1) {
+		ranges = append(ranges, [2]int{loc[2], loc[3]})
+	}
+	return ranges
+}
+
+// escape 转义XML文本
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// photoshopPacket 图片编辑软件写入的XMP数据包，已经包含版权信息
+const photoshopPacket = `<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:rights><rdf:Alt><rdf:li xml:lang="x-default">© Studio</rdf:li></rdf:Alt></dc:rights>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestNewPacket(t *testing.T) {
+	packet := NewPacket(Properties{Envelope: "V01LRQ==", Rights: "机密 <A&B>", Owner: "法务部"})
+
+	// 数据包应是格式正确的XML，文本已转义
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("XMP数据包不是有效的XML: %v", err)
+			}
+			break
+		}
+	}
+	for _, want := range []string{"机密 &lt;A&amp;B&gt;", "<rdf:li>法务部</rdf:li>", "<xmpRights:Marked>True</xmpRights:Marked>"} {
+		if !strings.Contains(string(packet), want) {
+			t.Errorf("XMP数据包中缺少 %s", want)
+		}
+	}
+
+	if envelope, ok := Envelope(packet); !ok || envelope != "V01LRQ==" {
+		t.Errorf("读取水印信封结果为 %q, %v", envelope, ok)
+	}
+	if rest, removed := Remove(packet); !removed || rest != nil {
+		t.Errorf("只有水印属性的数据包应整个删除，结果为 %q, %v", rest, removed)
+	}
+}
+
+func TestMergeExistingPacket(t *testing.T) {
+	original := []byte(photoshopPacket)
+
+	merged, err := Merge(original, Properties{Envelope: "V01LRQ==", Rights: "机密"})
+	if err != nil {
+		t.Fatalf("合并XMP数据包失败: %v", err)
+	}
+	// 已有版权信息时不重复写入
+	if strings.Count(string(merged), "<dc:rights>") != 1 {
+		t.Error("合并后的数据包中有重复的dc:rights")
+	}
+
+	// 再次合并时替换之前的水印属性
+	merged, err = Merge(merged, Properties{Envelope: "V01LRTI="})
+	if err != nil {
+		t.Fatalf("再次合并XMP数据包失败: %v", err)
+	}
+	if len(Descriptions(merged)) != 1 {
+		t.Errorf("合并后应只有一组水印属性，实际为%d组", len(Descriptions(merged)))
+	}
+	if envelope, _ := Envelope(merged); envelope != "V01LRTI=" {
+		t.Errorf("读取水印信封结果为 %q", envelope)
+	}
+
+	rest, removed := Remove(merged)
+	if !removed || !bytes.Equal(rest, original) {
+		t.Errorf("删除水印属性后与原数据包不一致:\n%s", rest)
+	}
+	if _, ok := Envelope(original); ok {
+		t.Error("没有水印属性的数据包不应读取到水印信封")
+	}
+}
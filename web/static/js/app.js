@@ -77,6 +77,7 @@ function setupEventListeners() {
     // 水印预览选项
     document.getElementById('previewSizeBtn').addEventListener('click', togglePreviewSize);
     document.getElementById('previewAngleBtn').addEventListener('click', togglePreviewAngle);
+    document.getElementById('visibleWatermark').addEventListener('change', toggleVisibleWatermark);
     
     // Hero按钮点击事件
     document.querySelectorAll('.hero-buttons a').forEach(btn => {
@@ -177,7 +178,7 @@ function loadSupportedTypes() {
         .catch(error => {
             console.error('获取支持的文件类型失败:', error);
             // 错误处理：显示默认格式
-            const defaultTypes = ['pdf', 'docx', 'xlsx', 'pptx', 'jpg', 'png'];
+            const defaultTypes = ['pdf', 'docx', 'xlsx', 'pptx', 'jpg', 'png', 'gif', 'tiff', 'bmp', 'svg'];
             updateFormatTags(defaultTypes);
             updateUploadAreaFormats(defaultTypes);
             updateFooterFormats(defaultTypes);
@@ -218,6 +219,10 @@ function updateFormatTags(types) {
                 icon.className += 'fa-file-image';
                 break;
             case 'png':
+            case 'gif':
+            case 'tiff':
+            case 'bmp':
+            case 'svg':
                 icon.className += 'fa-file-image';
                 break;
             case 'odt':
@@ -325,6 +330,10 @@ function updateFileName(input, containerId) {
                 fileIcon.className += 'fa-file-image';
                 break;
             case 'png':
+            case 'gif':
+            case 'tiff':
+            case 'bmp':
+            case 'svg':
                 fileIcon.className += 'fa-file-image';
                 break;
             default:
@@ -348,15 +357,30 @@ function resetFileInput(inputId, selectedContainerId, emptyContainerId) {
     document.getElementById(emptyContainerId).style.display = 'block';
 }
 
+// 可见水印的内置字体只支持ASCII可打印字符和少量符号，与服务端的 overlay.Supported 一致
+const VISIBLE_TEXT_PATTERN = /^[\x20-\x7E©®°·]*$/;
+
 /**
- * 更新水印预览
+ * 切换可见水印，启用时显示可见水印文本输入框
+ */
+function toggleVisibleWatermark() {
+    const enabled = document.getElementById('visibleWatermark').checked;
+    document.getElementById('visibleTextField').style.display = enabled ? 'block' : 'none';
+    updateWatermarkPreview();
+}
+
+/**
+ * 更新水印预览，启用可见水印时预览实际绘制的可见水印文本
  */
 function updateWatermarkPreview() {
     const watermarkText = document.getElementById('watermarkText').value;
     const preview = document.getElementById('watermarkPreview');
     
     // 更新预览文本
-    if (watermarkText.trim()) {
+    if (document.getElementById('visibleWatermark').checked) {
+        const visibleText = document.getElementById('visibleText').value;
+        preview.textContent = visibleText.trim() ? visibleText : '无可见水印预览';
+    } else if (watermarkText.trim()) {
         preview.textContent = watermarkText;
     } else {
         preview.textContent = '无隐水印预览';
@@ -391,6 +415,32 @@ function handleAddWatermark(event) {
     formData.append('file', fileInput.files[0]);
     formData.append('watermark', watermarkText);
     
+    // 可见水印使用预览的文本、字号和旋转角度
+    if (document.getElementById('visibleWatermark').checked) {
+        const visibleText = document.getElementById('visibleText').value;
+        if (!visibleText.trim()) {
+            showNotification('请输入可见水印文本', 'error');
+            return;
+        }
+        if (!VISIBLE_TEXT_PATTERN.test(visibleText)) {
+            showNotification('可见水印只支持英文字母、数字和常用符号', 'error');
+            return;
+        }
+        formData.append('visible_text', visibleText);
+        const previewSizes = { normal: 24, large: 32, xlarge: 40 };
+        const sizeBtn = document.getElementById('previewSizeBtn');
+        const angleBtn = document.getElementById('previewAngleBtn');
+        formData.append('visible', 'true');
+        formData.append('font_size', previewSizes[sizeBtn.getAttribute('data-size')] || 24);
+        formData.append('angle', angleBtn.getAttribute('data-angle'));
+    }
+    
+    // 加密的PDF需要密码才能添加水印
+    const addPassword = document.getElementById('addPassword').value;
+    if (addPassword) {
+        formData.append('password', addPassword);
+    }
+    
     // 显示进度条
     const progressArea = document.getElementById('addProgress');
     progressArea.style.display = 'block';
@@ -499,6 +549,12 @@ function handleExtractWatermark(event) {
     const formData = new FormData();
     formData.append('file', fileInput.files[0]);
     
+    // 加密的PDF需要密码才能提取水印
+    const extractPassword = document.getElementById('extractPassword').value;
+    if (extractPassword) {
+        formData.append('password', extractPassword);
+    }
+    
     // 显示进度条
     const progressArea = document.getElementById('extractProgress');
     progressArea.style.display = 'block';